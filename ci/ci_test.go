@@ -5,6 +5,7 @@ package ci_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/madlambda/spells/assert"
 	"github.com/terramate-io/terramate/ci"
@@ -33,3 +34,38 @@ func TestDetectPlatformFromEnv(t *testing.T) {
 		})
 	}
 }
+
+func TestFolding(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0)
+
+	type testcase struct {
+		platform  ci.PlatformType
+		wantStart string
+		wantEnd   string
+	}
+
+	for _, tc := range []testcase{
+		{
+			platform:  ci.PlatformGithub,
+			wantStart: "::group::stack /a/b\n",
+			wantEnd:   "::endgroup::\n",
+		},
+		{
+			platform:  ci.PlatformGitlab,
+			wantStart: "\x1b[0Ksection_start:1700000000:_a_b[collapsed=true]\r\x1b[0Kstack /a/b\n",
+			wantEnd:   "\x1b[0Ksection_end:1700000000:_a_b\r\x1b[0K\n",
+		},
+		{
+			platform: ci.PlatformLocal,
+		},
+		{
+			platform: ci.PlatformGenericCI,
+		},
+	} {
+		assert.EqualStrings(t, tc.wantStart, tc.platform.FoldStart("/a/b", "stack /a/b", now), tc.platform.String())
+		assert.EqualStrings(t, tc.wantEnd, tc.platform.FoldEnd("/a/b", now), tc.platform.String())
+		assert.IsTrue(t, tc.platform.SupportsFolding() == (tc.wantStart != ""), tc.platform.String())
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package ci
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var gitlabSectionNameRegex = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// SupportsFolding tells if the platform supports collapsible sections in the
+// job logs.
+func (plat PlatformType) SupportsFolding() bool {
+	return plat == PlatformGithub || plat == PlatformGitlab
+}
+
+// FoldStart returns the line starting a collapsible section of the job logs
+// with the given name and title. The name must be unique in the job and is
+// only used by platforms that require it.
+// It returns an empty string if the platform doesn't support folding.
+func (plat PlatformType) FoldStart(name, title string, t time.Time) string {
+	switch plat {
+	case PlatformGithub:
+		return fmt.Sprintf("::group::%s\n", title)
+	case PlatformGitlab:
+		return fmt.Sprintf("\x1b[0Ksection_start:%d:%s[collapsed=true]\r\x1b[0K%s\n",
+			t.Unix(), gitlabSectionName(name), title)
+	default:
+		return ""
+	}
+}
+
+// FoldEnd returns the line ending the collapsible section started by FoldStart
+// with the same name.
+// It returns an empty string if the platform doesn't support folding.
+func (plat PlatformType) FoldEnd(name string, t time.Time) string {
+	switch plat {
+	case PlatformGithub:
+		return "::endgroup::\n"
+	case PlatformGitlab:
+		return fmt.Sprintf("\x1b[0Ksection_end:%d:%s\r\x1b[0K\n", t.Unix(), gitlabSectionName(name))
+	default:
+		return ""
+	}
+}
+
+func gitlabSectionName(name string) string {
+	return gitlabSectionNameRegex.ReplaceAllString(name, "_")
+}
@@ -4,6 +4,7 @@
 package cli
 
 import (
+	"bytes"
 	"context"
 	errstd "errors"
 	stdfmt "fmt"
@@ -211,8 +212,9 @@ type cliSpec struct {
 		} `cmd:"" help:"Mark a stack as changed so it will be triggered in Change Detection."`
 
 		RunGraph struct {
-			Outfile string `short:"o" predictor:"file" default:"" help:"Output .dot file"`
+			Outfile string `short:"o" predictor:"file" default:"" help:"Output file"`
 			Label   string `short:"l" default:"stack.name" help:"Label used in graph nodes (it could be either \"stack.name\" or \"stack.dir\""`
+			Format  string `default:"dot" enum:"dot,json,mermaid" help:"Output format (dot, json or mermaid)"`
 		} `cmd:"" help:"Generate a graph of the execution order"`
 
 		Vendor struct {
@@ -302,6 +304,9 @@ type cloudFilterFlags struct {
 type changeDetectionFlags struct {
 	EnableChangeDetection  []string `help:"Enable specific change detection modes" enum:"git-untracked,git-uncommitted"`
 	DisableChangeDetection []string `help:"Disable specific change detection modes" enum:"git-untracked,git-uncommitted"`
+	IncludeDependents      bool     `help:"Also select the stacks ordered after the selected stacks, transitively."`
+	IncludeDependencies    bool     `help:"Also select the stacks ordered before the selected stacks, transitively."`
+	Shard                  string   `placeholder:"i/n" help:"Select only the stacks of shard i out of n. Stacks ordered before or after each other are always in the same shard."`
 }
 
 type cloudTargetFlags struct {
@@ -325,8 +330,29 @@ type cloudSyncFlags struct {
 type commonRunFlags struct {
 	NoRecursive     bool `env:"NO_RECURSIVE" default:"false" help:"Do not recurse into nested child stacks."`
 	ContinueOnError bool `env:"CONTINUE_ON_ERROR" default:"false" help:"Continue executing next stacks when a command returns an error."`
+	SkipDependents  bool `env:"SKIP_DEPENDENTS" default:"false" help:"Continue executing independent stacks when a command returns an error, but skip the stacks ordered after the failed one."`
 	DryRun          bool `env:"DRY_RUN" default:"false" help:"Plan the execution but do not execute it."`
 	Reverse         bool `env:"REVERSE" default:"false" help:"Reverse the order of execution."`
+	Resume          bool `env:"RESUME" default:"false" help:"Resume the previous run, executing only the stacks that did not succeed, with the same command and flags. Fails if the HEAD commit or the Terramate configuration files changed since the previous run."`
+	NoCache         bool `env:"NO_CACHE" default:"false" help:"Execute all stacks, ignoring the run cache enabled by terramate.config.run.cache."`
+	Summary         bool `env:"SUMMARY" default:"false" help:"Print the status of each stack that did not succeed at the end of the run. Always printed with --skip-dependents."`
+
+	Timeout time.Duration `env:"TIMEOUT" help:"Set the maximum execution time of the whole run (e.g. 30m). Running commands are interrupted and pending stacks are skipped."`
+
+	RetryMaxAttempts int           `env:"RETRY_MAX_ATTEMPTS" default:"1" help:"Set the maximum number of attempts of a failing command."`
+	RetryBackoff     time.Duration `env:"RETRY_BACKOFF" default:"5s" help:"Set the delay before the first retry of a failing command. The delay doubles on each subsequent retry, up to 5m."`
+	RetryExitCodes   []int         `env:"RETRY_EXIT_CODES" help:"Retry only commands failing with one of these exit codes. Requires --retry-max-attempts."`
+	RetryOutputRegex string        `env:"RETRY_OUTPUT_REGEX" help:"Retry only commands whose output matches this regular expression. The last 64KiB of the output are matched. Requires --retry-max-attempts."`
+
+	ReportJSON  string `env:"REPORT_JSON" predictor:"file" help:"Write a JSON report of the run to the given file."`
+	ReportJUnit string `name:"report-junit" env:"REPORT_JUNIT" predictor:"file" help:"Write a JUnit XML report of the run to the given file."`
+
+	LogDir string `env:"LOG_DIR" predictor:"file" help:"Write the stdout and stderr of the commands of each stack to files in the given directory."`
+
+	OutputMode string `env:"OUTPUT_MODE" enum:"plain,prefix,grouped" default:"plain" help:"Set the output mode of the commands: plain, prefix (prefix each line with the stack path) or grouped (write the output of each stack at once, folded in GitHub and GitLab CI logs)."`
+	NoProgress bool   `env:"NO_PROGRESS" default:"false" help:"Do not show the progress of parallel runs at the bottom of the terminal."`
+
+	Format string `env:"FORMAT" enum:"text,json" default:"text" help:"Set the format of the --dry-run output: text or json (the execution plan)."`
 
 	// Note: 0 is not the real default value here, this is just a workaround.
 	// Kong doesn't support having 0 as the default value in case the flag isn't set, but K in case it's set without a value.
@@ -352,7 +378,8 @@ type runCommandFlags struct {
 
 	Eval       bool     `env:"EVAL" default:"false" help:"Evaluate command arguments as HCL strings interpolating Globals, Functions and Metadata."`
 	Terragrunt bool     `env:"TERRAGRUNT" default:"false" help:"Use terragrunt when generating planfile for Terramate Cloud sync."`
-	Command    []string `arg:"" name:"cmd" predictor:"file" passthrough:"" help:"Command to execute"`
+	Matrix     []string `env:"MATRIX" sep:"none" placeholder:"name=value1,value2" help:"Run the command once for each combination of the values of the matrix variables. Can be given multiple times."`
+	Command    []string `arg:"" optional:"true" name:"cmd" predictor:"file" passthrough:"" help:"Command to execute"`
 }
 
 type runScriptFlags struct {
@@ -361,7 +388,8 @@ type runScriptFlags struct {
 	cloudTargetFlags
 	commonRunFlags
 
-	Cmds []string `arg:"" optional:"true" passthrough:"" help:"Script to execute."`
+	Param []string `env:"PARAM" sep:"none" placeholder:"name=value" help:"Set a parameter of the script. Can be given multiple times, also after the script name."`
+	Cmds  []string `arg:"" optional:"true" passthrough:"" help:"Script to execute."`
 }
 
 // Exec will execute terramate with the provided flags defined on args.
@@ -417,6 +445,12 @@ type cli struct {
 type changeDetection struct {
 	untracked   *bool
 	uncommitted *bool
+
+	includeDependents   bool
+	includeDependencies bool
+
+	// shard is the shard of the selected stacks, if --shard is given.
+	shard *stack.Shard
 }
 
 //go:embed cli_help.txt
@@ -725,11 +759,14 @@ func (c *cli) run() {
 			tel.BoolFlag("run-order", c.parsedArgs.List.RunOrder),
 		)
 		c.setupGit()
-		c.setupChangeDetection(c.parsedArgs.List.EnableChangeDetection, c.parsedArgs.List.DisableChangeDetection)
+		c.setupChangeDetection(c.parsedArgs.List.changeDetectionFlags)
 		c.printStacks()
 		c.sendAndWaitForAnalytics()
 	case "run":
-		fatal("no command specified")
+		if !c.parsedArgs.Run.Resume {
+			fatal("no command specified")
+		}
+		fallthrough
 	case "run <cmd>":
 		c.initAnalytics("run",
 			tel.BoolFlag("filter-changed", c.parsedArgs.Changed),
@@ -751,7 +788,7 @@ func (c *cli) run() {
 			tel.BoolFlag("output-mocks", c.parsedArgs.Run.MockOnFail),
 		)
 		c.setupGit()
-		c.setupChangeDetection(c.parsedArgs.Run.EnableChangeDetection, c.parsedArgs.Run.DisableChangeDetection)
+		c.setupChangeDetection(c.parsedArgs.Run.changeDetectionFlags)
 		c.setupSafeguards(c.parsedArgs.Run.runSafeguardsCliSpec)
 		c.runOnStacks()
 		c.sendAndWaitForAnalytics()
@@ -845,7 +882,10 @@ func (c *cli) run() {
 		c.sendAndWaitForAnalytics()
 	case "script run":
 		c.checkScriptEnabled()
-		fatal("no script specified")
+		if !c.parsedArgs.Script.Run.Resume {
+			fatal("no script specified")
+		}
+		fallthrough
 	case "script run <cmds>":
 		c.initAnalytics("script-run",
 			tel.BoolFlag("filter-changed", c.parsedArgs.Changed),
@@ -859,7 +899,7 @@ func (c *cli) run() {
 		)
 		c.checkScriptEnabled()
 		c.setupGit()
-		c.setupChangeDetection(c.parsedArgs.Script.Run.EnableChangeDetection, c.parsedArgs.Script.Run.DisableChangeDetection)
+		c.setupChangeDetection(c.parsedArgs.Script.Run.changeDetectionFlags)
 		c.setupSafeguards(c.parsedArgs.Script.Run.runSafeguardsCliSpec)
 		c.runScript()
 		c.sendAndWaitForAnalytics()
@@ -965,14 +1005,20 @@ func (c *cli) setupGit() {
 		return
 	}
 
+	if err := c.setupBaseRef(); err != nil {
+		fatalWithDetailf(err, "checking git default remote")
+	}
+}
+
+// setupBaseRef sets the git reference that change detection compares to.
+func (c *cli) setupBaseRef() error {
 	remoteCheckFailed := false
 
 	if err := c.prj.checkDefaultRemote(); err != nil {
 		if c.prj.git.remoteConfigured {
-			fatalWithDetailf(err, "checking git default remote")
-		} else {
-			remoteCheckFailed = true
+			return err
 		}
+		remoteCheckFailed = true
 	}
 
 	if c.parsedArgs.GitChangeBase != "" {
@@ -982,6 +1028,7 @@ func (c *cli) setupGit() {
 	} else {
 		c.prj.baseRef = c.prj.defaultBaseRef()
 	}
+	return nil
 }
 
 func (c *cli) vendorDownload() {
@@ -1414,9 +1461,22 @@ func (c *cli) checkChangeDetectionFlagConflicts(enable []string, disable []strin
 	}
 }
 
-func (c *cli) setupChangeDetection(enable []string, disable []string) {
+func (c *cli) setupChangeDetection(flags changeDetectionFlags) {
+	enable := flags.EnableChangeDetection
+	disable := flags.DisableChangeDetection
 	c.checkChangeDetectionFlagConflicts(enable, disable)
 
+	c.changeDetection.includeDependents = flags.IncludeDependents
+	c.changeDetection.includeDependencies = flags.IncludeDependencies
+
+	if flags.Shard != "" {
+		shard, err := stack.ParseShard(flags.Shard)
+		if err != nil {
+			fatalWithDetailf(err, "parsing --shard")
+		}
+		c.changeDetection.shard = &shard
+	}
+
 	on := true
 	off := false
 
@@ -1977,12 +2037,20 @@ func (c *cli) printStacks() {
 
 func (c *cli) printStacksList(allStacks []stack.Entry, why bool, runOrder bool) {
 	filteredStacks := c.filterStacks(allStacks)
+	if shard := c.changeDetection.shard; shard != nil {
+		var err error
+		filteredStacks, err = stack.SelectShard(c.cfg(), filteredStacks,
+			func(e stack.Entry) *config.Stack { return e.Stack }, *shard)
+		if err != nil {
+			fatalWithDetailf(err, "selecting shard %s", shard)
+		}
+	}
 
 	reasons := map[string]string{}
 	stacks := make(config.List[*config.SortableStack], len(filteredStacks))
 	for i, entry := range filteredStacks {
 		stacks[i] = entry.Stack.Sortable()
-		reasons[entry.Stack.ID] = entry.Reason
+		reasons[entry.Stack.Dir.String()] = entry.Reason
 	}
 
 	if runOrder {
@@ -2005,7 +2073,7 @@ func (c *cli) printStacksList(allStacks []stack.Entry, why bool, runOrder bool)
 		}
 
 		if why {
-			printer.Stdout.Println(stdfmt.Sprintf("%s - %s", friendlyDir, reasons[s.ID]))
+			printer.Stdout.Println(stdfmt.Sprintf("%s - %s", friendlyDir, reasons[dir]))
 		} else {
 			printer.Stdout.Println(friendlyDir)
 		}
@@ -2073,39 +2141,108 @@ func (c *cli) generateGraph() {
 		Str("workingDir", c.wd()).
 		Logger()
 
+	var getNodeLabel func(n runGraphNode) string
+
 	switch c.parsedArgs.Experimental.RunGraph.Label {
 	case "stack.name":
 		logger.Debug().Msg("Set label to stack name.")
 
 		getLabel = func(s *config.Stack) string { return s.Name }
+		getNodeLabel = func(n runGraphNode) string { return n.Name }
 	case "stack.dir":
 		logger.Debug().Msg("Set label stack directory.")
 
 		getLabel = func(s *config.Stack) string { return s.Dir.String() }
+		getNodeLabel = func(n runGraphNode) string { return n.Path }
 	default:
 		fatal(`-label expects the values "stack.name" or "stack.dir"`)
 	}
 
-	entries, err := stack.List(c.cfg(), c.cfg().Tree())
+	logger.Debug().Msg("Create new graph.")
+
+	graph, runGraph := c.selectRunGraph()
+
+	var buf bytes.Buffer
+	var err error
+	switch c.parsedArgs.Experimental.RunGraph.Format {
+	case runGraphFormatDot:
+		_, err = buf.WriteString(generateDotGraph(graph, runGraph, getLabel, getNodeLabel))
+	case runGraphFormatJSON:
+		err = runGraph.writeJSON(&buf)
+	default:
+		err = runGraph.writeMermaid(&buf, getNodeLabel)
+	}
+	if err != nil {
+		fatalWithDetailf(err, "generating graph")
+	}
+	output := buf.String()
+
+	logger.Debug().
+		Msg("Set output of graph.")
+	outFile := c.parsedArgs.Experimental.RunGraph.Outfile
+	var out io.Writer
+	if outFile == "" {
+
+		out = c.stdout
+	} else {
+
+		f, err := os.Create(outFile)
+		if err != nil {
+			fatalWithDetailf(err, "opening file %s", outFile)
+		}
+
+		defer func() {
+			if err := f.Close(); err != nil {
+				fatalWithDetailf(err, "closing output graph file")
+			}
+		}()
+
+		out = f
+	}
+
+	logger.Debug().
+		Msg("Write graph to output.")
+	_, err = out.Write([]byte(output))
+	if err != nil {
+		fatalWithDetailf(err, "writing output %s", outFile)
+	}
+}
+
+// selectRunGraph returns the DAG of the stacks selected the same way as in
+// `terramate run` and its annotated run graph.
+func (c *cli) selectRunGraph() (*dag.DAG[*config.Stack], *runGraph) {
+	report, err := c.listStacks(c.parsedArgs.Changed, cloudstack.AnyTarget, cloud.NoStatusFilters(), false)
 	if err != nil {
 		fatalWithDetailf(err, "listing stacks to build graph")
 	}
 
-	logger.Debug().Msg("Create new graph.")
+	selectedEntries := c.filterStacks(report.Stacks)
+	selected := make(config.List[*config.SortableStack], len(selectedEntries))
+	isSelected := map[string]bool{}
+	for i, e := range selectedEntries {
+		selected[i] = e.Stack.Sortable()
+		isSelected[e.Stack.Dir.String()] = true
+	}
+
+	stacks, err := c.stackManager().AddWantedOf(selected)
+	if err != nil {
+		fatalWithDetailf(err, "adding wanted stacks")
+	}
 
-	dotGraph := dot.NewGraph(dot.Directed)
 	graph := dag.New[*config.Stack]()
 
 	visited := dag.Visited{}
-	for _, e := range c.filterStacksByWorkingDir(entries) {
-		if _, ok := visited[dag.ID(e.Stack.Dir.String())]; ok {
+	isStack := map[string]bool{}
+	for _, s := range stacks {
+		isStack[s.Dir().String()] = true
+		if _, ok := visited[dag.ID(s.Dir().String())]; ok {
 			continue
 		}
 
 		if err := run.BuildDAG(
 			graph,
 			c.cfg(),
-			e.Stack,
+			s.Stack,
 			"before",
 			func(s config.Stack) []string { return s.Before },
 			"after",
@@ -2116,6 +2253,33 @@ func (c *cli) generateGraph() {
 		}
 	}
 
+	// Remove the stacks only pulled in for ordering, unless the graph has
+	// cycles, which are shown instead.
+	if _, err := graph.Validate(); err == nil {
+		graph.Reduce(func(id dag.ID) bool { return !isStack[string(id)] })
+	}
+
+	changed := c.changedStacks(report)
+	runGraph, err := newRunGraph(graph,
+		func(s *config.Stack) bool { return changed[s.Dir.String()] },
+		func(s *config.Stack) bool { return !isSelected[s.Dir.String()] },
+	)
+	if err != nil {
+		fatalWithDetailf(err, "generating graph")
+	}
+	return graph, runGraph
+}
+
+// generateDotGraph returns the dot graph of the stacks DAG, with the nodes
+// annotated as in the run graph: the stack ID and tags are node attributes,
+// changed stacks are filled and wanted stacks have a dashed border.
+func generateDotGraph(
+	graph *dag.DAG[*config.Stack],
+	runGraph *runGraph,
+	getLabel func(s *config.Stack) string,
+	getNodeLabel func(n runGraphNode) string,
+) string {
+	dotGraph := dot.NewGraph(dot.Directed)
 	for _, id := range graph.IDs() {
 		val, err := graph.Node(id)
 		if err != nil {
@@ -2125,35 +2289,28 @@ func (c *cli) generateGraph() {
 		generateDot(dotGraph, graph, id, val, getLabel)
 	}
 
-	logger.Debug().
-		Msg("Set output of graph.")
-	outFile := c.parsedArgs.Experimental.RunGraph.Outfile
-	var out io.Writer
-	if outFile == "" {
-
-		out = c.stdout
-	} else {
-
-		f, err := os.Create(outFile)
-		if err != nil {
-			fatalWithDetailf(err, "opening file %s", outFile)
+	for _, n := range runGraph.Nodes {
+		node := dotGraph.Node(getNodeLabel(n))
+		if n.ID != "" {
+			node.Attr("id", n.ID)
+		}
+		if len(n.Tags) > 0 {
+			node.Attr("tags", strings.Join(n.Tags, ","))
+		}
+		var styles []string
+		if n.Changed {
+			styles = append(styles, "filled")
+			node.Attr("fillcolor", "#fff3b0")
+			node.Attr("color", "#e0a800")
+		}
+		if n.Wanted {
+			styles = append(styles, "dashed")
+		}
+		if len(styles) > 0 {
+			node.Attr("style", strings.Join(styles, ","))
 		}
-
-		defer func() {
-			if err := f.Close(); err != nil {
-				fatalWithDetailf(err, "closing output graph file")
-			}
-		}()
-
-		out = f
-	}
-
-	logger.Debug().
-		Msg("Write graph to output.")
-	_, err = out.Write([]byte(dotGraph.String()))
-	if err != nil {
-		fatalWithDetailf(err, "writing output %s", outFile)
 	}
+	return dotGraph.String()
 }
 
 func generateDot(
@@ -2375,8 +2532,9 @@ func (c *cli) partialEval() {
 	}
 }
 
-func (c *cli) evalRunArgs(st *config.Stack, cmd []string) ([]string, error) {
+func (c *cli) evalRunArgs(st *config.Stack, variant config.Variant, cmd []string) ([]string, error) {
 	ctx := c.setupEvalContext(st, map[string]string{})
+	config.SetMatrixNamespace(ctx, variant)
 	var newargs []string
 	for _, arg := range cmd {
 		exprStr := `"` + arg + `"`
@@ -2604,11 +2762,28 @@ func (c *cli) computeSelectedStacks(ensureCleanRepo bool, target string, stackFi
 	if err != nil {
 		return nil, errors.E(err, "adding wanted stacks")
 	}
+
+	if shard := c.changeDetection.shard; shard != nil {
+		stacks, err = stack.SelectShard(c.cfg(), stacks,
+			func(s *config.SortableStack) *config.Stack { return s.Stack }, *shard)
+		if err != nil {
+			return nil, errors.E(err, "selecting shard %s", shard)
+		}
+	}
 	return stacks, nil
 }
 
+// filterStacks filters the stacks by the working dir and the --tags, then
+// adds the stacks related to them requested by --include-dependents and
+// --include-dependencies, which are not filtered.
 func (c *cli) filterStacks(stacks []stack.Entry) []stack.Entry {
-	return c.filterStacksByTags(c.filterStacksByWorkingDir(stacks))
+	filtered := c.filterStacksByTags(c.filterStacksByWorkingDir(stacks))
+	filtered, err := c.stackManager().AddRelatedOf(filtered,
+		c.changeDetection.includeDependents, c.changeDetection.includeDependencies)
+	if err != nil {
+		fatalWithDetailf(err, "adding related stacks")
+	}
+	return filtered
 }
 
 func (c *cli) filterStacksByBasePath(basePath prj.Path, stacks []stack.Entry) []stack.Entry {
@@ -4,17 +4,18 @@
 package cli
 
 import (
-	"bytes"
 	"context"
 	stdjson "encoding/json"
 	"regexp"
 
 	stdfmt "fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
-	"strconv"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -22,8 +23,10 @@ import (
 	"github.com/terramate-io/terramate/cloud"
 	"github.com/terramate-io/terramate/cloud/preview"
 	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/config/filter"
 	"github.com/terramate-io/terramate/errors"
-	"github.com/terramate-io/terramate/hcl/ast"
+	"github.com/terramate-io/terramate/hcl"
+	"github.com/terramate-io/terramate/hcl/eval"
 	"github.com/terramate-io/terramate/printer"
 	prj "github.com/terramate-io/terramate/project"
 	runutil "github.com/terramate-io/terramate/run"
@@ -31,8 +34,6 @@ import (
 	"github.com/terramate-io/terramate/scheduler"
 	"github.com/terramate-io/terramate/scheduler/resource"
 	"github.com/terramate-io/terramate/stack"
-	"github.com/zclconf/go-cty/cty"
-	"github.com/zclconf/go-cty/cty/json"
 )
 
 const (
@@ -45,6 +46,9 @@ const (
 	// ErrRunCommandNotExecuted represents the error when the command was not executed for whatever reason.
 	ErrRunCommandNotExecuted errors.Kind = "command not found"
 
+	// ErrRunTimeout represents the error when the execution exceeded its timeout.
+	ErrRunTimeout errors.Kind = "execution timed out"
+
 	cloudSyncPreviewCICDWarning = "--sync-preview is only supported in GitHub Actions workflows, Gitlab CICD pipelines or Bitbucket Cloud Pipelines"
 )
 
@@ -53,6 +57,40 @@ type stackRun struct {
 	Stack         *config.Stack
 	Tasks         []stackRunTask
 	SyncTaskIndex int // index of the task with sync options
+
+	// Script is the script executed in the stack, if it has on_failure or
+	// finally jobs. They are evaluated after the other jobs, in the
+	// evaluation context of the matrix variant in ScriptCtxs.
+	Script     *hcl.Script
+	ScriptCtxs map[string]*eval.Context
+
+	// Root is runutil.RootBefore or runutil.RootAfter for the run of the
+	// root context jobs of scripts, executed once in the root of the project
+	// before or after the stacks. It's not part of the DAG of the stacks.
+	Root string
+}
+
+// Cmds returns the commands of the tasks of the stack run.
+func (r stackRun) Cmds() [][]string {
+	cmds := make([][]string, 0, len(r.Tasks))
+	for _, task := range r.Tasks {
+		if task.Skipped {
+			continue
+		}
+		cmds = append(cmds, task.Cmd)
+	}
+	return cmds
+}
+
+// cloudSynced returns whether any task of the stack run is synchronized to
+// Terramate Cloud.
+func (r stackRun) cloudSynced() bool {
+	for _, task := range r.Tasks {
+		if task.CloudSyncDeployment || task.CloudSyncDriftStatus || task.CloudSyncPreview {
+			return true
+		}
+	}
+	return false
 }
 
 // stackCloudRun is a stackRun, but with a single task, because the cloud API only supports
@@ -68,10 +106,38 @@ type stackCloudRun struct {
 type stackRunTask struct {
 	Cmd []string
 
+	// Matrix is the matrix variant of the command, nil if the command is not
+	// executed for a matrix.
+	Matrix config.Variant
+
 	ScriptIdx    int
 	ScriptJobIdx int
 	ScriptCmdIdx int
 
+	// ScriptJobName is the name of the script job of the command, if any.
+	ScriptJobName string
+
+	// ScriptJobDeps are the indexes of the jobs of the script that must finish
+	// before the job of the command starts.
+	ScriptJobDeps []int
+
+	// Skipped tells if the task is a script job skipped by its condition,
+	// which has no command.
+	Skipped bool
+
+	// ScriptJobKind is "on_failure" or "finally" for the commands of the
+	// jobs executed after the other jobs of the script, and "root" for the
+	// root context jobs executed once in the root of the project.
+	ScriptJobKind string
+
+	// Env are the environment variables set by the script job of the command,
+	// in the NAME=value format. They override the env of the stack.
+	Env []string
+
+	// UnsetEnv are the names of the environment variables removed by the
+	// script job of the command.
+	UnsetEnv []string
+
 	CloudTarget     string
 	CloudFromTarget string
 
@@ -86,6 +152,12 @@ type stackRunTask struct {
 	UseTerragrunt bool
 	EnableSharing bool
 	MockOnFail    bool
+
+	// Timeout is the maximum execution time of the command, zero means no timeout.
+	Timeout time.Duration
+
+	// Retry is the retry policy of the command, nil means no retries.
+	Retry *config.RetryPolicy
 }
 
 // runResult contains exit code and duration of a completed run.
@@ -119,15 +191,33 @@ func selectPlanFile(terraformPlan, tofuPlan string) (planfile, provisioner strin
 func (c *cli) runOnStacks() {
 	c.gitSafeguardDefaultBranchIsReachable()
 
+	var journal *runutil.Journal
+	if c.parsedArgs.Run.Resume {
+		if len(c.parsedArgs.Run.Command) > 0 {
+			fatal("--resume conflicts with a command: the command of the previous run is used")
+		}
+		var opts resumeOptions
+		journal, opts = c.loadResumeJournal(runutil.JournalKindRun)
+		c.resumeFlags(func() { opts.applyToRun(&c.parsedArgs.Run.runCommandFlags) })
+		c.parsedArgs.Run.Command = journal.Command
+	}
+
 	if len(c.parsedArgs.Run.Command) == 0 {
 		fatal("run expects a cmd")
 	}
 
+	checkRunFormat(c.parsedArgs.Run.commonRunFlags)
+
 	c.checkOutdatedGeneratedCode()
 	c.checkCloudSync()
 
 	var stacks config.List[*config.SortableStack]
-	if c.parsedArgs.Run.NoRecursive {
+	if c.parsedArgs.Run.Resume {
+		stacks = c.resumeStacks(journal)
+		if len(stacks) == 0 {
+			return
+		}
+	} else if c.parsedArgs.Run.NoRecursive {
 		st, found, err := config.TryLoadStack(c.cfg(), prj.PrjAbsPath(c.rootdir(), c.wd()))
 		if err != nil {
 			fatalWithDetailf(err, "loading stack in current directory")
@@ -208,34 +298,44 @@ func (c *cli) runOnStacks() {
 		c.disableCloudFeatures(errors.E(cloudSyncPreviewCICDWarning))
 	}
 
+	retryPolicy := retryPolicyFromFlags(c.parsedArgs.Run.commonRunFlags)
+	variants := matrixVariantsFromFlags(c.parsedArgs.Run.Matrix)
+	if len(c.parsedArgs.Run.Matrix) > 0 && cloudSyncEnabled {
+		fatal("--matrix cannot be used with --sync-deployment, --sync-drift-status or --sync-preview")
+	}
+
 	var runs []stackRun
 	var err error
 	for _, st := range stacks {
 		run := stackRun{
 			SyncTaskIndex: -1,
 			Stack:         st.Stack,
-			Tasks: []stackRunTask{
-				{
-					Cmd:                  c.parsedArgs.Run.Command,
-					CloudTarget:          c.parsedArgs.Run.Target,
-					CloudFromTarget:      c.parsedArgs.Run.FromTarget,
-					CloudSyncDeployment:  c.parsedArgs.Run.SyncDeployment,
-					CloudSyncDriftStatus: c.parsedArgs.Run.SyncDriftStatus,
-					CloudSyncPreview:     c.parsedArgs.Run.SyncPreview,
-					CloudPlanFile:        planFile,
-					CloudPlanProvisioner: planProvisioner,
-					CloudSyncLayer:       c.parsedArgs.Run.Layer,
-					UseTerragrunt:        c.parsedArgs.Run.Terragrunt,
-					EnableSharing:        c.parsedArgs.Run.EnableSharing,
-					MockOnFail:           c.parsedArgs.Run.MockOnFail,
-				},
-			},
-		}
-		if c.parsedArgs.Run.Eval {
-			run.Tasks[0].Cmd, err = c.evalRunArgs(run.Stack, run.Tasks[0].Cmd)
-			if err != nil {
-				fatalWithDetailf(err, "unable to evaluate command")
+		}
+		for _, variant := range variants {
+			task := stackRunTask{
+				Cmd:                  c.parsedArgs.Run.Command,
+				Matrix:               variant,
+				CloudTarget:          c.parsedArgs.Run.Target,
+				CloudFromTarget:      c.parsedArgs.Run.FromTarget,
+				CloudSyncDeployment:  c.parsedArgs.Run.SyncDeployment,
+				CloudSyncDriftStatus: c.parsedArgs.Run.SyncDriftStatus,
+				CloudSyncPreview:     c.parsedArgs.Run.SyncPreview,
+				CloudPlanFile:        planFile,
+				CloudPlanProvisioner: planProvisioner,
+				CloudSyncLayer:       c.parsedArgs.Run.Layer,
+				UseTerragrunt:        c.parsedArgs.Run.Terragrunt,
+				EnableSharing:        c.parsedArgs.Run.EnableSharing,
+				MockOnFail:           c.parsedArgs.Run.MockOnFail,
+				Timeout:              c.runConfig().StackTimeout,
+				Retry:                retryPolicy,
+			}
+			if c.parsedArgs.Run.Eval {
+				task.Cmd, err = c.evalRunArgs(run.Stack, variant, task.Cmd)
+				if err != nil {
+					fatalWithDetailf(err, "unable to evaluate command")
+				}
 			}
+			run.Tasks = append(run.Tasks, task)
 		}
 		runs = append(runs, run)
 	}
@@ -243,25 +343,42 @@ func (c *cli) runOnStacks() {
 	if c.parsedArgs.Run.SyncDeployment {
 		// This will just select all runs, since the CloudSyncDeployment was set just above.
 		// Still, it's convenient to re-use this function here.
-		deployRuns := selectCloudStackTasks(runs, isDeploymentTask)
+		deployRuns := c.maskCloudRuns(runs, selectCloudStackTasks(runs, isDeploymentTask))
 		c.createCloudDeployment(deployRuns)
 	}
 
 	if c.parsedArgs.Run.SyncPreview && c.cloudEnabled() {
 		// See comment above.
-		previewRuns := selectCloudStackTasks(runs, isPreviewTask)
+		previewRuns := c.maskCloudRuns(runs, selectCloudStackTasks(runs, isPreviewTask))
 		for metaID, previewID := range c.createCloudPreview(previewRuns, c.parsedArgs.Run.Target, c.parsedArgs.Run.FromTarget) {
 			c.cloud.run.setMeta2PreviewID(metaID, previewID)
 		}
 	}
 
+	if c.parsedArgs.Run.DryRun {
+		journal = nil
+	} else if journal == nil {
+		journal = c.newRunJournal(runutil.JournalKindRun, c.parsedArgs.Run.Command, runResumeOptions(c.parsedArgs.Run.runCommandFlags))
+	}
+
 	err = c.runAll(runs, runAllOptions{
 		Quiet:           c.parsedArgs.Quiet,
 		DryRun:          c.parsedArgs.Run.DryRun,
 		Reverse:         c.parsedArgs.Run.Reverse,
 		ScriptRun:       false,
 		ContinueOnError: c.parsedArgs.Run.ContinueOnError,
+		SkipDependents:  c.parsedArgs.Run.SkipDependents,
 		Parallel:        c.parsedArgs.Run.Parallel,
+		Timeout:         c.parsedArgs.Run.Timeout,
+		Journal:         journal,
+		ReportJSON:      c.parsedArgs.Run.ReportJSON,
+		ReportJUnit:     c.parsedArgs.Run.ReportJUnit,
+		OutputMode:      c.parsedArgs.Run.OutputMode,
+		NoCache:         c.parsedArgs.Run.NoCache,
+		Summary:         c.parsedArgs.Run.Summary,
+		NoProgress:      c.parsedArgs.Run.NoProgress,
+		LogDir:          c.parsedArgs.Run.LogDir,
+		Format:          c.parsedArgs.Run.Format,
 	})
 	if err != nil {
 		fatalWithDetailf(err, "one or more commands failed")
@@ -276,6 +393,49 @@ type runAllOptions struct {
 	ScriptRun       bool
 	ContinueOnError bool
 	Parallel        int
+
+	// SkipDependents continues the execution of the independent stacks when a
+	// stack fails, skipping the stacks ordered after the failed one.
+	SkipDependents bool
+
+	// Timeout is the maximum execution time of the whole run, zero means no timeout.
+	Timeout time.Duration
+
+	// Journal, if not nil, records the status of each stack of the run.
+	Journal *runutil.Journal
+
+	// ReportJSON and ReportJUnit, if not empty, are the files where the
+	// machine-readable reports of the run are written.
+	ReportJSON  string
+	ReportJUnit string
+
+	// OutputMode is the output mode of the commands, see runOutputPlain,
+	// runOutputPrefix and runOutputGrouped.
+	OutputMode string
+
+	// NoCache disables the run cache, executing all stacks.
+	NoCache bool
+
+	// Summary prints the summary of the stacks that did not succeed at the
+	// end of the run, which is always printed with SkipDependents.
+	Summary bool
+
+	// NoProgress disables the progress view of parallel runs.
+	NoProgress bool
+
+	// LogDir, if not empty, is the directory where the output of the
+	// commands of each stack is written.
+	LogDir string
+
+	// Format is the format of the --dry-run output, either "text" or
+	// runFormatJSON.
+	Format string
+
+	// RootBefore and RootAfter are the tasks of the root context jobs of
+	// scripts, executed once in the root of the project before the stacks
+	// and after all of them succeed.
+	RootBefore []stackRunTask
+	RootAfter  []stackRunTask
 }
 
 // runAll will execute the list of RunStack definitions. A RunStack defines the
@@ -314,41 +474,156 @@ func (c *cli) runAll(
 	killCtx, kill := context.WithCancel(context.Background())
 	defer kill()
 
+	// This context is done when the whole run times out. Running processes are
+	// interrupted and pending runs are skipped.
+	timeoutCtx := context.Background()
+	if opts.Timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		timeoutCtx, cancelTimeout = context.WithTimeout(timeoutCtx, opts.Timeout)
+		defer cancelTimeout()
+	}
+	gracePeriod := c.runConfig().TimeoutGracePeriod
+	if gracePeriod == 0 {
+		gracePeriod = hcl.DefaultTimeoutGracePeriod
+	}
+
+	// The durations of previous runs are used to prioritize the stacks on the
+	// critical path of parallel runs, if enabled.
+	var durations *runutil.Durations
+	if c.runConfig().TrackDurations && opts.Parallel > 1 && !opts.DryRun {
+		var loadErr error
+		durations, loadErr = runutil.LoadDurations(c.rootdir())
+		if loadErr != nil {
+			printer.Stderr.WarnWithDetails("failed to load the durations of previous runs", loadErr)
+		}
+	}
+
+	// The run cache skips the stacks whose inputs didn't change since the last
+	// successful execution of the same commands.
+	var cache *runutil.Cache
+	if c.runConfig().Cache && !opts.NoCache && !opts.DryRun {
+		var loadErr error
+		cache, loadErr = runutil.LoadCache(c.rootdir())
+		if loadErr != nil {
+			printer.Stderr.WarnWithDetails("failed to load the run cache, executing all stacks", loadErr)
+		}
+	}
+
 	// Select a scheduling strategy for the DAG nodes.
 	var sched scheduler.S[stackRun]
-	acquireResource := func() {}
+	acquireResource := func(dag.ID) {}
 	releaseResource := func() {}
+	var stackGroups map[prj.Path]resource.Multi
 
 	if opts.Parallel > 1 {
-		sched = scheduler.NewParallel(d, opts.Reverse)
+		parallel := scheduler.NewParallel(d, opts.Reverse)
+		if durations != nil {
+			parallel.SetWeights(func(id dag.ID) float64 {
+				run, _ := d.Node(id)
+				return durations.Expected(run.Cmds(), string(id))
+			})
+		}
+		sched = parallel
 
-		rg := resource.NewBounded(opts.Parallel)
+		// Stacks on the critical path get the resource first.
+		rg := resource.NewPrioritized(opts.Parallel)
 		// Acquire can fail, but not with context.Background().
-		acquireResource = func() { _ = rg.Acquire(context.Background()) }
+		acquireResource = func(id dag.ID) { _ = rg.Acquire(context.Background(), parallel.Priority(id)) }
 		releaseResource = func() { rg.Release() }
+
+		stackGroups = c.concurrencyGroups(runs)
 	} else {
 		sched = scheduler.NewSequential(d, opts.Reverse)
 	}
 
 	// we load/check the env of all stacks beforehand then no stack is executed
 	// if the environment is not correct for all of them.
-	stackEnvs, err := c.loadAllStackEnvs(runs)
+	stackEnvs, variantEnvs, err := c.loadAllStackEnvs(runs)
 	if err != nil {
 		return err
 	}
 
+	stackHooks, err := c.loadAllStackHooks(runs)
+	if err != nil {
+		return err
+	}
+
+	stackMaskers, err := c.loadAllStackMaskers(runs, stackEnvs, variantEnvs)
+	if err != nil {
+		return err
+	}
+
+	var rootEnv runutil.EnvVars
+	var rootMasker *runutil.Masker
+	if len(opts.RootBefore)+len(opts.RootAfter) > 0 {
+		rootEnv, rootMasker, err = c.loadRootEnv()
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.DryRun && opts.Format == runFormatJSON {
+		plan, err := c.runPlan(d, opts, stackEnvs, variantEnvs, stackHooks, stackMaskers, rootEnv, rootMasker)
+		if err != nil {
+			return err
+		}
+		return plan.WriteJSON(c.stdout)
+	}
+
+	if opts.Journal != nil {
+		for _, id := range d.IDs() {
+			run, _ := d.Node(id)
+			var after []string
+			for _, ancestor := range d.AncestorsOf(id) {
+				after = append(after, string(ancestor))
+			}
+			opts.Journal.Track(run.Stack.Dir.String(), run.Stack.ID, after)
+		}
+		if len(opts.RootBefore) > 0 {
+			opts.Journal.TrackRoot(runutil.RootBefore)
+		}
+		if len(opts.RootAfter) > 0 {
+			opts.Journal.TrackRoot(runutil.RootAfter)
+		}
+		maskers := []*runutil.Masker{rootMasker}
+		for _, masker := range stackMaskers {
+			maskers = append(maskers, masker)
+		}
+		// The journal is only needed to resume the run, then the run doesn't
+		// fail if it can't be saved, e.g. in read-only projects.
+		err := opts.Journal.Redact(maskers...)
+		if err == nil {
+			err = opts.Journal.Save()
+		}
+		if err != nil {
+			printer.Stderr.WarnWithDetails("failed to save the run-state journal, the run cannot be resumed", err)
+			opts.Journal = nil
+		}
+	}
+
 	const signalsBufferSize = 10
 	signals := make(chan os.Signal, signalsBufferSize)
 	signal.Notify(signals, os.Interrupt)
 	defer signal.Reset(os.Interrupt)
 
-	continueOnError := opts.ContinueOnError
-
 	printPrefix := "terramate:"
 	if !opts.ScriptRun && opts.DryRun {
 		printPrefix = stdfmt.Sprintf("%s (dry-run)", printPrefix)
 	}
 
+	go func() {
+		select {
+		case <-killCtx.Done():
+		case <-timeoutCtx.Done():
+			if timeoutCtx.Err() == context.DeadlineExceeded {
+				log.Info().Msgf("run timed out after %s, interrupting execution of further stacks", opts.Timeout)
+				cancel()
+			}
+		}
+	}()
+
+	var interrupted atomic.Bool
+
 	go func() {
 		interruptions := 0
 
@@ -368,6 +643,7 @@ func (c *cli) runAll(
 					Msg("received interruption signal")
 
 				logger.Info().Msg("interrupting execution of further stacks")
+				interrupted.Store(true)
 				cancel()
 
 				if interruptions >= 3 {
@@ -379,338 +655,214 @@ func (c *cli) runAll(
 		}
 	}()
 
-	// map of stackName -> map of backendName -> outputs
-	type stackOutputs map[prj.Path]map[string]cty.Value
-
-	allOutputs := stackOutputs{}
-
-	err = sched.Run(func(run stackRun) error {
-		errs := errors.L()
-
-		failedTaskIndex := -1
-
-	tasksLoop:
-		for taskIndex, task := range run.Tasks {
-			acquireResource()
-
-			// For cloud sync, we always assume that there's a single task per stack.
-			cloudRun := stackCloudRun{Stack: run.Stack, Task: task}
-
-			select {
-			case <-cancelCtx.Done():
-				c.cloudSyncAfter(cloudRun, runResult{ExitCode: -1}, errors.E(ErrRunCanceled))
-				releaseResource()
-				continue tasksLoop
-			default:
-			}
-
-			if !opts.Quiet && !opts.ScriptRun {
-				printer.Stderr.Println(printPrefix + " Entering stack in " + run.Stack.String())
-			}
-
-			if !opts.Quiet && opts.ScriptRun {
-				printScriptCommand(c.stderr, run.Stack, task)
-			}
+	reportKind := runutil.JournalKindRun
+	if opts.ScriptRun {
+		reportKind = runutil.JournalKindScript
+	}
+	positions := dagPositions(d, opts.Reverse)
 
-			logger := log.With().
-				Stringer("stack", run.Stack).
-				Bool("enable_sharing", task.EnableSharing).
-				Bool("mock_on_fail", task.MockOnFail).
-				Logger()
-
-			cfg, _ := c.cfg().Lookup(run.Stack.Dir)
-			environ := newEnvironFrom(stackEnvs[run.Stack.Dir])
-			if task.EnableSharing {
-				for _, in := range cfg.Node.Inputs {
-					evalctx := c.setupEvalContext(run.Stack, map[string]string{})
-					input, err := config.EvalInput(evalctx, in)
-					if err != nil {
-						errs.Append(errors.E(err, "failed to evaluate input block"))
-						c.cloudSyncAfter(cloudRun, runResult{ExitCode: -1}, errors.E(ErrRunCommandNotExecuted, err))
-						releaseResource()
-						failedTaskIndex = taskIndex
-						if !continueOnError {
-							cancel()
-						}
-						break tasksLoop
-					}
-					otherStack, found, err := c.stackManager().StackByID(input.FromStackID)
-					if err != nil {
-						errs.Append(errors.E(err, "populating stack inputs from stack.id %s", input.FromStackID))
-						c.cloudSyncAfter(cloudRun, runResult{ExitCode: -1}, errors.E(ErrRunCommandNotExecuted, err))
-						releaseResource()
-						failedTaskIndex = taskIndex
-						if !continueOnError {
-							cancel()
-						}
-						break tasksLoop
-					}
-					if !found {
-						err := errors.E(
-							"Stack %s needs output from stack ID %q but it cannot be found",
-							run.Stack.Dir,
-							input.FromStackID)
-
-						errs.Append(err)
-
-						c.cloudSyncAfter(cloudRun, runResult{ExitCode: -1}, errors.E(ErrRunCommandNotExecuted, err))
-						releaseResource()
-						failedTaskIndex = taskIndex
-						if !continueOnError {
-							cancel()
-						}
-						break tasksLoop
-					}
-
-					logger.Debug().Msgf("Stack depends on outputs from stack %s", otherStack.Dir)
-
-					backend, ok := cfg.SharingBackend(input.Backend)
-					if !ok {
-						err := errors.E("backend %s not found", input.Backend)
-						errs.Append(err)
-						c.cloudSyncAfter(cloudRun, runResult{ExitCode: -1}, errors.E(ErrRunCommandNotExecuted, err))
-						releaseResource()
-						failedTaskIndex = taskIndex
-						if !continueOnError {
-							cancel()
-						}
-						break tasksLoop
-					}
-					_, ok = allOutputs[otherStack.Dir]
-					if !ok {
-						allOutputs[otherStack.Dir] = make(map[string]cty.Value)
-					}
-					_, ok = allOutputs[otherStack.Dir][backend.Name]
-					if !ok {
-						var stdout bytes.Buffer
-						var stderr bytes.Buffer
-						cmd := exec.Command(backend.Command[0], backend.Command[1:]...)
-						cmd.Stdout = &stdout
-						cmd.Stderr = &stderr
-						cmd.Dir = otherStack.HostDir(c.cfg())
-						var inputVal cty.Value
-						err := cmd.Run()
-						if err != nil {
-							if !task.MockOnFail {
-								errs.Append(errors.E(err, "failed to execute: (cmd: %s) (stdout: %s) (stderr: %s)", cmd.String(), stdout.String(), stderr.String()))
-								c.cloudSyncAfter(cloudRun, runResult{ExitCode: -1}, errors.E(ErrRunCommandNotExecuted, err))
-								releaseResource()
-								failedTaskIndex = taskIndex
-								if !continueOnError {
-									cancel()
-								}
-								break tasksLoop
-							}
-
-							printer.Stderr.WarnWithDetails(
-								"failed to execute `sharing_backend` command",
-								errors.E(err, "(cmd: %s) (stdout: %s) (stderr: %s)", cmd.String(), stdout.String(), stderr.String()),
-							)
-						} else {
-							stdoutBytes := stdout.Bytes()
-							typ, err := json.ImpliedType(stdoutBytes)
-							if err != nil {
-								err := errors.E(err, "unmashaling sharing_backend output")
-								errs.Append(err)
-								c.cloudSyncAfter(cloudRun, runResult{ExitCode: -1}, errors.E(ErrRunCommandNotExecuted, err))
-								releaseResource()
-								failedTaskIndex = taskIndex
-								if !continueOnError {
-									cancel()
-								}
-								break tasksLoop
-							}
-							inputVal, err = json.Unmarshal(stdoutBytes, typ)
-							if err != nil {
-								err := errors.E(err, "unmashaling sharing_backend output")
-								errs.Append(err)
-								c.cloudSyncAfter(cloudRun, runResult{ExitCode: -1}, errors.E(ErrRunCommandNotExecuted, err))
-								releaseResource()
-								failedTaskIndex = taskIndex
-								if !continueOnError {
-									cancel()
-								}
-								break tasksLoop
-							}
-						}
-						allOutputs[otherStack.Dir][backend.Name] = inputVal
-					}
-					stackOutputs := allOutputs[otherStack.Dir][backend.Name]
-					evalctx.SetNamespaceRaw("outputs", stackOutputs)
-					inputVal, inputErr := input.Value(evalctx)
-					mockVal, mockFound, mockErr := input.Mock(evalctx)
-
-					if inputErr != nil {
-						if !task.MockOnFail || !mockFound || mockErr != nil {
-							err := errors.E(inputErr, "evaluating input value")
-							errs.Append(err)
-							if mockErr != nil {
-								errs.Append(errors.E(mockErr, "failed to evaluate input mock"))
-							}
-							c.cloudSyncAfter(cloudRun, runResult{ExitCode: -1}, errors.E(ErrRunCommandNotExecuted, err))
-							releaseResource()
-							failedTaskIndex = taskIndex
-							if !continueOnError {
-								cancel()
-							}
-							break tasksLoop
-						}
-
-						inputVal = mockVal
-					}
-					environ = append(environ, stdfmt.Sprintf("TF_VAR_%s=%s", input.Name, string(ast.TokensForValue(inputVal).Bytes())))
-				}
-			}
+	// The progress view gives an overview of parallel runs in the terminal.
+	var progress *runProgress
+	if opts.Parallel > 1 && !opts.Quiet && !opts.DryRun && !opts.NoProgress {
+		progress = c.newRunProgress(len(d.IDs()))
+	}
 
-			cloudRun.Env = environ
+	runner := &stackRunner{
+		c:               c,
+		opts:            opts,
+		cancelCtx:       cancelCtx,
+		cancel:          cancel,
+		killCtx:         killCtx,
+		timeoutCtx:      timeoutCtx,
+		interrupted:     &interrupted,
+		gracePeriod:     gracePeriod,
+		printPrefix:     printPrefix,
+		continueOnError: opts.ContinueOnError || opts.SkipDependents,
+		acquireResource: acquireResource,
+		releaseResource: releaseResource,
+		stackGroups:     stackGroups,
+		stackEnvs:       stackEnvs,
+		variantEnvs:     variantEnvs,
+		stackHooks:      stackHooks,
+		stackMaskers:    stackMaskers,
+		rootEnv:         rootEnv,
+		rootMasker:      rootMasker,
+		durations:       durations,
+		cache:           cache,
+		allOutputs:      stackOutputs{},
+		failures:        &upstreamFailures{chains: map[string][]string{}},
+		summary:         newRunSummary(reportKind),
+		positions:       positions,
+		rootPositions: map[string]*dagPosition{
+			runutil.RootBefore: {order: 0},
+			runutil.RootAfter:  {order: len(positions) + 1},
+		},
+		progress: progress,
+		outputs:  c.newRunOutput(opts.OutputMode, progress),
+	}
 
-			cmdStr := strings.Join(task.Cmd, " ")
-			logger = logger.With().
-				Str("cmd", cmdStr).
-				Logger()
+	// The root context jobs executed after the stacks only run if all of
+	// them succeed.
+	runRoot := func(when string, tasks []stackRunTask) error {
+		if len(tasks) == 0 {
+			return nil
+		}
+		return runner.runStack(stackRun{
+			Stack:         &config.Stack{Dir: prj.NewPath("/")},
+			Tasks:         tasks,
+			SyncTaskIndex: -1,
+			Root:          when,
+		})
+	}
+	err = runRoot(runutil.RootBefore, opts.RootBefore)
+	if err == nil {
+		err = sched.Run(runner.runStack)
+	}
+	if err == nil && cancelCtx.Err() == nil {
+		err = runRoot(runutil.RootAfter, opts.RootAfter)
+	}
 
-			cmdPath, err := runutil.LookPath(task.Cmd[0], environ)
-			if err != nil {
-				c.cloudSyncAfter(cloudRun, runResult{ExitCode: -1}, errors.E(ErrRunCommandNotExecuted, err))
-				errs.Append(errors.E(err, "running `%s` in stack %s", cmdStr, run.Stack.Dir))
-				releaseResource()
-				failedTaskIndex = taskIndex
-				if !continueOnError {
-					cancel()
-				}
-				break tasksLoop
-			}
+	progress.stop()
 
-			cmd := exec.Command(cmdPath, task.Cmd[1:]...)
-			cmd.Dir = run.Stack.HostDir(c.cfg())
-			cmd.Env = environ
+	if !opts.Quiet && !opts.DryRun && (opts.Summary || opts.SkipDependents) {
+		runner.summary.print()
+	}
 
-			stdout := c.stdout
-			stderr := c.stderr
+	if durations != nil {
+		if err := durations.Save(); err != nil {
+			printer.Stderr.WarnWithDetails("failed to save the durations of the stacks", err)
+		}
+	}
 
-			logSyncWait := func() {}
-			if c.cloudEnabled() && (task.CloudSyncDeployment || task.CloudSyncPreview) {
-				logSyncer := cloud.NewLogSyncer(func(logs cloud.CommandLogs) {
-					c.syncLogs(&logger, run, logs)
-				})
-				stdout = logSyncer.NewBuffer(cloud.StdoutLogChannel, c.stdout)
-				stderr = logSyncer.NewBuffer(cloud.StderrLogChannel, c.stderr)
+	if cache != nil {
+		if err := cache.Save(); err != nil {
+			printer.Stderr.WarnWithDetails("failed to save the run cache", err)
+		}
+	}
 
-				logSyncWait = logSyncer.Wait
+	if !opts.DryRun {
+		if reportErr := runner.summary.save(opts.ReportJSON, opts.ReportJUnit); reportErr != nil {
+			printer.Stderr.ErrorWithDetails("failed to write the run report", reportErr)
+			if err == nil {
+				err = reportErr
 			}
+		}
+	}
 
-			cmd.Stdin = c.stdin
-			cmd.Stdout = stdout
-			cmd.Stderr = stderr
-
-			c.cloudSyncBefore(cloudRun)
-
-			if !opts.Quiet && !opts.ScriptRun {
-				printer.Stderr.Println(printPrefix + " Executing command " + strconv.Quote(cmdStr))
-			}
+	return err
+}
 
-			if opts.DryRun {
-				releaseResource()
-				continue tasksLoop
+// concurrencyGroups returns the resources of the concurrency groups of each
+// stack, for the stacks belonging to any group.
+// Groups not defined in terramate.config.run.concurrency_groups have a limit
+// of one stack at a time.
+func (c *cli) concurrencyGroups(runs []stackRun) map[prj.Path]resource.Multi {
+	groupsCfg := c.runConfig().ConcurrencyGroups
+	resources := map[string]*resource.Bounded{}
+	getResource := func(name string) *resource.Bounded {
+		if r, ok := resources[name]; ok {
+			return r
+		}
+		limit := 1
+		for _, group := range groupsCfg {
+			if group.Name == name {
+				limit = group.Limit
 			}
+		}
+		r := resource.NewBounded(limit)
+		resources[name] = r
+		return r
+	}
 
-			startTime := time.Now().UTC()
-
-			if err := cmd.Start(); err != nil {
-				endTime := time.Now().UTC()
-
-				logSyncWait()
-
-				res := runResult{
-					ExitCode:   -1,
-					StartedAt:  &startTime,
-					FinishedAt: &endTime,
-				}
-				c.cloudSyncAfter(cloudRun, res, errors.E(err, ErrRunFailed))
-				errs.Append(errors.E(err, "running %s (at stack %s)", cmd, run.Stack.Dir))
-
-				releaseResource()
-				failedTaskIndex = taskIndex
-				if !continueOnError {
-					cancel()
-				}
-				break tasksLoop
+	stackGroups := map[prj.Path]resource.Multi{}
+	for _, run := range runs {
+		var names []string
+		if run.Stack.ConcurrencyGroup != "" {
+			names = append(names, run.Stack.ConcurrencyGroup)
+		}
+		for _, group := range groupsCfg {
+			if !group.Tags.IsEmpty() && filter.MatchTags(group.Tags, run.Stack.Tags) &&
+				group.Name != run.Stack.ConcurrencyGroup {
+				names = append(names, group.Name)
 			}
+		}
+		if len(names) == 0 {
+			continue
+		}
 
-			resultc := makeResultChannel(cmd)
-
-			select {
-			case <-killCtx.Done():
-				if err := cmd.Process.Kill(); err != nil {
-					logger.Debug().Err(err).Msg("unable to send kill signal to child process")
-				}
-
-				endTime := time.Now().UTC()
-
-				logSyncWait()
+		// All stacks acquire their groups in the same order.
+		sort.Strings(names)
 
-				res := runResult{
-					ExitCode:   -1,
-					StartedAt:  &startTime,
-					FinishedAt: &endTime,
-				}
-				c.cloudSyncAfter(cloudRun, res, errors.E(ErrRunCanceled))
-				errs.Append(errors.E(ErrRunCanceled, "execution aborted by CTRL-C (3x)"))
-				releaseResource()
-				failedTaskIndex = taskIndex
-				if !continueOnError {
-					cancel()
-				}
-				break tasksLoop
-
-			case result := <-resultc:
-				logSyncWait()
+		var groups resource.Multi
+		for _, name := range names {
+			groups = append(groups, getResource(name))
+		}
+		stackGroups[run.Stack.Dir] = groups
+	}
+	return stackGroups
+}
 
-				var err error
-				if !task.isSuccessExit(result.cmd.ProcessState.ExitCode()) {
-					err = errors.E(result.err, ErrRunFailed, "running %s (in %s)", result.cmd, run.Stack.Dir)
-					errs.Append(err)
-				}
+// stopCommand interrupts the running command and waits for it to exit.
+// If the command doesn't exit within the grace period, or the kill context is
+// done, it's killed.
+func stopCommand(
+	logger *zerolog.Logger,
+	cmd *exec.Cmd,
+	resultc <-chan cmdResult,
+	gracePeriod time.Duration,
+	killCtx context.Context,
+	stderr io.Writer,
+	printPrefix string,
+) cmdResult {
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		logger.Debug().Err(err).Msg("unable to send interrupt signal to child process")
+	}
 
-				res := runResult{
-					ExitCode:   result.cmd.ProcessState.ExitCode(),
-					StartedAt:  &startTime,
-					FinishedAt: result.finishedAt,
-				}
+	timer := time.NewTimer(gracePeriod)
+	defer timer.Stop()
 
-				logMsg := logger.Debug().Int("exit_code", res.ExitCode)
-				if res.StartedAt != nil && res.FinishedAt != nil {
-					logMsg = logMsg.
-						Time("started_at", *res.StartedAt).
-						Time("finished_at", *res.FinishedAt).
-						TimeDiff("duration", *res.FinishedAt, *res.StartedAt)
-				}
-				logMsg.Msg("command execution finished")
+	select {
+	case result := <-resultc:
+		return result
+	case <-timer.C:
+		stdfmt.Fprintf(stderr, "%s command did not exit within %s, killing it\n", printPrefix, gracePeriod)
+	case <-killCtx.Done():
+	}
 
-				c.cloudSyncAfter(cloudRun, res, err)
-				releaseResource()
-				if err != nil {
-					failedTaskIndex = taskIndex
-					if !continueOnError {
-						cancel()
-					}
-					break tasksLoop
-				}
-			}
-		}
+	if err := cmd.Process.Kill(); err != nil {
+		logger.Debug().Err(err).Msg("unable to send kill signal to child process")
+	}
+	return <-resultc
+}
 
-		if failedTaskIndex != -1 && run.SyncTaskIndex != -1 && failedTaskIndex < run.SyncTaskIndex {
-			cloudRun := stackCloudRun{
-				Stack: run.Stack,
-				Task:  run.Tasks[run.SyncTaskIndex],
-			}
-			c.cloudSyncAfter(cloudRun, runResult{ExitCode: 1}, errors.E(ErrRunFailed))
+// retryPolicyFromFlags returns the retry policy defined by the --retry-* flags,
+// or nil if commands must not be retried.
+func retryPolicyFromFlags(flags commonRunFlags) *config.RetryPolicy {
+	policy, err := config.NewRetryPolicy(
+		flags.RetryMaxAttempts,
+		flags.RetryBackoff,
+		flags.RetryExitCodes,
+		flags.RetryOutputRegex,
+	)
+	if err != nil {
+		fatalWithDetailf(err, "invalid --retry-* flags")
+	}
+	if policy.MaxAttempts == 1 {
+		if len(flags.RetryExitCodes) > 0 || flags.RetryOutputRegex != "" {
+			fatal("--retry-exit-codes and --retry-output-regex require --retry-max-attempts greater than 1")
 		}
+		return nil
+	}
+	return policy
+}
 
-		return errs.AsError()
-	})
-
-	return err
+// runConfig returns the terramate.config.run configuration of the project.
+func (c *cli) runConfig() *hcl.RunConfig {
+	cfg := c.cfg().Tree().Node.Terramate
+	if cfg == nil || cfg.Config == nil || cfg.Config.Run == nil {
+		return hcl.NewRunConfig()
+	}
+	return cfg.Config.Run
 }
 
 func (c *cli) syncLogs(logger *zerolog.Logger, run stackRun, logs cloud.CommandLogs) {
@@ -757,19 +909,194 @@ func newEnvironFrom(stackEnviron []string) []string {
 	return environ
 }
 
-func (c *cli) loadAllStackEnvs(runs []stackRun) (map[prj.Path]runutil.EnvVars, error) {
+// withTaskEnv returns the environ with the variables set and unset by the
+// script job of the task applied.
+func withTaskEnv(environ []string, task stackRunTask) []string {
+	if len(task.Env) == 0 && len(task.UnsetEnv) == 0 {
+		return environ
+	}
+	overridden := map[string]struct{}{}
+	for _, name := range task.UnsetEnv {
+		overridden[name] = struct{}{}
+	}
+	for _, v := range task.Env {
+		name, _, _ := strings.Cut(v, "=")
+		overridden[name] = struct{}{}
+	}
+	result := make([]string, 0, len(environ)+len(task.Env))
+	for _, v := range environ {
+		name, _, _ := strings.Cut(v, "=")
+		if _, ok := overridden[name]; !ok {
+			result = append(result, v)
+		}
+	}
+	return append(result, task.Env...)
+}
+
+// loadAllStackEnvs loads the env of all stacks. For stacks executed for a
+// matrix, the env of each variant is loaded too, by variant, and the env of
+// the stack is the env of its first variant.
+func (c *cli) loadAllStackEnvs(runs []stackRun) (
+	map[prj.Path]runutil.EnvVars,
+	map[prj.Path]map[string]runutil.EnvVars,
+	error,
+) {
 	errs := errors.L()
 	stackEnvs := map[prj.Path]runutil.EnvVars{}
+	variantEnvs := map[prj.Path]map[string]runutil.EnvVars{}
 	for _, run := range runs {
-		env, err := runutil.LoadEnv(c.cfg(), run.Stack)
-		errs.Append(err)
-		stackEnvs[run.Stack.Dir] = env
+		variants := run.variants()
+		if len(variants) == 0 {
+			env, err := runutil.LoadEnv(c.cfg(), run.Stack)
+			errs.Append(err)
+			stackEnvs[run.Stack.Dir] = env
+			continue
+		}
+
+		envs := map[string]runutil.EnvVars{}
+		for _, variant := range variants {
+			env, err := runutil.LoadVariantEnv(c.cfg(), run.Stack, variant)
+			if err != nil {
+				errs.Append(errors.E(err, "matrix variant %s", variant))
+				continue
+			}
+			envs[variant.String()] = env
+		}
+		stackEnvs[run.Stack.Dir] = envs[variants[0].String()]
+		variantEnvs[run.Stack.Dir] = envs
 	}
 
 	if errs.AsError() != nil {
-		return nil, errs.AsError()
+		return nil, nil, errs.AsError()
+	}
+	return stackEnvs, variantEnvs, nil
+}
+
+// taskEnv returns the env of the task, which is the env of its matrix variant
+// if it's executed for a matrix.
+func taskEnv(
+	run stackRun,
+	task stackRunTask,
+	stackEnvs map[prj.Path]runutil.EnvVars,
+	variantEnvs map[prj.Path]map[string]runutil.EnvVars,
+) runutil.EnvVars {
+	if task.Matrix == nil {
+		return stackEnvs[run.Stack.Dir]
+	}
+	return variantEnvs[run.Stack.Dir][task.Matrix.String()]
+}
+
+// stackCacheEnv returns the env of the stack used to compute the inputs hash
+// of the run cache, including the env of all its matrix variants and the env
+// set and unset by its script jobs.
+func stackCacheEnv(
+	run stackRun,
+	stackEnvs map[prj.Path]runutil.EnvVars,
+	variantEnvs map[prj.Path]map[string]runutil.EnvVars,
+) runutil.EnvVars {
+	var env runutil.EnvVars
+	variants := run.variants()
+	if len(variants) == 0 {
+		env = append(env, stackEnvs[run.Stack.Dir]...)
+	}
+	for _, variant := range variants {
+		env = append(env, variantEnvs[run.Stack.Dir][variant.String()]...)
+	}
+	for _, task := range run.Tasks {
+		if task.ScriptJobKind != "" {
+			continue
+		}
+		env = append(env, task.Env...)
+		// Unset variables have no "=" so they don't clash with set ones.
+		env = append(env, task.UnsetEnv...)
+	}
+	return env
+}
+
+// stackCached tells if the inputs of the stack didn't change since the last
+// successful execution of the same commands. Failures to hash the inputs are
+// treated as cache misses and reported to the given printer.
+func (c *cli) stackCached(cache *runutil.Cache, run stackRun, env runutil.EnvVars, p *printer.Printer) bool {
+	inputs, err := runutil.StackInputsHash(c.cfg(), run.Stack, env)
+	if err != nil {
+		p.WarnWithDetails(
+			stdfmt.Sprintf("failed to compute the inputs hash of stack %s", run.Stack.Dir), err)
+		return false
+	}
+	return cache.Hit(run.Stack.Dir.String(), run.cacheCmds(), inputs)
+}
+
+// storeStackCache records the inputs hash of a successful execution of the
+// stack in the run cache.
+func (c *cli) storeStackCache(cache *runutil.Cache, run stackRun, env runutil.EnvVars, p *printer.Printer) {
+	inputs, err := runutil.StackInputsHash(c.cfg(), run.Stack, env)
+	if err != nil {
+		p.WarnWithDetails(
+			stdfmt.Sprintf("failed to compute the inputs hash of stack %s", run.Stack.Dir), err)
+		return
+	}
+	cache.Store(run.Stack.Dir.String(), run.cacheCmds(), inputs)
+}
+
+// loadAllStackMaskers loads the maskers of the sensitive values of all stacks
+// beforehand. It returns an empty map if terramate.config.run.sensitive is not
+// defined. The maskers of stacks executed for a matrix redact the sensitive
+// values of all variants.
+func (c *cli) loadAllStackMaskers(
+	runs []stackRun,
+	stackEnvs map[prj.Path]runutil.EnvVars,
+	variantEnvs map[prj.Path]map[string]runutil.EnvVars,
+) (map[prj.Path]*runutil.Masker, error) {
+	sensitive := c.runConfig().Sensitive
+	if sensitive == nil {
+		return nil, nil
+	}
+
+	errs := errors.L()
+	maskers := map[prj.Path]*runutil.Masker{}
+	for _, run := range runs {
+		environs := [][]string{newEnvironFrom(stackEnvs[run.Stack.Dir])}
+		for _, env := range variantEnvs[run.Stack.Dir] {
+			environs = append(environs, newEnvironFrom(env))
+		}
+		masker, err := runutil.LoadMasker(c.cfg(), run.Stack, sensitive, environs...)
+		errs.Append(err)
+		maskers[run.Stack.Dir] = masker
+	}
+
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+	return maskers, nil
+}
+
+// maskCmds returns the commands with the sensitive values redacted.
+func maskCmds(masker *runutil.Masker, cmds [][]string) [][]string {
+	masked := make([][]string, len(cmds))
+	for i, cmd := range cmds {
+		masked[i] = masker.MaskArgs(cmd)
+	}
+	return masked
+}
+
+// maskCloudRuns redacts the sensitive values from the commands of the runs
+// synchronized to Terramate Cloud before the stacks are executed.
+func (c *cli) maskCloudRuns(runs []stackRun, cloudRuns []stackCloudRun) []stackCloudRun {
+	if c.runConfig().Sensitive == nil {
+		return cloudRuns
+	}
+	stackEnvs, variantEnvs, err := c.loadAllStackEnvs(runs)
+	if err != nil {
+		fatalWithDetailf(err, "loading stack run environment")
+	}
+	maskers, err := c.loadAllStackMaskers(runs, stackEnvs, variantEnvs)
+	if err != nil {
+		fatalWithDetailf(err, "loading the sensitive values")
+	}
+	for i := range cloudRuns {
+		cloudRuns[i].Task.Cmd = maskers[cloudRuns[i].Stack.Dir].MaskArgs(cloudRuns[i].Task.Cmd)
 	}
-	return stackEnvs, nil
+	return cloudRuns
 }
 
 func (c *cli) createCloudPreview(runs []stackCloudRun, target, fromTarget string) map[string]string {
@@ -0,0 +1,272 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	stdfmt "fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/terramate-io/terramate/errors"
+	prj "github.com/terramate-io/terramate/project"
+)
+
+// commandAttempts executes the command of a task, retrying it according to
+// the retry policy of the task.
+type commandAttempts struct {
+	task     stackRunTask
+	stackDir prj.Path
+
+	// desc describes the command in errors, with the sensitive values
+	// redacted.
+	desc   string
+	logger *zerolog.Logger
+
+	killCtx    context.Context
+	cancelCtx  context.Context
+	timeoutCtx context.Context
+
+	// runTimeout is the timeout of the whole run, given by timeoutCtx.
+	runTimeout  time.Duration
+	gracePeriod time.Duration
+	printPrefix string
+
+	// stderr gets the messages about the timeout of the command and
+	// retryOut the messages about the retries, which are not part of the
+	// output of the attempts.
+	stderr   io.Writer
+	retryOut io.Writer
+
+	// output is the end of the output of the current attempt, matched by
+	// the output regex of the retry policy.
+	output *attemptOutput
+
+	// started is called when each attempt starts.
+	started func()
+
+	// finished is called when each attempt finishes, with its exit code,
+	// or -1 if the command was not started or was killed.
+	finished func(attempt, exitCode int, finishedAt time.Time)
+
+	// retrying is called before the given attempt is started again.
+	retrying func(attempt int)
+
+	// releaseSlot and acquireSlot release the parallel slot of the command
+	// while it waits to be retried, then other stacks run in the meantime,
+	// and acquire it again after. The concurrency groups of the stack are
+	// held, since they serialize the whole execution of the stacks.
+	releaseSlot func()
+	acquireSlot func()
+}
+
+// attemptsResult is the outcome of the last attempt of a command.
+type attemptsResult struct {
+	// exited tells if the command was started and exited by itself or after
+	// timing out.
+	exited   bool
+	exitCode int
+
+	finishedAt time.Time
+
+	// err is set if the command failed, was killed or timed out.
+	err error
+
+	// killed tells if the command was killed because the run was
+	// interrupted.
+	killed bool
+
+	// timedOut is the timeout that stopped the command, if it timed out.
+	timedOut time.Duration
+}
+
+// run executes the command until it succeeds, its retry policy gives up, it
+// times out or the run is killed.
+// The timeout of the task limits all the attempts, including the waits
+// between them.
+func (a *commandAttempts) run(cmd *exec.Cmd) attemptsResult {
+	var stackTimeoutc <-chan time.Time
+	if a.task.Timeout > 0 {
+		timer := time.NewTimer(a.task.Timeout)
+		defer timer.Stop()
+		stackTimeoutc = timer.C
+	}
+
+	for attempt := 1; ; attempt++ {
+		a.started()
+
+		if err := cmd.Start(); err != nil {
+			res := attemptsResult{
+				exitCode:   -1,
+				finishedAt: time.Now().UTC(),
+				err:        errors.E(err, "running %s (at stack %s)", a.desc, a.stackDir),
+			}
+			a.finished(attempt, -1, res.finishedAt)
+			return res
+		}
+
+		resultc := makeResultChannel(cmd)
+
+		var timedOut time.Duration
+		select {
+		case <-a.killCtx.Done():
+			if err := cmd.Process.Kill(); err != nil {
+				a.logger.Debug().Err(err).Msg("unable to send kill signal to child process")
+			}
+			res := attemptsResult{
+				exitCode:   -1,
+				finishedAt: time.Now().UTC(),
+				err:        errors.E(ErrRunCanceled, "execution aborted by CTRL-C (3x)"),
+				killed:     true,
+			}
+			a.finished(attempt, -1, res.finishedAt)
+			return res
+
+		case <-a.timeoutCtx.Done():
+			timedOut = a.runTimeout
+		case <-stackTimeoutc:
+			timedOut = a.task.Timeout
+
+		case result := <-resultc:
+			exitCode := result.cmd.ProcessState.ExitCode()
+			a.finished(attempt, exitCode, *result.finishedAt)
+
+			if !a.task.isSuccessExit(exitCode) && a.task.Retry.ShouldRetry(attempt, exitCode, a.output.Bytes()) {
+				delay := a.task.Retry.Delay(attempt)
+				stdfmt.Fprintf(a.retryOut, "%s attempt %d/%d failed with exit code %d, retrying in %s\n",
+					a.printPrefix, attempt, a.task.Retry.MaxAttempts, exitCode, delay)
+
+				a.releaseSlot()
+				wait := waitRetry(a.cancelCtx, stackTimeoutc, delay)
+				a.acquireSlot()
+
+				switch wait {
+				case retryNow:
+					a.retrying(attempt + 1)
+					stdfmt.Fprintf(a.retryOut, "%s attempt %d/%d\n", a.printPrefix, attempt+1, a.task.Retry.MaxAttempts)
+					cmd = cloneCmd(cmd)
+					a.output.Reset()
+					continue
+
+				case retryTimedOut:
+					stdfmt.Fprintf(a.stderr, "%s command timed out after %s, not retrying it\n", a.printPrefix, a.task.Timeout)
+					return attemptsResult{
+						exited:     true,
+						exitCode:   exitCode,
+						finishedAt: *result.finishedAt,
+						err:        a.timeoutError(a.task.Timeout),
+						timedOut:   a.task.Timeout,
+					}
+				}
+			}
+
+			res := attemptsResult{
+				exited:     true,
+				exitCode:   exitCode,
+				finishedAt: *result.finishedAt,
+			}
+			if !a.task.isSuccessExit(exitCode) {
+				res.err = errors.E(result.err, ErrRunFailed, "running %s (in %s)", a.desc, a.stackDir)
+			}
+			return res
+		}
+
+		stdfmt.Fprintf(a.stderr, "%s command timed out after %s, interrupting it\n", a.printPrefix, timedOut)
+		result := stopCommand(a.logger, cmd, resultc, a.gracePeriod, a.killCtx, a.stderr, a.printPrefix)
+
+		exitCode := result.cmd.ProcessState.ExitCode()
+		a.finished(attempt, exitCode, *result.finishedAt)
+		return attemptsResult{
+			exited:     true,
+			exitCode:   exitCode,
+			finishedAt: *result.finishedAt,
+			err:        a.timeoutError(timedOut),
+			timedOut:   timedOut,
+		}
+	}
+}
+
+func (a *commandAttempts) timeoutError(timeout time.Duration) error {
+	return errors.E(ErrRunTimeout, "running %s (in %s): timed out after %s", a.desc, a.stackDir, timeout)
+}
+
+// maxAttemptOutput is the amount of output of each attempt kept to be matched
+// by the output regex of the retry policy.
+const maxAttemptOutput = 64 * 1024
+
+// attemptOutput keeps the last maxAttemptOutput bytes of the output of an
+// attempt of a command, written concurrently by its stdout and stderr.
+type attemptOutput struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (o *attemptOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.buf = append(o.buf, p...)
+	// The buffer is trimmed only after it doubles the limit, so the output
+	// is not moved on every write.
+	if len(o.buf) > 2*maxAttemptOutput {
+		o.buf = append(o.buf[:0], o.buf[len(o.buf)-maxAttemptOutput:]...)
+	}
+	return len(p), nil
+}
+
+// Bytes returns the last maxAttemptOutput bytes written so far.
+func (o *attemptOutput) Bytes() []byte {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return bytes.Clone(o.buf[max(len(o.buf)-maxAttemptOutput, 0):])
+}
+
+// Reset discards the output written so far.
+func (o *attemptOutput) Reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.buf = o.buf[:0]
+}
+
+// cloneCmd returns a new command with the same configuration of cmd, so it
+// can be executed again.
+func cloneCmd(cmd *exec.Cmd) *exec.Cmd {
+	clone := exec.Command(cmd.Path, cmd.Args[1:]...)
+	clone.Dir = cmd.Dir
+	clone.Env = cmd.Env
+	clone.Stdin = cmd.Stdin
+	clone.Stdout = cmd.Stdout
+	clone.Stderr = cmd.Stderr
+	return clone
+}
+
+// retryWait is the outcome of the wait before a retry.
+type retryWait int
+
+const (
+	retryNow retryWait = iota
+	retryCanceled
+	retryTimedOut
+)
+
+// waitRetry waits for the given delay before a retry. The command must not
+// be retried if the run is canceled or the timeout of the task, given by
+// timeoutc, is reached in the meantime.
+func waitRetry(cancelCtx context.Context, timeoutc <-chan time.Time, delay time.Duration) retryWait {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return retryNow
+	case <-cancelCtx.Done():
+		return retryCanceled
+	case <-timeoutc:
+		return retryTimedOut
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"encoding/json"
+	stdfmt "fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/printer"
+	"github.com/terramate-io/terramate/run/dag"
+	"github.com/terramate-io/terramate/stack"
+)
+
+// Formats supported by `terramate experimental run-graph`.
+const (
+	runGraphFormatDot     = "dot"
+	runGraphFormatJSON    = "json"
+	runGraphFormatMermaid = "mermaid"
+)
+
+type (
+	// runGraph is the machine-readable representation of the run graph.
+	runGraph struct {
+		Nodes []runGraphNode `json:"nodes"`
+		Edges []runGraphEdge `json:"edges"`
+	}
+
+	runGraphNode struct {
+		Path string   `json:"path"`
+		ID   string   `json:"id,omitempty"`
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+
+		// Changed tells if the stack changed, when change detection is
+		// available.
+		Changed bool `json:"changed"`
+
+		// Wanted tells if the stack was not selected by itself but pulled
+		// in by the wants or wanted_by attributes of another stack.
+		Wanted bool `json:"wanted"`
+	}
+
+	// runGraphEdge means From runs before To.
+	runGraphEdge struct {
+		From  string `json:"from"`
+		To    string `json:"to"`
+		Cycle bool   `json:"cycle,omitempty"`
+	}
+)
+
+// newRunGraph builds the run graph from the stacks DAG. The changed and wanted
+// functions annotate each stack.
+func newRunGraph(
+	d *dag.DAG[*config.Stack],
+	changed func(s *config.Stack) bool,
+	wanted func(s *config.Stack) bool,
+) (*runGraph, error) {
+	g := &runGraph{
+		Nodes: []runGraphNode{},
+		Edges: []runGraphEdge{},
+	}
+	for _, id := range d.IDs() {
+		s, err := d.Node(id)
+		if err != nil {
+			return nil, err
+		}
+		tags := s.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		g.Nodes = append(g.Nodes, runGraphNode{
+			Path:    s.Dir.String(),
+			ID:      s.ID,
+			Name:    s.Name,
+			Tags:    tags,
+			Changed: changed(s),
+			Wanted:  wanted(s),
+		})
+		for _, ancestor := range sortedAncestors(d, id) {
+			g.Edges = append(g.Edges, runGraphEdge{
+				From:  string(ancestor),
+				To:    string(id),
+				Cycle: d.HasCycle(ancestor),
+			})
+		}
+	}
+	return g, nil
+}
+
+// changedStacks returns the set of changed stacks. If the stacks in the report
+// were not listed with change detection, it's done here, when possible.
+func (c *cli) changedStacks(report *stack.Report) map[string]bool {
+	changed := map[string]bool{}
+	if !c.parsedArgs.Changed {
+		if !c.prj.isGitFeaturesEnabled() {
+			return changed
+		}
+		if err := c.setupBaseRef(); err != nil {
+			printer.Stderr.WarnWithDetails("failed to detect the changed stacks", err)
+			return changed
+		}
+		var err error
+		report, err = c.stackManager().ListChanged(stack.ChangeConfig{
+			BaseRef:            c.baseRef(),
+			UntrackedChanges:   c.changeDetection.untracked,
+			UncommittedChanges: c.changeDetection.uncommitted,
+		})
+		if err != nil {
+			printer.Stderr.WarnWithDetails("failed to detect the changed stacks", err)
+			return changed
+		}
+	}
+	for _, e := range report.Stacks {
+		changed[e.Stack.Dir.String()] = true
+	}
+	return changed
+}
+
+func (g *runGraph) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(g); err != nil {
+		return errors.E(err, "encoding run graph")
+	}
+	return nil
+}
+
+// writeMermaid writes the graph as a Mermaid flowchart. Changed stacks are
+// highlighted and wanted stacks have a dashed border.
+func (g *runGraph) writeMermaid(w io.Writer, getLabel func(n runGraphNode) string) error {
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+
+	ids := map[string]string{}
+	for i, n := range g.Nodes {
+		ids[n.Path] = stdfmt.Sprintf("n%d", i+1)
+		stdfmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[n.Path], mermaidEscape(getLabel(n)))
+	}
+	for _, e := range g.Edges {
+		arrow := "-->"
+		if e.Cycle {
+			arrow = "-. cycle .->"
+		}
+		stdfmt.Fprintf(&b, "  %s %s %s\n", ids[e.From], arrow, ids[e.To])
+	}
+
+	var changed, wanted []string
+	for _, n := range g.Nodes {
+		if n.Changed {
+			changed = append(changed, ids[n.Path])
+		}
+		if n.Wanted {
+			wanted = append(wanted, ids[n.Path])
+		}
+	}
+	if len(changed) > 0 {
+		b.WriteString("  classDef changed fill:#fff3b0,stroke:#e0a800\n")
+		stdfmt.Fprintf(&b, "  class %s changed\n", strings.Join(changed, ","))
+	}
+	if len(wanted) > 0 {
+		b.WriteString("  classDef wanted stroke-dasharray:5 5\n")
+		stdfmt.Fprintf(&b, "  class %s wanted\n", strings.Join(wanted, ","))
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return errors.E(err, "writing run graph")
+	}
+	return nil
+}
+
+// mermaidEscape replaces the characters that can't be used inside quoted
+// Mermaid labels by their entity codes.
+func mermaidEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
+
+func sortedAncestors[V any](d *dag.DAG[V], id dag.ID) []dag.ID {
+	ancestors := append([]dag.ID{}, d.AncestorsOf(id)...)
+	sort.Slice(ancestors, func(i, j int) bool { return ancestors[i] < ancestors[j] })
+	return ancestors
+}
@@ -0,0 +1,151 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"context"
+	stdfmt "fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	prj "github.com/terramate-io/terramate/project"
+	runutil "github.com/terramate-io/terramate/run"
+)
+
+// ErrRunHookFailed indicates that a run hook failed.
+const ErrRunHookFailed errors.Kind = "run hook failed"
+
+// loadAllStackHooks loads the run hooks of all stacks beforehand, then no
+// stack is executed if any of the hooks is invalid.
+func (c *cli) loadAllStackHooks(runs []stackRun) (map[prj.Path]runutil.Hooks, error) {
+	errs := errors.L()
+	stackHooks := map[prj.Path]runutil.Hooks{}
+	for _, run := range runs {
+		hooks, err := runutil.LoadHooks(c.cfg(), run.Stack)
+		if err != nil {
+			errs.Append(errors.E(err, "loading run hooks of stack %s", run.Stack.Dir))
+			continue
+		}
+		stackHooks[run.Stack.Dir] = hooks
+	}
+
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+	return stackHooks, nil
+}
+
+// runHook executes the commands of the given hook in the stack directory,
+// stopping at the first failed command. The commands are killed if the kill
+// context is done.
+// Each command is limited by terramate.config.run.stack_timeout, like the
+// commands of the stack, and is interrupted as them when it times out. The
+// timeout of the whole run doesn't apply to hooks, then on_failure hooks
+// still run for the stacks interrupted by it.
+func (c *cli) runHook(
+	killCtx context.Context,
+	name string,
+	cmds [][]string,
+	st *config.Stack,
+	environ []string,
+	out *stackOutput,
+	masker *runutil.Masker,
+	opts runAllOptions,
+	gracePeriod time.Duration,
+	printPrefix string,
+) (runutil.HookReport, error) {
+	report := runutil.HookReport{
+		Name:   name,
+		Cmds:   maskCmds(masker, cmds),
+		Status: runutil.StackOK,
+	}
+
+	fail := func(err error) (runutil.HookReport, error) {
+		report.Status = runutil.StackFailed
+		return report, errors.E(ErrRunHookFailed, err, "running %s hook (in %s)", name, st.Dir)
+	}
+
+	for _, args := range cmds {
+		cmdStr := strings.Join(masker.MaskArgs(args), " ")
+		if !opts.Quiet {
+			out.Printer.Println(printPrefix + " Executing " + name + " hook " + strconv.Quote(cmdStr))
+		}
+
+		if opts.DryRun {
+			continue
+		}
+
+		cmdPath, err := runutil.LookPath(args[0], environ)
+		if err != nil {
+			return fail(err)
+		}
+
+		cmd := exec.Command(cmdPath, args[1:]...)
+		cmd.Dir = st.HostDir(c.cfg())
+		cmd.Env = environ
+		cmd.Stdout = out.Stdout
+		cmd.Stderr = out.Stderr
+
+		flush := func() {}
+		if masker != nil {
+			stdout := masker.Writer(out.Stdout)
+			stderr := masker.Writer(out.Stderr)
+			cmd.Stdout, cmd.Stderr = stdout, stderr
+			flush = func() {
+				_ = stdout.Flush()
+				_ = stderr.Flush()
+			}
+		}
+
+		if err := cmd.Start(); err != nil {
+			return fail(err)
+		}
+
+		resultc := makeResultChannel(cmd)
+
+		var timeoutc <-chan time.Time
+		stopTimer := func() {}
+		if timeout := c.runConfig().StackTimeout; timeout > 0 {
+			timer := time.NewTimer(timeout)
+			timeoutc = timer.C
+			stopTimer = func() { timer.Stop() }
+		}
+
+		select {
+		case <-killCtx.Done():
+			stopTimer()
+			if err := cmd.Process.Kill(); err != nil {
+				log.Debug().Err(err).Msg("unable to send kill signal to hook process")
+			}
+			<-resultc
+			flush()
+			return fail(errors.E(ErrRunCanceled, "execution aborted by CTRL-C (3x)"))
+
+		case <-timeoutc:
+			timeout := c.runConfig().StackTimeout
+			stdfmt.Fprintf(out.Stderr, "%s %s hook timed out after %s, interrupting it\n", printPrefix, name, timeout)
+			logger := log.With().Stringer("stack", st).Str("hook", name).Logger()
+			result := stopCommand(&logger, cmd, resultc, gracePeriod, killCtx, out.Stderr, printPrefix)
+			flush()
+			exitCode := result.cmd.ProcessState.ExitCode()
+			report.ExitCode = &exitCode
+			return fail(errors.E(ErrRunTimeout, "timed out after %s", timeout))
+
+		case result := <-resultc:
+			stopTimer()
+			flush()
+			exitCode := result.cmd.ProcessState.ExitCode()
+			report.ExitCode = &exitCode
+			if exitCode != 0 {
+				return fail(result.err)
+			}
+		}
+	}
+	return report, nil
+}
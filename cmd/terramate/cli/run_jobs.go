@@ -0,0 +1,326 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	stdfmt "fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/terramate-io/terramate/errors"
+	runutil "github.com/terramate-io/terramate/run"
+)
+
+// taskJob is a group of tasks of a stack run executed in sequence: the
+// commands of a script job, or a matrix variant of a command.
+type taskJob struct {
+	// first and last are the indexes of the first and last tasks of the job.
+	first, last int
+
+	// group is the index of the script and matrix variant of the job.
+	group int
+
+	// after are the indexes of the jobs that must finish before this one.
+	after []int
+
+	// deps are the indexes of the jobs that must succeed before this one.
+	deps []int
+
+	// alone tells if the job never runs concurrently with other jobs.
+	alone bool
+}
+
+// jobs groups the tasks of the stack run in jobs. The jobs of a matrix
+// variant start after all the jobs of the previous variant finished.
+func (r stackRun) jobs() []taskJob {
+	var jobs []taskJob
+	for i, task := range r.Tasks {
+		if i > 0 && sameTaskGroup(r.Tasks[i-1], task) && r.Tasks[i-1].ScriptJobIdx == task.ScriptJobIdx {
+			jobs[len(jobs)-1].last = i
+			continue
+		}
+		jobs = append(jobs, taskJob{first: i, last: i})
+	}
+
+	// group and prevGroup are the indexes of the first jobs of the current
+	// and previous group of jobs.
+	group, prevGroup := 0, 0
+	for i := range jobs {
+		task := r.Tasks[jobs[i].first]
+		if i > 0 && !sameTaskGroup(r.Tasks[jobs[i-1].first], task) {
+			prevGroup, group = group, i
+			jobs[i].group = jobs[i-1].group + 1
+		} else if i > 0 {
+			jobs[i].group = jobs[i-1].group
+		}
+		for j := prevGroup; j < group; j++ {
+			jobs[i].after = append(jobs[i].after, j)
+		}
+		for _, dep := range task.ScriptJobDeps {
+			for j := group; j < len(jobs) && sameTaskGroup(r.Tasks[jobs[j].first], task); j++ {
+				if r.Tasks[jobs[j].first].ScriptJobIdx == dep {
+					jobs[i].deps = append(jobs[i].deps, j)
+				}
+			}
+		}
+	}
+
+	// A job runs alone if it's ordered before or after every other job.
+	waits := make([][]bool, len(jobs))
+	var visit func(i, dep int)
+	visit = func(i, dep int) {
+		if waits[i][dep] {
+			return
+		}
+		waits[i][dep] = true
+		for _, next := range jobs[dep].after {
+			visit(i, next)
+		}
+		for _, next := range jobs[dep].deps {
+			visit(i, next)
+		}
+	}
+	for i := range jobs {
+		waits[i] = make([]bool, len(jobs))
+	}
+	for i := range jobs {
+		for _, dep := range jobs[i].after {
+			visit(i, dep)
+		}
+		for _, dep := range jobs[i].deps {
+			visit(i, dep)
+		}
+	}
+	for i := range jobs {
+		jobs[i].alone = true
+		for j := range jobs {
+			if j != i && !waits[i][j] && !waits[j][i] {
+				jobs[i].alone = false
+				break
+			}
+		}
+	}
+	return jobs
+}
+
+// taskGroups returns the ranges of the tasks of each script and matrix
+// variant of the stack run.
+func (r stackRun) taskGroups() []taskJob {
+	var groups []taskJob
+	for i, task := range r.Tasks {
+		if i > 0 && sameTaskGroup(r.Tasks[i-1], task) {
+			groups[len(groups)-1].last = i
+			continue
+		}
+		groups = append(groups, taskJob{first: i, last: i})
+	}
+	return groups
+}
+
+// taskGroupJobs groups the tasks from the first index in jobs executed one
+// after another, as the on_failure and finally jobs of a script.
+func taskGroupJobs(tasks []stackRunTask, first int) []taskJob {
+	var jobs []taskJob
+	for i := first; i < len(tasks); i++ {
+		if i > first && tasks[i-1].ScriptJobKind == tasks[i].ScriptJobKind &&
+			tasks[i-1].ScriptJobIdx == tasks[i].ScriptJobIdx {
+			jobs[len(jobs)-1].last = i
+			continue
+		}
+		jobs = append(jobs, taskJob{first: i, last: i, alone: true})
+	}
+	return jobs
+}
+
+// sameTaskGroup tells if the tasks belong to the same script and matrix
+// variant.
+func sameTaskGroup(a, b stackRunTask) bool {
+	return a.ScriptIdx == b.ScriptIdx && a.Matrix.String() == b.Matrix.String()
+}
+
+// concurrentJobs tells if any of the jobs can run concurrently with the
+// previous one.
+func concurrentJobs(jobs []taskJob) bool {
+	for i := 1; i < len(jobs); i++ {
+		dependsOnPrevious := false
+		for _, dep := range append(jobs[i].after, jobs[i].deps...) {
+			if dep == i-1 {
+				dependsOnPrevious = true
+			}
+		}
+		if !dependsOnPrevious {
+			return true
+		}
+	}
+	return false
+}
+
+// jobName returns the name of the script job of the task, used to identify
+// the job in the output and the reports.
+func (t stackRunTask) jobName() string {
+	if t.ScriptJobName != "" {
+		return t.ScriptJobName
+	}
+	return stdfmt.Sprintf("%s %d", t.jobKind(), t.ScriptJobIdx+1)
+}
+
+// runJobs executes each job as soon as the jobs it depends on succeed and
+// the jobs ordered before it finish. The exec function returns false if the
+// job failed, in which case the jobs not started yet are not executed, or
+// only the jobs of the same group if continueOnError is set, then a failed
+// matrix variant doesn't stop the other variants.
+func runJobs(jobs []taskJob, continueOnError bool, exec func(job taskJob) bool) {
+	done := make([]chan struct{}, len(jobs))
+	succeeded := make([]bool, len(jobs))
+	stopped := map[int]*atomic.Bool{}
+	for i, job := range jobs {
+		done[i] = make(chan struct{})
+		if _, ok := stopped[job.group]; !ok {
+			stopped[job.group] = &atomic.Bool{}
+		}
+	}
+	stopOf := func(job taskJob) *atomic.Bool {
+		if continueOnError {
+			return stopped[job.group]
+		}
+		return stopped[jobs[0].group]
+	}
+
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Add(1)
+		go func(i int, job taskJob) {
+			defer wg.Done()
+			defer close(done[i])
+
+			for _, dep := range job.after {
+				<-done[dep]
+			}
+			for _, dep := range job.deps {
+				<-done[dep]
+				if !succeeded[dep] {
+					return
+				}
+			}
+			if stopOf(job).Load() {
+				return
+			}
+			if !exec(job) {
+				stopOf(job).Store(true)
+				return
+			}
+			succeeded[i] = true
+		}(i, job)
+	}
+	wg.Wait()
+}
+
+// jobReports returns the reports of the script jobs of the stack run, given
+// the report of the whole stack and the outcome of each task.
+func jobReports(
+	run stackRun,
+	jobs []taskJob,
+	stack runutil.StackReport,
+	results []taskResult,
+) []runutil.JobReport {
+	reports := make([]runutil.JobReport, 0, len(jobs))
+	for _, job := range jobs {
+		task := run.Tasks[job.first]
+		report := runutil.JobReport{
+			Name:    task.ScriptJobName,
+			Kind:    task.ScriptJobKind,
+			Index:   task.ScriptJobIdx + 1,
+			Variant: task.Matrix.String(),
+			Status:  runutil.StackOK,
+		}
+
+		var startedAt, finishedAt time.Time
+		exitCode := -1
+		executed := true
+		for i := job.first; i <= job.last; i++ {
+			res := results[i]
+			if startedAt.IsZero() {
+				startedAt = res.startedAt
+			}
+			if !res.finishedAt.IsZero() {
+				finishedAt = res.finishedAt
+			}
+			if res.exitCode != -1 {
+				exitCode = res.exitCode
+			}
+			if res.status == "" {
+				executed = false
+			}
+			if report.Status == runutil.StackOK && res.status != "" && res.status != runutil.StackOK {
+				report.Status = res.status
+				report.Reason = res.reason
+			}
+		}
+
+		switch {
+		case stack.Status == runutil.StackSkipped || stack.Status == runutil.StackCached:
+			report.Status = stack.Status
+			report.Reason = stack.Reason
+		case report.Status == runutil.StackOK && !executed:
+			report.Status = runutil.StackCanceled
+		}
+		if report.Status == runutil.StackCanceled && report.Reason == "" {
+			report.Reason = stack.Reason
+			if stack.Status == runutil.StackFailed || stack.Status == runutil.StackTimedOut {
+				report.Reason = "another job failed"
+			}
+		}
+
+		if exitCode != -1 {
+			report.ExitCode = &exitCode
+		}
+		if !startedAt.IsZero() {
+			if finishedAt.IsZero() {
+				finishedAt = time.Now().UTC()
+			}
+			report.SetTimes(startedAt, finishedAt)
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// failureReason describes the failure of a command.
+// The exit code is not part of the reason when the command didn't exit by
+// itself, for example when it failed to start.
+func failureReason(exitCode, attempts int) string {
+	var parts []string
+	if exitCode > 0 {
+		parts = append(parts, stdfmt.Sprintf("exit code %d", exitCode))
+	}
+	if attempts > 1 {
+		if len(parts) == 0 {
+			parts = append(parts, "failed")
+		}
+		parts = append(parts, stdfmt.Sprintf("after %d attempts", attempts))
+	}
+	return strings.Join(parts, " ")
+}
+
+// syncErrors is an error list safe to be used concurrently.
+type syncErrors struct {
+	mu   sync.Mutex
+	errs *errors.List
+}
+
+func (e *syncErrors) Append(errs ...error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.errs.Append(errs...)
+}
+
+func (e *syncErrors) AsError() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.errs.AsError()
+}
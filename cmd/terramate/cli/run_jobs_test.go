@@ -0,0 +1,59 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+)
+
+func TestFailureReason(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		name     string
+		exitCode int
+		attempts int
+		want     string
+	}
+
+	for _, tc := range []testcase{
+		{
+			name:     "not started",
+			exitCode: -1,
+			attempts: 1,
+		},
+		{
+			name:     "exit code",
+			exitCode: 2,
+			attempts: 1,
+			want:     "exit code 2",
+		},
+		{
+			name:     "exit code after retries",
+			exitCode: 2,
+			attempts: 3,
+			want:     "exit code 2 after 3 attempts",
+		},
+		{
+			name:     "not started after retries",
+			exitCode: -1,
+			attempts: 3,
+			want:     "failed after 3 attempts",
+		},
+		{
+			name:     "killed after retries",
+			exitCode: 0,
+			attempts: 2,
+			want:     "failed after 2 attempts",
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.EqualStrings(t, tc.want, failureReason(tc.exitCode, tc.attempts))
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	stdfmt "fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/terramate-io/terramate/errors"
+)
+
+// ErrLogDir indicates a failure writing the logs of the commands to the
+// directory given by --log-dir.
+const ErrLogDir errors.Kind = "writing command logs"
+
+// commandLogFiles are the files keeping the stdout and stderr of a command
+// of a stack, in the directory given by --log-dir. It's safe to be used
+// concurrently.
+type commandLogFiles struct {
+	dir        string
+	name       string
+	perAttempt bool
+
+	mu         sync.Mutex
+	stdout     *os.File
+	stderr     *os.File
+	stdoutPath string
+	stderrPath string
+
+	// err is the first error writing the files.
+	err error
+}
+
+// commandLogsDir returns the directory of the logs of the stack, mirroring
+// the stack path inside logDir.
+func commandLogsDir(logDir string, run stackRun) string {
+	return filepath.Join(logDir, filepath.FromSlash(run.Stack.Dir.String()))
+}
+
+// commandLogsName returns the base name of the log files of the task. The
+// logs of matrix variants are named by the variant and the logs of script
+// commands by the job and command indexes.
+func commandLogsName(task stackRunTask, scriptRun bool) string {
+	var name string
+	if task.Matrix != nil {
+		name = logNameReplacer.Replace(task.Matrix.String()) + "."
+	}
+	if scriptRun {
+		kind := strings.ReplaceAll(task.jobKind(), "_", "-")
+		name += stdfmt.Sprintf("%s-%d.cmd-%d.", kind, task.ScriptJobIdx+1, task.ScriptCmdIdx+1)
+	}
+	return name
+}
+
+// logNameReplacer escapes the path separators and quotes of the matrix
+// variants in the names of the log files. The escape character is escaped
+// too, then distinct variants have distinct file names.
+var logNameReplacer = strings.NewReplacer("%", "%25", "/", "%2F", `\`, "%5C", `"`, "%22")
+
+// createCommandLogs creates the log files of the given task of the stack.
+// Existing files of previous runs are truncated. If the task has a retry
+// policy, each attempt has its own files, named by the attempt number, e.g.
+// attempt-1.stdout.log.
+func createCommandLogs(logDir string, run stackRun, task stackRunTask, scriptRun bool) (*commandLogFiles, error) {
+	dir := commandLogsDir(logDir, run)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.E(ErrLogDir, err)
+	}
+
+	l := &commandLogFiles{
+		dir:        dir,
+		name:       commandLogsName(task, scriptRun),
+		perAttempt: task.Retry != nil,
+	}
+	if err := l.create(1); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// create creates the log files of the given attempt.
+func (l *commandLogFiles) create(attempt int) error {
+	name := l.name
+	if l.perAttempt {
+		name += stdfmt.Sprintf("attempt-%d.", attempt)
+	}
+	l.stdoutPath = filepath.Join(l.dir, name+"stdout.log")
+	l.stderrPath = filepath.Join(l.dir, name+"stderr.log")
+
+	stdout, err := os.Create(l.stdoutPath)
+	if err != nil {
+		return errors.E(ErrLogDir, err)
+	}
+	stderr, err := os.Create(l.stderrPath)
+	if err != nil {
+		_ = stdout.Close()
+		return errors.E(ErrLogDir, err)
+	}
+	l.stdout, l.stderr = stdout, stderr
+	return nil
+}
+
+// NextAttempt closes the log files of the current attempt and creates the
+// files of the given one. The output of the command is kept in the same
+// files if the task has no retry policy.
+func (l *commandLogFiles) NextAttempt(attempt int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.perAttempt {
+		return nil
+	}
+	if err := l.close(); err != nil {
+		return err
+	}
+	return l.create(attempt)
+}
+
+// Paths returns the paths of the stdout and stderr log files of the current
+// attempt.
+func (l *commandLogFiles) Paths() (stdout, stderr string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.stdoutPath, l.stderrPath
+}
+
+// Stdout returns the writer of the stdout log file.
+func (l *commandLogFiles) Stdout() io.Writer {
+	return logFileWriter{files: l}
+}
+
+// Stderr returns the writer of the stderr log file.
+func (l *commandLogFiles) Stderr() io.Writer {
+	return logFileWriter{files: l, stderr: true}
+}
+
+// logFileWriter writes to a log file, keeping the first error in the
+// commandLogFiles instead of returning it, then a failure writing the logs
+// doesn't interrupt the output of the command.
+type logFileWriter struct {
+	files  *commandLogFiles
+	stderr bool
+}
+
+func (w logFileWriter) Write(p []byte) (int, error) {
+	w.files.mu.Lock()
+	defer w.files.mu.Unlock()
+
+	f := w.files.stdout
+	if w.stderr {
+		f = w.files.stderr
+	}
+	if w.files.err == nil && f != nil {
+		_, w.files.err = f.Write(p)
+	}
+	return len(p), nil
+}
+
+// Close closes the log files, returning any error writing them.
+func (l *commandLogFiles) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.close()
+}
+
+func (l *commandLogFiles) close() error {
+	errs := errors.L(l.err)
+	if l.stdout != nil {
+		errs.Append(l.stdout.Close())
+	}
+	if l.stderr != nil {
+		errs.Append(l.stderr.Close())
+	}
+	l.stdout, l.stderr = nil, nil
+	l.err = nil
+	if err := errs.AsError(); err != nil {
+		return errors.E(ErrLogDir, err)
+	}
+	return nil
+}
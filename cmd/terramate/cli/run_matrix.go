@@ -0,0 +1,179 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"time"
+
+	"github.com/terramate-io/terramate/config"
+	runutil "github.com/terramate-io/terramate/run"
+)
+
+// matrixVariantsFromFlags returns the matrix variants defined by the --matrix
+// flags. It returns a single nil variant if no flag is given.
+func matrixVariantsFromFlags(flags []string) []config.Variant {
+	var vars []config.MatrixVar
+	seen := map[string]bool{}
+	for _, flag := range flags {
+		v, err := config.ParseMatrixVar(flag)
+		if err != nil {
+			fatalWithDetailf(err, "invalid --matrix flag")
+		}
+		if seen[v.Name] {
+			fatalf("--matrix variable %q given multiple times", v.Name)
+		}
+		seen[v.Name] = true
+		vars = append(vars, v)
+	}
+	return config.MatrixVariants(vars)
+}
+
+// variantSuffix returns the suffix identifying the matrix variant in the
+// messages of a run, or an empty string for nil variants.
+func variantSuffix(variant config.Variant) string {
+	if variant == nil {
+		return ""
+	}
+	return " [" + variant.String() + "]"
+}
+
+// variants returns the matrix variants of the tasks of the stack run, in
+// execution order. It returns nil if the tasks are not executed for a matrix.
+// The tasks of each variant are contiguous.
+func (r stackRun) variants() []config.Variant {
+	var variants []config.Variant
+	for i, task := range r.Tasks {
+		if task.Matrix == nil {
+			continue
+		}
+		if i == 0 || r.Tasks[i-1].Matrix.String() != task.Matrix.String() {
+			variants = append(variants, task.Matrix)
+		}
+	}
+	return variants
+}
+
+// cacheCmds returns the commands identifying the stack run in the run cache.
+// The commands of matrix variants are prefixed by the variant, so changing
+// the matrix invalidates the cache.
+func (r stackRun) cacheCmds() [][]string {
+	cmds := make([][]string, 0, len(r.Tasks))
+	for _, task := range r.Tasks {
+		if task.Skipped || task.ScriptJobKind != "" {
+			continue
+		}
+		if task.Matrix == nil {
+			cmds = append(cmds, task.Cmd)
+			continue
+		}
+		cmds = append(cmds, append([]string{"matrix:" + task.Matrix.String()}, task.Cmd...))
+	}
+	return cmds
+}
+
+// taskResult is the outcome of a task of a stack run.
+type taskResult struct {
+	startedAt  time.Time
+	finishedAt time.Time
+	exitCode   int
+	attempts   int
+
+	// timedOut is the timeout that stopped the command, if it timed out.
+	timedOut time.Duration
+
+	// err is the error that failed the task.
+	err error
+
+	// attemptReports are the reports of the attempts of commands with a
+	// retry policy.
+	attemptReports []runutil.AttemptReport
+
+	// status is empty if the task was not executed.
+	status runutil.StackStatus
+	reason string
+}
+
+// variantReports returns the reports of the matrix variants of the stack
+// run, given the report of the whole stack and the outcome of each task.
+// Each variant has a single report, given by the outcome of its own tasks.
+func variantReports(
+	run stackRun,
+	stack runutil.StackReport,
+	results []taskResult,
+) []runutil.VariantReport {
+	groups := run.taskGroups()
+	var reports []runutil.VariantReport
+	for i, group := range groups {
+		task := run.Tasks[group.first]
+		if task.Matrix == nil {
+			continue
+		}
+
+		report := runutil.VariantReport{
+			Name:   task.Matrix.String(),
+			Matrix: task.Matrix.Map(),
+			Status: runutil.StackOK,
+		}
+
+		var startedAt, finishedAt time.Time
+		exitCode := -1
+		executed, skipped := true, true
+		for j := group.first; j <= group.last; j++ {
+			res := results[j]
+			if run.Tasks[j].Skipped {
+				continue
+			}
+			skipped = false
+			if startedAt.IsZero() {
+				startedAt = res.startedAt
+			}
+			if !res.finishedAt.IsZero() {
+				finishedAt = res.finishedAt
+			}
+			if res.exitCode != -1 {
+				exitCode = res.exitCode
+			}
+			if res.status == "" {
+				executed = false
+			}
+			if report.Status == runutil.StackOK && res.status != "" && res.status != runutil.StackOK {
+				report.Status = res.status
+				report.Reason = res.reason
+			}
+		}
+
+		switch {
+		case stack.Status == runutil.StackSkipped || stack.Status == runutil.StackCached:
+			report.Status = stack.Status
+			report.Reason = stack.Reason
+		case report.Status == runutil.StackOK && skipped:
+			report.Status = runutil.StackSkipped
+			report.Reason = "condition is false"
+		case report.Status == runutil.StackOK && !executed:
+			report.Status = runutil.StackCanceled
+		case report.Status == runutil.StackOK && i == len(groups)-1 && stack.Status != runutil.StackOK:
+			// The stack failed after its tasks, in the after_run hook.
+			report.Status = stack.Status
+			report.Reason = stack.Reason
+		}
+		if report.Status == runutil.StackCanceled && report.Reason == "" {
+			report.Reason = stack.Reason
+			if stack.Status == runutil.StackFailed || stack.Status == runutil.StackTimedOut {
+				report.Reason = "a previous variant failed"
+			}
+		}
+
+		if exitCode != -1 {
+			report.ExitCode = &exitCode
+		}
+		if !startedAt.IsZero() {
+			if finishedAt.IsZero() {
+				finishedAt = time.Now().UTC()
+			}
+			report.SetTimes(startedAt, finishedAt)
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
@@ -0,0 +1,254 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/terramate-io/terramate/ci"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/printer"
+)
+
+// Output modes of `terramate run` and `terramate script run`.
+const (
+	// runOutputPlain writes the output of the commands as is.
+	runOutputPlain = "plain"
+
+	// runOutputPrefix prefixes each line of output with the stack path.
+	runOutputPrefix = "prefix"
+
+	// runOutputGrouped buffers the output of each stack and writes it at once
+	// when the stack finishes, folded in the CI logs when supported.
+	runOutputGrouped = "grouped"
+)
+
+var stackPrefixColors = []*color.Color{
+	color.New(color.FgCyan),
+	color.New(color.FgGreen),
+	color.New(color.FgYellow),
+	color.New(color.FgBlue),
+	color.New(color.FgMagenta),
+	color.New(color.FgRed),
+}
+
+// runOutput multiplexes the output of the stacks of a run to stdout and
+// stderr, according to the output mode. It's safe to be used concurrently.
+type runOutput struct {
+	mode     string
+	stdout   io.Writer
+	stderr   io.Writer
+	colored  bool
+	platform ci.PlatformType
+
+	// printer prints the messages of the stacks in the plain output mode.
+	printer *printer.Printer
+
+	// mu serializes the writes to stdout and stderr.
+	mu sync.Mutex
+}
+
+// stackOutput is the output of a single stack of the run.
+type stackOutput struct {
+	Stdout  io.Writer
+	Stderr  io.Writer
+	Printer *printer.Printer
+
+	flush func(title string)
+}
+
+// newRunOutput returns the output of a run. If progress is not nil, the
+// output is written above the progress view.
+func (c *cli) newRunOutput(mode string, progress *runProgress) *runOutput {
+	if mode == "" {
+		mode = runOutputPlain
+	}
+	o := &runOutput{
+		mode:     mode,
+		stdout:   c.stdout,
+		stderr:   c.stderr,
+		colored:  c.uimode == HumanMode,
+		platform: ci.DetectPlatformFromEnv(),
+		printer:  printer.Stderr,
+	}
+	if progress != nil {
+		o.stdout = progress.writer(c.stdout)
+		o.stderr = progress.writer(c.stderr)
+		o.printer = printer.NewPrinter(o.stderr)
+	}
+	return o
+}
+
+// forStack returns the output for the given stack. The index is used to pick
+// the color of the stack prefix.
+func (o *runOutput) forStack(st *config.Stack, index int) *stackOutput {
+	switch o.mode {
+	case runOutputPrefix:
+		prefix := "[" + st.Dir.String() + "] "
+		if o.colored {
+			prefix = stackPrefixColors[index%len(stackPrefixColors)].Sprint(prefix)
+		}
+		stdout := &prefixWriter{mu: &o.mu, w: o.stdout, prefix: []byte(prefix)}
+		stderr := &prefixWriter{mu: &o.mu, w: o.stderr, prefix: []byte(prefix)}
+		return &stackOutput{
+			Stdout:  stdout,
+			Stderr:  stderr,
+			Printer: printer.NewPrinter(stderr),
+			flush: func(string) {
+				stdout.flush()
+				stderr.flush()
+			},
+		}
+
+	case runOutputGrouped:
+		buf := &groupedBuffer{mu: &o.mu}
+		stderr := buf.stream(true)
+		name := st.Dir.String()
+		return &stackOutput{
+			Stdout:  buf.stream(false),
+			Stderr:  stderr,
+			Printer: printer.NewPrinter(stderr),
+			flush: func(title string) {
+				o.mu.Lock()
+				defer o.mu.Unlock()
+
+				_, _ = io.WriteString(o.stdout, o.platform.FoldStart(name, title, time.Now()))
+				buf.writeTo(o.stdout, o.stderr)
+				_, _ = io.WriteString(o.stdout, o.platform.FoldEnd(name, time.Now()))
+			},
+		}
+
+	default:
+		return &stackOutput{
+			Stdout:  o.stdout,
+			Stderr:  o.stderr,
+			Printer: o.printer,
+			flush:   func(string) {},
+		}
+	}
+}
+
+// forJob returns the output of a job of the stack running concurrently with
+// other jobs. Each line of output is prefixed with the job name.
+func (s *stackOutput) forJob(name string) *stackOutput {
+	mu := &sync.Mutex{}
+	prefix := []byte("[" + name + "] ")
+	stdout := &prefixWriter{mu: mu, w: s.Stdout, prefix: prefix}
+	stderr := &prefixWriter{mu: mu, w: s.Stderr, prefix: prefix}
+	return &stackOutput{
+		Stdout:  stdout,
+		Stderr:  stderr,
+		Printer: printer.NewPrinter(stderr),
+		flush: func(string) {
+			stdout.flush()
+			stderr.flush()
+		},
+	}
+}
+
+// Flush writes any output of the stack not written yet. The title is the
+// title of the folded section in the CI logs, if supported.
+func (s *stackOutput) Flush(title string) {
+	s.flush(title)
+}
+
+// prefixWriter writes each line of output with a prefix. Incomplete lines
+// are buffered until completed or flushed.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := w.writeLine(w.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *prefixWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) > 0 {
+		_ = w.writeLine(append(w.buf, '\n'))
+		w.buf = nil
+	}
+}
+
+func (w *prefixWriter) writeLine(line []byte) error {
+	_, err := w.w.Write(append(append([]byte{}, w.prefix...), line...))
+	return err
+}
+
+// groupedBuffer buffers the stdout and stderr of a stack in the order they
+// are written, then error lines are kept next to the output that caused them.
+// It shares the lock of the run output, so it can be written while other
+// stacks flush their output.
+type groupedBuffer struct {
+	mu     *sync.Mutex
+	chunks []outputChunk
+}
+
+// outputChunk is a contiguous piece of output written to the same stream.
+type outputChunk struct {
+	stderr bool
+	data   []byte
+}
+
+// groupedStream is the writer of one of the streams of a groupedBuffer.
+type groupedStream struct {
+	buf    *groupedBuffer
+	stderr bool
+}
+
+func (b *groupedBuffer) stream(stderr bool) io.Writer {
+	return &groupedStream{buf: b, stderr: stderr}
+}
+
+func (w *groupedStream) Write(p []byte) (int, error) {
+	b := w.buf
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if n := len(b.chunks); n > 0 && b.chunks[n-1].stderr == w.stderr {
+		b.chunks[n-1].data = append(b.chunks[n-1].data, p...)
+	} else {
+		b.chunks = append(b.chunks, outputChunk{
+			stderr: w.stderr,
+			data:   append([]byte{}, p...),
+		})
+	}
+	return len(p), nil
+}
+
+// writeTo writes the buffered output to stdout and stderr, in order, and
+// resets the buffer. The caller must hold the lock.
+func (b *groupedBuffer) writeTo(stdout, stderr io.Writer) {
+	for _, chunk := range b.chunks {
+		w := stdout
+		if chunk.stderr {
+			w = stderr
+		}
+		_, _ = w.Write(chunk.data)
+	}
+	b.chunks = nil
+}
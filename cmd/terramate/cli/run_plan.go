@@ -0,0 +1,235 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/hcl"
+	prj "github.com/terramate-io/terramate/project"
+	runutil "github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/run/dag"
+)
+
+// runFormatJSON is the --format of `terramate run` and `terramate script run`
+// printing the execution plan as JSON.
+const runFormatJSON = "json"
+
+// checkRunFormat checks the --format flag of `terramate run` and
+// `terramate script run`.
+func checkRunFormat(flags commonRunFlags) {
+	if flags.Format == runFormatJSON && !flags.DryRun {
+		fatal("--format json requires --dry-run")
+	}
+}
+
+// runPlan computes the execution plan of the run. The sensitive values are
+// redacted from the commands.
+func (c *cli) runPlan(
+	d *dag.DAG[stackRun],
+	opts runAllOptions,
+	stackEnvs map[prj.Path]runutil.EnvVars,
+	variantEnvs map[prj.Path]map[string]runutil.EnvVars,
+	stackHooks map[prj.Path]runutil.Hooks,
+	stackMaskers map[prj.Path]*runutil.Masker,
+	rootEnv runutil.EnvVars,
+	rootMasker *runutil.Masker,
+) (*runutil.Plan, error) {
+	plan := &runutil.Plan{Kind: runutil.JournalKindRun}
+	if opts.ScriptRun {
+		plan.Kind = runutil.JournalKindScript
+	}
+
+	errs := errors.L()
+	positions := dagPositions(d, opts.Reverse)
+	for _, id := range d.IDs() {
+		run, err := d.Node(id)
+		if err != nil {
+			return nil, errors.E(errors.ErrInternal, err, "building the plan of the run")
+		}
+		pos := positions[id]
+		masker := stackMaskers[run.Stack.Dir]
+
+		stackPlan := runutil.StackPlan{
+			Path:  run.Stack.Dir.String(),
+			ID:    run.Stack.ID,
+			Order: pos.order,
+			After: pos.after,
+			Env:   envNames(stackEnvs[run.Stack.Dir]),
+		}
+		for _, name := range hcl.RunHookNames {
+			cmds := stackHooks[run.Stack.Dir].Commands(name)
+			if len(cmds) == 0 {
+				continue
+			}
+			if stackPlan.Hooks == nil {
+				stackPlan.Hooks = map[string][][]string{}
+			}
+			stackPlan.Hooks[name] = maskCmds(masker, cmds)
+		}
+
+		tasks := run.Tasks
+		if run.Script != nil {
+			resultTasks, err := c.scriptResultPlanTasks(run)
+			errs.Append(err)
+			tasks = append(slices.Clip(tasks), resultTasks...)
+		}
+		var inputs []runutil.InputPlan
+		if slices.ContainsFunc(tasks, func(task stackRunTask) bool { return task.EnableSharing }) {
+			inputs, err = c.sharingInputsPlan(run.Stack)
+			errs.Append(err)
+		}
+		for _, task := range tasks {
+			taskPlan := planTask(task, masker, opts.ScriptRun, inputs)
+			if task.Matrix != nil {
+				taskPlan.Env = envNames(variantEnvs[run.Stack.Dir][task.Matrix.String()])
+			}
+			stackPlan.Tasks = append(stackPlan.Tasks, taskPlan)
+		}
+		plan.Stacks = append(plan.Stacks, stackPlan)
+	}
+
+	for _, root := range []struct {
+		when  string
+		order int
+		tasks []stackRunTask
+	}{
+		{runutil.RootBefore, 0, opts.RootBefore},
+		{runutil.RootAfter, len(positions) + 1, opts.RootAfter},
+	} {
+		if len(root.tasks) == 0 {
+			continue
+		}
+		stackPlan := runutil.StackPlan{
+			Path:  "/",
+			Root:  root.when,
+			Order: root.order,
+			Env:   envNames(rootEnv),
+		}
+		for _, task := range root.tasks {
+			stackPlan.Tasks = append(stackPlan.Tasks, planTask(task, rootMasker, opts.ScriptRun, nil))
+		}
+		plan.Stacks = append(plan.Stacks, stackPlan)
+	}
+
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(plan.Stacks, func(a, b runutil.StackPlan) int {
+		return a.Order - b.Order
+	})
+	return plan, nil
+}
+
+// planTask returns the plan of the task. The inputs are the evaluated input
+// blocks of the stack, listed if the task enables outputs sharing.
+func planTask(task stackRunTask, masker *runutil.Masker, scriptRun bool, inputs []runutil.InputPlan) runutil.TaskPlan {
+	plan := runutil.TaskPlan{
+		Cmd:     masker.MaskArgs(task.Cmd),
+		Matrix:  task.Matrix.Map(),
+		Timeout: task.Timeout.Seconds(),
+	}
+	if scriptRun {
+		plan.ScriptJob = task.ScriptJobIdx + 1
+		plan.ScriptCommand = task.ScriptCmdIdx + 1
+		plan.ScriptJobName = task.ScriptJobName
+		plan.ScriptJobKind = task.ScriptJobKind
+		plan.Skipped = task.Skipped
+		plan.ScriptEnv = envNames(task.Env)
+		plan.ScriptUnsetEnv = task.UnsetEnv
+		for _, dep := range task.ScriptJobDeps {
+			plan.ScriptJobDependsOn = append(plan.ScriptJobDependsOn, dep+1)
+		}
+	}
+	if task.Retry != nil {
+		plan.MaxAttempts = task.Retry.MaxAttempts
+	}
+
+	if task.CloudSyncDeployment || task.CloudSyncDriftStatus || task.CloudSyncPreview {
+		plan.CloudSync = &runutil.CloudSyncPlan{
+			Deployment:      task.CloudSyncDeployment,
+			DriftStatus:     task.CloudSyncDriftStatus,
+			Preview:         task.CloudSyncPreview,
+			Target:          task.CloudTarget,
+			FromTarget:      task.CloudFromTarget,
+			Layer:           string(task.CloudSyncLayer),
+			PlanFile:        task.CloudPlanFile,
+			PlanProvisioner: task.CloudPlanProvisioner,
+		}
+	}
+
+	if task.EnableSharing {
+		plan.Sharing = &runutil.SharingPlan{
+			MockOnFail: task.MockOnFail,
+			Inputs:     inputs,
+		}
+	}
+	return plan
+}
+
+// sharingInputsPlan evaluates the input blocks of the stack, listed in the
+// plan of its tasks enabling outputs sharing.
+func (c *cli) sharingInputsPlan(st *config.Stack) ([]runutil.InputPlan, error) {
+	cfg, _ := c.cfg().Lookup(st.Dir)
+	if len(cfg.Node.Inputs) == 0 {
+		return nil, nil
+	}
+	evalctx := c.setupEvalContext(st, map[string]string{})
+	var inputs []runutil.InputPlan
+	for _, in := range cfg.Node.Inputs {
+		input, err := config.EvalInput(evalctx, in)
+		if err != nil {
+			return nil, errors.E(err, "evaluating input block of stack %s", st.Dir)
+		}
+		inputs = append(inputs, runutil.InputPlan{
+			Name:        input.Name,
+			Backend:     input.Backend,
+			FromStackID: input.FromStackID,
+		})
+	}
+	return inputs, nil
+}
+
+// scriptResultPlanTasks returns the tasks of the on_failure and finally jobs
+// of each matrix variant of the script run. The result of the script is only
+// known when it runs, so the on_failure jobs are evaluated as if a job failed
+// with exit code 1 and the finally jobs as if all the jobs succeeded.
+func (c *cli) scriptResultPlanTasks(run stackRun) ([]stackRunTask, error) {
+	errs := errors.L()
+	var tasks []stackRunTask
+	for _, group := range run.taskGroups() {
+		first := run.Tasks[group.first]
+		failed, err := c.scriptResultTasks(run, first, config.ScriptResult{Failed: true, ExitCode: 1})
+		if err != nil {
+			errs.Append(err)
+			continue
+		}
+		succeeded, err := c.scriptResultTasks(run, first, config.ScriptResult{})
+		if err != nil {
+			errs.Append(err)
+			continue
+		}
+		for _, task := range failed {
+			if task.ScriptJobKind == "on_failure" {
+				tasks = append(tasks, task)
+			}
+		}
+		tasks = append(tasks, succeeded...)
+	}
+	return tasks, errs.AsError()
+}
+
+// envNames returns the names of the environment variables.
+func envNames(env runutil.EnvVars) []string {
+	var names []string
+	for _, v := range env {
+		name, _, _ := strings.Cut(v, "=")
+		names = append(names, name)
+	}
+	return names
+}
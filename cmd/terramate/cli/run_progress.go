@@ -0,0 +1,279 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	stdfmt "fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+	runutil "github.com/terramate-io/terramate/run"
+)
+
+const (
+	// progressRefreshInterval is the interval between redraws of the
+	// progress view, updating the elapsed time of the running stacks.
+	progressRefreshInterval = 500 * time.Millisecond
+
+	// progressMaxRunning is the maximum number of running stacks listed in
+	// the progress view.
+	progressMaxRunning = 10
+)
+
+// runProgress is a live view of the progress of a parallel run, drawn at the
+// bottom of the terminal. The output of the stacks is written above it.
+// It's safe to be used concurrently.
+type runProgress struct {
+	mu sync.Mutex
+	w  io.Writer
+
+	// width returns the width of the terminal, then the lines of the view
+	// are truncated to it and each one takes a single row.
+	width func() int
+
+	total    int
+	running  map[string]time.Time
+	finished map[runutil.StackStatus]int
+
+	// lines is the number of lines of the last drawn view.
+	lines int
+
+	// partial tells if the last line written above the view is incomplete,
+	// e.g. a prompt. The view is then drawn below it and the cursor is moved
+	// back to its end, where the following output and the input echoed by
+	// the terminal continue it.
+	partial bool
+
+	done    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// newRunProgress returns a progress view for a run of the given number of
+// stacks, or nil if the progress view is not supported. It's only supported
+// in the human UI mode, when stdout is a terminal.
+func (c *cli) newRunProgress(total int) *runProgress {
+	if c.uimode != HumanMode || !isTerminal(c.stdout) {
+		return nil
+	}
+	p := &runProgress{
+		w:        c.stdout,
+		width:    func() int { return guessWidth(c.stdout) },
+		total:    total,
+		running:  map[string]time.Time{},
+		finished: map[runutil.StackStatus]int{},
+		done:     make(chan struct{}),
+	}
+	p.stopped.Add(1)
+	go p.refresh()
+	return p
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// start marks the stack as running. Stacks already running are ignored.
+func (p *runProgress) start(stack string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.running[stack]; ok {
+		return
+	}
+	p.running[stack] = time.Now()
+	p.redraw()
+}
+
+// finish marks the stack as finished with the given status.
+func (p *runProgress) finish(stack string, status runutil.StackStatus) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.running, stack)
+	p.finished[status]++
+	p.redraw()
+}
+
+// stop erases the progress view. Nothing is drawn after stopping.
+func (p *runProgress) stop() {
+	if p == nil {
+		return
+	}
+	close(p.done)
+	p.stopped.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clear()
+	p.w = nil
+}
+
+// writer returns a writer writing above the progress view. Incomplete lines
+// are written right away, with the view drawn below them.
+func (p *runProgress) writer(w io.Writer) io.Writer {
+	return &progressWriter{p: p, w: w}
+}
+
+func (p *runProgress) refresh() {
+	defer p.stopped.Done()
+
+	ticker := time.NewTicker(progressRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			p.redraw()
+			p.mu.Unlock()
+		}
+	}
+}
+
+func (p *runProgress) redraw() {
+	p.clear()
+	p.draw()
+}
+
+// clear erases the last drawn view, leaving the cursor where it started.
+func (p *runProgress) clear() {
+	if p.w == nil || p.lines == 0 {
+		return
+	}
+	if p.partial {
+		// The cursor is at the end of the incomplete line, above the view.
+		_, _ = io.WriteString(p.w, "\x1b[J")
+	} else {
+		_, _ = stdfmt.Fprintf(p.w, "\x1b[%dF\x1b[J", p.lines)
+	}
+	p.lines = 0
+}
+
+func (p *runProgress) draw() {
+	if p.w == nil {
+		return
+	}
+
+	ok := p.finished[runutil.StackOK] + p.finished[runutil.StackCached]
+	failed := p.finished[runutil.StackFailed] + p.finished[runutil.StackTimedOut]
+	skipped := p.finished[runutil.StackSkipped] + p.finished[runutil.StackCanceled]
+	queued := p.total - len(p.running) - ok - failed - skipped
+
+	counts := []string{
+		stdfmt.Sprintf("%d running", len(p.running)),
+		stdfmt.Sprintf("%d queued", queued),
+		stdfmt.Sprintf("%d done", ok),
+	}
+	if failed > 0 {
+		counts = append(counts, color.RedString("%d failed", failed))
+	}
+	if skipped > 0 {
+		counts = append(counts, stdfmt.Sprintf("%d skipped", skipped))
+	}
+
+	lines := []string{color.New(color.Bold).Sprint("terramate: ") + strings.Join(counts, ", ")}
+
+	stacks := make([]string, 0, len(p.running))
+	for stack := range p.running {
+		stacks = append(stacks, stack)
+	}
+	// The stacks running for longer come first.
+	slices.SortFunc(stacks, func(a, b string) int {
+		if c := p.running[a].Compare(p.running[b]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+
+	now := time.Now()
+	for i, stack := range stacks {
+		if i == progressMaxRunning {
+			lines = append(lines, stdfmt.Sprintf("  ... and %d more", len(stacks)-i))
+			break
+		}
+		elapsed := now.Sub(p.running[stack]).Truncate(time.Second)
+		lines = append(lines, stdfmt.Sprintf("  %s %s", stack, color.New(color.Faint).Sprint(elapsed)))
+	}
+
+	width := p.width()
+	for i, line := range lines {
+		lines[i] = truncateLine(line, width)
+	}
+
+	view := strings.Join(lines, "\n")
+	if p.partial {
+		// Room is made below the incomplete line, scrolling the terminal if
+		// needed, with the cursor keeping its column. Then the cursor is
+		// restored to the same position after drawing the view.
+		n := len(lines)
+		_, _ = stdfmt.Fprintf(p.w, "%s\x1b[%dA\x1b7\n%s\x1b8", strings.Repeat("\x1bD", n), n, view)
+	} else {
+		_, _ = io.WriteString(p.w, view+"\n")
+	}
+	p.lines = len(lines)
+}
+
+// truncateLine truncates the line to the given number of columns. The escape
+// sequences of colors take no columns and are all kept, then the colors are
+// reset even if the line is truncated.
+func truncateLine(line string, width int) string {
+	var b strings.Builder
+	cols := 0
+	for i := 0; i < len(line); {
+		if line[i] == '\x1b' {
+			if end := strings.IndexByte(line[i:], 'm'); end != -1 {
+				b.WriteString(line[i : i+end+1])
+				i += end + 1
+				continue
+			}
+		}
+		r, size := utf8.DecodeRuneInString(line[i:])
+		if cols < width {
+			b.WriteRune(r)
+		}
+		cols++
+		i += size
+	}
+	return b.String()
+}
+
+// progressWriter writes above the progress view, redrawing it after each
+// write.
+type progressWriter struct {
+	p *runProgress
+	w io.Writer
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	w.p.mu.Lock()
+	defer w.p.mu.Unlock()
+
+	w.p.clear()
+	defer w.p.draw()
+	n, err := w.w.Write(b)
+	if n > 0 {
+		w.p.partial = b[n-1] != '\n'
+	}
+	return n, err
+}
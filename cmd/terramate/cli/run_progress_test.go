@@ -0,0 +1,216 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"bytes"
+	stdfmt "fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/madlambda/spells/assert"
+	runutil "github.com/terramate-io/terramate/run"
+)
+
+var colorEscapes = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func newTestRunProgress(out *bytes.Buffer, width int, running ...string) *runProgress {
+	p := &runProgress{
+		w:        out,
+		width:    func() int { return width },
+		total:    len(running) + 2,
+		running:  map[string]time.Time{},
+		finished: map[runutil.StackStatus]int{runutil.StackOK: 1},
+	}
+	start := time.Now()
+	for i, stack := range running {
+		p.running[stack] = start.Add(time.Duration(i) * time.Millisecond)
+	}
+	return p
+}
+
+func TestRunProgressDrawAndClear(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		name    string
+		running int
+		want    int
+	}
+
+	for _, tc := range []testcase{
+		{
+			name: "no running stacks",
+			want: 1,
+		},
+		{
+			name:    "running stacks",
+			running: 3,
+			want:    4,
+		},
+		{
+			name:    "more running stacks than listed",
+			running: progressMaxRunning + 5,
+			want:    progressMaxRunning + 2,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var stacks []string
+			for i := 0; i < tc.running; i++ {
+				stacks = append(stacks, stdfmt.Sprintf("/stack-%02d", i))
+			}
+
+			var out bytes.Buffer
+			p := newTestRunProgress(&out, 80, stacks...)
+			p.draw()
+			assert.EqualInts(t, tc.want, p.lines)
+			assert.EqualInts(t, tc.want, strings.Count(out.String(), "\n"))
+
+			out.Reset()
+			p.clear()
+			assert.EqualStrings(t, stdfmt.Sprintf("\x1b[%dF\x1b[J", tc.want), out.String())
+			assert.EqualInts(t, 0, p.lines)
+
+			// Nothing is left to be cleared.
+			out.Reset()
+			p.clear()
+			assert.EqualStrings(t, "", out.String())
+		})
+	}
+}
+
+func TestRunProgressTruncatesLinesToWidth(t *testing.T) {
+	t.Parallel()
+
+	const width = 20
+
+	var out bytes.Buffer
+	p := newTestRunProgress(&out, width, "/"+strings.Repeat("long/", 10)+"stack", "/short")
+	p.draw()
+	assert.EqualInts(t, 3, p.lines)
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert.EqualInts(t, p.lines, len(lines))
+	for _, line := range lines {
+		visible := colorEscapes.ReplaceAllString(line, "")
+		if n := utf8.RuneCountInString(visible); n > width {
+			t.Errorf("line %q has %d columns, want at most %d", visible, n, width)
+		}
+	}
+}
+
+func TestRunProgressWriterWritesAboveView(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	p := newTestRunProgress(&out, 80, "/stack")
+	p.draw()
+	view := out.String()
+
+	out.Reset()
+	w := p.writer(&out)
+	n, err := w.Write([]byte("output\n"))
+	assert.NoError(t, err)
+	assert.EqualInts(t, len("output\n"), n)
+
+	// The view is cleared, the output is written and the view is drawn
+	// again below it.
+	want := "\x1b[2F\x1b[J" + "output\n"
+	got := out.String()
+	if !strings.HasPrefix(got, want) {
+		t.Fatalf("output %q doesn't start with %q", got, want)
+	}
+	assert.EqualInts(t, strings.Count(view, "\n"), strings.Count(got[len(want):], "\n"))
+	assert.EqualInts(t, 2, p.lines)
+
+	// After stopping, the writes go straight to the output. The refresh is
+	// started as in newRunProgress, since stop waits for it.
+	p.done = make(chan struct{})
+	p.stopped.Add(1)
+	go p.refresh()
+	p.stop()
+
+	out.Reset()
+	_, err = w.Write([]byte("more output\n"))
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "more output\n", out.String())
+}
+
+func TestRunProgressWriterWritesPartialLines(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	p := newTestRunProgress(&out, 80, "/stack")
+	p.draw()
+
+	out.Reset()
+	w := p.writer(&out)
+	_, err := w.Write([]byte("Enter a value: "))
+	assert.NoError(t, err)
+
+	// The prompt is written right away and the view is drawn below it, with
+	// the cursor restored to the end of the prompt.
+	want := "\x1b[2F\x1b[J" + "Enter a value: " + "\x1bD\x1bD\x1b[2A\x1b7\n"
+	got := out.String()
+	if !strings.HasPrefix(got, want) {
+		t.Fatalf("output %q doesn't start with %q", got, want)
+	}
+	if !strings.HasSuffix(got, "\x1b8") {
+		t.Fatalf("output %q doesn't restore the cursor", got)
+	}
+	assert.EqualInts(t, 2, p.lines)
+
+	// The rest of the line continues the prompt, clearing only the view below
+	// it.
+	out.Reset()
+	_, err = w.Write([]byte("done\n"))
+	assert.NoError(t, err)
+	want = "\x1b[J" + "done\n"
+	got = out.String()
+	if !strings.HasPrefix(got, want) {
+		t.Fatalf("output %q doesn't start with %q", got, want)
+	}
+	assert.IsTrue(t, !p.partial)
+
+	out.Reset()
+	p.redraw()
+	if !strings.HasPrefix(out.String(), "\x1b[2F\x1b[J") {
+		t.Fatalf("output %q doesn't clear the view above the cursor", out.String())
+	}
+}
+
+func TestTruncateLine(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		line  string
+		width int
+		want  string
+	}
+
+	for _, tc := range []testcase{
+		{line: "short", width: 10, want: "short"},
+		{line: "exactly 10", width: 10, want: "exactly 10"},
+		{line: "longer than 10", width: 10, want: "longer tha"},
+		{line: "ação e reação", width: 6, want: "ação e"},
+		{
+			line:  "\x1b[1mterramate: \x1b[0m1 running",
+			width: 12,
+			want:  "\x1b[1mterramate: \x1b[0m1",
+		},
+		{
+			line:  "  /stack \x1b[2m10s\x1b[0m",
+			width: 8,
+			want:  "  /stack\x1b[2m\x1b[0m",
+		},
+	} {
+		assert.EqualStrings(t, tc.want, truncateLine(tc.line, tc.width))
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	stdjson "encoding/json"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/terramate-io/terramate/cloud/preview"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/printer"
+	prj "github.com/terramate-io/terramate/project"
+	runutil "github.com/terramate-io/terramate/run"
+)
+
+// resumeOptionsVersion is the version of the resumeOptions saved in the
+// run-state journal. It must be increased when the meaning of a saved option
+// changes, then runs saved by other versions are not resumed with wrong
+// options.
+const resumeOptionsVersion = 1
+
+// resumeOptions are the options of a run saved in the run-state journal and
+// restored when the run is resumed. They are saved under stable names, apart
+// from the flags, then renaming a flag doesn't break resuming runs saved
+// before. The options selecting the stacks are not saved, since the resumed
+// run executes the stacks recorded in the journal.
+type resumeOptions struct {
+	Version int `json:"version"`
+
+	ContinueOnError  bool          `json:"continue_on_error,omitempty"`
+	SkipDependents   bool          `json:"skip_dependents,omitempty"`
+	Reverse          bool          `json:"reverse,omitempty"`
+	NoCache          bool          `json:"no_cache,omitempty"`
+	Summary          bool          `json:"summary,omitempty"`
+	Timeout          time.Duration `json:"timeout,omitempty"`
+	RetryMaxAttempts int           `json:"retry_max_attempts,omitempty"`
+	RetryBackoff     time.Duration `json:"retry_backoff,omitempty"`
+	RetryExitCodes   []int         `json:"retry_exit_codes,omitempty"`
+	RetryOutputRegex string        `json:"retry_output_regex,omitempty"`
+	ReportJSON       string        `json:"report_json,omitempty"`
+	ReportJUnit      string        `json:"report_junit,omitempty"`
+	LogDir           string        `json:"log_dir,omitempty"`
+	OutputMode       string        `json:"output_mode,omitempty"`
+	NoProgress       bool          `json:"no_progress,omitempty"`
+	Parallel         int           `json:"parallel,omitempty"`
+	Target           string        `json:"target,omitempty"`
+	FromTarget       string        `json:"from_target,omitempty"`
+
+	// The options below are only given to `terramate run`.
+	EnableSharing     bool          `json:"enable_sharing,omitempty"`
+	MockOnFail        bool          `json:"mock_on_fail,omitempty"`
+	SyncDeployment    bool          `json:"sync_deployment,omitempty"`
+	SyncDriftStatus   bool          `json:"sync_drift_status,omitempty"`
+	SyncPreview       bool          `json:"sync_preview,omitempty"`
+	Layer             preview.Layer `json:"layer,omitempty"`
+	TerraformPlanFile string        `json:"terraform_plan_file,omitempty"`
+	TofuPlanFile      string        `json:"tofu_plan_file,omitempty"`
+	Eval              bool          `json:"eval,omitempty"`
+	Terragrunt        bool          `json:"terragrunt,omitempty"`
+	Matrix            []string      `json:"matrix,omitempty"`
+}
+
+func commonResumeOptions(flags commonRunFlags, target cloudTargetFlags) resumeOptions {
+	return resumeOptions{
+		Version:          resumeOptionsVersion,
+		ContinueOnError:  flags.ContinueOnError,
+		SkipDependents:   flags.SkipDependents,
+		Reverse:          flags.Reverse,
+		NoCache:          flags.NoCache,
+		Summary:          flags.Summary,
+		Timeout:          flags.Timeout,
+		RetryMaxAttempts: flags.RetryMaxAttempts,
+		RetryBackoff:     flags.RetryBackoff,
+		RetryExitCodes:   flags.RetryExitCodes,
+		RetryOutputRegex: flags.RetryOutputRegex,
+		ReportJSON:       flags.ReportJSON,
+		ReportJUnit:      flags.ReportJUnit,
+		LogDir:           flags.LogDir,
+		OutputMode:       flags.OutputMode,
+		NoProgress:       flags.NoProgress,
+		Parallel:         flags.Parallel,
+		Target:           target.Target,
+		FromTarget:       target.FromTarget,
+	}
+}
+
+func (o resumeOptions) applyCommon(flags *commonRunFlags, target *cloudTargetFlags) {
+	flags.ContinueOnError = o.ContinueOnError
+	flags.SkipDependents = o.SkipDependents
+	flags.Reverse = o.Reverse
+	flags.NoCache = o.NoCache
+	flags.Summary = o.Summary
+	flags.Timeout = o.Timeout
+	flags.RetryMaxAttempts = o.RetryMaxAttempts
+	flags.RetryBackoff = o.RetryBackoff
+	flags.RetryExitCodes = o.RetryExitCodes
+	flags.RetryOutputRegex = o.RetryOutputRegex
+	flags.ReportJSON = o.ReportJSON
+	flags.ReportJUnit = o.ReportJUnit
+	flags.LogDir = o.LogDir
+	flags.OutputMode = o.OutputMode
+	flags.NoProgress = o.NoProgress
+	flags.Parallel = o.Parallel
+	target.Target = o.Target
+	target.FromTarget = o.FromTarget
+}
+
+// runResumeOptions returns the resumable options of a `terramate run`.
+func runResumeOptions(flags runCommandFlags) resumeOptions {
+	opts := commonResumeOptions(flags.commonRunFlags, flags.cloudTargetFlags)
+	opts.EnableSharing = flags.EnableSharing
+	opts.MockOnFail = flags.MockOnFail
+	opts.SyncDeployment = flags.SyncDeployment
+	opts.SyncDriftStatus = flags.SyncDriftStatus
+	opts.SyncPreview = flags.SyncPreview
+	opts.Layer = flags.Layer
+	opts.TerraformPlanFile = flags.TerraformPlanFile
+	opts.TofuPlanFile = flags.TofuPlanFile
+	opts.Eval = flags.Eval
+	opts.Terragrunt = flags.Terragrunt
+	opts.Matrix = flags.Matrix
+	return opts
+}
+
+func (o resumeOptions) applyToRun(flags *runCommandFlags) {
+	o.applyCommon(&flags.commonRunFlags, &flags.cloudTargetFlags)
+	flags.EnableSharing = o.EnableSharing
+	flags.MockOnFail = o.MockOnFail
+	flags.SyncDeployment = o.SyncDeployment
+	flags.SyncDriftStatus = o.SyncDriftStatus
+	flags.SyncPreview = o.SyncPreview
+	flags.Layer = o.Layer
+	flags.TerraformPlanFile = o.TerraformPlanFile
+	flags.TofuPlanFile = o.TofuPlanFile
+	flags.Eval = o.Eval
+	flags.Terragrunt = o.Terragrunt
+	flags.Matrix = o.Matrix
+}
+
+// scriptResumeOptions returns the resumable options of a `terramate script run`.
+// The params of the script are saved apart, see Journal.Params.
+func scriptResumeOptions(flags runScriptFlags) resumeOptions {
+	return commonResumeOptions(flags.commonRunFlags, flags.cloudTargetFlags)
+}
+
+func (o resumeOptions) applyToScript(flags *runScriptFlags) {
+	o.applyCommon(&flags.commonRunFlags, &flags.cloudTargetFlags)
+}
+
+// newRunJournal creates the run-state journal for a new run of the given kind.
+// The options are restored by resumeFlags when the run is resumed.
+// The journal is not required by the run, then it returns nil with a warning
+// if it can't be created.
+func (c *cli) newRunJournal(kind string, command []string, opts resumeOptions) *runutil.Journal {
+	journal := runutil.NewJournal(c.rootdir(), kind, command)
+
+	data, err := stdjson.Marshal(opts)
+	if err != nil {
+		printer.Stderr.WarnWithDetails("failed to save the run options, the run cannot be resumed", err)
+		return nil
+	}
+	journal.Options = data
+
+	digest, err := runutil.ConfigDigest(c.rootdir())
+	if err != nil {
+		printer.Stderr.WarnWithDetails("failed to compute the configuration digest, the run cannot be resumed", err)
+		return nil
+	}
+	journal.ConfigDigest = digest
+
+	if c.prj.isRepo && c.prj.hasCommit() {
+		journal.Commit = c.prj.headCommit()
+	}
+	return journal
+}
+
+// loadResumeJournal loads the run-state journal of the previous run and its
+// options, and checks that it can be resumed: the run must be of the same
+// kind, saved by a compatible version, have no redacted sensitive values and
+// neither the commit nor the configuration of the project changed since.
+func (c *cli) loadResumeJournal(kind string) (*runutil.Journal, resumeOptions) {
+	journal, err := runutil.LoadJournal(c.rootdir())
+	if err != nil {
+		if errors.IsKind(err, runutil.ErrJournalNotFound) {
+			fatal("--resume provided but there is no previous run to resume")
+		}
+		fatalWithDetailf(err, "loading run-state journal")
+	}
+
+	if journal.Kind != kind {
+		fatalf("--resume provided but the previous run was a `terramate %s` and cannot be resumed by this command", journal.Kind)
+	}
+
+	var opts resumeOptions
+	if len(journal.Options) > 0 {
+		if err := stdjson.Unmarshal(journal.Options, &opts); err != nil {
+			fatalWithDetailf(errors.E(runutil.ErrState, err), "loading the options of the previous run")
+		}
+	}
+	if opts.Version != resumeOptionsVersion {
+		fatal("cannot resume: the previous run was saved by an incompatible version of Terramate")
+	}
+
+	if journal.Redacted {
+		fatal("cannot resume: the command of the previous run has sensitive values, which are not saved")
+	}
+
+	if journal.Commit != "" && c.prj.isRepo && c.prj.hasCommit() {
+		if head := c.prj.headCommit(); head != journal.Commit {
+			fatalf("cannot resume: HEAD moved from %s to %s since the previous run", journal.Commit, head)
+		}
+	}
+
+	digest, err := runutil.ConfigDigest(c.rootdir())
+	if err != nil {
+		fatalWithDetailf(err, "computing configuration digest")
+	}
+	if digest != journal.ConfigDigest {
+		fatal("cannot resume: the Terramate configuration files changed since the previous run")
+	}
+	return journal, opts
+}
+
+// resumeFlags restores the options of the previous run with the given apply
+// function. The flags explicitly given to the resumed run have precedence.
+func (c *cli) resumeFlags(apply func()) {
+	targets := c.explicitFlagTargets()
+	values := make([]reflect.Value, len(targets))
+	for i, target := range targets {
+		values[i] = reflect.New(target.Type()).Elem()
+		values[i].Set(target)
+	}
+
+	apply()
+
+	for i, target := range targets {
+		target.Set(values[i])
+	}
+}
+
+// explicitFlagTargets returns the targets of the flags given in the command
+// line or by their environment variables.
+func (c *cli) explicitFlagTargets() []reflect.Value {
+	var targets []reflect.Value
+	for _, path := range c.ctx.Path {
+		if path.Flag != nil {
+			targets = append(targets, path.Flag.Target)
+		}
+	}
+	for _, flag := range c.ctx.Flags() {
+		if flag.Env == "" {
+			continue
+		}
+		if _, ok := os.LookupEnv(flag.Env); ok {
+			targets = append(targets, flag.Target)
+		}
+	}
+	return targets
+}
+
+// resumeStacks loads the stacks of the journal that did not complete successfully.
+func (c *cli) resumeStacks(journal *runutil.Journal) config.List[*config.SortableStack] {
+	stacks := c.loadJournalStacks(journal.Incomplete())
+	if len(stacks) == 0 {
+		printer.Stderr.Success("Nothing to resume: all stacks of the previous run completed successfully")
+	}
+	return stacks
+}
+
+// resumeScriptStacks loads all the stacks selected by the script run of the
+// journal, as the root context jobs are given all of them. The stacks that
+// completed successfully are skipped by checking the journal.
+func (c *cli) resumeScriptStacks(journal *runutil.Journal) config.List[*config.SortableStack] {
+	return c.loadJournalStacks(journal.Selected)
+}
+
+func (c *cli) loadJournalStacks(paths []string) config.List[*config.SortableStack] {
+	var stacks config.List[*config.SortableStack]
+	for _, path := range paths {
+		st, found, err := config.TryLoadStack(c.cfg(), prj.NewPath(path))
+		if err != nil {
+			fatalWithDetailf(err, "loading stack %s of the previous run", path)
+		}
+		if !found {
+			fatalf("cannot resume: stack %s of the previous run not found", path)
+		}
+		stacks = append(stacks, st.Sortable())
+	}
+	return stacks
+}
@@ -0,0 +1,839 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	stdfmt "fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/terramate-io/terramate/cloud"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/hcl/ast"
+	prj "github.com/terramate-io/terramate/project"
+	runutil "github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/run/dag"
+	"github.com/terramate-io/terramate/scheduler/resource"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/json"
+)
+
+// stackOutputs maps the stacks to the outputs of their sharing backends.
+type stackOutputs map[prj.Path]map[string]cty.Value
+
+// stackRunner executes the stack runs of runAll. It holds the options and
+// the state of the whole run, shared by all its stacks.
+type stackRunner struct {
+	c    *cli
+	opts runAllOptions
+
+	// cancelCtx is done when the pending runs are skipped, killCtx when the
+	// running processes are killed and timeoutCtx when the whole run times
+	// out.
+	cancelCtx  context.Context
+	cancel     context.CancelFunc
+	killCtx    context.Context
+	timeoutCtx context.Context
+
+	// interrupted tells if the run was canceled by an interruption signal.
+	interrupted *atomic.Bool
+
+	gracePeriod     time.Duration
+	printPrefix     string
+	continueOnError bool
+
+	// acquireResource and releaseResource limit the number of commands
+	// running in parallel. The stacks of the same concurrency group in
+	// stackGroups run one at a time.
+	acquireResource func(dag.ID)
+	releaseResource func()
+	stackGroups     map[prj.Path]resource.Multi
+
+	stackEnvs    map[prj.Path]runutil.EnvVars
+	variantEnvs  map[prj.Path]map[string]runutil.EnvVars
+	stackHooks   map[prj.Path]runutil.Hooks
+	stackMaskers map[prj.Path]*runutil.Masker
+	rootEnv      runutil.EnvVars
+	rootMasker   *runutil.Masker
+
+	durations *runutil.Durations
+	cache     *runutil.Cache
+
+	allOutputs stackOutputs
+	failures   *upstreamFailures
+
+	summary       *runSummary
+	positions     map[dag.ID]*dagPosition
+	rootPositions map[string]*dagPosition
+	progress      *runProgress
+	outputs       *runOutput
+}
+
+// stackExecution is the execution of a single stack run.
+// Its state is shared by the concurrent jobs of the stack.
+type stackExecution struct {
+	r   *stackRunner
+	run stackRun
+
+	// root tells if the run executes the root context jobs, which have no
+	// hooks, get the env of the root of the project and are not shown in
+	// the progress view.
+	root     bool
+	pos      *dagPosition
+	hooks    runutil.Hooks
+	masker   *runutil.Masker
+	progress *runProgress
+	out      *stackOutput
+
+	// upstreamChain is the chain of failed and skipped stacks leading to
+	// this stack, if it must be skipped.
+	upstreamChain []string
+
+	// cached is true if the inputs of the stack didn't change since the
+	// last successful execution of the same commands.
+	cached bool
+
+	errs        *syncErrors
+	hookReports []runutil.HookReport
+
+	// The before_run hook runs once, before the first executed task.
+	beforeRunOnce sync.Once
+	beforeRunErr  error
+
+	// mu guards the state below, shared by the concurrent jobs.
+	mu              sync.Mutex
+	results         []taskResult
+	failedTaskIndex int
+	canceled        bool
+	stackTimedOut   time.Duration
+	exitCode        int
+	startedAt       time.Time
+}
+
+// runStack executes the tasks of the given stack run, then its on_failure
+// and finally script jobs and its after_run or on_failure hooks. The outcome
+// of the stack is added to the summary of the run.
+func (r *stackRunner) runStack(run stackRun) error {
+	e := r.newStackExecution(run)
+
+	// Stacks synchronized to Terramate Cloud are always executed, since their
+	// deployment, drift or preview must be reported.
+	if r.cache != nil && e.upstreamChain == nil && !e.root && !run.cloudSynced() {
+		e.cached = r.c.stackCached(r.cache, run, stackCacheEnv(run, r.stackEnvs, r.variantEnvs), e.out.Printer)
+		if e.cached && !r.opts.Quiet {
+			e.out.Printer.Println(r.printPrefix + " Skipping stack in " + run.Stack.String() +
+				": inputs unchanged since the last successful run")
+		}
+	}
+
+	// If the run is canceled while waiting for the concurrency groups,
+	// the tasks below are skipped.
+	if groups, ok := r.stackGroups[run.Stack.Dir]; ok && !e.root && e.upstreamChain == nil && !e.cached && groups.Acquire(r.cancelCtx) {
+		defer groups.Release()
+	}
+
+	jobs := run.jobs()
+	concurrent := concurrentJobs(jobs)
+	execJob := func(job taskJob) bool {
+		jobOut := e.out
+		if concurrent {
+			jobOut = e.out.forJob(e.run.Tasks[job.first].jobName())
+			defer jobOut.Flush("")
+		}
+		// Jobs running concurrently would compete for the input, so
+		// they get none.
+		stdin := r.c.stdin
+		if !job.alone {
+			stdin = nil
+		}
+		for taskIndex := job.first; taskIndex <= job.last; taskIndex++ {
+			if !e.execTask(taskIndex, e.run.Tasks[taskIndex], jobOut, stdin) {
+				return false
+			}
+		}
+		return true
+	}
+	runJobs(jobs, r.continueOnError, execJob)
+
+	// The on_failure and finally jobs of the script are executed after
+	// the other jobs of each started matrix variant, one after another.
+	mainTasks := len(e.run.Tasks)
+	if e.run.Script != nil && e.upstreamChain == nil && !e.cached && r.killCtx.Err() == nil {
+		for _, group := range e.run.taskGroups() {
+			result, started := scriptResult(e.run, group, e.results)
+			if !started && !r.opts.DryRun {
+				continue
+			}
+			tasks, err := r.c.scriptResultTasks(e.run, e.run.Tasks[group.first], result)
+			if err != nil {
+				e.errs.Append(err)
+				continue
+			}
+			first := len(e.run.Tasks)
+			e.run.Tasks = append(e.run.Tasks, tasks...)
+			for range tasks {
+				e.results = append(e.results, taskResult{exitCode: -1})
+			}
+			resultJobs := taskGroupJobs(e.run.Tasks, first)
+			jobs = append(jobs, resultJobs...)
+			for _, job := range resultJobs {
+				execJob(job)
+			}
+		}
+	}
+
+	// The after_run and on_failure hooks are not executed for skipped,
+	// cached and canceled stacks, nor if the run was killed.
+	if e.upstreamChain == nil && !e.cached && !e.canceled && r.killCtx.Err() == nil &&
+		len(e.hooks.AfterRun)+len(e.hooks.OnFailure) > 0 {
+		r.acquireResource(dag.ID(run.Stack.Dir.String()))
+		if e.errs.AsError() == nil && e.stackTimedOut == 0 {
+			if err := e.runHook(runutil.HookAfterRun); err != nil {
+				e.errs.Append(err)
+				if !r.continueOnError {
+					r.cancel()
+				}
+			}
+		}
+		failed := e.errs.AsError() != nil || e.stackTimedOut > 0
+		if failed && r.killCtx.Err() == nil && !errors.IsKind(e.errs.AsError(), ErrRunCanceled) {
+			e.errs.Append(e.runHook(runutil.HookOnFailure))
+		}
+		r.releaseResource()
+	}
+
+	if e.failedTaskIndex != -1 && run.SyncTaskIndex != -1 && e.failedTaskIndex < run.SyncTaskIndex {
+		cloudTask := e.run.Tasks[run.SyncTaskIndex]
+		cloudTask.Cmd = e.masker.MaskArgs(cloudTask.Cmd)
+		cloudRun := stackCloudRun{
+			Stack: run.Stack,
+			Task:  cloudTask,
+		}
+		// A timeout of the failed task is synchronized as the reason
+		// of the failure.
+		var syncErr error = errors.E(ErrRunFailed)
+		if failedErr := e.results[e.failedTaskIndex].err; errors.IsKind(failedErr, ErrRunTimeout) {
+			syncErr = failedErr
+		}
+		r.c.cloudSyncAfter(cloudRun, runResult{ExitCode: 1}, syncErr)
+	}
+
+	err := e.errs.AsError()
+	stackReport := e.report(err, jobs, mainTasks, concurrent)
+	status := stackReport.Status
+	r.summary.add(stackReport)
+	e.progress.finish(stackReport.Path, status)
+
+	if r.durations != nil && !e.root && status == runutil.StackOK && stackReport.StartedAt != nil {
+		r.durations.Update(e.run.Cmds(), stackReport.Path, stackReport.FinishedAt.Sub(*stackReport.StartedAt))
+	}
+
+	// The inputs are hashed again after the execution, as the commands
+	// may change the files of the stack.
+	if r.cache != nil && !e.root && status == runutil.StackOK {
+		r.c.storeStackCache(r.cache, e.run, stackCacheEnv(e.run, r.stackEnvs, r.variantEnvs), e.out.Printer)
+	}
+
+	switch {
+	case e.root:
+	case status == runutil.StackFailed || status == runutil.StackTimedOut:
+		r.failures.add(stackReport.Path, nil)
+	case status == runutil.StackSkipped:
+		r.failures.add(stackReport.Path, e.upstreamChain)
+	}
+
+	if r.opts.Journal != nil {
+		setStatus, key := r.opts.Journal.SetStatus, run.Stack.Dir.String()
+		if e.root {
+			setStatus, key = r.opts.Journal.SetRootStatus, run.Root
+		}
+		if err := setStatus(key, status); err != nil {
+			e.out.Printer.WarnWithDetails("failed to update the run-state journal", err)
+		}
+	}
+
+	e.out.Flush(stdfmt.Sprintf("%s: %s", stackReport.Name(), statusDescription(status)))
+	return err
+}
+
+func (r *stackRunner) newStackExecution(run stackRun) *stackExecution {
+	e := &stackExecution{
+		r:               r,
+		run:             run,
+		root:            run.Root != "",
+		pos:             r.positions[dag.ID(run.Stack.Dir.String())],
+		hooks:           r.stackHooks[run.Stack.Dir],
+		masker:          r.stackMaskers[run.Stack.Dir],
+		progress:        r.progress,
+		errs:            &syncErrors{errs: errors.L()},
+		results:         make([]taskResult, len(run.Tasks)),
+		failedTaskIndex: -1,
+		exitCode:        -1,
+	}
+	for i := range e.results {
+		e.results[i].exitCode = -1
+	}
+	if e.root {
+		e.pos = r.rootPositions[run.Root]
+		e.hooks = runutil.Hooks{}
+		e.masker = r.rootMasker
+		e.progress = nil
+	}
+	e.out = r.outputs.forStack(run.Stack, max(e.pos.order-1, 0))
+	if r.opts.SkipDependents {
+		e.upstreamChain = r.failures.chainOf(e.pos.after)
+	}
+	return e
+}
+
+// runHook runs the commands of the given hook of the stack, if any.
+func (e *stackExecution) runHook(name string) error {
+	cmds := e.hooks.Commands(name)
+	if len(cmds) == 0 {
+		return nil
+	}
+	r := e.r
+	environ := newEnvironFrom(r.stackEnvs[e.run.Stack.Dir])
+	report, err := r.c.runHook(r.killCtx, name, cmds, e.run.Stack, environ, e.out, e.masker,
+		r.opts, r.gracePeriod, r.printPrefix)
+	e.hookReports = append(e.hookReports, report)
+	return err
+}
+
+// fail records the failure of the given task. An empty reason is given by
+// the exit code of its command.
+func (e *stackExecution) fail(taskIndex int, status runutil.StackStatus, reason string, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.failedTaskIndex == -1 {
+		e.failedTaskIndex = taskIndex
+	}
+	res := &e.results[taskIndex]
+	if reason == "" {
+		reason = failureReason(res.exitCode, res.attempts)
+	}
+	res.status = status
+	res.reason = reason
+	res.err = err
+	res.finishedAt = time.Now().UTC()
+	if status == runutil.StackTimedOut {
+		e.stackTimedOut = res.timedOut
+	}
+}
+
+func (e *stackExecution) setExitCode(taskIndex, code int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// The exit code of a failed script is kept by its on_failure and
+	// finally jobs.
+	if e.run.Tasks[taskIndex].ScriptJobKind == "" || e.failedTaskIndex == -1 {
+		e.exitCode = code
+	}
+	e.results[taskIndex].exitCode = code
+}
+
+// execTask executes the given task of the stack and tells if the following
+// tasks of its job must be executed.
+func (e *stackExecution) execTask(taskIndex int, task stackRunTask, out *stackOutput, stdin io.Reader) bool {
+	r, c, opts, run := e.r, e.r.c, e.r.opts, e.run
+
+	if task.Skipped {
+		if !opts.Quiet && e.upstreamChain == nil && !e.cached {
+			printScriptJobSkipped(out.Stderr, run.Stack.Dir, task)
+		}
+		e.results[taskIndex].status = runutil.StackSkipped
+		e.results[taskIndex].reason = "condition is false"
+		return true
+	}
+
+	r.acquireResource(dag.ID(run.Stack.Dir.String()))
+
+	// For cloud sync, we always assume that there's a single task per stack.
+	// The command synchronized to Terramate Cloud has the sensitive
+	// values redacted.
+	cloudTask := task
+	cloudTask.Cmd = e.masker.MaskArgs(task.Cmd)
+	cloudRun := stackCloudRun{Stack: run.Stack, Task: cloudTask}
+
+	// failTask records the failure of the task with the given status
+	// and releases the resources of the stack. An empty reason is
+	// given by the exit code of the command. Unless the run continues
+	// on errors, the pending stacks are canceled.
+	failTask := func(status runutil.StackStatus, reason string, err error) bool {
+		e.errs.Append(err)
+		r.releaseResource()
+		e.fail(taskIndex, status, reason, err)
+		if !r.continueOnError {
+			r.cancel()
+		}
+		return false
+	}
+
+	// notExecuted fails the task whose command could not be executed.
+	notExecuted := func(err error) bool {
+		c.cloudSyncAfter(cloudRun, runResult{ExitCode: -1}, errors.E(ErrRunCommandNotExecuted, err))
+		return failTask(runutil.StackFailed, "", err)
+	}
+
+	if e.cached {
+		r.releaseResource()
+		return true
+	}
+	if e.upstreamChain != nil {
+		c.cloudSyncAfter(cloudRun, runResult{ExitCode: -1}, errors.E(ErrRunCanceled))
+		r.releaseResource()
+		return true
+	}
+
+	// The on_failure and finally jobs of scripts are executed even if
+	// the run was canceled.
+	select {
+	case <-r.cancelCtx.Done():
+		if task.ScriptJobKind != "" {
+			break
+		}
+		c.cloudSyncAfter(cloudRun, runResult{ExitCode: -1}, errors.E(ErrRunCanceled))
+		r.releaseResource()
+		e.mu.Lock()
+		e.canceled = true
+		e.mu.Unlock()
+		e.results[taskIndex].status = runutil.StackCanceled
+		return true
+	default:
+	}
+
+	e.progress.start(run.Stack.Dir.String())
+
+	if !opts.Quiet && !opts.ScriptRun {
+		out.Printer.Println(r.printPrefix + " Entering stack in " + run.Stack.String() + variantSuffix(task.Matrix))
+	}
+
+	ranBeforeRun := false
+	e.beforeRunOnce.Do(func() {
+		ranBeforeRun = true
+		e.beforeRunErr = e.runHook(runutil.HookBeforeRun)
+	})
+	if e.beforeRunErr != nil {
+		// The failure of the hook is only recorded by the task that
+		// executed it.
+		if !ranBeforeRun {
+			c.cloudSyncAfter(cloudRun, runResult{ExitCode: -1}, errors.E(ErrRunCommandNotExecuted, e.beforeRunErr))
+			r.releaseResource()
+			return false
+		}
+		return notExecuted(e.beforeRunErr)
+	}
+
+	if !opts.Quiet && opts.ScriptRun {
+		printScriptCommand(out.Stderr, run.Stack.Dir, task, e.masker)
+	}
+
+	logger := log.With().
+		Stringer("stack", run.Stack).
+		Bool("enable_sharing", task.EnableSharing).
+		Bool("mock_on_fail", task.MockOnFail).
+		Logger()
+
+	env := taskEnv(run, task, r.stackEnvs, r.variantEnvs)
+	if e.root {
+		env = r.rootEnv
+	}
+	environ := withTaskEnv(newEnvironFrom(env), task)
+	if task.EnableSharing {
+		inputsEnv, err := e.sharingInputsEnv(task, out, &logger)
+		if err != nil {
+			return notExecuted(err)
+		}
+		environ = append(environ, inputsEnv...)
+	}
+
+	cloudRun.Env = environ
+
+	cmdStr := strings.Join(cloudTask.Cmd, " ")
+	logger = logger.With().
+		Str("cmd", cmdStr).
+		Logger()
+
+	cmdPath, err := runutil.LookPath(task.Cmd[0], environ)
+	if err != nil {
+		return notExecuted(errors.E(err, "running `%s` in stack %s", cmdStr, run.Stack.Dir))
+	}
+
+	cmd := exec.Command(cmdPath, task.Cmd[1:]...)
+	cmd.Dir = run.Stack.HostDir(c.cfg())
+	cmd.Env = environ
+
+	stdout := out.Stdout
+	stderr := out.Stderr
+
+	logSyncWait := func() {}
+	if c.cloudEnabled() && (task.CloudSyncDeployment || task.CloudSyncPreview) {
+		logSyncer := cloud.NewLogSyncer(func(logs cloud.CommandLogs) {
+			c.syncLogs(&logger, run, logs)
+		})
+		stdout = logSyncer.NewBuffer(cloud.StdoutLogChannel, out.Stdout)
+		stderr = logSyncer.NewBuffer(cloud.StderrLogChannel, out.Stderr)
+
+		logSyncWait = logSyncer.Wait
+	}
+
+	// The messages about the retries are not part of the output of
+	// the attempts, written to the log files and the reports.
+	retryOut := stderr
+
+	// The files of --log-dir get the output as written by the
+	// command.
+	var logFiles *commandLogFiles
+	if opts.LogDir != "" && !opts.DryRun {
+		logFiles, err = createCommandLogs(opts.LogDir, run, task, opts.ScriptRun)
+		if err != nil {
+			out.Printer.WarnWithDetails("failed to create the log files of the command", err)
+			logFiles = nil
+		} else {
+			stdout = io.MultiWriter(stdout, logFiles.Stdout())
+			stderr = io.MultiWriter(stderr, logFiles.Stderr())
+
+			syncWait := logSyncWait
+			logSyncWait = func() {
+				syncWait()
+				if err := logFiles.Close(); err != nil {
+					out.Printer.WarnWithDetails("failed to write the log files of the command", err)
+				}
+			}
+		}
+	}
+
+	// Sensitive values are redacted before the output reaches the
+	// terminal, the Terramate Cloud logs and the log files.
+	flushMasked := func() {}
+	if e.masker != nil {
+		maskedStdout := e.masker.Writer(stdout)
+		maskedStderr := e.masker.Writer(stderr)
+		stdout, stderr = maskedStdout, maskedStderr
+
+		flushMasked = func() {
+			_ = maskedStdout.Flush()
+			_ = maskedStderr.Flush()
+		}
+		syncWait := logSyncWait
+		logSyncWait = func() {
+			flushMasked()
+			syncWait()
+		}
+	}
+
+	// output captures the end of the output of each attempt of
+	// commands retried on matching output. It's captured before the
+	// sensitive values are redacted, then the retry output regex
+	// matches the actual output of the command.
+	output := &attemptOutput{}
+	if task.Retry != nil && task.Retry.OutputRegex != nil {
+		stdout = io.MultiWriter(stdout, output)
+		stderr = io.MultiWriter(stderr, output)
+	}
+
+	var attemptStart time.Time
+	recordAttempt := func(attempt, exitCode int, finishedAt time.Time) {
+		e.results[taskIndex].attempts = attempt
+		if task.Retry == nil {
+			return
+		}
+		flushMasked()
+		report := runutil.AttemptReport{
+			Cmd:        cloudTask.Cmd,
+			Attempt:    attempt,
+			StartedAt:  attemptStart,
+			FinishedAt: finishedAt,
+			Duration:   finishedAt.Sub(attemptStart).Seconds(),
+		}
+		if exitCode != -1 {
+			report.ExitCode = &exitCode
+		}
+		if logFiles != nil {
+			report.StdoutLog, report.StderrLog = logFiles.Paths()
+		}
+		e.results[taskIndex].attemptReports = append(e.results[taskIndex].attemptReports, report)
+	}
+
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	c.cloudSyncBefore(cloudRun)
+
+	if !opts.Quiet && !opts.ScriptRun {
+		out.Printer.Println(r.printPrefix + " Executing command " + strconv.Quote(cmdStr))
+	}
+
+	if opts.DryRun {
+		r.releaseResource()
+		return true
+	}
+
+	startTime := time.Now().UTC()
+	e.mu.Lock()
+	if e.startedAt.IsZero() {
+		e.startedAt = startTime
+	}
+	e.mu.Unlock()
+	e.results[taskIndex].startedAt = startTime
+
+	attempts := &commandAttempts{
+		task:        task,
+		stackDir:    run.Stack.Dir,
+		desc:        strings.Join(e.masker.MaskArgs(append([]string{cmdPath}, task.Cmd[1:]...)), " "),
+		logger:      &logger,
+		killCtx:     r.killCtx,
+		cancelCtx:   r.cancelCtx,
+		timeoutCtx:  r.timeoutCtx,
+		runTimeout:  opts.Timeout,
+		gracePeriod: r.gracePeriod,
+		printPrefix: r.printPrefix,
+		stderr:      stderr,
+		retryOut:    retryOut,
+		output:      output,
+		started: func() {
+			attemptStart = time.Now().UTC()
+		},
+		finished: recordAttempt,
+		retrying: func(attempt int) {
+			flushMasked()
+			if logFiles != nil {
+				if err := logFiles.NextAttempt(attempt); err != nil {
+					out.Printer.WarnWithDetails("failed to write the log files of the command", err)
+				}
+			}
+		},
+		releaseSlot: r.releaseResource,
+		acquireSlot: func() {
+			r.acquireResource(dag.ID(run.Stack.Dir.String()))
+		},
+	}
+	result := attempts.run(cmd)
+	if result.exited {
+		e.setExitCode(taskIndex, result.exitCode)
+	}
+	logSyncWait()
+
+	res := runResult{
+		ExitCode:   result.exitCode,
+		StartedAt:  &startTime,
+		FinishedAt: &result.finishedAt,
+	}
+
+	switch {
+	case result.killed:
+		c.cloudSyncAfter(cloudRun, res, errors.E(ErrRunCanceled))
+		return failTask(runutil.StackCanceled, "interrupted", result.err)
+
+	case result.timedOut > 0:
+		e.results[taskIndex].timedOut = result.timedOut
+		c.cloudSyncAfter(cloudRun, res, result.err)
+		return failTask(runutil.StackTimedOut, stdfmt.Sprintf("after %s", result.timedOut), result.err)
+
+	case !result.exited:
+		c.cloudSyncAfter(cloudRun, res, errors.E(result.err, ErrRunFailed))
+		return failTask(runutil.StackFailed, "", result.err)
+	}
+
+	logger.Debug().
+		Int("exit_code", res.ExitCode).
+		Time("started_at", *res.StartedAt).
+		Time("finished_at", *res.FinishedAt).
+		TimeDiff("duration", *res.FinishedAt, *res.StartedAt).
+		Msg("command execution finished")
+
+	c.cloudSyncAfter(cloudRun, res, result.err)
+	if result.err != nil {
+		return failTask(runutil.StackFailed, "", result.err)
+	}
+	r.releaseResource()
+	e.results[taskIndex].status = runutil.StackOK
+	e.results[taskIndex].finishedAt = result.finishedAt
+	return true
+}
+
+// sharingInputsEnv returns the TF_VAR_ environment variables of the inputs
+// of the stack, evaluated from the outputs of the sharing backends of other
+// stacks.
+func (e *stackExecution) sharingInputsEnv(task stackRunTask, out *stackOutput, logger *zerolog.Logger) ([]string, error) {
+	c, run, allOutputs := e.r.c, e.run, e.r.allOutputs
+
+	var environ []string
+	cfg, _ := c.cfg().Lookup(run.Stack.Dir)
+	for _, in := range cfg.Node.Inputs {
+		evalctx := c.setupEvalContext(run.Stack, map[string]string{})
+		input, err := config.EvalInput(evalctx, in)
+		if err != nil {
+			return nil, errors.E(err, "failed to evaluate input block")
+		}
+		otherStack, found, err := c.stackManager().StackByID(input.FromStackID)
+		if err != nil {
+			return nil, errors.E(err, "populating stack inputs from stack.id %s", input.FromStackID)
+		}
+		if !found {
+			return nil, errors.E(
+				"Stack %s needs output from stack ID %q but it cannot be found",
+				run.Stack.Dir,
+				input.FromStackID)
+		}
+
+		logger.Debug().Msgf("Stack depends on outputs from stack %s", otherStack.Dir)
+
+		backend, ok := cfg.SharingBackend(input.Backend)
+		if !ok {
+			return nil, errors.E("backend %s not found", input.Backend)
+		}
+		_, ok = allOutputs[otherStack.Dir]
+		if !ok {
+			allOutputs[otherStack.Dir] = make(map[string]cty.Value)
+		}
+		_, ok = allOutputs[otherStack.Dir][backend.Name]
+		if !ok {
+			var stdout bytes.Buffer
+			var stderr bytes.Buffer
+			cmd := exec.Command(backend.Command[0], backend.Command[1:]...)
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+			cmd.Dir = otherStack.HostDir(c.cfg())
+			var inputVal cty.Value
+			err := cmd.Run()
+			if err != nil {
+				if !task.MockOnFail {
+					return nil, errors.E(err, "failed to execute: (cmd: %s) (stdout: %s) (stderr: %s)", cmd.String(), stdout.String(), stderr.String())
+				}
+
+				out.Printer.WarnWithDetails(
+					"failed to execute `sharing_backend` command",
+					errors.E(err, "(cmd: %s) (stdout: %s) (stderr: %s)", cmd.String(), stdout.String(), stderr.String()),
+				)
+			} else {
+				stdoutBytes := stdout.Bytes()
+				typ, err := json.ImpliedType(stdoutBytes)
+				if err != nil {
+					return nil, errors.E(err, "unmashaling sharing_backend output")
+				}
+				inputVal, err = json.Unmarshal(stdoutBytes, typ)
+				if err != nil {
+					return nil, errors.E(err, "unmashaling sharing_backend output")
+				}
+			}
+			allOutputs[otherStack.Dir][backend.Name] = inputVal
+		}
+		evalctx.SetNamespaceRaw("outputs", allOutputs[otherStack.Dir][backend.Name])
+		inputVal, inputErr := input.Value(evalctx)
+		mockVal, mockFound, mockErr := input.Mock(evalctx)
+
+		if inputErr != nil {
+			if !task.MockOnFail || !mockFound || mockErr != nil {
+				if mockErr != nil {
+					e.errs.Append(errors.E(mockErr, "failed to evaluate input mock"))
+				}
+				return nil, errors.E(inputErr, "evaluating input value")
+			}
+
+			inputVal = mockVal
+		}
+		environ = append(environ, stdfmt.Sprintf("TF_VAR_%s=%s", input.Name, string(ast.TokensForValue(inputVal).Bytes())))
+	}
+	return environ, nil
+}
+
+// report returns the report of the executed stack, given the error of its
+// execution, its jobs and the number of tasks before the on_failure and
+// finally jobs of its script.
+func (e *stackExecution) report(err error, jobs []taskJob, mainTasks int, concurrent bool) runutil.StackReport {
+	r, run := e.r, e.run
+
+	stackReport := runutil.StackReport{
+		Path:  run.Stack.Dir.String(),
+		ID:    run.Stack.ID,
+		Root:  run.Root,
+		Order: e.pos.order,
+		After: e.pos.after,
+		Hooks: e.hookReports,
+		Cmds:  maskCmds(e.masker, run.Cmds()),
+	}
+	if !e.startedAt.IsZero() {
+		stackReport.SetTimes(e.startedAt, time.Now().UTC())
+	}
+	if e.exitCode != -1 {
+		exitCode := e.exitCode
+		stackReport.ExitCode = &exitCode
+	}
+
+	status := runutil.StackOK
+	reason := ""
+	switch {
+	case e.upstreamChain != nil:
+		status = runutil.StackSkipped
+		reason = "upstream failed: " + strings.Join(e.upstreamChain, " -> ")
+	case e.cached:
+		status = runutil.StackCached
+		reason = "inputs unchanged"
+	case e.stackTimedOut > 0:
+		status = runutil.StackTimedOut
+		reason = stdfmt.Sprintf("after %s", e.stackTimedOut)
+	case e.canceled || errors.IsKind(err, ErrRunCanceled):
+		status = runutil.StackCanceled
+		switch {
+		case r.timeoutCtx.Err() == context.DeadlineExceeded:
+			reason = "run timed out"
+		case r.interrupted.Load():
+			reason = "interrupted"
+		default:
+			reason = "a previous stack failed"
+		}
+	case err != nil:
+		status = runutil.StackFailed
+		if e.failedTaskIndex != -1 {
+			reason = e.results[e.failedTaskIndex].reason
+		}
+	}
+	// The failure of concurrent jobs is attributed to the job.
+	if concurrent && e.failedTaskIndex != -1 && (status == runutil.StackFailed || status == runutil.StackTimedOut) {
+		jobName := run.Tasks[e.failedTaskIndex].jobName()
+		if reason != "" {
+			reason = jobName + ": " + reason
+		} else {
+			reason = jobName + " failed"
+		}
+	}
+	for _, hook := range e.hookReports {
+		if hook.Status != runutil.StackFailed {
+			continue
+		}
+		if hook.Name == runutil.HookOnFailure && reason != "" {
+			reason += ", " + hook.Reason()
+		} else {
+			reason = hook.Reason()
+		}
+	}
+	stackReport.Status = status
+	stackReport.Reason = reason
+	// The variants are reported by their jobs, failures of the on_failure
+	// and finally jobs are reported like failures after the tasks.
+	mainRun := run
+	mainRun.Tasks = run.Tasks[:mainTasks]
+	stackReport.Variants = variantReports(mainRun, stackReport, e.results[:mainTasks])
+	if r.opts.ScriptRun {
+		stackReport.Jobs = jobReports(run, jobs, stackReport, e.results)
+	}
+	for _, res := range e.results {
+		stackReport.Attempts = append(stackReport.Attempts, res.attemptReports...)
+	}
+	return stackReport
+}
@@ -0,0 +1,193 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	stdfmt "fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/printer"
+	runutil "github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/run/dag"
+)
+
+// runSummary collects the outcome of each stack of a run.
+// It's safe to be used concurrently.
+type runSummary struct {
+	mu     sync.Mutex
+	report runutil.Report
+}
+
+func newRunSummary(kind string) *runSummary {
+	return &runSummary{
+		report: runutil.Report{
+			Kind:      kind,
+			StartedAt: time.Now().UTC(),
+		},
+	}
+}
+
+func (s *runSummary) add(st runutil.StackReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.report.Stacks = append(s.report.Stacks, st)
+}
+
+// save writes the machine-readable reports of the run to the given files.
+// Empty file names are ignored.
+func (s *runSummary) save(jsonFile, junitFile string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.report.Finish(time.Now().UTC())
+
+	errs := errors.L()
+	if jsonFile != "" {
+		errs.Append(s.report.SaveJSON(jsonFile))
+	}
+	if junitFile != "" {
+		errs.Append(s.report.SaveJUnit(junitFile))
+	}
+	return errs.AsError()
+}
+
+// print writes the summary to stderr, if any of the stacks did not succeed.
+// The matrix variants of the stacks are counted and listed separately.
+func (s *runSummary) print() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type entry struct {
+		name   string
+		status runutil.StackStatus
+		reason string
+	}
+	var entries []entry
+	for _, st := range s.report.Stacks {
+		if len(st.Variants) == 0 {
+			entries = append(entries, entry{st.Name(), st.Status, st.Reason})
+			continue
+		}
+		for _, variant := range st.Variants {
+			entries = append(entries, entry{st.Name() + " [" + variant.Name + "]", variant.Status, variant.Reason})
+		}
+	}
+
+	counts := map[runutil.StackStatus]int{}
+	for _, e := range entries {
+		counts[e.status]++
+	}
+	if counts[runutil.StackOK] == len(entries) {
+		return
+	}
+
+	var totals []string
+	for _, status := range []runutil.StackStatus{
+		runutil.StackOK,
+		runutil.StackFailed,
+		runutil.StackTimedOut,
+		runutil.StackCanceled,
+		runutil.StackSkipped,
+		runutil.StackCached,
+	} {
+		if counts[status] > 0 {
+			totals = append(totals, stdfmt.Sprintf("%d %s", counts[status], statusDescription(status)))
+		}
+	}
+
+	printer.Stderr.Println("Run summary: " + strings.Join(totals, ", "))
+	for _, e := range entries {
+		if e.status == runutil.StackOK {
+			continue
+		}
+		line := stdfmt.Sprintf("  %s: %s", e.name, statusDescription(e.status))
+		if e.reason != "" {
+			line += " (" + e.reason + ")"
+		}
+		printer.Stderr.Println(line)
+	}
+}
+
+func statusDescription(status runutil.StackStatus) string {
+	switch status {
+	case runutil.StackOK:
+		return "succeeded"
+	case runutil.StackTimedOut:
+		return "timed out"
+	default:
+		return string(status)
+	}
+}
+
+// dagPosition is the position of a stack in the execution DAG.
+type dagPosition struct {
+	order int
+	after []string
+}
+
+// dagPositions computes the position of each node of the DAG, following the
+// execution order of the scheduler.
+func dagPositions[V any](d *dag.DAG[V], reverse bool) map[dag.ID]*dagPosition {
+	order := d.Order()
+	if reverse {
+		slices.Reverse(order)
+	}
+
+	positions := make(map[dag.ID]*dagPosition, len(order))
+	for i, id := range order {
+		positions[id] = &dagPosition{order: i + 1}
+	}
+	for _, id := range order {
+		for _, ancestor := range d.AncestorsOf(id) {
+			if reverse {
+				positions[ancestor].after = append(positions[ancestor].after, string(id))
+			} else {
+				positions[id].after = append(positions[id].after, string(ancestor))
+			}
+		}
+	}
+	for _, pos := range positions {
+		slices.Sort(pos.after)
+	}
+	return positions
+}
+
+// upstreamFailures tracks the failed and skipped stacks of a run, so the
+// stacks ordered after them can be skipped.
+// It's safe to be used concurrently.
+type upstreamFailures struct {
+	mu sync.Mutex
+
+	// chains maps each failed or skipped stack to the chain of stacks leading
+	// to it, starting with the stack that failed.
+	chains map[string][]string
+}
+
+// add records the failure of the given stack. The upstream chain is the
+// chain of the upstream failure the stack was skipped for, if any.
+func (f *upstreamFailures) add(stack string, upstream []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.chains[stack] = append(append([]string{}, upstream...), stack)
+}
+
+// chainOf returns the chain of the first failed or skipped stack among the
+// given upstream stacks, or nil if none of them failed.
+func (f *upstreamFailures) chainOf(upstream []string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, stack := range upstream {
+		if chain, ok := f.chains[stack]; ok {
+			return chain
+		}
+	}
+	return nil
+}
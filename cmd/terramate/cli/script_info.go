@@ -56,27 +56,50 @@ func (c *cli) printScriptInfo() {
 			c.output.MsgStdOut("Stacks: (none)")
 		}
 
-		c.output.MsgStdOut("Jobs:")
-		for _, job := range x.ScriptCfg.Jobs {
-			for cmdIdx, cmd := range formatScriptJob(job) {
-				if cmdIdx == 0 {
-					if job.Name != nil {
-						c.output.MsgStdOut("  Name: %s", nameTruncation(exprString(job.Name.Expr), "script.job.name"))
-					}
-					if job.Description != nil {
-						c.output.MsgStdOut("  Description: %s", descTruncation(exprString(job.Description.Expr), "script.job.description"))
-					}
-					c.output.MsgStdOut("  * %v", cmd)
-				} else {
-					c.output.MsgStdOut("    %v", cmd)
-				}
+		if len(x.ScriptCfg.Params) > 0 {
+			c.output.MsgStdOut("Parameters:")
+			for _, param := range x.ScriptCfg.Params {
+				c.output.MsgStdOut("  * %s", formatScriptParam(param))
 			}
 		}
 
+		c.output.MsgStdOut("Jobs:")
+		c.printScriptJobs(x.ScriptCfg.Jobs)
+
+		if len(x.ScriptCfg.OnFailure) > 0 {
+			c.output.MsgStdOut("On failure:")
+			c.printScriptJobs(x.ScriptCfg.OnFailure)
+		}
+		if len(x.ScriptCfg.Finally) > 0 {
+			c.output.MsgStdOut("Finally:")
+			c.printScriptJobs(x.ScriptCfg.Finally)
+		}
+
 		c.output.MsgStdOut("")
 	}
 }
 
+func (c *cli) printScriptJobs(jobs []*hcl.ScriptJob) {
+	for _, job := range jobs {
+		for cmdIdx, cmd := range formatScriptJob(job) {
+			if cmdIdx == 0 {
+				if job.Name != nil {
+					c.output.MsgStdOut("  Name: %s", nameTruncation(exprString(job.Name.Expr), "script.job.name"))
+				}
+				if job.Description != nil {
+					c.output.MsgStdOut("  Description: %s", descTruncation(exprString(job.Description.Expr), "script.job.description"))
+				}
+				if job.Context == hcl.ScriptRootContext {
+					c.output.MsgStdOut("  Context: %s", job.Context)
+				}
+				c.output.MsgStdOut("  * %v", cmd)
+			} else {
+				c.output.MsgStdOut("    %v", cmd)
+			}
+		}
+	}
+}
+
 type scriptInfoEntry struct {
 	ScriptCfg *hcl.Script
 	Stacks    config.List[*config.SortableStack]
@@ -183,6 +206,22 @@ func formatScriptJob(job *hcl.ScriptJob) []string {
 	return []string{}
 }
 
+// formatScriptParam formats the param as `name (type, default value): description`.
+func formatScriptParam(param *hcl.ScriptParam) string {
+	typ := "string"
+	if param.Type != nil {
+		typ = exprString(param.Type.Expr)
+	}
+	s := fmt.Sprintf("%s (%s, required)", param.Name, typ)
+	if param.Default != nil {
+		s = fmt.Sprintf("%s (%s, default %s)", param.Name, typ, exprString(param.Default.Expr))
+	}
+	if param.Description != nil {
+		s += ": " + descTruncation(exprString(param.Description.Expr), "script.param.description")
+	}
+	return s
+}
+
 func nameTruncation(name string, attrName string) string {
 	if len(name) > config.MaxScriptNameRunes {
 		printer.Stderr.Warn(
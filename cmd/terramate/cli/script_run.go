@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/fatih/color"
@@ -19,6 +20,7 @@ import (
 	"github.com/terramate-io/terramate/hcl/eval"
 	"github.com/terramate-io/terramate/printer"
 	prj "github.com/terramate-io/terramate/project"
+	runutil "github.com/terramate-io/terramate/run"
 	"github.com/terramate-io/terramate/stdlib"
 	"github.com/zclconf/go-cty/cty"
 )
@@ -31,6 +33,27 @@ const (
 
 func (c *cli) runScript() {
 	c.gitSafeguardDefaultBranchIsReachable()
+
+	labels, params := splitScriptParamArgs(c.parsedArgs.Script.Run.Cmds)
+	c.parsedArgs.Script.Run.Cmds = labels
+	c.parsedArgs.Script.Run.Param = append(c.parsedArgs.Script.Run.Param, params...)
+
+	var journal *runutil.Journal
+	if c.parsedArgs.Script.Run.Resume {
+		if len(c.parsedArgs.Script.Run.Cmds) > 0 {
+			fatal("--resume conflicts with a script name: the script of the previous run is used")
+		}
+		var opts resumeOptions
+		journal, opts = c.loadResumeJournal(runutil.JournalKindScript)
+		params := c.parsedArgs.Script.Run.Param
+		c.resumeFlags(func() { opts.applyToScript(&c.parsedArgs.Script.Run.runScriptFlags) })
+		c.parsedArgs.Script.Run.Cmds = journal.Command
+		// The params given to the resumed run override the ones of the
+		// previous run with the same name.
+		c.parsedArgs.Script.Run.Param = append(append([]string{}, journal.Params...), params...)
+	}
+
+	checkRunFormat(c.parsedArgs.Script.Run.commonRunFlags)
 	c.checkOutdatedGeneratedCode()
 
 	c.checkTargetsConfiguration(c.parsedArgs.Script.Run.Target, c.parsedArgs.Script.Run.FromTarget, func(isTargetSet bool) {
@@ -42,7 +65,9 @@ func (c *cli) runScript() {
 	})
 
 	var stacks config.List[*config.SortableStack]
-	if c.parsedArgs.Script.Run.NoRecursive {
+	if c.parsedArgs.Script.Run.Resume {
+		stacks = c.resumeScriptStacks(journal)
+	} else if c.parsedArgs.Script.Run.NoRecursive {
 		st, found, err := config.TryLoadStack(c.cfg(), prj.PrjAbsPath(c.rootdir(), c.wd()))
 		if err != nil {
 			fatalWithDetailf(err, "failed to load stack in current directory")
@@ -78,11 +103,26 @@ func (c *cli) runScript() {
 		os.Exit(1)
 	}
 
-	if c.parsedArgs.Script.Run.DryRun {
+	if c.parsedArgs.Script.Run.DryRun && c.parsedArgs.Script.Run.Format != runFormatJSON {
 		c.output.MsgStdErr("This is a dry run, commands will not be executed.")
 	}
 
-	var runs []stackRun
+	retryPolicy := retryPolicyFromFlags(c.parsedArgs.Script.Run.commonRunFlags)
+
+	paramValues := map[string]string{}
+	for _, param := range c.parsedArgs.Script.Run.Param {
+		name, value, err := config.ParseScriptParam(param)
+		if err != nil {
+			fatalWithDetailf(err, "invalid --param")
+		}
+		paramValues[name] = value
+	}
+
+	var (
+		runs        []stackRun
+		rootsBefore []stackRunTask
+		rootsAfter  []stackRunTask
+	)
 
 	for scriptIdx, result := range m.Results {
 		if len(result.Stacks) == 0 {
@@ -97,7 +137,18 @@ func (c *cli) runScript() {
 			)
 		}
 
+		// The stacks selected to run the script, exposed to its root context
+		// jobs. Scripts without stack context jobs have no stack runs.
+		var runStacks prj.Paths
+		hasStackJobs := len(result.ScriptCfg.StackJobs()) > 0
+
 		for _, st := range result.Stacks {
+			// The stacks completed by the resumed run are not executed again.
+			if !hasStackJobs || (c.parsedArgs.Script.Run.Resume && journal.Completed(st.Stack.Dir.String())) {
+				runStacks = append(runStacks, st.Stack.Dir)
+				continue
+			}
+
 			run := stackRun{Stack: st.Stack}
 
 			ectx, err := scriptEvalContext(c.cfg(), st.Stack, c.parsedArgs.Script.Run.Target)
@@ -105,75 +156,341 @@ func (c *cli) runScript() {
 				fatalWithDetailf(err, "failed to get context")
 			}
 
-			evalScript, err := config.EvalScript(ectx, *result.ScriptCfg)
+			params, err := config.EvalScriptParams(ectx, result.ScriptCfg.Params)
+			if err != nil {
+				fatalWithDetailf(err, "failed to eval script params")
+			}
+			values, err := config.BindScriptParams(params, paramValues)
 			if err != nil {
-				fatalWithDetailf(err, "failed to eval script")
+				fatalWithDetailf(err, "script at %s", result.ScriptCfg.Range)
 			}
+			config.SetScriptParamsNamespace(ectx, values)
 
-			for jobIdx, job := range evalScript.Jobs {
-				for cmdIdx, cmd := range job.Commands() {
-					task := stackRunTask{
-						Cmd:             cmd.Args,
-						CloudTarget:     c.parsedArgs.Script.Run.Target,
-						CloudFromTarget: c.parsedArgs.Script.Run.FromTarget,
-						ScriptIdx:       scriptIdx,
-						ScriptJobIdx:    jobIdx,
-						ScriptCmdIdx:    cmdIdx,
-					}
+			variants := []config.Variant{nil}
+			if result.ScriptCfg.Matrix != nil {
+				vars, err := config.EvalMatrix(ectx, result.ScriptCfg.Matrix)
+				if err != nil {
+					fatalWithDetailf(err, "failed to eval script matrix")
+				}
+				variants = config.MatrixVariants(vars)
+			}
+
+			for _, variant := range variants {
+				variantCtx := ectx.Copy()
+				config.SetMatrixNamespace(variantCtx, variant)
+
+				evalScript, err := config.EvalScript(variantCtx, *result.ScriptCfg)
+				if err != nil {
+					fatalWithDetailf(err, "failed to eval script")
+				}
+
+				if evalScript.Skipped {
+					continue
+				}
 
-					if cmd.Options != nil {
-						planFile, planProvisioner := selectPlanFile(
-							cmd.Options.CloudTerraformPlanFile,
-							cmd.Options.CloudTofuPlanFile)
-
-						task.CloudSyncDeployment = cmd.Options.CloudSyncDeployment
-						task.CloudSyncDriftStatus = cmd.Options.CloudSyncDriftStatus
-						task.CloudSyncPreview = cmd.Options.CloudSyncPreview
-						task.CloudSyncLayer = cmd.Options.CloudSyncLayer
-						task.CloudPlanFile = planFile
-						task.CloudPlanProvisioner = planProvisioner
-						task.UseTerragrunt = cmd.Options.UseTerragrunt
-						task.EnableSharing = cmd.Options.EnableSharing
-						task.MockOnFail = cmd.Options.MockOnFail
-
-						tel.DefaultRecord.Set(
-							tel.BoolFlag("sync-deployment", cmd.Options.CloudSyncDeployment),
-							tel.BoolFlag("sync-drift", cmd.Options.CloudSyncDriftStatus),
-							tel.BoolFlag("sync-preview", cmd.Options.CloudSyncPreview),
-							tel.StringFlag("terraform-planfile", cmd.Options.CloudTerraformPlanFile),
-							tel.StringFlag("tofu-planfile", cmd.Options.CloudTofuPlanFile),
-							tel.StringFlag("layer", string(cmd.Options.CloudSyncLayer)),
-							tel.BoolFlag("terragrunt", cmd.Options.UseTerragrunt),
-							tel.BoolFlag("output-sharing", cmd.Options.EnableSharing),
-							tel.BoolFlag("output-mocks", cmd.Options.MockOnFail),
-						)
+				if variant != nil && scriptHasSyncOptions(evalScript) {
+					fatalf("script at %s: sync options cannot be used in scripts with a matrix", result.ScriptCfg.Range)
+				}
+
+				if len(result.ScriptCfg.OnFailure)+len(result.ScriptCfg.Finally) > 0 {
+					// The jobs are evaluated for a failed result beforehand, then
+					// no stack is executed if they are invalid.
+					_, err := config.EvalScriptResultJobs(variantCtx, *result.ScriptCfg, config.ScriptResult{Failed: true})
+					if err != nil {
+						fatalWithDetailf(err, "failed to eval script")
 					}
-					run.Tasks = append(run.Tasks, task)
-					if task.CloudSyncDeployment || task.CloudSyncDriftStatus || task.CloudSyncPreview {
-						run.SyncTaskIndex = len(run.Tasks) - 1
+					if run.ScriptCtxs == nil {
+						run.ScriptCtxs = map[string]*eval.Context{}
 					}
+					run.Script = result.ScriptCfg
+					run.ScriptCtxs[variant.String()] = variantCtx
+				}
+
+				c.appendScriptTasks(&run, evalScript, scriptIdx, variant, retryPolicy)
+			}
+
+			// Stacks where the script or all its jobs are skipped by their
+			// condition are not executed.
+			if !slices.ContainsFunc(run.Tasks, func(task stackRunTask) bool { return !task.Skipped }) {
+				if !c.parsedArgs.Quiet {
+					c.output.MsgStdErr("Skipping stack %s: condition is false", st.Stack.Dir)
 				}
+				continue
 			}
 
 			runs = append(runs, run)
+			runStacks = append(runStacks, st.Stack.Dir)
+		}
+
+		rootBefore, rootAfter := result.ScriptCfg.RootJobs()
+		if len(rootBefore)+len(rootAfter) > 0 && len(runStacks) > 0 {
+			before, after, err := c.scriptRootTasks(result.ScriptCfg, scriptIdx, runStacks, paramValues)
+			if err != nil {
+				fatalWithDetailf(err, "failed to eval the root context jobs of the script at %s", result.ScriptCfg.Range)
+			}
+			rootsBefore = append(rootsBefore, before...)
+			rootsAfter = append(rootsAfter, after...)
+		}
+	}
+
+	if c.parsedArgs.Script.Run.Resume {
+		if journal.RootCompleted(runutil.RootBefore) {
+			rootsBefore = nil
+		}
+		if journal.RootCompleted(runutil.RootAfter) {
+			rootsAfter = nil
+		}
+		if len(runs)+len(rootsBefore)+len(rootsAfter) == 0 {
+			printer.Stderr.Success("Nothing to resume: all stacks and root jobs of the previous run completed successfully")
+			return
 		}
 	}
 
 	c.prepareScriptForCloudSync(runs)
 
+	if c.parsedArgs.Script.Run.DryRun {
+		journal = nil
+	} else if journal == nil {
+		// The params are saved apart from the options, then they are merged
+		// with the params given to the resumed run.
+		journal = c.newRunJournal(runutil.JournalKindScript, c.parsedArgs.Script.Run.Cmds,
+			scriptResumeOptions(c.parsedArgs.Script.Run.runScriptFlags))
+		if journal != nil {
+			journal.Params = c.parsedArgs.Script.Run.Param
+			for _, st := range stacks {
+				journal.Selected = append(journal.Selected, st.Stack.Dir.String())
+			}
+		}
+	}
+
 	err := c.runAll(runs, runAllOptions{
 		Quiet:           c.parsedArgs.Quiet,
 		DryRun:          c.parsedArgs.Script.Run.DryRun,
 		Reverse:         c.parsedArgs.Script.Run.Reverse,
 		ScriptRun:       true,
 		ContinueOnError: c.parsedArgs.Script.Run.ContinueOnError,
+		SkipDependents:  c.parsedArgs.Script.Run.SkipDependents,
 		Parallel:        c.parsedArgs.Script.Run.Parallel,
+		Timeout:         c.parsedArgs.Script.Run.Timeout,
+		Journal:         journal,
+		ReportJSON:      c.parsedArgs.Script.Run.ReportJSON,
+		ReportJUnit:     c.parsedArgs.Script.Run.ReportJUnit,
+		OutputMode:      c.parsedArgs.Script.Run.OutputMode,
+		NoCache:         c.parsedArgs.Script.Run.NoCache,
+		Summary:         c.parsedArgs.Script.Run.Summary,
+		NoProgress:      c.parsedArgs.Script.Run.NoProgress,
+		LogDir:          c.parsedArgs.Script.Run.LogDir,
+		Format:          c.parsedArgs.Script.Run.Format,
+		RootBefore:      rootsBefore,
+		RootAfter:       rootsAfter,
 	})
 	if err != nil {
 		fatalWithDetailf(err, "one or more commands failed")
 	}
 }
 
+// appendScriptTasks appends the tasks of the commands of the evaluated script
+// to the stack run, for the given matrix variant.
+func (c *cli) appendScriptTasks(
+	run *stackRun,
+	evalScript config.Script,
+	scriptIdx int,
+	variant config.Variant,
+	retryPolicy *config.RetryPolicy,
+) {
+	for jobIdx, job := range evalScript.Jobs {
+		if job.Skipped {
+			run.Tasks = append(run.Tasks, stackRunTask{
+				Matrix:        variant,
+				ScriptIdx:     scriptIdx,
+				ScriptJobIdx:  jobIdx,
+				ScriptJobName: job.Name,
+				ScriptJobDeps: job.Deps,
+				Skipped:       true,
+			})
+			continue
+		}
+		for cmdIdx, cmd := range job.Commands() {
+			task := stackRunTask{
+				Cmd:             cmd.Args,
+				Matrix:          variant,
+				CloudTarget:     c.parsedArgs.Script.Run.Target,
+				CloudFromTarget: c.parsedArgs.Script.Run.FromTarget,
+				ScriptIdx:       scriptIdx,
+				ScriptJobIdx:    jobIdx,
+				ScriptCmdIdx:    cmdIdx,
+				ScriptJobName:   job.Name,
+				ScriptJobDeps:   job.Deps,
+				Env:             job.Env,
+				UnsetEnv:        job.UnsetEnv,
+				Timeout:         c.runConfig().StackTimeout,
+				Retry:           retryPolicy,
+			}
+
+			if cmd.Options != nil {
+				planFile, planProvisioner := selectPlanFile(
+					cmd.Options.CloudTerraformPlanFile,
+					cmd.Options.CloudTofuPlanFile)
+
+				task.CloudSyncDeployment = cmd.Options.CloudSyncDeployment
+				task.CloudSyncDriftStatus = cmd.Options.CloudSyncDriftStatus
+				task.CloudSyncPreview = cmd.Options.CloudSyncPreview
+				task.CloudSyncLayer = cmd.Options.CloudSyncLayer
+				task.CloudPlanFile = planFile
+				task.CloudPlanProvisioner = planProvisioner
+				task.UseTerragrunt = cmd.Options.UseTerragrunt
+				task.EnableSharing = cmd.Options.EnableSharing
+				task.MockOnFail = cmd.Options.MockOnFail
+				if cmd.Options.Timeout > 0 {
+					task.Timeout = cmd.Options.Timeout
+				}
+				if cmd.Options.Retry != nil {
+					task.Retry = cmd.Options.Retry
+				}
+
+				tel.DefaultRecord.Set(
+					tel.BoolFlag("sync-deployment", cmd.Options.CloudSyncDeployment),
+					tel.BoolFlag("sync-drift", cmd.Options.CloudSyncDriftStatus),
+					tel.BoolFlag("sync-preview", cmd.Options.CloudSyncPreview),
+					tel.StringFlag("terraform-planfile", cmd.Options.CloudTerraformPlanFile),
+					tel.StringFlag("tofu-planfile", cmd.Options.CloudTofuPlanFile),
+					tel.StringFlag("layer", string(cmd.Options.CloudSyncLayer)),
+					tel.BoolFlag("terragrunt", cmd.Options.UseTerragrunt),
+					tel.BoolFlag("output-sharing", cmd.Options.EnableSharing),
+					tel.BoolFlag("output-mocks", cmd.Options.MockOnFail),
+				)
+			}
+			run.Tasks = append(run.Tasks, task)
+			if task.CloudSyncDeployment || task.CloudSyncDriftStatus || task.CloudSyncPreview {
+				run.SyncTaskIndex = len(run.Tasks) - 1
+			}
+		}
+	}
+}
+
+// scriptResult returns the result of the jobs of the given group of tasks of
+// the stack run and tells if any of them was executed.
+func scriptResult(run stackRun, group taskJob, results []taskResult) (config.ScriptResult, bool) {
+	var result config.ScriptResult
+	started := false
+	for i := group.first; i <= group.last; i++ {
+		switch results[i].status {
+		case runutil.StackOK:
+			started = true
+		case runutil.StackFailed, runutil.StackTimedOut:
+			started = true
+			if !result.Failed {
+				result = config.ScriptResult{
+					Failed:    true,
+					FailedJob: run.Tasks[i].jobName(),
+					ExitCode:  results[i].exitCode,
+				}
+			}
+		}
+	}
+	return result, started
+}
+
+// scriptResultTasks evaluates the on_failure and finally jobs of the script of
+// the stack run for the result of the jobs of the given task group, and
+// returns the tasks of their commands.
+func (c *cli) scriptResultTasks(run stackRun, group stackRunTask, result config.ScriptResult) ([]stackRunTask, error) {
+	jobs, err := config.EvalScriptResultJobs(run.ScriptCtxs[group.Matrix.String()], *run.Script, result)
+	if err != nil {
+		return nil, errors.E(err, "evaluating the on_failure and finally jobs of the script in stack %s", run.Stack.Dir)
+	}
+
+	onFailureJobs := 0
+	if result.Failed {
+		onFailureJobs = len(run.Script.OnFailure)
+	}
+
+	retryPolicy := retryPolicyFromFlags(c.parsedArgs.Script.Run.commonRunFlags)
+
+	var tasks []stackRunTask
+	for i, job := range jobs {
+		kind, jobIdx := "on_failure", i
+		if i >= onFailureJobs {
+			kind, jobIdx = "finally", i-onFailureJobs
+		}
+		if job.Skipped {
+			tasks = append(tasks, stackRunTask{
+				Matrix:        group.Matrix,
+				ScriptIdx:     group.ScriptIdx,
+				ScriptJobIdx:  jobIdx,
+				ScriptJobName: job.Name,
+				ScriptJobKind: kind,
+				Skipped:       true,
+			})
+			continue
+		}
+		for cmdIdx, cmd := range job.Commands() {
+			task := stackRunTask{
+				Cmd:           cmd.Args,
+				Matrix:        group.Matrix,
+				ScriptIdx:     group.ScriptIdx,
+				ScriptJobIdx:  jobIdx,
+				ScriptCmdIdx:  cmdIdx,
+				ScriptJobName: job.Name,
+				ScriptJobKind: kind,
+				Env:           job.Env,
+				UnsetEnv:      job.UnsetEnv,
+				Timeout:       c.runConfig().StackTimeout,
+				Retry:         retryPolicy,
+			}
+			if cmd.Options != nil {
+				task.UseTerragrunt = cmd.Options.UseTerragrunt
+				if cmd.Options.Timeout > 0 {
+					task.Timeout = cmd.Options.Timeout
+				}
+				if cmd.Options.Retry != nil {
+					task.Retry = cmd.Options.Retry
+				}
+			}
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks, nil
+}
+
+// splitScriptParamArgs splits the script labels from the parameters given
+// after them, as `--param name=value` or `--param=name=value`, since all the
+// arguments after the script name are passed through.
+func splitScriptParamArgs(args []string) (labels []string, params []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--param":
+			if i+1 == len(args) {
+				fatal("--param requires a value in the format name=value")
+			}
+			params = append(params, args[i+1])
+			i++
+		case strings.HasPrefix(arg, "--param="):
+			params = append(params, strings.TrimPrefix(arg, "--param="))
+		case len(params) > 0:
+			fatalf("unexpected argument %q after script parameters", arg)
+		default:
+			labels = append(labels, arg)
+		}
+	}
+	return labels, params
+}
+
+// scriptHasSyncOptions tells if any command of the script synchronizes to
+// Terramate Cloud, which supports a single command per stack.
+func scriptHasSyncOptions(script config.Script) bool {
+	for _, job := range script.Jobs {
+		for _, cmd := range job.Commands() {
+			if cmd.Options != nil &&
+				(cmd.Options.CloudSyncDeployment || cmd.Options.CloudSyncDriftStatus || cmd.Options.CloudSyncPreview) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (c *cli) prepareScriptForCloudSync(runs []stackRun) {
 	if c.parsedArgs.Script.Run.DryRun {
 		return
@@ -228,7 +545,7 @@ func (c *cli) prepareScriptForCloudSync(runs []stackRun) {
 			sortableDeployStacks[i] = &config.SortableStack{Stack: e.Stack}
 		}
 		c.ensureAllStackHaveIDs(sortableDeployStacks)
-		c.createCloudDeployment(deployRuns)
+		c.createCloudDeployment(c.maskCloudRuns(runs, deployRuns))
 	}
 
 	if len(driftRuns) > 0 {
@@ -241,20 +558,41 @@ func (c *cli) prepareScriptForCloudSync(runs []stackRun) {
 
 	if len(previewRuns) > 0 {
 		// HACK: Target and FromTarget are passed through opts for preview and not used from the runs.
-		for metaID, previewID := range c.createCloudPreview(previewRuns, c.parsedArgs.Script.Run.Target, c.parsedArgs.Script.Run.FromTarget) {
+		for metaID, previewID := range c.createCloudPreview(c.maskCloudRuns(runs, previewRuns), c.parsedArgs.Script.Run.Target, c.parsedArgs.Script.Run.FromTarget) {
 			c.cloud.run.setMeta2PreviewID(metaID, previewID)
 		}
 	}
 }
 
-// printScriptCommand pretty prints the cmd and attaches a "prompt" style prefix to it
+// printScriptCommand pretty prints the cmd, with the sensitive values redacted,
+// and attaches a "prompt" style prefix to it
 // for example:
 // /somestack (script:0 job:0.0)> echo hello
-func printScriptCommand(w io.Writer, stack *config.Stack, run stackRunTask) {
-	prompt := color.GreenString(fmt.Sprintf("%s (script:%d job:%d.%d)>",
-		stack.Dir.String(),
-		run.ScriptIdx, run.ScriptJobIdx, run.ScriptCmdIdx))
-	fprintln(w, prompt, color.YellowString(strings.Join(run.Cmd, " ")))
+func printScriptCommand(w io.Writer, dir prj.Path, run stackRunTask, masker *runutil.Masker) {
+	prompt := color.GreenString(fmt.Sprintf("%s (script:%d %s:%d.%d)%s>",
+		dir.String(),
+		run.ScriptIdx, run.jobKind(), run.ScriptJobIdx, run.ScriptCmdIdx,
+		variantSuffix(run.Matrix)))
+	fprintln(w, prompt, color.YellowString(strings.Join(masker.MaskArgs(run.Cmd), " ")))
+}
+
+// printScriptJobSkipped prints that the job of the task was skipped by its
+// condition, using the same prompt as printScriptCommand.
+func printScriptJobSkipped(w io.Writer, dir prj.Path, run stackRunTask) {
+	prompt := color.GreenString(fmt.Sprintf("%s (script:%d %s:%d)%s>",
+		dir.String(),
+		run.ScriptIdx, run.jobKind(), run.ScriptJobIdx,
+		variantSuffix(run.Matrix)))
+	fprintln(w, prompt, color.YellowString("skipped (condition is false)"))
+}
+
+// jobKind returns the kind of the script job of the task: job, on_failure,
+// finally or root.
+func (t stackRunTask) jobKind() string {
+	if t.ScriptJobKind != "" {
+		return t.ScriptJobKind
+	}
+	return "job"
 }
 
 func scriptEvalContext(root *config.Root, st *config.Stack, target string) (*eval.Context, error) {
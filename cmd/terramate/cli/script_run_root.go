@@ -0,0 +1,141 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package cli
+
+import (
+	"os"
+
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/globals"
+	"github.com/terramate-io/terramate/hcl"
+	"github.com/terramate-io/terramate/hcl/eval"
+	prj "github.com/terramate-io/terramate/project"
+	runutil "github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/stdlib"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// scriptRootTasks evaluates the root context jobs of the script for the stacks
+// selected to run it and returns the tasks of the commands executed in the
+// root of the project before and after the stacks.
+func (c *cli) scriptRootTasks(
+	script *hcl.Script,
+	scriptIdx int,
+	stacks prj.Paths,
+	paramValues map[string]string,
+) (before, after []stackRunTask, err error) {
+	evalctx, err := scriptRootEvalContext(c.cfg(), script.Range.Path().Dir(), c.parsedArgs.Script.Run.Target)
+	if err != nil {
+		return nil, nil, err
+	}
+	config.SetRunStacksNamespace(evalctx, stacks)
+
+	params, err := config.EvalScriptParams(evalctx, script.Params)
+	if err != nil {
+		return nil, nil, err
+	}
+	values, err := config.BindScriptParams(params, paramValues)
+	if err != nil {
+		return nil, nil, err
+	}
+	config.SetScriptParamsNamespace(evalctx, values)
+
+	beforeJobs, afterJobs, err := config.EvalScriptRootJobs(evalctx, *script)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.scriptRootJobTasks(scriptIdx, 0, beforeJobs),
+		c.scriptRootJobTasks(scriptIdx, len(beforeJobs), afterJobs), nil
+}
+
+// scriptRootJobTasks returns the tasks of the commands of the root context
+// jobs, numbered from the given index. Each job starts after the previous one
+// succeeds.
+func (c *cli) scriptRootJobTasks(scriptIdx, firstJobIdx int, jobs []config.ScriptJob) []stackRunTask {
+	retryPolicy := retryPolicyFromFlags(c.parsedArgs.Script.Run.commonRunFlags)
+
+	var tasks []stackRunTask
+	for i, job := range jobs {
+		var deps []int
+		for dep := firstJobIdx; dep < firstJobIdx+i; dep++ {
+			deps = append(deps, dep)
+		}
+		if job.Skipped {
+			tasks = append(tasks, stackRunTask{
+				ScriptIdx:     scriptIdx,
+				ScriptJobIdx:  firstJobIdx + i,
+				ScriptJobName: job.Name,
+				ScriptJobDeps: deps,
+				ScriptJobKind: hcl.ScriptRootContext,
+				Skipped:       true,
+			})
+			continue
+		}
+		for cmdIdx, cmd := range job.Commands() {
+			task := stackRunTask{
+				Cmd:           cmd.Args,
+				ScriptIdx:     scriptIdx,
+				ScriptJobIdx:  firstJobIdx + i,
+				ScriptCmdIdx:  cmdIdx,
+				ScriptJobName: job.Name,
+				ScriptJobDeps: deps,
+				ScriptJobKind: hcl.ScriptRootContext,
+				Env:           job.Env,
+				UnsetEnv:      job.UnsetEnv,
+				Retry:         retryPolicy,
+			}
+			// The stack_timeout is not applied, as the root jobs run once for
+			// all the stacks. Only the timeout option of the command applies.
+			if cmd.Options != nil {
+				if cmd.Options.Timeout > 0 {
+					task.Timeout = cmd.Options.Timeout
+				}
+				if cmd.Options.Retry != nil {
+					task.Retry = cmd.Options.Retry
+				}
+			}
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// loadRootEnv loads the env of the root context jobs, from the
+// terramate.config.run.env of the root of the project, and the masker of the
+// sensitive values of their commands.
+func (c *cli) loadRootEnv() (runutil.EnvVars, *runutil.Masker, error) {
+	env, err := runutil.LoadRootEnv(c.cfg())
+	if err != nil {
+		return nil, nil, errors.E(err, "loading the env of the root context jobs")
+	}
+	masker, err := runutil.LoadMasker(c.cfg(), nil, c.runConfig().Sensitive, newEnvironFrom(env))
+	if err != nil {
+		return nil, nil, errors.E(err, "loading the sensitive values of the root context jobs")
+	}
+	return env, masker, nil
+}
+
+// scriptRootEvalContext returns the evaluation context of the root context
+// jobs of a script, with the globals of the directory of the script.
+func scriptRootEvalContext(root *config.Root, cfgdir prj.Path, target string) (*eval.Context, error) {
+	runtime := root.Runtime()
+	if target != "" {
+		runtime["target"] = cty.StringVal(target)
+	}
+
+	globalsctx := eval.NewContext(stdlib.Functions(root.HostDir(), root.Tree().Node.Experiments()))
+	globalsctx.SetNamespace("terramate", root.Runtime())
+	globalsReport := globals.ForDir(root, cfgdir, globalsctx)
+	if err := globalsReport.AsError(); err != nil {
+		return nil, err
+	}
+
+	evalctx := eval.NewContext(stdlib.Functions(root.HostDir(), root.Tree().Node.Experiments()))
+	evalctx.SetNamespace("terramate", runtime)
+	evalctx.SetNamespace("global", globalsReport.Globals.AsValueMap())
+	evalctx.SetEnv(os.Environ())
+
+	return evalctx, nil
+}
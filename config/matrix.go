@@ -0,0 +1,168 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"strconv"
+	"strings"
+
+	hclsyntax "github.com/terramate-io/hcl/v2/hclsyntax"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/hcl/ast"
+	"github.com/terramate-io/terramate/hcl/eval"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// ErrMatrix indicates an invalid matrix definition.
+const ErrMatrix errors.Kind = "invalid matrix"
+
+// MatrixVar is a variable of a matrix and its values.
+type MatrixVar struct {
+	Name   string
+	Values []string
+}
+
+// MatrixValue is the value of a matrix variable in a variant.
+type MatrixValue struct {
+	Name  string
+	Value string
+}
+
+// Variant is a combination of values of the matrix variables, in the order
+// the variables are defined.
+type Variant []MatrixValue
+
+// ParseMatrixVar parses a matrix variable in the format `name=value1,value2`.
+func ParseMatrixVar(s string) (MatrixVar, error) {
+	name, values, ok := strings.Cut(s, "=")
+	if !ok || !hclsyntax.ValidIdentifier(name) {
+		return MatrixVar{}, errors.E(ErrMatrix, "%q must be in the format name=value1,value2", s)
+	}
+	v := MatrixVar{Name: name}
+	for _, value := range strings.Split(values, ",") {
+		if value == "" {
+			return MatrixVar{}, errors.E(ErrMatrix, "%q has an empty value", s)
+		}
+		v.Values = append(v.Values, value)
+	}
+	return v, nil
+}
+
+// EvalMatrix evaluates the attributes of a matrix block. Each attribute is a
+// variable and must be a non-empty list of strings, numbers or bools.
+func EvalMatrix(evalctx *eval.Context, attrs ast.Attributes) ([]MatrixVar, error) {
+	errs := errors.L()
+	var vars []MatrixVar
+	for _, attr := range attrs.SortedList() {
+		val, err := evalctx.Eval(attr.Expr)
+		if err != nil {
+			errs.Append(errors.E(ErrMatrix, attr.Range, err))
+			continue
+		}
+		if !val.Type().IsListType() && !val.Type().IsTupleType() && !val.Type().IsSetType() {
+			errs.Append(errors.E(ErrMatrix, attr.Range,
+				"matrix.%s must be a list but has type %s", attr.Name, val.Type().FriendlyName()))
+			continue
+		}
+		if val.LengthInt() == 0 {
+			errs.Append(errors.E(ErrMatrix, attr.Range, "matrix.%s must not be empty", attr.Name))
+			continue
+		}
+
+		v := MatrixVar{Name: attr.Name}
+		for it := val.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			str, err := convert.Convert(elem, cty.String)
+			if err != nil || str.IsNull() || !str.IsKnown() {
+				errs.Append(errors.E(ErrMatrix, attr.Range,
+					"matrix.%s elements must be strings, numbers or bools but has element of type %s",
+					attr.Name, elem.Type().FriendlyName()))
+				break
+			}
+			v.Values = append(v.Values, str.AsString())
+		}
+		vars = append(vars, v)
+	}
+
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// MatrixVariants returns all combinations of the values of the given
+// variables. The values of the last variable change first. If no variables
+// are given, it returns a single nil variant.
+func MatrixVariants(vars []MatrixVar) []Variant {
+	variants := []Variant{nil}
+	for _, v := range vars {
+		var next []Variant
+		for _, variant := range variants {
+			for _, value := range v.Values {
+				combined := append(append(Variant{}, variant...), MatrixValue{Name: v.Name, Value: value})
+				next = append(next, combined)
+			}
+		}
+		variants = next
+	}
+	return variants
+}
+
+// String returns the variant in the format `name1=value1,name2=value2`.
+// Values that are empty or contain `,`, `=`, quotes, backslashes or
+// non-printable characters are quoted, then distinct variants have distinct
+// strings, which can be used as map keys.
+func (v Variant) String() string {
+	parts := make([]string, len(v))
+	for i, value := range v {
+		parts[i] = value.Name + "=" + quoteMatrixValue(value.Value)
+	}
+	return strings.Join(parts, ",")
+}
+
+func quoteMatrixValue(value string) string {
+	quoted := strconv.Quote(value)
+	if value == "" || strings.ContainsAny(value, ",=") || quoted != `"`+value+`"` {
+		return quoted
+	}
+	return value
+}
+
+// Map returns the values of the variant by variable name.
+func (v Variant) Map() map[string]string {
+	if v == nil {
+		return nil
+	}
+	m := make(map[string]string, len(v))
+	for _, value := range v {
+		m[value.Name] = value.Value
+	}
+	return m
+}
+
+// SetMatrixNamespace exposes the values of the variant as
+// `terramate.run.matrix.<name>` in the given context. Nothing is done for
+// nil variants.
+func SetMatrixNamespace(evalctx *eval.Context, variant Variant) {
+	if variant == nil {
+		return
+	}
+	values := map[string]cty.Value{}
+	for _, value := range variant {
+		values[value.Name] = cty.StringVal(value.Value)
+	}
+
+	terramate := map[string]cty.Value{}
+	if ns, ok := evalctx.GetNamespace("terramate"); ok && ns.Type().IsObjectType() {
+		terramate = ns.AsValueMap()
+	}
+	run := map[string]cty.Value{}
+	if old, ok := terramate["run"]; ok && old.Type().IsObjectType() {
+		run = old.AsValueMap()
+	}
+	run["matrix"] = cty.ObjectVal(values)
+	terramate["run"] = cty.ObjectVal(run)
+	evalctx.SetNamespace("terramate", terramate)
+}
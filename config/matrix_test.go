@@ -0,0 +1,178 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package config_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/madlambda/spells/assert"
+	hhcl "github.com/terramate-io/hcl/v2"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/hcl/ast"
+	"github.com/terramate-io/terramate/hcl/eval"
+	"github.com/terramate-io/terramate/test"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestParseMatrixVar(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		flag    string
+		want    config.MatrixVar
+		wantErr bool
+	}
+
+	for _, tc := range []testcase{
+		{
+			flag: "region=us",
+			want: config.MatrixVar{Name: "region", Values: []string{"us"}},
+		},
+		{
+			flag: "region=us,eu,ap",
+			want: config.MatrixVar{Name: "region", Values: []string{"us", "eu", "ap"}},
+		},
+		{
+			flag: "workspace=a=b",
+			want: config.MatrixVar{Name: "workspace", Values: []string{"a=b"}},
+		},
+		{flag: "region", wantErr: true},
+		{flag: "=us", wantErr: true},
+		{flag: "1region=us", wantErr: true},
+		{flag: "region=", wantErr: true},
+		{flag: "region=us,,eu", wantErr: true},
+	} {
+		tc := tc
+		t.Run(tc.flag, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := config.ParseMatrixVar(tc.flag)
+			if tc.wantErr {
+				assert.IsTrue(t, errors.IsKind(err, config.ErrMatrix), "want matrix error, got %v", err)
+				return
+			}
+			assert.NoError(t, err)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("-(want) +(got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMatrixVariants(t *testing.T) {
+	t.Parallel()
+
+	variants := config.MatrixVariants(nil)
+	assert.EqualInts(t, 1, len(variants))
+	assert.IsTrue(t, variants[0] == nil)
+
+	variants = config.MatrixVariants([]config.MatrixVar{
+		{Name: "region", Values: []string{"us", "eu"}},
+		{Name: "workspace", Values: []string{"dev", "prd"}},
+	})
+
+	var got []string
+	for _, variant := range variants {
+		got = append(got, variant.String())
+	}
+	want := []string{
+		"region=us,workspace=dev",
+		"region=us,workspace=prd",
+		"region=eu,workspace=dev",
+		"region=eu,workspace=prd",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("-(want) +(got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]string{"region": "eu", "workspace": "dev"}, variants[2].Map()); diff != "" {
+		t.Fatalf("-(want) +(got):\n%s", diff)
+	}
+}
+
+func TestMatrixVariantString(t *testing.T) {
+	t.Parallel()
+
+	// Values that could be confused with the separators are quoted.
+	for _, tc := range []struct {
+		variant config.Variant
+		want    string
+	}{
+		{
+			variant: config.Variant{{Name: "a", Value: "x,b=y"}},
+			want:    `a="x,b=y"`,
+		},
+		{
+			variant: config.Variant{{Name: "a", Value: "x"}, {Name: "b", Value: "y"}},
+			want:    `a=x,b=y`,
+		},
+		{
+			variant: config.Variant{{Name: "a", Value: ""}, {Name: "b", Value: `say "hi"`}},
+			want:    `a="",b="say \"hi\""`,
+		},
+		{
+			variant: config.Variant{{Name: "region", Value: "eu-west-1"}},
+			want:    `region=eu-west-1`,
+		},
+	} {
+		assert.EqualStrings(t, tc.want, tc.variant.String())
+	}
+}
+
+func TestEvalMatrix(t *testing.T) {
+	t.Parallel()
+
+	evalctx := eval.NewContext(nil)
+	evalctx.SetNamespace("global", map[string]cty.Value{
+		"regions": cty.ListVal([]cty.Value{cty.StringVal("us"), cty.StringVal("eu")}),
+	})
+
+	attrs := func(exprs map[string]string) ast.Attributes {
+		attrs := ast.Attributes{}
+		for name, expr := range exprs {
+			attrs[name] = ast.Attribute{
+				Attribute: &hhcl.Attribute{Name: name, Expr: test.NewExpr(t, expr)},
+			}
+		}
+		return attrs
+	}
+
+	vars, err := config.EvalMatrix(evalctx, attrs(map[string]string{
+		"region": `global.regions`,
+		"size":   `[1, true, "x"]`,
+	}))
+	assert.NoError(t, err)
+	want := []config.MatrixVar{
+		{Name: "region", Values: []string{"us", "eu"}},
+		{Name: "size", Values: []string{"1", "true", "x"}},
+	}
+	if diff := cmp.Diff(want, vars); diff != "" {
+		t.Fatalf("-(want) +(got):\n%s", diff)
+	}
+
+	for _, expr := range []string{`"us"`, `[]`, `[["us"]]`} {
+		_, err := config.EvalMatrix(evalctx, attrs(map[string]string{"region": expr}))
+		assert.IsTrue(t, errors.IsKind(err, config.ErrMatrix), "%s: want matrix error, got %v", expr, err)
+	}
+}
+
+func TestSetMatrixNamespace(t *testing.T) {
+	t.Parallel()
+
+	evalctx := eval.NewContext(nil)
+	evalctx.SetNamespace("terramate", map[string]cty.Value{
+		"stack": cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("stack")}),
+	})
+	config.SetMatrixNamespace(evalctx, config.Variant{{Name: "region", Value: "eu"}})
+
+	for expr, want := range map[string]string{
+		`terramate.run.matrix.region`: "eu",
+		`terramate.stack.name`:        "stack",
+	} {
+		val, err := evalctx.Eval(test.NewExpr(t, expr))
+		assert.NoError(t, err)
+		assert.EqualStrings(t, want, val.AsString())
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"regexp"
+	"time"
+
+	hhcl "github.com/terramate-io/hcl/v2"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ErrInvalidRetryPolicy indicates an invalid retry policy.
+const ErrInvalidRetryPolicy errors.Kind = "invalid retry policy"
+
+// maxRetryDelay is the maximum delay the backoff doubles up to.
+const maxRetryDelay = 5 * time.Minute
+
+// RetryPolicy defines how a failed command is retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of executions of the command,
+	// including the first one.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry. The delay doubles on each
+	// subsequent retry, up to 5 minutes.
+	Backoff time.Duration
+
+	// ExitCodes, if not empty, restricts the retries to failures with one of
+	// these exit codes.
+	ExitCodes []int
+
+	// OutputRegex, if not nil, restricts the retries to failures where the
+	// output of the command matches the regex.
+	OutputRegex *regexp.Regexp
+}
+
+// NewRetryPolicy creates a new retry policy, validating its parameters.
+// The outputRegex is optional.
+func NewRetryPolicy(maxAttempts int, backoff time.Duration, exitCodes []int, outputRegex string) (*RetryPolicy, error) {
+	p := &RetryPolicy{
+		MaxAttempts: maxAttempts,
+		Backoff:     backoff,
+		ExitCodes:   exitCodes,
+	}
+	if maxAttempts < 1 {
+		return nil, errors.E(ErrInvalidRetryPolicy, "max attempts must be greater than zero")
+	}
+	if backoff < 0 {
+		return nil, errors.E(ErrInvalidRetryPolicy, "backoff must not be negative")
+	}
+	for _, code := range exitCodes {
+		if code <= 0 {
+			return nil, errors.E(ErrInvalidRetryPolicy, "exit code %d is not a failure exit code", code)
+		}
+	}
+	if outputRegex != "" {
+		re, err := regexp.Compile(outputRegex)
+		if err != nil {
+			return nil, errors.E(ErrInvalidRetryPolicy, err, "compiling output regex")
+		}
+		p.OutputRegex = re
+	}
+	return p, nil
+}
+
+// ShouldRetry tells if a command that failed with the given exit code and
+// output in the given attempt must be retried.
+// It's safe to call it on a nil policy, which never retries.
+func (p *RetryPolicy) ShouldRetry(attempt int, exitCode int, output []byte) bool {
+	if p == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+	if len(p.ExitCodes) > 0 {
+		found := false
+		for _, code := range p.ExitCodes {
+			if code == exitCode {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if p.OutputRegex != nil && !p.OutputRegex.Match(output) {
+		return false
+	}
+	return true
+}
+
+// Delay returns the delay before retrying the command that failed in the
+// given attempt. The doubled delay is capped at maxRetryDelay, but a longer
+// backoff is kept as is.
+func (p *RetryPolicy) Delay(attempt int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempt && delay > 0 && delay < maxRetryDelay; i++ {
+		delay = min(delay*2, maxRetryDelay)
+	}
+	return delay
+}
+
+func unmarshalRetryPolicy(obj cty.Value, expr hhcl.Expression) (*RetryPolicy, error) {
+	if !obj.Type().IsObjectType() && !obj.Type().IsMapType() {
+		return nil, errors.E(ErrScriptInvalidCmdOptions, expr.Range(),
+			"command option 'retry' must be an object, but has type %s",
+			obj.Type().FriendlyName())
+	}
+
+	var (
+		maxAttempts = 1
+		backoff     time.Duration
+		exitCodes   []int
+		outputRegex string
+	)
+
+	errs := errors.L()
+	it := obj.ElementIterator()
+	for it.Next() {
+		k, v := it.Element()
+
+		switch ks := k.AsString(); ks {
+		case "max_attempts":
+			if v.Type() != cty.Number || !v.AsBigFloat().IsInt() {
+				errs.Append(errors.E(ErrScriptInvalidCmdOptions, expr.Range(),
+					"command option 'retry.%s' must be an integer, but has type %s",
+					ks, v.Type().FriendlyName()))
+				break
+			}
+			n, _ := v.AsBigFloat().Int64()
+			maxAttempts = int(n)
+
+		case "backoff":
+			if v.Type() != cty.String {
+				errs.Append(errors.E(ErrScriptInvalidCmdOptions, expr.Range(),
+					"command option 'retry.%s' must be a string, but has type %s",
+					ks, v.Type().FriendlyName()))
+				break
+			}
+			d, err := time.ParseDuration(v.AsString())
+			if err != nil {
+				errs.Append(errors.E(ErrScriptInvalidCmdOptions, expr.Range(), err,
+					"command option 'retry.%s' must be a duration, like \"10s\"", ks))
+				break
+			}
+			backoff = d
+
+		case "exit_codes":
+			if !v.Type().IsListType() && !v.Type().IsTupleType() {
+				errs.Append(errors.E(ErrScriptInvalidCmdOptions, expr.Range(),
+					"command option 'retry.%s' must be a list of numbers, but has type %s",
+					ks, v.Type().FriendlyName()))
+				break
+			}
+			codesIt := v.ElementIterator()
+			for codesIt.Next() {
+				_, code := codesIt.Element()
+				if code.Type() != cty.Number || !code.AsBigFloat().IsInt() {
+					errs.Append(errors.E(ErrScriptInvalidCmdOptions, expr.Range(),
+						"command option 'retry.%s' must be a list of numbers, but has element of type %s",
+						ks, code.Type().FriendlyName()))
+					break
+				}
+				n, _ := code.AsBigFloat().Int64()
+				exitCodes = append(exitCodes, int(n))
+			}
+
+		case "output_regex":
+			if v.Type() != cty.String {
+				errs.Append(errors.E(ErrScriptInvalidCmdOptions, expr.Range(),
+					"command option 'retry.%s' must be a string, but has type %s",
+					ks, v.Type().FriendlyName()))
+				break
+			}
+			outputRegex = v.AsString()
+
+		default:
+			errs.Append(errors.E(ErrScriptInvalidCmdOptions, expr.Range(), "unknown command option: retry.%s", ks))
+		}
+	}
+
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+
+	p, err := NewRetryPolicy(maxAttempts, backoff, exitCodes, outputRegex)
+	if err != nil {
+		return nil, errors.E(ErrScriptInvalidCmdOptions, expr.Range(), err)
+	}
+	return p, nil
+}
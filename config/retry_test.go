@@ -0,0 +1,147 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	t.Parallel()
+
+	type attempt struct {
+		attempt  int
+		exitCode int
+		output   string
+		want     bool
+	}
+
+	type testcase struct {
+		name        string
+		maxAttempts int
+		exitCodes   []int
+		outputRegex string
+		attempts    []attempt
+	}
+
+	for _, tc := range []testcase{
+		{
+			name:        "retries any failure up to max attempts",
+			maxAttempts: 3,
+			attempts: []attempt{
+				{attempt: 1, exitCode: 1, want: true},
+				{attempt: 2, exitCode: 2, want: true},
+				{attempt: 3, exitCode: 1, want: false},
+			},
+		},
+		{
+			name:        "single attempt never retries",
+			maxAttempts: 1,
+			attempts: []attempt{
+				{attempt: 1, exitCode: 1, want: false},
+			},
+		},
+		{
+			name:        "retries only matching exit codes",
+			maxAttempts: 3,
+			exitCodes:   []int{2, 3},
+			attempts: []attempt{
+				{attempt: 1, exitCode: 1, want: false},
+				{attempt: 1, exitCode: 2, want: true},
+				{attempt: 2, exitCode: 3, want: true},
+			},
+		},
+		{
+			name:        "retries only matching output",
+			maxAttempts: 2,
+			outputRegex: `Error acquiring the state lock`,
+			attempts: []attempt{
+				{attempt: 1, exitCode: 1, output: "some error", want: false},
+				{attempt: 1, exitCode: 1, output: "Error acquiring the state lock\n", want: true},
+			},
+		},
+		{
+			name:        "retries only matching exit codes and output",
+			maxAttempts: 2,
+			exitCodes:   []int{1},
+			outputRegex: `throttl`,
+			attempts: []attempt{
+				{attempt: 1, exitCode: 2, output: "throttling", want: false},
+				{attempt: 1, exitCode: 1, output: "throttled", want: true},
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := config.NewRetryPolicy(tc.maxAttempts, time.Second, tc.exitCodes, tc.outputRegex)
+			assert.NoError(t, err)
+
+			for _, a := range tc.attempts {
+				got := p.ShouldRetry(a.attempt, a.exitCode, []byte(a.output))
+				assert.IsTrue(t, got == a.want,
+					"attempt %d with exit code %d and output %q: got %t, want %t",
+					a.attempt, a.exitCode, a.output, got, a.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	t.Parallel()
+
+	p, err := config.NewRetryPolicy(4, time.Second, nil, "")
+	assert.NoError(t, err)
+	assert.IsTrue(t, p.Delay(1) == time.Second)
+	assert.IsTrue(t, p.Delay(2) == 2*time.Second)
+	assert.IsTrue(t, p.Delay(3) == 4*time.Second)
+
+	// The delay stops doubling at 5 minutes instead of overflowing.
+	assert.IsTrue(t, p.Delay(9) == 256*time.Second)
+	assert.IsTrue(t, p.Delay(10) == 5*time.Minute)
+	assert.IsTrue(t, p.Delay(100) == 5*time.Minute)
+	assert.IsTrue(t, p.Delay(1<<30) == 5*time.Minute)
+
+	p, err = config.NewRetryPolicy(4, time.Hour, nil, "")
+	assert.NoError(t, err)
+	assert.IsTrue(t, p.Delay(1) == time.Hour)
+	assert.IsTrue(t, p.Delay(100) == time.Hour)
+
+	p, err = config.NewRetryPolicy(4, 0, nil, "")
+	assert.NoError(t, err)
+	assert.IsTrue(t, p.Delay(1<<30) == 0)
+}
+
+func TestRetryPolicyNilNeverRetries(t *testing.T) {
+	t.Parallel()
+
+	var p *config.RetryPolicy
+	assert.IsTrue(t, !p.ShouldRetry(1, 1, nil))
+}
+
+func TestRetryPolicyValidation(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name        string
+		maxAttempts int
+		backoff     time.Duration
+		exitCodes   []int
+		outputRegex string
+	}{
+		{name: "zero max attempts", maxAttempts: 0},
+		{name: "negative backoff", maxAttempts: 2, backoff: -time.Second},
+		{name: "success exit code", maxAttempts: 2, exitCodes: []int{0}},
+		{name: "invalid regex", maxAttempts: 2, outputRegex: "("},
+	} {
+		_, err := config.NewRetryPolicy(tc.maxAttempts, tc.backoff, tc.exitCodes, tc.outputRegex)
+		assert.IsTrue(t, errors.IsKind(err, config.ErrInvalidRetryPolicy), "%s: unexpected error: %v", tc.name, err)
+	}
+}
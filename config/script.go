@@ -5,17 +5,23 @@ package config
 
 import (
 	"fmt"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	hhcl "github.com/terramate-io/hcl/v2"
 	"github.com/terramate-io/terramate/cloud/preview"
 	"github.com/terramate-io/terramate/errors"
 	"github.com/terramate-io/terramate/hcl"
+	"github.com/terramate-io/terramate/hcl/ast"
 	"github.com/terramate-io/terramate/hcl/eval"
 	"github.com/terramate-io/terramate/hcl/info"
 	"github.com/terramate-io/terramate/lets"
 	"github.com/terramate-io/terramate/printer"
 	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/exp/maps"
 )
 
 // Errors for indicating invalid script schema
@@ -26,6 +32,8 @@ const (
 	ErrScriptInvalidTypeCommands errors.Kind = "invalid type for script.job.commands"
 	ErrScriptEmptyCmds           errors.Kind = "job command or commands evaluated to empty list"
 	ErrScriptInvalidCmdOptions   errors.Kind = "invalid options for script command"
+	ErrScriptInvalidJobDeps      errors.Kind = "invalid script job dependencies"
+	ErrScriptInvalidEnv          errors.Kind = "invalid script env"
 )
 
 // MaxScriptNameRunes defines the maximum number of runes allowed for a script name.
@@ -45,6 +53,8 @@ type ScriptCmdOptions struct {
 	UseTerragrunt          bool
 	EnableSharing          bool
 	MockOnFail             bool
+	Timeout                time.Duration
+	Retry                  *RetryPolicy
 }
 
 // ScriptCmd represents an evaluated script command
@@ -59,6 +69,32 @@ type ScriptJob struct {
 	Description string
 	Cmd         *ScriptCmd
 	Cmds        []*ScriptCmd
+
+	// DependsOn are the names of the jobs that must finish before this job
+	// starts.
+	DependsOn []string
+
+	// Parallel tells if the job runs concurrently with the previous parallel
+	// jobs of the script.
+	Parallel bool
+
+	// Deps are the indexes of the jobs that must finish before this job
+	// starts. Jobs without depends_on wait for all the previous jobs, except
+	// for the consecutive parallel jobs.
+	Deps []int
+
+	// Skipped tells if the job condition is false in the stack. The commands
+	// of skipped jobs are not evaluated.
+	Skipped bool
+
+	// Env are the environment variables set for the commands of the job, in
+	// the NAME=value format and sorted by name. It includes the variables of
+	// the script env block not redefined by the job.
+	Env []string
+
+	// UnsetEnv are the sorted names of the environment variables removed from
+	// the environment of the commands of the job.
+	UnsetEnv []string
 }
 
 // Script represents an evaluated script block
@@ -68,6 +104,10 @@ type Script struct {
 	Name        string
 	Description string
 	Jobs        []ScriptJob
+
+	// Skipped tells if the script condition is false in the stack. The jobs
+	// of skipped scripts are not evaluated.
+	Skipped bool
 }
 
 // Commands is a convenience method for callers who don't specifically
@@ -81,20 +121,29 @@ func (es ScriptJob) Commands() []*ScriptCmd {
 	return es.Cmds
 }
 
-// EvalScript evaluates a script block using the provided evaluation context
+// EvalScript evaluates a script block using the provided evaluation context.
+// Only the stack context jobs are evaluated, see EvalScriptRootJobs.
 func EvalScript(evalctx *eval.Context, script hcl.Script) (Script, error) {
 	evaluatedScript := Script{
 		Range:  script.Range,
 		Labels: script.Labels,
 	}
 
-	errs := errors.L()
+	if script.Condition != nil {
+		cond, err := evalBool(evalctx, script.Condition.Expr, "script.condition")
+		if err != nil {
+			return Script{}, errors.E(ErrScriptInvalidType, script.Condition.Expr.Range(), err)
+		}
+		if !cond {
+			evaluatedScript.Skipped = true
+			return evaluatedScript, nil
+		}
+	}
 
-	localctx := evalctx.ChildContext()
-	localctx.SetNamespace("let", map[string]cty.Value{})
+	errs := errors.L()
 
-	errs.Append(lets.Load(script.Lets, localctx))
-	if err := errs.AsError(); err != nil {
+	localctx, err := scriptLocalContext(evalctx, script)
+	if err != nil {
 		return Script{}, err
 	}
 
@@ -124,68 +173,16 @@ func EvalScript(evalctx *eval.Context, script hcl.Script) (Script, error) {
 		evaluatedScript.Description = desc
 	}
 
-	for _, job := range script.Jobs {
-		evaluatedJob := ScriptJob{}
-
-		if job.Name != nil {
-			name, err := evalScriptStringField(localctx, job.Name.Expr, "script.job.name")
-			errs.Append(err)
-			if len(name) > MaxScriptNameRunes {
-				name = name[:MaxScriptNameRunes]
-
-				printer.Stderr.Warn(
-					fmt.Sprintf("`script.job.name` exceeds the maximum allowed characters (%d): field truncated", MaxScriptNameRunes),
-				)
-			}
-			evaluatedJob.Name = name
-		}
+	scriptEnv, err := evalScriptEnv(localctx, script.Env, nil)
+	errs.Append(err)
 
-		if job.Description != nil {
-			desc, err := evalScriptStringField(localctx, job.Description.Expr, "script.job.description")
+	stackJobs := script.StackJobs()
+	for _, job := range stackJobs {
+		evaluatedJob, err := evalScriptJob(localctx, job, scriptEnv)
+		if err != nil {
 			errs.Append(err)
-			if len(desc) > MaxScriptDescRunes {
-				desc = desc[:MaxScriptDescRunes]
-
-				printer.Stderr.Warn(
-					fmt.Sprintf("`script.job.description` exceeds the maximum allowed characters (%d): field truncated", MaxScriptDescRunes),
-				)
-			}
-
-			evaluatedJob.Description = desc
-		}
-
-		if job.Command != nil {
-			expr := job.Command.Expr
-			v, err := localctx.Eval(expr)
-			if err != nil {
-				errs.Append(errors.E(ErrScriptSchema, expr.Range(), err, "evaluating command"))
-				continue
-			}
-
-			command, err := unmarshalScriptJobCommand(v, expr)
-			if err != nil {
-				errs.Append(err)
-				continue
-			}
-			evaluatedJob.Cmd = command
-		}
-
-		if job.Commands != nil {
-			expr := job.Commands.Expr
-			v, err := localctx.Eval(expr)
-			if err != nil {
-				errs.Append(errors.E(ErrScriptSchema, expr.Range(), err, "evaluating commands"))
-				continue
-			}
-
-			commands, err := unmarshalScriptJobCommands(v, expr)
-			if err != nil {
-				errs.Append(err)
-				continue
-			}
-			evaluatedJob.Cmds = commands
+			continue
 		}
-
 		evaluatedScript.Jobs = append(evaluatedScript.Jobs, evaluatedJob)
 	}
 
@@ -224,9 +221,267 @@ func EvalScript(evalctx *eval.Context, script hcl.Script) (Script, error) {
 		return Script{}, err
 	}
 
+	if err := resolveScriptJobDeps(stackJobs, evaluatedScript.Jobs); err != nil {
+		return Script{}, err
+	}
+
 	return evaluatedScript, nil
 }
 
+// scriptLocalContext returns the evaluation context of the jobs of the
+// script, with its lets loaded.
+func scriptLocalContext(evalctx *eval.Context, script hcl.Script) (*eval.Context, error) {
+	localctx := evalctx.ChildContext()
+	localctx.SetNamespace("let", map[string]cty.Value{})
+
+	if err := lets.Load(script.Lets, localctx); err != nil {
+		return nil, err
+	}
+	return localctx, nil
+}
+
+// evalScriptJob evaluates a job block. The commands of the job are not
+// evaluated if its condition is false.
+func evalScriptJob(evalctx *eval.Context, job *hcl.ScriptJob, scriptEnv map[string]*string) (ScriptJob, error) {
+	errs := errors.L()
+	evaluatedJob := ScriptJob{}
+
+	if job.Name != nil {
+		name, err := evalScriptStringField(evalctx, job.Name.Expr, "script.job.name")
+		errs.Append(err)
+		if len(name) > MaxScriptNameRunes {
+			name = name[:MaxScriptNameRunes]
+
+			printer.Stderr.Warn(
+				fmt.Sprintf("`script.job.name` exceeds the maximum allowed characters (%d): field truncated", MaxScriptNameRunes),
+			)
+		}
+		evaluatedJob.Name = name
+	}
+
+	if job.Description != nil {
+		desc, err := evalScriptStringField(evalctx, job.Description.Expr, "script.job.description")
+		errs.Append(err)
+		if len(desc) > MaxScriptDescRunes {
+			desc = desc[:MaxScriptDescRunes]
+
+			printer.Stderr.Warn(
+				fmt.Sprintf("`script.job.description` exceeds the maximum allowed characters (%d): field truncated", MaxScriptDescRunes),
+			)
+		}
+
+		evaluatedJob.Description = desc
+	}
+
+	if job.DependsOn != nil {
+		dependsOn, err := evalScriptStringList(evalctx, job.DependsOn.Expr, "script.job.depends_on")
+		errs.Append(err)
+		evaluatedJob.DependsOn = dependsOn
+	}
+
+	if job.Parallel != nil {
+		parallel, err := evalBool(evalctx, job.Parallel.Expr, "script.job.parallel")
+		if err != nil {
+			errs.Append(errors.E(ErrScriptInvalidType, job.Parallel.Expr.Range(), err))
+		}
+		evaluatedJob.Parallel = parallel
+	}
+
+	if job.Condition != nil {
+		cond, err := evalBool(evalctx, job.Condition.Expr, "script.job.condition")
+		if err != nil {
+			errs.Append(errors.E(ErrScriptInvalidType, job.Condition.Expr.Range(), err))
+			return ScriptJob{}, errs.AsError()
+		}
+		if !cond {
+			evaluatedJob.Skipped = true
+			return evaluatedJob, errs.AsError()
+		}
+	}
+
+	jobEnv, err := evalScriptEnv(evalctx, job.Env, scriptEnv)
+	if err != nil {
+		errs.Append(err)
+		return ScriptJob{}, errs.AsError()
+	}
+	names := maps.Keys(jobEnv)
+	sort.Strings(names)
+	for _, name := range names {
+		if value := jobEnv[name]; value != nil {
+			evaluatedJob.Env = append(evaluatedJob.Env, name+"="+*value)
+		} else {
+			evaluatedJob.UnsetEnv = append(evaluatedJob.UnsetEnv, name)
+		}
+	}
+
+	if job.Command != nil {
+		expr := job.Command.Expr
+		v, err := evalctx.Eval(expr)
+		if err != nil {
+			errs.Append(errors.E(ErrScriptSchema, expr.Range(), err, "evaluating command"))
+			return ScriptJob{}, errs.AsError()
+		}
+
+		command, err := unmarshalScriptJobCommand(v, expr)
+		if err != nil {
+			errs.Append(err)
+			return ScriptJob{}, errs.AsError()
+		}
+		evaluatedJob.Cmd = command
+	}
+
+	if job.Commands != nil {
+		expr := job.Commands.Expr
+		v, err := evalctx.Eval(expr)
+		if err != nil {
+			errs.Append(errors.E(ErrScriptSchema, expr.Range(), err, "evaluating commands"))
+			return ScriptJob{}, errs.AsError()
+		}
+
+		commands, err := unmarshalScriptJobCommands(v, expr)
+		if err != nil {
+			errs.Append(err)
+			return ScriptJob{}, errs.AsError()
+		}
+		evaluatedJob.Cmds = commands
+	}
+
+	if err := errs.AsError(); err != nil {
+		return ScriptJob{}, err
+	}
+	return evaluatedJob, nil
+}
+
+// resolveScriptJobDeps computes the dependencies of each evaluated job and
+// checks they don't form a cycle.
+func resolveScriptJobDeps(jobs []*hcl.ScriptJob, evaluated []ScriptJob) error {
+	const ambiguous = -1
+
+	indexes := map[string]int{}
+	for i, job := range evaluated {
+		if job.Name == "" {
+			continue
+		}
+		if _, ok := indexes[job.Name]; ok {
+			indexes[job.Name] = ambiguous
+		} else {
+			indexes[job.Name] = i
+		}
+	}
+
+	errs := errors.L()
+	for i := range evaluated {
+		job := &evaluated[i]
+		switch {
+		case jobs[i].DependsOn != nil:
+			rng := jobs[i].DependsOn.Expr.Range()
+			for _, name := range job.DependsOn {
+				idx, ok := indexes[name]
+				switch {
+				case !ok:
+					errs.Append(errors.E(ErrScriptInvalidJobDeps, rng, "job %q not found", name))
+				case idx == ambiguous:
+					errs.Append(errors.E(ErrScriptInvalidJobDeps, rng, "job name %q is not unique", name))
+				case idx == i:
+					errs.Append(errors.E(ErrScriptInvalidJobDeps, rng, "job %q depends on itself", name))
+				case !slices.Contains(job.Deps, idx):
+					job.Deps = append(job.Deps, idx)
+				}
+			}
+		default:
+			// Consecutive parallel jobs wait only for the jobs before them.
+			last := i
+			if job.Parallel {
+				for last > 0 && evaluated[last-1].Parallel && jobs[last-1].DependsOn == nil {
+					last--
+				}
+			}
+			for j := 0; j < last; j++ {
+				job.Deps = append(job.Deps, j)
+			}
+		}
+	}
+
+	if err := errs.AsError(); err != nil {
+		return err
+	}
+
+	// Jobs are removed as their dependencies are satisfied, the remaining
+	// ones are part of a cycle.
+	done := make([]bool, len(evaluated))
+	for pending := len(evaluated); pending > 0; {
+		progress := false
+		for i, job := range evaluated {
+			if done[i] || slices.ContainsFunc(job.Deps, func(dep int) bool { return !done[dep] }) {
+				continue
+			}
+			done[i] = true
+			pending--
+			progress = true
+		}
+		if !progress {
+			// A cycle always contains a job with depends_on, as the other
+			// jobs only depend on the previous ones.
+			var cycle []string
+			var rng hhcl.Range
+			for i, job := range evaluated {
+				if done[i] {
+					continue
+				}
+				name := strconv.Quote(job.Name)
+				if job.Name == "" {
+					name = fmt.Sprintf("#%d", i+1)
+				}
+				cycle = append(cycle, name)
+				if jobs[i].DependsOn != nil && rng.Filename == "" {
+					rng = jobs[i].DependsOn.Expr.Range()
+				}
+			}
+			return errors.E(ErrScriptInvalidJobDeps, rng,
+				"jobs %s have cyclic dependencies", strings.Join(cycle, ", "))
+		}
+	}
+	return nil
+}
+
+// evalScriptEnv evaluates the attributes of an env block on top of the
+// inherited variables. Variables set to unset or null are mapped to nil.
+func evalScriptEnv(evalctx *eval.Context, env ast.Attributes, inherited map[string]*string) (map[string]*string, error) {
+	vars := maps.Clone(inherited)
+	if vars == nil {
+		vars = map[string]*string{}
+	}
+
+	errs := errors.L()
+	for _, attr := range env.SortedList() {
+		traversal, diags := hhcl.AbsTraversalForExpr(attr.Expr)
+		if !diags.HasErrors() && len(traversal) == 1 && traversal.RootName() == "unset" {
+			vars[attr.Name] = nil
+			continue
+		}
+		val, err := evalctx.Eval(attr.Expr)
+		if err != nil {
+			errs.Append(errors.E(ErrScriptInvalidEnv, attr.Expr.Range(), err, "evaluating env.%s", attr.Name))
+			continue
+		}
+		if val.IsNull() {
+			vars[attr.Name] = nil
+			continue
+		}
+		if val.Type() != cty.String {
+			errs.Append(errors.E(ErrScriptInvalidEnv, attr.Expr.Range(),
+				"env.%s must be a string, but has type %s", attr.Name, val.Type().FriendlyName()))
+			continue
+		}
+		value := val.AsString()
+		vars[attr.Name] = &value
+	}
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
 func evalScriptStringField(evalctx *eval.Context, expr hhcl.Expression, name string) (string, error) {
 	f, err := evalString(evalctx, expr, name)
 	if err != nil {
@@ -235,6 +490,27 @@ func evalScriptStringField(evalctx *eval.Context, expr hhcl.Expression, name str
 	return f, nil
 }
 
+func evalScriptStringList(evalctx *eval.Context, expr hhcl.Expression, name string) ([]string, error) {
+	v, err := evalctx.Eval(expr)
+	if err != nil {
+		return nil, errors.E(ErrScriptSchema, expr.Range(), err, "evaluating %s", name)
+	}
+	if !v.Type().IsTupleType() && !v.Type().IsListType() {
+		return nil, errors.E(ErrScriptInvalidType, expr.Range(),
+			"%s must be a list(string), but has type %s", name, v.Type().FriendlyName())
+	}
+	var list []string
+	for it := v.ElementIterator(); it.Next(); {
+		_, elem := it.Element()
+		if elem.Type() != cty.String {
+			return nil, errors.E(ErrScriptInvalidType, expr.Range(),
+				"%s must be a list(string), but element %d has type %s", name, len(list), elem.Type().FriendlyName())
+		}
+		list = append(list, elem.AsString())
+	}
+	return list, nil
+}
+
 func unmarshalScriptJobCommands(cmdList cty.Value, expr hhcl.Expression) ([]*ScriptCmd, error) {
 	if !cmdList.Type().IsTupleType() && !cmdList.Type().IsListType() {
 		return nil, errors.E(ErrScriptInvalidTypeCommands,
@@ -450,6 +726,29 @@ func unmarshalScriptCommandOptions(obj cty.Value, expr hhcl.Expression) (*Script
 			}
 			r.MockOnFail = v.True()
 
+		case "timeout":
+			if v.Type() != cty.String {
+				errs.Append(errors.E(ErrScriptInvalidCmdOptions, expr.Range(),
+					"command option '%s' must be a string, but has type %s",
+					ks, v.Type().FriendlyName()))
+				break
+			}
+			d, err := time.ParseDuration(v.AsString())
+			if err != nil || d < 0 {
+				errs.Append(errors.E(ErrScriptInvalidCmdOptions, expr.Range(),
+					"command option '%s' must be a non-negative duration, like \"10m\"", ks))
+				break
+			}
+			r.Timeout = d
+
+		case "retry":
+			retry, err := unmarshalRetryPolicy(v, expr)
+			if err != nil {
+				errs.Append(err)
+				break
+			}
+			r.Retry = retry
+
 		default:
 			errs.Append(errors.E(ErrScriptInvalidCmdOptions, expr.Range(), "unknown command option: %s", ks))
 		}
@@ -0,0 +1,180 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"strings"
+
+	hhcl "github.com/terramate-io/hcl/v2"
+	"github.com/terramate-io/hcl/v2/ext/typeexpr"
+	hclsyntax "github.com/terramate-io/hcl/v2/hclsyntax"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/hcl"
+	"github.com/terramate-io/terramate/hcl/eval"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// ErrScriptParam indicates an invalid script parameter definition or value.
+const ErrScriptParam errors.Kind = "invalid script parameter"
+
+// ScriptParam is an evaluated parameter of a script.
+type ScriptParam struct {
+	Name        string
+	Description string
+
+	// Type is the type of the parameter value, defaults to string.
+	Type cty.Type
+
+	// Default is the value of the parameter if it's not set, or cty.NilVal
+	// if the parameter is required.
+	Default cty.Value
+}
+
+// ParseScriptParam parses a parameter value in the format `name=value`.
+func ParseScriptParam(s string) (name string, value string, err error) {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || !hclsyntax.ValidIdentifier(name) {
+		return "", "", errors.E(ErrScriptParam, "%q must be in the format name=value", s)
+	}
+	return name, value, nil
+}
+
+// Required tells if the parameter must be set, as it has no default value.
+func (p ScriptParam) Required() bool {
+	return p.Default.Type() == cty.NilType
+}
+
+// EvalScriptParams evaluates the param blocks of a script. The defaults are
+// evaluated with the given context and converted to the parameter type.
+func EvalScriptParams(evalctx *eval.Context, params []*hcl.ScriptParam) ([]ScriptParam, error) {
+	errs := errors.L()
+	var evaluated []ScriptParam
+	for _, param := range params {
+		p := ScriptParam{
+			Name:    param.Name,
+			Type:    cty.String,
+			Default: cty.NilVal,
+		}
+
+		if param.Type != nil {
+			typ, diags := typeexpr.TypeConstraint(param.Type.Expr)
+			if diags.HasErrors() {
+				errs.Append(errors.E(ErrScriptParam, param.Type.Expr.Range(), diags,
+					"param.%s has an invalid type", param.Name))
+				continue
+			}
+			p.Type = typ
+		}
+
+		if param.Description != nil {
+			desc, err := evalString(evalctx, param.Description.Expr, "param.description")
+			if err != nil {
+				errs.Append(errors.E(ErrScriptParam, param.Description.Expr.Range(), err))
+				continue
+			}
+			p.Description = desc
+		}
+
+		if param.Default != nil {
+			val, err := evalctx.Eval(param.Default.Expr)
+			if err != nil {
+				errs.Append(errors.E(ErrScriptParam, param.Default.Expr.Range(), err))
+				continue
+			}
+			val, err = convert.Convert(val, p.Type)
+			if err != nil {
+				errs.Append(errors.E(ErrScriptParam, param.Default.Expr.Range(),
+					"param.%s default must be of type %s: %s",
+					param.Name, typeexpr.TypeString(p.Type), err))
+				continue
+			}
+			p.Default = val
+		}
+
+		evaluated = append(evaluated, p)
+	}
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+	return evaluated, nil
+}
+
+// BindScriptParams returns the values of the script parameters, given the
+// values set in the command line by parameter name. The values of string
+// parameters are used as is, other values are parsed as HCL expressions and
+// converted to the parameter type.
+func BindScriptParams(params []ScriptParam, values map[string]string) (map[string]cty.Value, error) {
+	errs := errors.L()
+	for name := range values {
+		found := false
+		for _, param := range params {
+			if param.Name == name {
+				found = true
+			}
+		}
+		if !found {
+			errs.Append(errors.E(ErrScriptParam, "unknown parameter %q", name))
+		}
+	}
+
+	bound := map[string]cty.Value{}
+	for _, param := range params {
+		str, ok := values[param.Name]
+		if !ok {
+			if param.Required() {
+				errs.Append(errors.E(ErrScriptParam, "missing required parameter %q", param.Name))
+				continue
+			}
+			bound[param.Name] = param.Default
+			continue
+		}
+
+		val, err := parseScriptParamValue(param, str)
+		if err != nil {
+			errs.Append(err)
+			continue
+		}
+		bound[param.Name] = val
+	}
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+	return bound, nil
+}
+
+func parseScriptParamValue(param ScriptParam, str string) (cty.Value, error) {
+	if param.Type.Equals(cty.String) || param.Type.Equals(cty.DynamicPseudoType) {
+		return cty.StringVal(str), nil
+	}
+	expr, diags := hclsyntax.ParseExpression([]byte(str), "<param>", hhcl.InitialPos)
+	if diags.HasErrors() {
+		return cty.NilVal, errors.E(ErrScriptParam, diags,
+			"parameter %q must be of type %s", param.Name, typeexpr.TypeString(param.Type))
+	}
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return cty.NilVal, errors.E(ErrScriptParam, diags,
+			"parameter %q must be of type %s", param.Name, typeexpr.TypeString(param.Type))
+	}
+	val, err := convert.Convert(val, param.Type)
+	if err != nil {
+		return cty.NilVal, errors.E(ErrScriptParam,
+			"parameter %q must be of type %s: %s", param.Name, typeexpr.TypeString(param.Type), err)
+	}
+	return val, nil
+}
+
+// SetScriptParamsNamespace sets the values of the script parameters as
+// `script.params.<name>` in the evaluation context.
+func SetScriptParamsNamespace(evalctx *eval.Context, values map[string]cty.Value) {
+	script := map[string]cty.Value{}
+	if ns, ok := evalctx.GetNamespace("script"); ok && ns.Type().IsObjectType() {
+		for name, val := range ns.AsValueMap() {
+			script[name] = val
+		}
+	}
+	script["params"] = cty.ObjectVal(values)
+	evalctx.SetNamespace("script", script)
+}
@@ -0,0 +1,113 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package config_test
+
+import (
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	hhcl "github.com/terramate-io/hcl/v2"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/hcl"
+	"github.com/terramate-io/terramate/hcl/ast"
+	"github.com/terramate-io/terramate/hcl/eval"
+	"github.com/terramate-io/terramate/test"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestParseScriptParam(t *testing.T) {
+	t.Parallel()
+
+	name, value, err := config.ParseScriptParam("region=eu-west-1")
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "region", name)
+	assert.EqualStrings(t, "eu-west-1", value)
+
+	name, value, err = config.ParseScriptParam("filter=a=b")
+	assert.NoError(t, err)
+	assert.EqualStrings(t, "filter", name)
+	assert.EqualStrings(t, "a=b", value)
+
+	for _, flag := range []string{"region", "=eu", "1region=eu"} {
+		_, _, err := config.ParseScriptParam(flag)
+		assert.IsTrue(t, errors.IsKind(err, config.ErrScriptParam), "%s: want param error, got %v", flag, err)
+	}
+}
+
+func TestScriptParams(t *testing.T) {
+	t.Parallel()
+
+	evalctx := eval.NewContext(nil)
+	evalctx.SetNamespace("global", map[string]cty.Value{
+		"region": cty.StringVal("eu-west-1"),
+	})
+
+	attr := func(name, expr string) *ast.Attribute {
+		return &ast.Attribute{
+			Attribute: &hhcl.Attribute{Name: name, Expr: test.NewExpr(t, expr)},
+		}
+	}
+
+	params, err := config.EvalScriptParams(evalctx, []*hcl.ScriptParam{
+		{
+			Name:        "region",
+			Default:     attr("default", `global.region`),
+			Description: attr("description", `"AWS region"`),
+		},
+		{
+			Name: "replicas",
+			Type: attr("type", `number`),
+		},
+		{
+			Name:    "zones",
+			Type:    attr("type", `list(string)`),
+			Default: attr("default", `["a"]`),
+		},
+	})
+	assert.NoError(t, err)
+	assert.EqualInts(t, 3, len(params))
+	assert.EqualStrings(t, "AWS region", params[0].Description)
+	assert.IsTrue(t, params[0].Type.Equals(cty.String))
+	assert.IsTrue(t, !params[0].Required())
+	assert.IsTrue(t, params[1].Required())
+	assert.IsTrue(t, params[2].Type.Equals(cty.List(cty.String)))
+
+	values, err := config.BindScriptParams(params, map[string]string{
+		"replicas": "3",
+		"zones":    `["b", "c"]`,
+	})
+	assert.NoError(t, err)
+
+	config.SetScriptParamsNamespace(evalctx, values)
+	for expr, want := range map[string]string{
+		`script.params.region`:                       "eu-west-1",
+		`"n=${script.params.replicas + 1}"`:          "n=4",
+		`"zone=${script.params.zones[1]}"`:           "zone=c",
+		`"${script.params.region}/${global.region}"`: "eu-west-1/eu-west-1",
+	} {
+		val, err := evalctx.Eval(test.NewExpr(t, expr))
+		assert.NoError(t, err, expr)
+		assert.EqualStrings(t, want, val.AsString(), expr)
+	}
+
+	for _, values := range []map[string]string{
+		{},
+		{"replicas": "three"},
+		{"replicas": "3", "zones": `"a"`},
+		{"replicas": "3", "unknown": "x"},
+	} {
+		_, err := config.BindScriptParams(params, values)
+		assert.IsTrue(t, errors.IsKind(err, config.ErrScriptParam), "%v: want param error, got %v", values, err)
+	}
+
+	for _, param := range []*hcl.ScriptParam{
+		{Name: "region", Type: attr("type", `strin`)},
+		{Name: "region", Type: attr("type", `number`), Default: attr("default", `"eu"`)},
+		{Name: "region", Default: attr("default", `global.undefined`)},
+	} {
+		_, err := config.EvalScriptParams(evalctx, []*hcl.ScriptParam{param})
+		assert.IsTrue(t, errors.IsKind(err, config.ErrScriptParam), "want param error, got %v", err)
+	}
+}
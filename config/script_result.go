@@ -0,0 +1,93 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/hcl"
+	"github.com/terramate-io/terramate/hcl/eval"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ScriptResult is the result of the jobs of a script executed in a stack,
+// exposed to its on_failure and finally jobs as script.result.
+type ScriptResult struct {
+	// Failed tells if any job of the script failed.
+	Failed bool
+
+	// FailedJob is the name of the failed job, if any.
+	FailedJob string
+
+	// ExitCode is the exit code of the failed command, zero if no job failed
+	// and -1 if the command didn't exit by itself.
+	ExitCode int
+}
+
+// SetScriptResultNamespace sets the script.result namespace of the
+// evaluation context, keeping the other values of the script namespace.
+func SetScriptResultNamespace(evalctx *eval.Context, result ScriptResult) {
+	script := map[string]cty.Value{}
+	if ns, ok := evalctx.GetNamespace("script"); ok && ns.Type().IsObjectType() {
+		for name, val := range ns.AsValueMap() {
+			script[name] = val
+		}
+	}
+	script["result"] = cty.ObjectVal(map[string]cty.Value{
+		"failed":     cty.BoolVal(result.Failed),
+		"failed_job": cty.StringVal(result.FailedJob),
+		"exit_code":  cty.NumberIntVal(int64(result.ExitCode)),
+	})
+	evalctx.SetNamespace("script", script)
+}
+
+// EvalScriptResultJobs evaluates the jobs executed after the jobs of the
+// script, given their result: the on_failure jobs, if a job failed, followed
+// by the finally jobs.
+func EvalScriptResultJobs(evalctx *eval.Context, script hcl.Script, result ScriptResult) ([]ScriptJob, error) {
+	resultctx := evalctx.ChildContext()
+	SetScriptResultNamespace(resultctx, result)
+
+	var jobs []*hcl.ScriptJob
+	if result.Failed {
+		jobs = append(jobs, script.OnFailure...)
+	}
+	jobs = append(jobs, script.Finally...)
+	return evalScriptUnsyncedJobs(resultctx, script, jobs, "on_failure and finally jobs")
+}
+
+// evalScriptUnsyncedJobs evaluates the given jobs of the script, which can't
+// have sync options since they are not part of the jobs of the stacks.
+func evalScriptUnsyncedJobs(evalctx *eval.Context, script hcl.Script, jobs []*hcl.ScriptJob, desc string) ([]ScriptJob, error) {
+	localctx, err := scriptLocalContext(evalctx, script)
+	if err != nil {
+		return nil, err
+	}
+
+	scriptEnv, err := evalScriptEnv(localctx, script.Env, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := errors.L()
+	var evaluated []ScriptJob
+	for _, job := range jobs {
+		evaluatedJob, err := evalScriptJob(localctx, job, scriptEnv)
+		if err != nil {
+			errs.Append(err)
+			continue
+		}
+		for _, cmd := range evaluatedJob.Commands() {
+			if cmd.Options != nil &&
+				(cmd.Options.CloudSyncDeployment || cmd.Options.CloudSyncDriftStatus || cmd.Options.CloudSyncPreview) {
+				errs.Append(errors.E(ErrScriptInvalidCmdOptions, script.Range,
+					"sync options cannot be used in %s", desc))
+			}
+		}
+		evaluated = append(evaluated, evaluatedJob)
+	}
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+	return evaluated, nil
+}
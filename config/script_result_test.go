@@ -0,0 +1,98 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package config_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/madlambda/spells/assert"
+	hhcl "github.com/terramate-io/hcl/v2"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/hcl"
+	"github.com/terramate-io/terramate/hcl/ast"
+	"github.com/terramate-io/terramate/hcl/eval"
+	"github.com/terramate-io/terramate/test"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestScriptResultJobs(t *testing.T) {
+	t.Parallel()
+
+	attr := func(name, expr string) *ast.Attribute {
+		return &ast.Attribute{
+			Attribute: &hhcl.Attribute{Name: name, Expr: test.NewExpr(t, expr)},
+		}
+	}
+	command := func(expr string) *hcl.Command {
+		return hcl.NewScriptCommand(*attr("command", expr))
+	}
+
+	evalctx := eval.NewContext(nil)
+	evalctx.SetNamespace("global", map[string]cty.Value{
+		"channel": cty.StringVal("#deploys"),
+	})
+	config.SetScriptParamsNamespace(evalctx, map[string]cty.Value{
+		"region": cty.StringVal("eu-west-1"),
+	})
+
+	script := hcl.Script{
+		Labels: []string{"deploy"},
+		Lets:   ast.NewMergedBlock("lets", []string{}),
+		OnFailure: []*hcl.ScriptJob{
+			{
+				Name:    attr("name", `"notify"`),
+				Command: command(`["notify", global.channel, "${script.result.failed_job}: ${script.result.exit_code}"]`),
+			},
+		},
+		Finally: []*hcl.ScriptJob{
+			{
+				Command: command(`["unlock", script.params.region, script.result.failed ? "failed" : "ok"]`),
+			},
+		},
+	}
+
+	jobs, err := config.EvalScriptResultJobs(evalctx, script, config.ScriptResult{
+		Failed:    true,
+		FailedJob: "apply",
+		ExitCode:  2,
+	})
+	assert.NoError(t, err)
+	want := []config.ScriptJob{
+		{
+			Name: "notify",
+			Cmd:  &config.ScriptCmd{Args: []string{"notify", "#deploys", "apply: 2"}},
+		},
+		{
+			Cmd: &config.ScriptCmd{Args: []string{"unlock", "eu-west-1", "failed"}},
+		},
+	}
+	if diff := cmp.Diff(want, jobs); diff != "" {
+		t.Fatalf("unexpected jobs\n%s", diff)
+	}
+
+	jobs, err = config.EvalScriptResultJobs(evalctx, script, config.ScriptResult{})
+	assert.NoError(t, err)
+	want = []config.ScriptJob{
+		{
+			Cmd: &config.ScriptCmd{Args: []string{"unlock", "eu-west-1", "ok"}},
+		},
+	}
+	if diff := cmp.Diff(want, jobs); diff != "" {
+		t.Fatalf("unexpected jobs\n%s", diff)
+	}
+
+	// The result is not set in the evaluation context of the caller.
+	_, err = evalctx.Eval(test.NewExpr(t, `script.result`))
+	assert.Error(t, err)
+
+	script.Finally = []*hcl.ScriptJob{
+		{
+			Command: command(`["unlock", {sync_deployment = true}]`),
+		},
+	}
+	_, err = config.EvalScriptResultJobs(evalctx, script, config.ScriptResult{})
+	assert.IsTrue(t, errors.IsKind(err, config.ErrScriptInvalidCmdOptions), "want options error, got %v", err)
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/hcl"
+	"github.com/terramate-io/terramate/hcl/eval"
+	"github.com/terramate-io/terramate/project"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// SetRunStacksNamespace sets terramate.run.stacks in the evaluation context
+// to the paths of the stacks selected for a run.
+func SetRunStacksNamespace(evalctx *eval.Context, stacks project.Paths) {
+	paths := make([]cty.Value, len(stacks))
+	for i, stack := range stacks {
+		paths[i] = cty.StringVal(stack.String())
+	}
+	stacksVal := cty.ListValEmpty(cty.String)
+	if len(paths) > 0 {
+		stacksVal = cty.ListVal(paths)
+	}
+
+	terramate := map[string]cty.Value{}
+	if ns, ok := evalctx.GetNamespace("terramate"); ok && ns.Type().IsObjectType() {
+		terramate = ns.AsValueMap()
+	}
+	run := map[string]cty.Value{}
+	if old, ok := terramate["run"]; ok && old.Type().IsObjectType() {
+		run = old.AsValueMap()
+	}
+	run["stacks"] = stacksVal
+	terramate["run"] = cty.ObjectVal(run)
+	evalctx.SetNamespace("terramate", terramate)
+}
+
+// EvalScriptRootJobs evaluates the root context jobs of the script, which
+// are executed once in the root of the project before and after the stacks.
+// The evaluation context is expected to be the one of the project root, with
+// terramate.run.stacks set. No jobs are returned if the condition of a root
+// context script is false.
+func EvalScriptRootJobs(evalctx *eval.Context, script hcl.Script) (before, after []ScriptJob, err error) {
+	if script.Context == hcl.ScriptRootContext && script.Condition != nil {
+		cond, err := evalBool(evalctx, script.Condition.Expr, "script.condition")
+		if err != nil {
+			return nil, nil, errors.E(ErrScriptInvalidType, script.Condition.Expr.Range(), err)
+		}
+		if !cond {
+			return nil, nil, nil
+		}
+	}
+
+	beforeJobs, afterJobs := script.RootJobs()
+	jobs, err := evalScriptUnsyncedJobs(evalctx, script,
+		append(append([]*hcl.ScriptJob{}, beforeJobs...), afterJobs...), "root context jobs")
+	if err != nil {
+		return nil, nil, err
+	}
+	return jobs[:len(beforeJobs)], jobs[len(beforeJobs):], nil
+}
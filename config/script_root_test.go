@@ -0,0 +1,83 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package config_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/madlambda/spells/assert"
+	hhcl "github.com/terramate-io/hcl/v2"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/hcl"
+	"github.com/terramate-io/terramate/hcl/ast"
+	"github.com/terramate-io/terramate/hcl/eval"
+	"github.com/terramate-io/terramate/project"
+	"github.com/terramate-io/terramate/test"
+)
+
+func TestScriptRootJobs(t *testing.T) {
+	t.Parallel()
+
+	attr := func(name, expr string) *ast.Attribute {
+		return &ast.Attribute{
+			Attribute: &hhcl.Attribute{Name: name, Expr: test.NewExpr(t, expr)},
+		}
+	}
+	command := func(expr string) *hcl.Command {
+		return hcl.NewScriptCommand(*attr("command", expr))
+	}
+
+	evalctx := eval.NewContext(nil)
+	config.SetRunStacksNamespace(evalctx, project.Paths{
+		project.NewPath("/stacks/a"),
+		project.NewPath("/stacks/b"),
+	})
+
+	script := hcl.Script{
+		Labels:  []string{"deploy"},
+		Context: hcl.ScriptStackContext,
+		Lets:    ast.NewMergedBlock("lets", []string{}),
+		Jobs: []*hcl.ScriptJob{
+			{
+				Name:    attr("name", `"credentials"`),
+				Context: hcl.ScriptRootContext,
+				Command: command(`["refresh-credentials"]`),
+			},
+			{
+				Context: hcl.ScriptStackContext,
+				Command: command(`["terraform", "apply"]`),
+			},
+			{
+				Name:    attr("name", `"report"`),
+				Context: hcl.ScriptRootContext,
+				Command: command(`["report", terramate.run.stacks[0], terramate.run.stacks[1]]`),
+			},
+		},
+	}
+
+	before, after, err := config.EvalScriptRootJobs(evalctx, script)
+	assert.NoError(t, err)
+	if diff := cmp.Diff([]config.ScriptJob{
+		{
+			Name: "credentials",
+			Cmd:  &config.ScriptCmd{Args: []string{"refresh-credentials"}},
+		},
+	}, before); diff != "" {
+		t.Fatalf("unexpected before jobs\n%s", diff)
+	}
+	if diff := cmp.Diff([]config.ScriptJob{
+		{
+			Name: "report",
+			Cmd:  &config.ScriptCmd{Args: []string{"report", "/stacks/a", "/stacks/b"}},
+		},
+	}, after); diff != "" {
+		t.Fatalf("unexpected after jobs\n%s", diff)
+	}
+
+	script.Jobs[0].Command = command(`["refresh-credentials", {sync_deployment = true}]`)
+	_, _, err = config.EvalScriptRootJobs(evalctx, script)
+	assert.IsTrue(t, errors.IsKind(err, config.ErrScriptInvalidCmdOptions), "want options error, got %v", err)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -432,10 +433,286 @@ func TestScriptEval(t *testing.T) {
 							{Args: []string{"echo", "HELLO TERRAMATE"}},
 							{Args: []string{"ls", "-l"}},
 						},
+						Deps: []int{0},
 					},
 				},
 			},
 		},
+		{
+			name: "jobs with dependencies and parallel jobs",
+			config: Script(
+				Labels(labels...),
+				Block("job",
+					Str("name", "init"),
+					Command("init"),
+				),
+				Block("job",
+					Str("name", "lint"),
+					Bool("parallel", true),
+					Command("lint"),
+				),
+				Block("job",
+					Str("name", "scan"),
+					Bool("parallel", true),
+					Command("scan"),
+				),
+				Block("job",
+					Str("name", "validate"),
+					Expr("depends_on", `["init"]`),
+					Command("validate"),
+				),
+				Block("job",
+					Str("name", "plan"),
+					Command("plan"),
+				),
+			),
+			want: config.Script{
+				Labels: labels,
+				Jobs: []config.ScriptJob{
+					{
+						Name: "init",
+						Cmd:  &config.ScriptCmd{Args: []string{"init"}},
+					},
+					{
+						Name:     "lint",
+						Cmd:      &config.ScriptCmd{Args: []string{"lint"}},
+						Parallel: true,
+						Deps:     []int{0},
+					},
+					{
+						Name:     "scan",
+						Cmd:      &config.ScriptCmd{Args: []string{"scan"}},
+						Parallel: true,
+						Deps:     []int{0},
+					},
+					{
+						Name:      "validate",
+						Cmd:       &config.ScriptCmd{Args: []string{"validate"}},
+						DependsOn: []string{"init"},
+						Deps:      []int{0},
+					},
+					{
+						Name: "plan",
+						Cmd:  &config.ScriptCmd{Args: []string{"plan"}},
+						Deps: []int{0, 1, 2, 3},
+					},
+				},
+			},
+		},
+		{
+			name: "job.parallel attribute wrong type",
+			config: Script(
+				Labels(labels...),
+				Block("job",
+					Str("parallel", "true"),
+					Command("lint"),
+				),
+			),
+			wantErr: errors.E(config.ErrScriptInvalidType),
+		},
+		{
+			name: "job.depends_on attribute wrong type",
+			config: Script(
+				Labels(labels...),
+				Block("job",
+					Str("name", "lint"),
+					Command("lint"),
+				),
+				Block("job",
+					Str("depends_on", "lint"),
+					Command("plan"),
+				),
+			),
+			wantErr: errors.E(config.ErrScriptInvalidType),
+		},
+		{
+			name: "job depends on unknown job",
+			config: Script(
+				Labels(labels...),
+				Block("job",
+					Expr("depends_on", `["lint"]`),
+					Command("plan"),
+				),
+			),
+			wantErr: errors.E(config.ErrScriptInvalidJobDeps),
+		},
+		{
+			name: "job depends on ambiguous job name",
+			config: Script(
+				Labels(labels...),
+				Block("job",
+					Str("name", "lint"),
+					Command("lint"),
+				),
+				Block("job",
+					Str("name", "lint"),
+					Command("lint"),
+				),
+				Block("job",
+					Expr("depends_on", `["lint"]`),
+					Command("plan"),
+				),
+			),
+			wantErr: errors.E(config.ErrScriptInvalidJobDeps),
+		},
+		{
+			name: "jobs with cyclic dependencies",
+			config: Script(
+				Labels(labels...),
+				Block("job",
+					Str("name", "lint"),
+					Expr("depends_on", `["plan"]`),
+					Command("lint"),
+				),
+				Block("job",
+					Str("name", "plan"),
+					Command("plan"),
+				),
+			),
+			wantErr: errors.E(config.ErrScriptInvalidJobDeps),
+		},
+		{
+			name: "script condition is false",
+			config: Script(
+				Labels(labels...),
+				Str("description", "some description"),
+				Expr("condition", `global.enabled`),
+				Block("job",
+					Expr("command", `["echo", global.undefined]`),
+				),
+			),
+			globals: map[string]cty.Value{
+				"enabled": cty.False,
+			},
+			want: config.Script{
+				Labels:  labels,
+				Skipped: true,
+			},
+		},
+		{
+			name: "script condition is true",
+			config: Script(
+				Labels(labels...),
+				Expr("condition", `tm_contains(terramate.stack.tags, "terraform") || global.enabled`),
+				Block("job",
+					Command("echo", "hello"),
+				),
+			),
+			globals: map[string]cty.Value{
+				"enabled": cty.True,
+			},
+			want: config.Script{
+				Labels: labels,
+				Jobs: []config.ScriptJob{
+					{Cmd: &config.ScriptCmd{Args: []string{"echo", "hello"}}},
+				},
+			},
+		},
+		{
+			name: "job condition is false",
+			config: Script(
+				Labels(labels...),
+				Block("job",
+					Str("name", "tflint"),
+					Expr("condition", `tm_contains(terramate.stack.tags, "terraform")`),
+					Expr("command", `["tflint", global.undefined]`),
+				),
+				Block("job",
+					Str("name", "plan"),
+					Expr("condition", `!tm_contains(terramate.stack.tags, "terraform")`),
+					Command("plan"),
+				),
+			),
+			want: config.Script{
+				Labels: labels,
+				Jobs: []config.ScriptJob{
+					{
+						Name:    "tflint",
+						Skipped: true,
+					},
+					{
+						Name: "plan",
+						Cmd:  &config.ScriptCmd{Args: []string{"plan"}},
+						Deps: []int{0},
+					},
+				},
+			},
+		},
+		{
+			name: "script.condition attribute wrong type",
+			config: Script(
+				Labels(labels...),
+				Str("condition", "true"),
+				Block("job",
+					Command("echo", "hello"),
+				),
+			),
+			wantErr: errors.E(config.ErrScriptInvalidType),
+		},
+		{
+			name: "job.condition attribute wrong type",
+			config: Script(
+				Labels(labels...),
+				Block("job",
+					Number("condition", 1),
+					Command("echo", "hello"),
+				),
+			),
+			wantErr: errors.E(config.ErrScriptInvalidType),
+		},
+		{
+			name: "script and job env",
+			config: Script(
+				Labels(labels...),
+				Block("env",
+					Expr("AWS_PROFILE", `global.profile`),
+					Str("TF_LOG", "debug"),
+					Expr("TF_INPUT", `unset`),
+				),
+				Block("job",
+					Block("env",
+						Expr("TF_CLI_ARGS_plan", `"-lock=false -var=stack=${terramate.stack.path.absolute}"`),
+						Expr("TF_LOG", `null`),
+					),
+					Command("terraform", "plan"),
+				),
+				Block("job",
+					Command("terraform", "apply"),
+				),
+			),
+			globals: map[string]cty.Value{
+				"profile": cty.StringVal("prod"),
+			},
+			want: config.Script{
+				Labels: labels,
+				Jobs: []config.ScriptJob{
+					{
+						Cmd:      &config.ScriptCmd{Args: []string{"terraform", "plan"}},
+						Env:      []string{"AWS_PROFILE=prod", "TF_CLI_ARGS_plan=-lock=false -var=stack=/"},
+						UnsetEnv: []string{"TF_INPUT", "TF_LOG"},
+					},
+					{
+						Cmd:      &config.ScriptCmd{Args: []string{"terraform", "apply"}},
+						Deps:     []int{0},
+						Env:      []string{"AWS_PROFILE=prod", "TF_LOG=debug"},
+						UnsetEnv: []string{"TF_INPUT"},
+					},
+				},
+			},
+		},
+		{
+			name: "env attribute wrong type",
+			config: Script(
+				Labels(labels...),
+				Block("job",
+					Block("env",
+						Number("TF_LOG", 1),
+					),
+					Command("echo", "hello"),
+				),
+			),
+			wantErr: errors.E(config.ErrScriptInvalidEnv),
+		},
 		{
 			name: "job.name attribute exceeds maximum allowed characters - truncation",
 			config: Script(
@@ -598,6 +875,7 @@ func TestScriptEval(t *testing.T) {
 								CloudTerraformPlanFile: "plan_b",
 							},
 						},
+						Deps: []int{0},
 					},
 				},
 			},
@@ -637,6 +915,109 @@ func TestScriptEval(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "command options with timeout",
+			config: Script(
+				Labels(labels...),
+				Str("description", "some description"),
+				Block("job",
+					Expr("command", `["echo", "hello", {
+								timeout = "1h30m"
+							}]`),
+				),
+			),
+			want: config.Script{
+				Labels:      labels,
+				Description: "some description",
+				Jobs: []config.ScriptJob{
+					{
+						Cmd: &config.ScriptCmd{
+							Args: []string{"echo", "hello"},
+							Options: &config.ScriptCmdOptions{
+								Timeout: 90 * time.Minute,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "command options with retry",
+			config: Script(
+				Labels(labels...),
+				Str("description", "some description"),
+				Block("job",
+					Expr("command", `["echo", "hello", {
+								retry = {
+									max_attempts = 3
+									backoff      = "30s"
+									exit_codes   = [1, 2]
+								}
+							}]`),
+				),
+			),
+			want: config.Script{
+				Labels:      labels,
+				Description: "some description",
+				Jobs: []config.ScriptJob{
+					{
+						Cmd: &config.ScriptCmd{
+							Args: []string{"echo", "hello"},
+							Options: &config.ScriptCmdOptions{
+								Retry: &config.RetryPolicy{
+									MaxAttempts: 3,
+									Backoff:     30 * time.Second,
+									ExitCodes:   []int{1, 2},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "invalid command option retry",
+			config: Script(
+				Labels(labels...),
+				Str("description", "some description"),
+				Block("job",
+					Expr("command", `["echo", "hello", {
+								retry = {
+									max_attempts = 0
+								}
+							}]`),
+				),
+			),
+			wantErr: errors.E(config.ErrScriptInvalidCmdOptions),
+		},
+		{
+			name: "invalid command option retry attribute",
+			config: Script(
+				Labels(labels...),
+				Str("description", "some description"),
+				Block("job",
+					Expr("command", `["echo", "hello", {
+								retry = {
+									attempts = 2
+								}
+							}]`),
+				),
+			),
+			wantErr: errors.E(config.ErrScriptInvalidCmdOptions),
+		},
+		{
+			name: "invalid command option timeout",
+			config: Script(
+				Labels(labels...),
+				Str("description", "some description"),
+				Block("job",
+					Expr("command", `["echo", "hello", {
+								timeout = "forever"
+							}]`),
+				),
+			),
+			wantErr: errors.E(config.ErrScriptInvalidCmdOptions),
+		},
 		{
 			name: "invalid command option",
 			config: Script(
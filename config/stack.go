@@ -53,6 +53,9 @@ type (
 		// Watch is the list of files to be watched for changes.
 		Watch project.Paths
 
+		// ConcurrencyGroup is the name of the concurrency group of the stack.
+		ConcurrencyGroup string
+
 		// IsChanged tells if this is a changed stack.
 		IsChanged bool
 	}
@@ -106,6 +109,8 @@ func NewStackFromHCL(root string, cfg hcl.Config) (*Stack, error) {
 		WantedBy:    cfg.Stack.WantedBy,
 		Watch:       watchFiles,
 		Dir:         project.PrjAbsPath(root, cfg.AbsDir()),
+
+		ConcurrencyGroup: cfg.Stack.ConcurrencyGroup,
 	}
 	err = stack.Validate()
 	if err != nil {
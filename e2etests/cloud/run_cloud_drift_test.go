@@ -760,6 +760,61 @@ func TestCLIRunWithCloudSyncDriftStatus(t *testing.T) {
 	}
 }
 
+func TestCLIRunWithCloudSyncDriftStatusIgnoresCache(t *testing.T) {
+	t.Parallel()
+
+	cloudData, err := cloudstore.LoadDatastore(testserverJSONFile)
+	assert.NoError(t, err)
+	addr := startFakeTMCServer(t, cloudData)
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		"s:stack:id=stack",
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    run {
+		      cache = true
+		    }
+		  }
+		}`,
+		"f:.gitignore:.terramate-cache\n",
+	})
+	s.Git().CommitAll("all stacks committed")
+
+	env := RemoveEnv(os.Environ(), "CI", "GITHUB_ACTIONS")
+	env = append(env, "TMC_API_URL=http://"+addr)
+	cli := NewCLI(t, s.RootDir(), env...)
+	s.Git().SetRemoteURL("origin", testRemoteRepoURL)
+
+	wantDrift := expectedDriftStackPayloadRequest{
+		DriftStackPayloadRequest: cloud.DriftStackPayloadRequest{
+			Stack: cloud.Stack{
+				Repository:    normalizedTestRemoteRepo,
+				DefaultBranch: "main",
+				Path:          "/stack",
+				MetaName:      "stack",
+				MetaID:        "stack",
+				Target:        "default",
+			},
+			Status:   drift.Drifted,
+			Metadata: expectedMetadata,
+		},
+	}
+
+	// The second run has a cache hit but the stack is executed anyway, then
+	// its drift status is synchronized again.
+	minStartTime := time.Now().UTC()
+	for i := 0; i < 2; i++ {
+		AssertRunResult(t, cli.Run(
+			"run", "--disable-safeguards=git-out-of-sync", "--quiet", "--sync-drift-status",
+			"--", HelperPath, "exit", "2",
+		), RunExpected{})
+	}
+	maxEndTime := time.Now().UTC()
+	assertRunDrifts(t, cloudData, addr, expectedDriftStackPayloadRequests{wantDrift, wantDrift}, minStartTime, maxEndTime)
+}
+
 func TestSyncPlanSerial(t *testing.T) {
 	layout := []string{
 		"s:s1:id=s1",
@@ -9,6 +9,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
@@ -60,6 +61,12 @@ func main() {
 		cat(os.Args[2])
 	case "rm":
 		rm(os.Args[2])
+	case "fail-once":
+		failOnce(os.Args[2], os.Args[3])
+	case "concurrent":
+		concurrent(os.Args[2], os.Args[3], os.Args[4])
+	case "rendezvous":
+		rendezvous(os.Args[2], os.Args[3], os.Args[4])
 	case "tempdir":
 		tempDir()
 	case "stack-abs-path":
@@ -141,9 +148,15 @@ func envPrefix(rootdir string, prefix string) {
 	}
 }
 
-// cat the file contents to stdout.
+// cat the file contents, or the stdin if the file is "-", to stdout.
 func cat(fname string) {
-	bytes, err := os.ReadFile(fname)
+	var bytes []byte
+	var err error
+	if fname == "-" {
+		bytes, err = io.ReadAll(os.Stdin)
+	} else {
+		bytes, err = os.ReadFile(fname)
+	}
 	checkerr(err)
 	fmt.Printf("%s", string(bytes))
 }
@@ -154,6 +167,72 @@ func rm(fname string) {
 	checkerr(err)
 }
 
+// failOnce fails with the given exit code if the marker file doesn't exist,
+// creating it, so the next execution succeeds.
+func failOnce(marker string, exitCodeStr string) {
+	code, err := strconv.Atoi(exitCodeStr)
+	checkerr(err)
+	if _, err := os.Stat(marker); err == nil {
+		fmt.Println("success")
+		return
+	}
+	checkerr(os.WriteFile(marker, nil, 0644))
+	fmt.Fprintln(os.Stderr, "transient failure")
+	os.Exit(code)
+}
+
+// concurrent registers the execution in the given directory for the given
+// duration and fails if more than max executions are registered concurrently.
+func concurrent(dir string, maxStr string, durationStr string) {
+	max, err := strconv.Atoi(maxStr)
+	checkerr(err)
+	d, err := time.ParseDuration(durationStr)
+	checkerr(err)
+
+	f, err := os.CreateTemp(dir, "running")
+	checkerr(err)
+	checkerr(f.Close())
+
+	entries, err := os.ReadDir(dir)
+	checkerr(err)
+	if len(entries) > max {
+		checkerr(os.Remove(f.Name()))
+		fmt.Fprintf(os.Stderr, "%d concurrent executions, want at most %d\n", len(entries), max)
+		os.Exit(1)
+	}
+	time.Sleep(d)
+	checkerr(os.Remove(f.Name()))
+	fmt.Println("done")
+}
+
+// rendezvous registers the execution in the given directory and waits until
+// n executions are registered, failing if it takes longer than the timeout.
+func rendezvous(dir string, nStr string, timeoutStr string) {
+	n, err := strconv.Atoi(nStr)
+	checkerr(err)
+	timeout, err := time.ParseDuration(timeoutStr)
+	checkerr(err)
+
+	f, err := os.CreateTemp(dir, "arrived")
+	checkerr(err)
+	checkerr(f.Close())
+
+	deadline := time.Now().Add(timeout)
+	for {
+		entries, err := os.ReadDir(dir)
+		checkerr(err)
+		if len(entries) >= n {
+			fmt.Println("done")
+			return
+		}
+		if time.Now().After(deadline) {
+			fmt.Fprintf(os.Stderr, "%d executions arrived, want %d\n", len(entries), n)
+			os.Exit(1)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 // tempdir creates a temporary directory.
 func tempDir() {
 	tmpdir, err := os.MkdirTemp("", "tm-tmpdir")
@@ -329,3 +329,122 @@ func TestOrderGraphAfter(t *testing.T) {
 		})
 	}
 }
+
+func TestRunGraphFormats(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`s:stack-a:id=a;tags=["infra"]`,
+		`s:stack-b:after=["/stack-a"];tags=["app"];wants=["/stack-c"]`,
+		`s:stack-c`,
+	})
+	cli := NewCLI(t, s.RootDir())
+
+	AssertRunResult(t, cli.StacksRunGraph("--format", "json", "--tags", "app"), RunExpected{
+		Stdout: `{
+  "nodes": [
+    {
+      "path": "/stack-b",
+      "name": "stack-b",
+      "tags": [
+        "app"
+      ],
+      "changed": false,
+      "wanted": false
+    },
+    {
+      "path": "/stack-c",
+      "name": "stack-c",
+      "tags": [],
+      "changed": false,
+      "wanted": true
+    }
+  ],
+  "edges": []
+}
+`,
+	})
+
+	AssertRunResult(t, cli.StacksRunGraph(), RunExpected{
+		Stdout: `
+		digraph  {
+			n1[id="a",label="stack-a",tags="infra"];
+			n2[label="stack-b",tags="app"];
+			n3[label="stack-c"];
+			n1->n2;
+		}`,
+		FlattenStdout: true,
+	})
+
+	AssertRunResult(t, cli.StacksRunGraph("--tags", "app"), RunExpected{
+		Stdout: `
+		digraph  {
+			n1[label="stack-b",tags="app"];
+			n2[label="stack-c",style="dashed"];
+		}`,
+		FlattenStdout: true,
+	})
+
+	AssertRunResult(t, cli.StacksRunGraph("--format", "mermaid", "--label", "stack.dir"), RunExpected{
+		Stdout: `flowchart TD
+  n1["/stack-a"]
+  n2["/stack-b"]
+  n3["/stack-c"]
+  n1 --> n2
+`,
+	})
+}
+
+func TestRunGraphChanged(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:stack-a`,
+		`s:stack-b:after=["/stack-a"]`,
+		`s:stack-c:after=["/stack-b"]`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change-stacks")
+
+	s.DirEntry("stack-a").CreateFile("main.tf", "# changed")
+	s.DirEntry("stack-c").CreateFile("main.tf", "# changed")
+	git.CommitAll("stacks changed")
+
+	cli := NewCLI(t, s.RootDir())
+
+	AssertRunResult(t, cli.StacksRunGraph("--format", "mermaid"), RunExpected{
+		Stdout: `flowchart TD
+  n1["stack-a"]
+  n2["stack-b"]
+  n3["stack-c"]
+  n1 --> n2
+  n2 --> n3
+  classDef changed fill:#fff3b0,stroke:#e0a800
+  class n1,n3 changed
+`,
+	})
+
+	AssertRunResult(t, cli.StacksRunGraph("--changed"), RunExpected{
+		Stdout: `
+		digraph  {
+			n1[color="#e0a800",fillcolor="#fff3b0",label="stack-a",style="filled"];
+			n2[color="#e0a800",fillcolor="#fff3b0",label="stack-c",style="filled"];
+			n1->n2;
+		}`,
+		FlattenStdout: true,
+	})
+
+	AssertRunResult(t, cli.StacksRunGraph("--changed", "--format", "mermaid"), RunExpected{
+		Stdout: `flowchart TD
+  n1["stack-a"]
+  n2["stack-c"]
+  n1 --> n2
+  classDef changed fill:#fff3b0,stroke:#e0a800
+  class n1,n2 changed
+`,
+	})
+}
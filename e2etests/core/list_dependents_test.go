@@ -0,0 +1,82 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"testing"
+
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestListIncludeDependents(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.New(t)
+	s.BuildTree([]string{
+		`s:network`,
+		`s:database:after=["/network"]`,
+		`s:app:after=["/database"]`,
+		`s:dns:before=["/network"]`,
+		`s:other`,
+	})
+	git := s.Git()
+	git.CommitAll("first commit")
+	git.Push("main")
+	git.CheckoutNew("change-network")
+
+	s.DirEntry("network").CreateFile("main.tf", "# changed")
+	git.CommitAll("network changed")
+
+	tm := NewCLI(t, s.RootDir())
+
+	AssertRunResult(t, tm.Run("list", "--changed"), RunExpected{
+		Stdout: nljoin("network"),
+	})
+	AssertRunResult(t, tm.Run("list", "--changed", "--include-dependents"), RunExpected{
+		Stdout: nljoin("app", "database", "network"),
+	})
+	AssertRunResult(t, tm.Run("list", "--changed", "--include-dependencies"), RunExpected{
+		Stdout: nljoin("dns", "network"),
+	})
+	AssertRunResult(t, tm.Run("list", "--changed", "--include-dependents", "--why"), RunExpected{
+		Stdout: nljoin(
+			"app - stack runs after /network through /database",
+			"database - stack runs after /network",
+			"network - stack has unmerged changes",
+		),
+	})
+	AssertRunResult(t, tm.Run("run", "--quiet", "--changed", "--include-dependents", HelperPath, "stack-abs-path", s.RootDir()), RunExpected{
+		Stdout: nljoin("/network", "/database", "/app"),
+	})
+}
+
+func TestListIncludeDependentsWithFilters(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`s:infra/network:tags=["net"]`,
+		`s:infra/other`,
+		`s:apps/app:after=["/infra/network"]`,
+	})
+
+	// The dependents are added after the stacks are filtered by --tags and
+	// the working dir, then they don't need to match them.
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("list", "--tags", "net"), RunExpected{
+		Stdout: nljoin("infra/network"),
+	})
+	AssertRunResult(t, tm.Run("list", "--tags", "net", "--include-dependents"), RunExpected{
+		Stdout: nljoin("apps/app", "infra/network"),
+	})
+	AssertRunResult(t, tm.Run("run", "--quiet", "--tags", "net", "--include-dependents", HelperPath, "stack-abs-path", s.RootDir()), RunExpected{
+		Stdout: nljoin("/infra/network", "/apps/app"),
+	})
+
+	tm = NewCLI(t, s.DirEntry("infra").Path())
+	AssertRunResult(t, tm.Run("run", "--quiet", "--tags", "net", "--include-dependents", HelperPath, "stack-abs-path", s.RootDir()), RunExpected{
+		Stdout: nljoin("/infra/network", "/apps/app"),
+	})
+}
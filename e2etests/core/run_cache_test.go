@@ -0,0 +1,59 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"testing"
+
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunCache(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    run {
+		      cache = true
+		    }
+		  }
+		}`,
+		`s:s1`,
+		`s:s2`,
+		`f:s1/data:s1`,
+		`f:s2/data:s2`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	run := func(flags ...string) RunResult {
+		args := append([]string{"run", "--quiet"}, flags...)
+		return tm.Run(append(args, HelperPath, "cat", "data")...)
+	}
+
+	AssertRunResult(t, run(), RunExpected{Stdout: "s1s2"})
+
+	AssertRunResult(t, tm.Run("run", "--summary", HelperPath, "cat", "data"), RunExpected{
+		StderrRegexes: []string{
+			`Skipping stack in /s1: inputs unchanged since the last successful run`,
+			`Run summary: 2 cached`,
+			`/s2: cached \(inputs unchanged\)`,
+		},
+	})
+
+	AssertRunResult(t, run("--no-cache"), RunExpected{Stdout: "s1s2"})
+
+	s.RootEntry().CreateFile("s2/data", "changed")
+	AssertRunResult(t, run(), RunExpected{
+		Stdout:       "changed",
+		IgnoreStderr: true,
+	})
+
+	AssertRunResult(t, tm.Run("run", "--quiet", HelperPath, "echo", "other"), RunExpected{
+		Stdout: "other\nother\n",
+	})
+}
@@ -0,0 +1,98 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"strconv"
+	"testing"
+
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunConcurrencyGroups(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		name   string
+		layout []string
+
+		// max is the maximum number of stacks expected to run concurrently.
+		max int
+	}
+
+	for _, tc := range []testcase{
+		{
+			name: "stacks of the same group run one at a time",
+			layout: []string{
+				`s:s1:concurrency_group=backend`,
+				`s:s2:concurrency_group=backend`,
+				`s:s3:concurrency_group=backend`,
+				`s:s4`,
+			},
+			max: 2,
+		},
+		{
+			name: "stacks of the same group run up to the group limit",
+			layout: []string{
+				`f:terramate.tm:
+				terramate {
+				  config {
+				    run {
+				      concurrency_groups = {
+				        backend = {
+				          limit = 2
+				        }
+				      }
+				    }
+				  }
+				}`,
+				`s:s1:concurrency_group=backend`,
+				`s:s2:concurrency_group=backend`,
+				`s:s3:concurrency_group=backend`,
+				`s:s4:concurrency_group=backend`,
+			},
+			max: 2,
+		},
+		{
+			name: "stacks selected by tags run up to the group limit",
+			layout: []string{
+				`f:terramate.tm:
+				terramate {
+				  config {
+				    run {
+				      concurrency_groups = {
+				        prod = {
+				          limit = 1
+				          tags  = "aws:prod"
+				        }
+				      }
+				    }
+				  }
+				}`,
+				`s:s1:tags=["aws", "prod"]`,
+				`s:s2:tags=["aws", "prod"]`,
+				`s:s3:tags=["aws", "prod"]`,
+				`s:s4:tags=["gcp", "prod"]`,
+			},
+			max: 2,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := sandbox.NoGit(t, true)
+			s.BuildTree(tc.layout)
+
+			// all stacks register their executions in the same directory.
+			dir := t.TempDir()
+			tm := NewCLI(t, s.RootDir())
+			AssertRunResult(t, tm.Run("run", "--quiet", "--parallel", "4",
+				HelperPath, "concurrent", dir, strconv.Itoa(tc.max), "500ms"), RunExpected{
+				Stdout: "done\ndone\ndone\ndone\n",
+			})
+		})
+	}
+}
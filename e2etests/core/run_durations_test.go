@@ -0,0 +1,116 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	runutil "github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunRecordsStackDurations(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`s:s1`,
+		`s:s2:after=["/s1"]`,
+		`s:s3`,
+		`f:s1/data:s1`,
+		`f:s2/data:s2`,
+	})
+
+	durationsFile := filepath.Join(s.RootDir(), runutil.StateDirName, runutil.DurationsFilename)
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("run", "--parallel", "2", HelperPath, "true"), RunExpected{
+		IgnoreStdout: true,
+		IgnoreStderr: true,
+	})
+	_, err := os.Stat(durationsFile)
+	assert.IsTrue(t, os.IsNotExist(err), "durations are recorded only if enabled")
+
+	s.RootEntry().CreateFile("terramate.tm.hcl", `
+terramate {
+  config {
+    run {
+      track_durations = true
+    }
+  }
+}
+`)
+
+	AssertRunResult(t, tm.Run("run", "--dry-run", "--parallel", "2", HelperPath, "cat", "data"), RunExpected{
+		IgnoreStdout: true,
+		IgnoreStderr: true,
+	})
+	_, err = os.Stat(durationsFile)
+	assert.IsTrue(t, os.IsNotExist(err), "dry runs must not record durations")
+
+	AssertRunResult(t, tm.Run("run", "--parallel", "2", "--continue-on-error", HelperPath, "cat", "data"), RunExpected{
+		IgnoreStdout: true,
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	data, err := os.ReadFile(durationsFile)
+	assert.NoError(t, err)
+
+	var commands map[string]map[string]float64
+	assert.NoError(t, json.Unmarshal(data, &commands))
+	assert.EqualInts(t, 1, len(commands), "durations are keyed by command: %v", commands)
+	for _, durations := range commands {
+		assert.EqualInts(t, 2, len(durations), "only successful stacks are recorded: %v", durations)
+		_, ok := durations["/s3"]
+		assert.IsTrue(t, !ok, "failed stacks are not recorded")
+	}
+}
+
+func TestRunStackDurationsDontKeepSensitiveValues(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    run {
+		      track_durations = true
+		      sensitive {
+		        globals = ["secrets.password"]
+		      }
+		    }
+		  }
+		}
+		globals {
+		  secrets = {
+		    password = "global-secret"
+		  }
+		}`,
+		`s:s1`,
+		`s:s2`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("run", "--quiet", "--parallel", "2", "--eval",
+		HelperPathAsHCL, "echo", "${global.secrets.password}"), RunExpected{
+		Stdout: nljoin("***", "***"),
+	})
+
+	data, err := os.ReadFile(filepath.Join(s.RootDir(), runutil.StateDirName, runutil.DurationsFilename))
+	assert.NoError(t, err)
+	assert.IsTrue(t, !strings.Contains(string(data), "global-secret"),
+		"sensitive value written to the durations: %s", data)
+
+	var commands map[string]map[string]float64
+	assert.NoError(t, json.Unmarshal(data, &commands))
+	assert.EqualInts(t, 1, len(commands), "durations are keyed by command: %v", commands)
+}
@@ -384,6 +384,62 @@ func TestRunEnv(t *testing.T) {
 				),
 			},
 		},
+		{
+			name: "env files are loaded relative to the stack and the root",
+			layout: []string{
+				`f:root.tm:` + Terramate(
+					Config(
+						Run(
+							Env(
+								Str("env_file", "/envs/common.env"),
+								Str("BAR", "BAR"),
+							),
+						),
+					),
+				).String(),
+				`f:envs/common.env:BAR=BAR FILE` + "\n" + `CAR=CAR ROOT` + "\n",
+				`s:s1`,
+				`s:s2`,
+				`f:s1/.env:CAR="CAR S1"` + "\n",
+				`f:s1/env.tm:` + Terramate(
+					Config(
+						Run(
+							Env(
+								Str("env_file", ".env"),
+							),
+						),
+					),
+				).String(),
+			},
+			args: []string{HelperPath, "env", "BAR", "CAR"},
+			want: RunExpected{
+				Stdout: nljoin(
+					"/s1: BAR", "/s1: CAR S1",
+					"/s2: BAR", "/s2: CAR ROOT",
+				),
+			},
+		},
+		{
+			name: "invalid env file fails with the file range",
+			layout: []string{
+				`f:root.tm:` + Terramate(
+					Config(
+						Run(
+							Env(
+								Str("env_file", "/.env"),
+							),
+						),
+					),
+				).String(),
+				`f:.env:FOO=foo` + "\n" + `1BAR=bar` + "\n",
+				`s:s1`,
+			},
+			args: []string{HelperPath, "env", "FOO"},
+			want: RunExpected{
+				StderrRegex: `\.env:2,1-9: .*invalid dotenv file syntax: invalid variable name "1BAR"`,
+				Status:      1,
+			},
+		},
 	} {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
@@ -0,0 +1,188 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	runutil "github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunHooks(t *testing.T) {
+	t.Parallel()
+
+	hooksConfig := `f:hooks.tm:
+	terramate {
+	  config {
+	    run {
+	      before_run {
+	        command = ["` + HelperPathAsHCL + `", "echo", "before ${terramate.stack.name}"]
+	      }
+	      after_run {
+	        commands = [
+	          ["` + HelperPathAsHCL + `", "echo", "after ${global.suffix}"],
+	        ]
+	      }
+	      on_failure {
+	        command = ["` + HelperPathAsHCL + `", "echo", "failure ${terramate.stack.name}"]
+	      }
+	    }
+	  }
+	}
+	globals {
+	  suffix = "ok"
+	}`
+
+	type testcase struct {
+		name   string
+		layout []string
+		flags  []string
+		want   RunExpected
+	}
+
+	for _, tc := range []testcase{
+		{
+			name: "hooks run around the stack commands",
+			layout: []string{
+				hooksConfig,
+				`s:a`,
+				`f:a/data:a`,
+			},
+			want: RunExpected{
+				Stdout:       "before a\naafter ok\n",
+				IgnoreStderr: true,
+			},
+		},
+		{
+			name:  "on_failure runs when the stack fails",
+			flags: []string{"--summary"},
+			layout: []string{
+				hooksConfig,
+				`s:a`,
+			},
+			want: RunExpected{
+				Stdout: "before a\nfailure a\n",
+				StderrRegexes: []string{
+					`Run summary: 1 failed`,
+					`/a: failed \(exit code 1\)`,
+				},
+				Status: 1,
+			},
+		},
+		{
+			name:  "failed before_run skips the stack commands",
+			flags: []string{"--summary"},
+			layout: []string{
+				hooksConfig,
+				`s:a`,
+				`f:a/data:a`,
+				`f:a/hooks.tm:
+				terramate {
+				  config {
+				    run {
+				      before_run {
+				        command = ["` + HelperPathAsHCL + `", "exit", "3"]
+				      }
+				    }
+				  }
+				}`,
+			},
+			want: RunExpected{
+				Stdout: "failure a\n",
+				StderrRegexes: []string{
+					`/a: failed \(before_run hook exit code 3\)`,
+				},
+				Status: 1,
+			},
+		},
+		{
+			name:  "failed after_run fails the stack",
+			flags: []string{"--summary"},
+			layout: []string{
+				hooksConfig,
+				`s:a`,
+				`f:a/data:a`,
+				`f:a/hooks.tm:
+				terramate {
+				  config {
+				    run {
+				      after_run {
+				        command = ["` + HelperPathAsHCL + `", "exit", "2"]
+				      }
+				      on_failure {
+				        command = ["` + HelperPathAsHCL + `", "exit", "4"]
+				      }
+				    }
+				  }
+				}`,
+			},
+			want: RunExpected{
+				Stdout: "before a\na",
+				StderrRegexes: []string{
+					`/a: failed \(after_run hook exit code 2, on_failure hook exit code 4\)`,
+				},
+				Status: 1,
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := sandbox.NoGit(t, true)
+			s.BuildTree(tc.layout)
+
+			tm := NewCLI(t, s.RootDir())
+			args := append([]string{"run"}, tc.flags...)
+			args = append(args, HelperPath, "cat", "data")
+			AssertRunResult(t, tm.Run(args...), tc.want)
+		})
+	}
+}
+
+func TestRunHooksReport(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:hooks.tm:
+		terramate {
+		  config {
+		    run {
+		      before_run {
+		        command = ["` + HelperPathAsHCL + `", "true"]
+		      }
+		    }
+		  }
+		}`,
+		`s:a`,
+	})
+
+	jsonReport := filepath.Join(t.TempDir(), "report.json")
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("run", "--report-json", jsonReport, HelperPath, "true"), RunExpected{
+		IgnoreStdout: true,
+		IgnoreStderr: true,
+	})
+
+	data, err := os.ReadFile(jsonReport)
+	assert.NoError(t, err)
+
+	var report runutil.Report
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.EqualInts(t, 1, len(report.Stacks))
+	assert.EqualInts(t, 1, len(report.Stacks[0].Hooks))
+
+	hook := report.Stacks[0].Hooks[0]
+	assert.EqualStrings(t, runutil.HookBeforeRun, hook.Name)
+	assert.EqualStrings(t, string(runutil.StackOK), string(hook.Status))
+	assert.EqualInts(t, 0, *hook.ExitCode)
+}
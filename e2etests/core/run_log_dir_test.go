@@ -0,0 +1,127 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunLogDir(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    run {
+		      sensitive {
+		        patterns = ["secret-[0-9]+"]
+		      }
+		    }
+		  }
+		}`,
+		`s:a`,
+		`s:a/nested`,
+		`f:a/data:a secret-123
+`,
+	})
+
+	logDir := t.TempDir()
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("run", "--quiet", "--continue-on-error", "--log-dir", logDir,
+		HelperPath, "cat", "data"), RunExpected{
+		Stdout:       "a ***\n",
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	assertLogFile(t, filepath.Join(logDir, "a", "stdout.log"), "a ***\n")
+	assertLogFile(t, filepath.Join(logDir, "a", "stderr.log"), "")
+	assertLogFile(t, filepath.Join(logDir, "a", "nested", "stdout.log"), "")
+
+	data, err := os.ReadFile(filepath.Join(logDir, "a", "nested", "stderr.log"))
+	assert.NoError(t, err)
+	if !strings.Contains(string(data), "no such file or directory") {
+		t.Errorf("unexpected stderr log: %q", data)
+	}
+}
+
+func TestScriptRunLogDir(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    experiments = ["scripts"]
+		  }
+		}`,
+		`s:stack`,
+		`f:script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  job {
+		    commands = [
+		      ["` + HelperPathAsHCL + `", "echo", "one"],
+		      ["` + HelperPathAsHCL + `", "echo", "two"],
+		    ]
+		  }
+		  job {
+		    command = ["` + HelperPathAsHCL + `", "echo", "three"]
+		  }
+		}`,
+	})
+
+	logDir := t.TempDir()
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "--log-dir", logDir, "deploy"), RunExpected{
+		Stdout: "one\ntwo\nthree\n",
+	})
+
+	for name, want := range map[string]string{
+		"job-1.cmd-1.stdout.log": "one\n",
+		"job-1.cmd-2.stdout.log": "two\n",
+		"job-2.cmd-1.stdout.log": "three\n",
+		"job-2.cmd-1.stderr.log": "",
+	} {
+		assertLogFile(t, filepath.Join(logDir, "stack", name), want)
+	}
+}
+
+func TestRunLogDirKeepsRawOutput(t *testing.T) {
+	t.Parallel()
+
+	const output = "progress 1\rprogress 2\r\nbinary \xff\xfe\nafter binary\nno newline"
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`s:stack`,
+		`f:stack/data:` + output,
+	})
+
+	logDir := t.TempDir()
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("run", "--quiet", "--log-dir", logDir, HelperPath, "cat", "data"), RunExpected{
+		Stdout: output,
+	})
+
+	assertLogFile(t, filepath.Join(logDir, "stack", "stdout.log"), output)
+}
+
+func assertLogFile(t *testing.T, path, want string) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.EqualStrings(t, want, string(data), "log file %s", path)
+}
@@ -0,0 +1,249 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	runutil "github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunMatrix(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    run {
+		      env {
+		        REGION = "region-${terramate.run.matrix.region}"
+		      }
+		    }
+		  }
+		}`,
+		`s:a`,
+		`s:b`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("run", "--quiet", "--eval",
+		"--matrix", "region=us,eu", "--matrix", "workspace=dev",
+		HelperPath, "echo", "${terramate.stack.name}-${terramate.run.matrix.region}-${terramate.run.matrix.workspace}"),
+		RunExpected{
+			Stdout: "a-us-dev\na-eu-dev\nb-us-dev\nb-eu-dev\n",
+		})
+
+	AssertRunResult(t, tm.Run("run", "--quiet", "--matrix", "region=us,eu",
+		HelperPath, "env", s.RootDir(), "REGION"),
+		RunExpected{
+			Stdout: "/a: region-us\n/a: region-eu\n/b: region-us\n/b: region-eu\n",
+		})
+}
+
+func TestRunMatrixInvalidFlag(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{`s:a`})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("run", "--matrix", "region", HelperPath, "true"), RunExpected{
+		StderrRegex: "invalid --matrix flag",
+		Status:      1,
+	})
+	AssertRunResult(t, tm.Run("run", "--matrix", "region=us", "--matrix", "region=eu", HelperPath, "true"), RunExpected{
+		StderrRegex: `--matrix variable "region" given multiple times`,
+		Status:      1,
+	})
+}
+
+func TestRunMatrixReport(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{`s:stack`})
+
+	reportsDir := t.TempDir()
+	jsonReport := filepath.Join(reportsDir, "report.json")
+	junitReport := filepath.Join(reportsDir, "report.xml")
+
+	tm := NewCLI(t, s.RootDir())
+	res := tm.Run("run", "--summary", "--eval", "--matrix", "code=0,3,4",
+		"--report-json", jsonReport,
+		"--report-junit", junitReport,
+		HelperPath, "exit", "${terramate.run.matrix.code}")
+	AssertRunResult(t, res, RunExpected{
+		IgnoreStdout: true,
+		IgnoreStderr: true,
+		Status:       1,
+	})
+	for _, want := range []string{
+		"Entering stack in /stack [code=0]",
+		"Entering stack in /stack [code=3]",
+		"Run summary: 1 succeeded, 1 failed, 1 canceled",
+		"/stack [code=3]: failed (exit code 3)",
+		"/stack [code=4]: canceled (a previous variant failed)",
+	} {
+		if !strings.Contains(res.Stdout+res.Stderr, want) {
+			t.Errorf("output does not contain %q:\nstdout:\n%s\nstderr:\n%s", want, res.Stdout, res.Stderr)
+		}
+	}
+
+	data, err := os.ReadFile(jsonReport)
+	assert.NoError(t, err)
+
+	var report runutil.Report
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.EqualInts(t, 1, len(report.Stacks))
+
+	stack := report.Stacks[0]
+	assert.EqualStrings(t, string(runutil.StackFailed), string(stack.Status))
+	assert.EqualInts(t, 3, len(stack.Variants))
+
+	ok, failed, canceled := stack.Variants[0], stack.Variants[1], stack.Variants[2]
+
+	assert.EqualStrings(t, "code=0", ok.Name)
+	assert.EqualStrings(t, "0", ok.Matrix["code"])
+	assert.EqualStrings(t, string(runutil.StackOK), string(ok.Status))
+	assert.EqualInts(t, 0, *ok.ExitCode)
+	assert.IsTrue(t, ok.StartedAt != nil && ok.FinishedAt != nil)
+
+	assert.EqualStrings(t, "code=3", failed.Name)
+	assert.EqualStrings(t, string(runutil.StackFailed), string(failed.Status))
+	assert.EqualStrings(t, "exit code 3", failed.Reason)
+	assert.EqualInts(t, 3, *failed.ExitCode)
+
+	assert.EqualStrings(t, "code=4", canceled.Name)
+	assert.EqualStrings(t, string(runutil.StackCanceled), string(canceled.Status))
+	assert.EqualStrings(t, "a previous variant failed", canceled.Reason)
+	assert.IsTrue(t, canceled.ExitCode == nil)
+	assert.IsTrue(t, canceled.StartedAt == nil)
+
+	junit, err := os.ReadFile(junitReport)
+	assert.NoError(t, err)
+	for _, want := range []string{
+		`<testsuites name="terramate run" tests="3" failures="1" skipped="1"`,
+		`<testcase name="/stack [code=0]"`,
+		`<testcase name="/stack [code=3]"`,
+		`<skipped type="canceled" message="canceled: a previous variant failed">`,
+	} {
+		if !strings.Contains(string(junit), want) {
+			t.Errorf("JUnit report does not contain %q:\n%s", want, junit)
+		}
+	}
+}
+
+func TestRunMatrixContinueOnError(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{`s:stack`})
+
+	jsonReport := filepath.Join(t.TempDir(), "report.json")
+
+	tm := NewCLI(t, s.RootDir())
+	res := tm.Run("run", "--summary", "--continue-on-error", "--eval", "--matrix", "code=3,0,4",
+		"--report-json", jsonReport,
+		HelperPath, "exit", "${terramate.run.matrix.code}")
+	AssertRunResult(t, res, RunExpected{
+		IgnoreStdout: true,
+		IgnoreStderr: true,
+		Status:       1,
+	})
+	for _, want := range []string{
+		"Entering stack in /stack [code=0]",
+		"Entering stack in /stack [code=4]",
+		"Run summary: 1 succeeded, 2 failed",
+		"/stack [code=3]: failed (exit code 3)",
+		"/stack [code=4]: failed (exit code 4)",
+	} {
+		if !strings.Contains(res.Stdout+res.Stderr, want) {
+			t.Errorf("output does not contain %q:\nstdout:\n%s\nstderr:\n%s", want, res.Stdout, res.Stderr)
+		}
+	}
+
+	data, err := os.ReadFile(jsonReport)
+	assert.NoError(t, err)
+
+	var report runutil.Report
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.EqualInts(t, 1, len(report.Stacks))
+
+	variants := report.Stacks[0].Variants
+	assert.EqualInts(t, 3, len(variants))
+	for i, want := range []struct {
+		name     string
+		status   runutil.StackStatus
+		exitCode int
+	}{
+		{name: "code=3", status: runutil.StackFailed, exitCode: 3},
+		{name: "code=0", status: runutil.StackOK, exitCode: 0},
+		{name: "code=4", status: runutil.StackFailed, exitCode: 4},
+	} {
+		assert.EqualStrings(t, want.name, variants[i].Name)
+		assert.EqualStrings(t, string(want.status), string(variants[i].Status))
+		assert.EqualInts(t, want.exitCode, *variants[i].ExitCode)
+	}
+}
+
+func TestScriptRunMatrix(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    experiments = ["scripts"]
+		  }
+		}`,
+		`s:stack`,
+		`f:stack/globals.tm:
+		globals {
+		  workspaces = ["dev", "prd"]
+		}`,
+		`f:script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  matrix {
+		    region    = ["us", "eu"]
+		    workspace = global.workspaces
+		  }
+		  lets {
+		    target = "${terramate.run.matrix.region}/${terramate.run.matrix.workspace}"
+		  }
+		  job {
+		    command = ["` + HelperPathAsHCL + `", "echo", let.target]
+		  }
+		}`,
+	})
+
+	jsonReport := filepath.Join(t.TempDir(), "report.json")
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "--report-json", jsonReport, "deploy"), RunExpected{
+		Stdout: "us/dev\nus/prd\neu/dev\neu/prd\n",
+	})
+
+	data, err := os.ReadFile(jsonReport)
+	assert.NoError(t, err)
+
+	var report runutil.Report
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.EqualInts(t, 1, len(report.Stacks))
+	assert.EqualInts(t, 4, len(report.Stacks[0].Variants))
+	for _, variant := range report.Stacks[0].Variants {
+		assert.EqualStrings(t, string(runutil.StackOK), string(variant.Status))
+	}
+	assert.EqualStrings(t, "region=eu,workspace=prd", report.Stacks[0].Variants[3].Name)
+}
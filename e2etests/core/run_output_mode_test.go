@@ -0,0 +1,133 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunOutputMode(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		name  string
+		flags []string
+		env   []string
+		want  RunExpected
+	}
+
+	for _, tc := range []testcase{
+		{
+			name:  "plain",
+			flags: []string{"--output-mode", "plain"},
+			want: RunExpected{
+				Stdout:       "hello\nhello\n",
+				IgnoreStderr: true,
+			},
+		},
+		{
+			name:  "prefix",
+			flags: []string{"--output-mode", "prefix"},
+			want: RunExpected{
+				Stdout: "[/s1] hello\n[/s2] hello\n",
+				StderrRegexes: []string{
+					`\[/s1\] terramate: Entering stack in /s1`,
+					`\[/s2\] terramate: Executing command`,
+				},
+			},
+		},
+		{
+			name:  "prefix in parallel",
+			flags: []string{"--output-mode", "prefix", "--parallel", "2"},
+			want: RunExpected{
+				StdoutRegexes: []string{
+					`(?m)^\[/s1\] hello$`,
+					`(?m)^\[/s2\] hello$`,
+				},
+				IgnoreStderr: true,
+			},
+		},
+		{
+			name:  "grouped in parallel",
+			flags: []string{"--output-mode", "grouped", "--parallel", "2"},
+			want: RunExpected{
+				Stdout:       "hello\nhello\n",
+				IgnoreStderr: true,
+			},
+		},
+		{
+			name:  "grouped in GitHub Actions",
+			flags: []string{"--output-mode", "grouped"},
+			env:   []string{"GITHUB_ACTIONS=1"},
+			want: RunExpected{
+				Stdout: "::group::/s1: succeeded\nhello\n::endgroup::\n" +
+					"::group::/s2: succeeded\nhello\n::endgroup::\n",
+				IgnoreStderr: true,
+			},
+		},
+		{
+			name:  "grouped in GitLab CI",
+			flags: []string{"--output-mode", "grouped"},
+			env:   []string{"GITLAB_CI=1"},
+			want: RunExpected{
+				StdoutRegexes: []string{
+					`section_start:\d+:_s1\[collapsed=true\]\r\x1b\[0K/s1: succeeded\nhello\n\x1b\[0Ksection_end:\d+:_s1`,
+					`section_start:\d+:_s2\[collapsed=true\]\r\x1b\[0K/s2: succeeded\nhello\n\x1b\[0Ksection_end:\d+:_s2`,
+				},
+				IgnoreStderr: true,
+			},
+		},
+		{
+			name:  "invalid output mode",
+			flags: []string{"--output-mode", "fancy"},
+			want: RunExpected{
+				StderrRegex: `--output-mode must be one of "plain","prefix","grouped"`,
+				Status:      1,
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := sandbox.NoGit(t, true)
+			s.BuildTree([]string{
+				`s:s1`,
+				`s:s2`,
+			})
+
+			env := RemoveEnv(os.Environ(), "CI", "GITHUB_ACTIONS", "GITHUB_TOKEN", "GITLAB_CI")
+			env = append(env, tc.env...)
+
+			tm := NewCLI(t, s.RootDir(), env...)
+			args := append([]string{"run"}, tc.flags...)
+			args = append(args, HelperPath, "echo", "hello")
+			AssertRunResult(t, tm.Run(args...), tc.want)
+		})
+	}
+}
+
+func TestRunOutputModeGroupedKeepsOrder(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{`s:s1`})
+
+	env := RemoveEnv(os.Environ(), "CI", "GITHUB_ACTIONS", "GITHUB_TOKEN", "GITLAB_CI")
+	env = append(env, "GITHUB_ACTIONS=1")
+
+	tm := NewCLI(t, s.RootDir(), env...)
+	res := tm.RunWithCombinedOutput("run", "--output-mode", "grouped", HelperPath, "echo", "hello")
+	AssertRunResult(t, res, RunExpected{
+		StdoutRegex: `(?s)::group::/s1: succeeded\n` +
+			`terramate: Entering stack in /s1\n` +
+			`terramate: Executing command "[^\n]*echo hello"\n` +
+			`hello\n` +
+			`::endgroup::`,
+	})
+}
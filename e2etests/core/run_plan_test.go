@@ -0,0 +1,232 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/terramate-io/terramate/hcl"
+	runutil "github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test/sandbox"
+
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	. "github.com/terramate-io/terramate/test/hclwrite/hclutils"
+)
+
+func TestRunDryRunJSONPlan(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		"f:terramate.tm:" + Terramate(
+			Config(
+				Experiments(hcl.SharingIsCaringExperimentName),
+			),
+		).String(),
+		`f:run.tm:
+		terramate {
+		  config {
+		    run {
+		      env {
+		        TOKEN = "secret"
+		      }
+		      before_run {
+		        command = ["echo", "before ${terramate.stack.name}"]
+		      }
+		    }
+		  }
+		}`,
+		"f:backend.tm:" + Block("sharing_backend",
+			Labels("name"),
+			Expr("type", "terraform"),
+			Str("filename", "sharing.tf"),
+			Command("terraform", "output", "-json"),
+		).String(),
+		`s:s1:id=s1`,
+		`s:s2:id=s2;after=["/s1"]`,
+		"f:s2/input.tm:" + Input(
+			Labels("s2_input"),
+			Str("backend", "name"),
+			Expr("value", "outputs.s1_output.value"),
+			Str("from_stack_id", "s1"),
+		).String(),
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("generate"), RunExpected{IgnoreStdout: true})
+
+	res := tm.Run("run", "--dry-run", "--format", "json", "--enable-sharing", "--eval",
+		"--", "echo", "${terramate.stack.name}")
+	AssertRunResult(t, res, RunExpected{IgnoreStdout: true})
+
+	var plan runutil.Plan
+	if err := json.Unmarshal([]byte(res.Stdout), &plan); err != nil {
+		t.Fatalf("invalid JSON plan: %v\n%s", err, res.Stdout)
+	}
+
+	want := runutil.Plan{
+		Kind: runutil.JournalKindRun,
+		Stacks: []runutil.StackPlan{
+			{
+				Path:  "/s1",
+				ID:    "s1",
+				Order: 1,
+				Env:   []string{"TOKEN"},
+				Hooks: map[string][][]string{"before_run": {{"echo", "before s1"}}},
+				Tasks: []runutil.TaskPlan{
+					{
+						Cmd:     []string{"echo", "s1"},
+						Sharing: &runutil.SharingPlan{},
+					},
+				},
+			},
+			{
+				Path:  "/s2",
+				ID:    "s2",
+				Order: 2,
+				After: []string{"/s1"},
+				Env:   []string{"TOKEN"},
+				Hooks: map[string][][]string{"before_run": {{"echo", "before s2"}}},
+				Tasks: []runutil.TaskPlan{
+					{
+						Cmd: []string{"echo", "s2"},
+						Sharing: &runutil.SharingPlan{
+							Inputs: []runutil.InputPlan{
+								{Name: "s2_input", Backend: "name", FromStackID: "s1"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, plan); diff != "" {
+		t.Fatalf("unexpected plan: %s", diff)
+	}
+	if strings.Contains(res.Stdout, "secret") {
+		t.Fatalf("plan must not contain the values of the environment: %s", res.Stdout)
+	}
+}
+
+func TestRunDryRunJSONPlanMatrix(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    run {
+		      env {
+		        REGION = "region-${terramate.run.matrix.region}"
+		        EU     = terramate.run.matrix.region == "eu" ? "yes" : null
+		      }
+		    }
+		  }
+		}`,
+		`s:stack`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	res := tm.Run("run", "--dry-run", "--format", "json", "--matrix", "region=us,eu", "--", "echo")
+	AssertRunResult(t, res, RunExpected{IgnoreStdout: true})
+
+	var plan runutil.Plan
+	if err := json.Unmarshal([]byte(res.Stdout), &plan); err != nil {
+		t.Fatalf("invalid JSON plan: %v\n%s", err, res.Stdout)
+	}
+
+	want := runutil.Plan{
+		Kind: runutil.JournalKindRun,
+		Stacks: []runutil.StackPlan{
+			{
+				Path:  "/stack",
+				Order: 1,
+				Env:   []string{"REGION"},
+				Tasks: []runutil.TaskPlan{
+					{
+						Cmd:    []string{"echo"},
+						Matrix: map[string]string{"region": "us"},
+						Env:    []string{"REGION"},
+					},
+					{
+						Cmd:    []string{"echo"},
+						Matrix: map[string]string{"region": "eu"},
+						Env:    []string{"EU", "REGION"},
+					},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, plan); diff != "" {
+		t.Fatalf("unexpected plan: %s", diff)
+	}
+}
+
+func TestRunFormatJSONRequiresDryRun(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{`s:stack`})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("run", "--format", "json", "--", HelperPath, "true"), RunExpected{
+		StderrRegex: "--format json requires --dry-run",
+		Status:      1,
+	})
+}
+
+func TestScriptRunDryRunJSONPlan(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    experiments = ["scripts"]
+		  }
+		}`,
+		`s:stack`,
+		`f:script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  job {
+		    commands = [
+		      ["echo", "one"],
+		      ["echo", "${terramate.stack.path.absolute}"],
+		    ]
+		  }
+		}`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	res := tm.Run("script", "run", "--dry-run", "--format", "json", "deploy")
+	AssertRunResult(t, res, RunExpected{IgnoreStdout: true, IgnoreStderr: true})
+
+	var plan runutil.Plan
+	if err := json.Unmarshal([]byte(res.Stdout), &plan); err != nil {
+		t.Fatalf("invalid JSON plan: %v\n%s", err, res.Stdout)
+	}
+
+	want := runutil.Plan{
+		Kind: runutil.JournalKindScript,
+		Stacks: []runutil.StackPlan{
+			{
+				Path:  "/stack",
+				Order: 1,
+				Tasks: []runutil.TaskPlan{
+					{Cmd: []string{"echo", "one"}, ScriptJob: 1, ScriptCommand: 1},
+					{Cmd: []string{"echo", "/stack"}, ScriptJob: 1, ScriptCommand: 2},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, plan); diff != "" {
+		t.Fatalf("unexpected plan: %s", diff)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build unix && !darwin
+
+package core_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunProgressShowsPartialLines(t *testing.T) {
+	t.Parallel()
+
+	// The command echoed before running it must not match the prompt nor the
+	// answer written after it.
+	const (
+		prompt = "Enter a value: "
+		answer = "42"
+	)
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		"s:s1",
+		"s:s2",
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	cmd := tm.NewCmd("run", "--parallel", "2", "--",
+		"sh", "-c", `printf "Enter a %s: " value; sleep 2; echo $((6*7))`)
+	cmd.StartWithPty()
+
+	// The prompts must be shown while the commands still wait, before the
+	// rest of their lines are written.
+	const timeout = 10 * time.Second
+	start := time.Now()
+	for !strings.Contains(cmd.Stdout.String(), prompt) {
+		if time.Since(start) > timeout {
+			t.Fatalf("prompt not shown after %s, got output: %q", timeout, cmd.Stdout.String())
+		}
+		time.Sleep(30 * time.Millisecond)
+	}
+	output := cmd.Stdout.String()
+	assert.IsTrue(t, !strings.Contains(output, answer), "output %q written after the prompt was shown", output)
+	assert.IsTrue(t, strings.Contains(output, "running"), "progress view not shown in output %q", output)
+
+	assert.NoError(t, cmd.Wait())
+	assert.EqualInts(t, 2, strings.Count(cmd.Stdout.String(), answer),
+		"output %q", cmd.Stdout.String())
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	runutil "github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunReport(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`s:s1:id=s1-id`,
+		`s:s2:after=["/s1"]`,
+		`s:s3:after=["/s2"]`,
+		`f:s1/data:s1`,
+		`f:s3/data:s3`,
+	})
+
+	reportsDir := t.TempDir()
+	jsonReport := filepath.Join(reportsDir, "report.json")
+	junitReport := filepath.Join(reportsDir, "report.xml")
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("run",
+		"--report-json", jsonReport,
+		"--report-junit", junitReport,
+		HelperPath, "cat", "data"), RunExpected{
+		Stdout:       "s1",
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	data, err := os.ReadFile(jsonReport)
+	assert.NoError(t, err)
+
+	var report runutil.Report
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.EqualStrings(t, runutil.JournalKindRun, report.Kind)
+	assert.EqualInts(t, 3, len(report.Stacks))
+
+	s1, s2, s3 := report.Stacks[0], report.Stacks[1], report.Stacks[2]
+
+	assert.EqualStrings(t, "/s1", s1.Path)
+	assert.EqualStrings(t, "s1-id", s1.ID)
+	assert.EqualStrings(t, string(runutil.StackOK), string(s1.Status))
+	assert.EqualInts(t, 0, *s1.ExitCode)
+	assert.EqualInts(t, 1, s1.Order)
+	assert.IsTrue(t, s1.StartedAt != nil && s1.FinishedAt != nil)
+	assert.EqualStrings(t, "cat data", strings.Join(s1.Cmds[0][1:], " "))
+
+	assert.EqualStrings(t, "/s2", s2.Path)
+	assert.EqualStrings(t, string(runutil.StackFailed), string(s2.Status))
+	assert.EqualStrings(t, "exit code 1", s2.Reason)
+	assert.EqualInts(t, 1, *s2.ExitCode)
+	assert.EqualInts(t, 2, s2.Order)
+	assert.EqualStrings(t, "/s1", strings.Join(s2.After, ","))
+
+	assert.EqualStrings(t, "/s3", s3.Path)
+	assert.EqualStrings(t, string(runutil.StackCanceled), string(s3.Status))
+	assert.EqualStrings(t, "a previous stack failed", s3.Reason)
+	assert.IsTrue(t, s3.ExitCode == nil)
+	assert.IsTrue(t, s3.StartedAt == nil)
+	assert.EqualInts(t, 3, s3.Order)
+	assert.EqualStrings(t, "/s2", strings.Join(s3.After, ","))
+
+	junit, err := os.ReadFile(junitReport)
+	assert.NoError(t, err)
+	for _, want := range []string{
+		`<testsuites name="terramate run" tests="3" failures="1" skipped="1"`,
+		`<failure type="failed" message="failed: exit code 1">`,
+		`<skipped type="canceled" message="canceled: a previous stack failed">`,
+	} {
+		if !strings.Contains(string(junit), want) {
+			t.Errorf("JUnit report does not contain %q:\n%s", want, junit)
+		}
+	}
+}
+
+func TestScriptRunReport(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    experiments = ["scripts"]
+		  }
+		}`,
+		`s:s1`,
+		`f:script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  job {
+		    commands = [
+		      ["` + HelperPathAsHCL + `", "echo", "one"],
+		      ["` + HelperPathAsHCL + `", "echo", "two"],
+		    ]
+		  }
+		}`,
+	})
+
+	jsonReport := filepath.Join(t.TempDir(), "report.json")
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--report-json", jsonReport, "deploy"), RunExpected{
+		Stdout:       "one\ntwo\n",
+		IgnoreStderr: true,
+	})
+
+	data, err := os.ReadFile(jsonReport)
+	assert.NoError(t, err)
+
+	var report runutil.Report
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.EqualStrings(t, runutil.JournalKindScript, report.Kind)
+	assert.EqualInts(t, 1, len(report.Stacks))
+	assert.EqualStrings(t, string(runutil.StackOK), string(report.Stacks[0].Status))
+	assert.EqualInts(t, 2, len(report.Stacks[0].Cmds))
+}
@@ -0,0 +1,392 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunResume(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`s:s1`,
+		`s:s2`,
+		`s:s3`,
+		`f:s1/file.txt:s1`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("run", "--quiet", HelperPath, "cat", "file.txt"), RunExpected{
+		Stdout:      "s1",
+		StderrRegex: "one or more commands failed",
+		Status:      1,
+	})
+
+	s.RootEntry().CreateFile("s2/file.txt", "s2")
+	s.RootEntry().CreateFile("s3/file.txt", "s3")
+
+	AssertRunResult(t, tm.Run("run", "--resume"), RunExpected{
+		Stdout:      "s2s3",
+		StderrRegex: "Entering stack in /s2",
+	})
+	AssertRunResult(t, tm.Run("run", "--resume"), RunExpected{
+		StderrRegex: "Nothing to resume",
+	})
+}
+
+func TestRunResumeContinueOnError(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`s:s1`,
+		`s:s2`,
+		`s:s3`,
+		`f:s1/file.txt:s1`,
+		`f:s3/file.txt:s3`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("run", "--quiet", "--continue-on-error", HelperPath, "cat", "file.txt"), RunExpected{
+		Stdout:       "s1s3",
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	s.RootEntry().CreateFile("s2/file.txt", "s2")
+
+	AssertRunResult(t, tm.Run("run", "--quiet", "--resume"), RunExpected{
+		Stdout: "s2",
+	})
+}
+
+func TestRunResumeExplicitFlags(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`s:s1`,
+		`s:s2`,
+		`s:s3`,
+		`f:s2/file.txt:s2`,
+		`f:s3/file.txt:s3`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("run", "--quiet", HelperPath, "cat", "file.txt"), RunExpected{
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	// The flags given to the resumed run override the ones of the previous run.
+	AssertRunResult(t, tm.Run("run", "--quiet", "--resume", "--continue-on-error"), RunExpected{
+		Stdout:       "s2s3",
+		IgnoreStderr: true,
+		Status:       1,
+	})
+}
+
+func TestRunResumeFailures(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no previous run", func(t *testing.T) {
+		t.Parallel()
+
+		s := sandbox.NoGit(t, true)
+		s.BuildTree([]string{`s:s1`})
+		tm := NewCLI(t, s.RootDir())
+		AssertRunResult(t, tm.Run("run", "--resume"), RunExpected{
+			StderrRegex: "there is no previous run to resume",
+			Status:      1,
+		})
+	})
+
+	t.Run("resume with a command", func(t *testing.T) {
+		t.Parallel()
+
+		s := sandbox.NoGit(t, true)
+		s.BuildTree([]string{`s:s1`})
+		tm := NewCLI(t, s.RootDir())
+		AssertRunResult(t, tm.Run("run", "--resume", HelperPath, "true"), RunExpected{
+			StderrRegex: "--resume conflicts with a command",
+			Status:      1,
+		})
+	})
+
+	t.Run("configuration changed", func(t *testing.T) {
+		t.Parallel()
+
+		s := sandbox.NoGit(t, true)
+		s.BuildTree([]string{`s:s1`})
+		tm := NewCLI(t, s.RootDir())
+		AssertRunResult(t, tm.Run("run", "--quiet", HelperPath, "false"), RunExpected{
+			IgnoreStderr: true,
+			Status:       1,
+		})
+
+		s.RootEntry().CreateFile("globals.tm", "globals {\n  a = 1\n}\n")
+
+		AssertRunResult(t, tm.Run("run", "--resume"), RunExpected{
+			StderrRegex: "the Terramate configuration files changed",
+			Status:      1,
+		})
+	})
+
+	t.Run("sensitive values in the command", func(t *testing.T) {
+		t.Parallel()
+
+		s := sandbox.NoGit(t, true)
+		s.BuildTree([]string{
+			`f:terramate.tm:
+			terramate {
+			  config {
+			    run {
+			      sensitive {
+			        env = ["TOKEN"]
+			      }
+			    }
+			  }
+			}`,
+			`s:s1`,
+		})
+		tm := NewCLI(t, s.RootDir(), "TOKEN=secret-token")
+		AssertRunResult(t, tm.Run("run", "--quiet", HelperPath, "false", "secret-token"), RunExpected{
+			IgnoreStderr: true,
+			Status:       1,
+		})
+
+		journal := s.RootEntry().ReadFile(".terramate-cache/run-state.json")
+		if strings.Contains(string(journal), "secret-token") {
+			t.Errorf("sensitive value saved in the journal: %s", journal)
+		}
+
+		AssertRunResult(t, tm.Run("run", "--resume"), RunExpected{
+			StderrRegex: "the command of the previous run has sensitive values",
+			Status:      1,
+		})
+	})
+
+	t.Run("options saved by another version", func(t *testing.T) {
+		t.Parallel()
+
+		s := sandbox.NoGit(t, true)
+		s.BuildTree([]string{`s:s1`})
+		tm := NewCLI(t, s.RootDir())
+		AssertRunResult(t, tm.Run("run", "--quiet", HelperPath, "false"), RunExpected{
+			IgnoreStderr: true,
+			Status:       1,
+		})
+
+		journal := string(s.RootEntry().ReadFile(".terramate-cache/run-state.json"))
+		if !strings.Contains(journal, `"version": 1`) {
+			t.Fatalf("options version not saved in the journal: %s", journal)
+		}
+		journal = strings.Replace(journal, `"version": 1`, `"version": 99`, 1)
+		s.RootEntry().CreateFile(".terramate-cache/run-state.json", journal)
+
+		AssertRunResult(t, tm.Run("run", "--resume"), RunExpected{
+			StderrRegex: "saved by an incompatible version of Terramate",
+			Status:      1,
+		})
+	})
+
+	t.Run("commit changed", func(t *testing.T) {
+		t.Parallel()
+
+		s := sandbox.New(t)
+		s.BuildTree([]string{`s:s1`})
+		git := s.Git()
+		git.CommitAll("first commit")
+		git.Push("main")
+
+		tm := NewCLI(t, s.RootDir())
+		AssertRunResult(t, tm.Run("run", "--quiet", HelperPath, "false"), RunExpected{
+			IgnoreStderr: true,
+			Status:       1,
+		})
+
+		s.RootEntry().CreateFile("README.md", "# project")
+		git.CommitAll("second commit")
+
+		AssertRunResult(t, tm.Run("run", "--resume"), RunExpected{
+			StderrRegex: "HEAD moved from",
+			Status:      1,
+		})
+	})
+}
+
+func TestScriptRunResume(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    experiments = ["scripts"]
+		  }
+		}`,
+		`s:s1`,
+		`s:s2`,
+		`f:s1/file.txt:s1`,
+		fmt.Sprintf(`f:script.tm:
+		script "cat" {
+		  description = "cat file"
+		  job {
+		    command = ["%s", "cat", "file.txt"]
+		  }
+		}`, HelperPathAsHCL),
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "cat"), RunExpected{
+		Stdout:       "s1",
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	s.RootEntry().CreateFile("s2/file.txt", "s2")
+
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "--resume"), RunExpected{
+		Stdout: "s2",
+	})
+}
+
+func TestScriptRunResumeParams(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    experiments = ["scripts"]
+		  }
+		}`,
+		`s:s1`,
+		`s:s2`,
+		`f:s1/file.txt:s1`,
+		fmt.Sprintf(`f:script.tm:
+		script "greet" {
+		  description = "greet"
+		  param "greeting" {
+		    type = string
+		  }
+		  param "name" {
+		    type = string
+		  }
+		  job {
+		    commands = [
+		      ["%[1]s", "cat", "file.txt"],
+		      ["%[1]s", "echo", "${script.params.greeting} ${script.params.name}"],
+		    ]
+		  }
+		}`, HelperPathAsHCL),
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "greet", "--param", "greeting=hello", "--param", "name=world"), RunExpected{
+		Stdout:       "s1hello world\n",
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	s.RootEntry().CreateFile("s2/file.txt", "s2")
+
+	// The params of the previous run are kept and the params given to the
+	// resumed run override them.
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "--resume", "--param", "name=terramate"), RunExpected{
+		Stdout: "s2hello terramate\n",
+	})
+}
+
+func TestScriptRunResumeRootJobs(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:s1`,
+		`s:s2`,
+		`f:s1/file.txt:s1`,
+		fmt.Sprintf(`f:script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  job {
+		    context = root
+		    command = ["%[1]s", "echo", "before ${tm_length(terramate.run.stacks)}"]
+		  }
+		  job {
+		    command = ["%[1]s", "cat", "file.txt"]
+		  }
+		  job {
+		    context = root
+		    command = ["%[1]s", "echo", "after ${tm_length(terramate.run.stacks)}"]
+		  }
+		}`, HelperPathAsHCL),
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "deploy"), RunExpected{
+		Stdout:       "before 2\ns1",
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	s.RootEntry().CreateFile("s2/file.txt", "s2")
+
+	// The completed root jobs and stacks are skipped, but the root jobs are
+	// still given all the stacks of the run.
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "--resume"), RunExpected{
+		Stdout: "s2after 2\n",
+	})
+	AssertRunResult(t, tm.Run("script", "run", "--resume"), RunExpected{
+		StderrRegex: "Nothing to resume",
+	})
+}
+
+func TestScriptRunResumeRootContextScript(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:s1`,
+		`s:s2`,
+		fmt.Sprintf(`f:script.tm:
+		script "report" {
+		  description = "report"
+		  context     = root
+		  job {
+		    commands = [
+		      ["%[1]s", "echo", "report ${tm_length(terramate.run.stacks)}"],
+		      ["%[1]s", "cat", "marker"],
+		    ]
+		  }
+		}`, HelperPathAsHCL),
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "report"), RunExpected{
+		Stdout:       "report 2\n",
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	s.RootEntry().CreateFile("marker", "done")
+
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "--resume"), RunExpected{
+		Stdout: "report 2\ndone",
+	})
+	AssertRunResult(t, tm.Run("script", "run", "--resume"), RunExpected{
+		StderrRegex: "Nothing to resume",
+	})
+}
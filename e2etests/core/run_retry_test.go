@@ -0,0 +1,256 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	runutil "github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunRetry(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		name  string
+		flags []string
+		want  RunExpected
+	}
+
+	for _, tc := range []testcase{
+		{
+			name: "no retries by default",
+			want: RunExpected{
+				StderrRegex: "transient failure",
+				Status:      1,
+			},
+		},
+		{
+			name:  "retries failed command",
+			flags: []string{"--retry-max-attempts", "2", "--retry-backoff", "1ms"},
+			want: RunExpected{
+				Stdout: "success\n",
+				StderrRegexes: []string{
+					"transient failure",
+					`attempt 1/2 failed with exit code 3, retrying in 1ms`,
+					`attempt 2/2`,
+				},
+			},
+		},
+		{
+			name: "retries failed command with matching exit code",
+			flags: []string{
+				"--retry-max-attempts", "2", "--retry-backoff", "1ms",
+				"--retry-exit-codes", "1,3",
+			},
+			want: RunExpected{
+				Stdout:      "success\n",
+				StderrRegex: `attempt 1/2 failed with exit code 3`,
+			},
+		},
+		{
+			name: "do not retry failed command with other exit code",
+			flags: []string{
+				"--retry-max-attempts", "2", "--retry-backoff", "1ms",
+				"--retry-exit-codes", "2",
+				"--summary",
+			},
+			want: RunExpected{
+				StderrRegex: `/s1: failed \(exit code 3\)`,
+				Status:      1,
+			},
+		},
+		{
+			name: "retries failed command with matching output",
+			flags: []string{
+				"--retry-max-attempts", "2", "--retry-backoff", "1ms",
+				"--retry-output-regex", "transient",
+			},
+			want: RunExpected{
+				Stdout:      "success\n",
+				StderrRegex: `attempt 1/2 failed with exit code 3`,
+			},
+		},
+		{
+			name: "do not retry failed command with other output",
+			flags: []string{
+				"--retry-max-attempts", "2", "--retry-backoff", "1ms",
+				"--retry-output-regex", "permanent",
+				"--summary",
+			},
+			want: RunExpected{
+				StderrRegex: `/s1: failed \(exit code 3\)`,
+				Status:      1,
+			},
+		},
+		{
+			name:  "invalid retry flags",
+			flags: []string{"--retry-max-attempts", "0"},
+			want: RunExpected{
+				StderrRegex: "invalid --retry-\\* flags",
+				Status:      1,
+			},
+		},
+		{
+			name:  "retry conditions without attempts",
+			flags: []string{"--retry-exit-codes", "3"},
+			want: RunExpected{
+				StderrRegex: "require --retry-max-attempts greater than 1",
+				Status:      1,
+			},
+		},
+		{
+			name:  "retry output regex without attempts",
+			flags: []string{"--retry-max-attempts", "1", "--retry-output-regex", "transient"},
+			want: RunExpected{
+				StderrRegex: "require --retry-max-attempts greater than 1",
+				Status:      1,
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := sandbox.NoGit(t, true)
+			s.BuildTree([]string{`s:s1`})
+
+			marker := filepath.Join(s.RootDir(), "marker")
+			tm := NewCLI(t, s.RootDir())
+			args := append([]string{"run"}, tc.flags...)
+			args = append(args, HelperPath, "fail-once", marker, "3")
+			AssertRunResult(t, tm.Run(args...), tc.want)
+		})
+	}
+}
+
+func TestRunRetryAttemptsLogsAndReport(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    run {
+		      sensitive {
+		        patterns = ["trans[a-z]+"]
+		      }
+		    }
+		  }
+		}`,
+		`s:s1`,
+	})
+
+	marker := filepath.Join(s.RootDir(), "marker")
+	logDir := t.TempDir()
+	jsonReport := filepath.Join(t.TempDir(), "report.json")
+
+	// The output regex matches the output before the sensitive values are
+	// redacted.
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("run", "--quiet",
+		"--retry-max-attempts", "2", "--retry-backoff", "1ms", "--retry-output-regex", "transient",
+		"--log-dir", logDir, "--report-json", jsonReport,
+		HelperPath, "fail-once", marker, "3"), RunExpected{
+		Stdout: "success\n",
+		StderrRegexes: []string{
+			`^\*\*\* failure\n`,
+			`attempt 1/2 failed with exit code 3, retrying in 1ms`,
+		},
+	})
+
+	for name, want := range map[string]string{
+		"attempt-1.stdout.log": "",
+		"attempt-1.stderr.log": "*** failure\n",
+		"attempt-2.stdout.log": "success\n",
+		"attempt-2.stderr.log": "",
+	} {
+		assertLogFile(t, filepath.Join(logDir, "s1", name), want)
+	}
+
+	data, err := os.ReadFile(jsonReport)
+	assert.NoError(t, err)
+
+	var report runutil.Report
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.EqualInts(t, 1, len(report.Stacks))
+
+	attempts := report.Stacks[0].Attempts
+	assert.EqualInts(t, 2, len(attempts))
+	for i, wantExitCode := range []int{3, 0} {
+		got := attempts[i]
+		assert.EqualInts(t, i+1, got.Attempt)
+		assert.EqualInts(t, wantExitCode, *got.ExitCode)
+		assert.EqualStrings(t, filepath.Join(logDir, "s1", fmt.Sprintf("attempt-%d.stdout.log", i+1)), got.StdoutLog)
+	}
+}
+
+func TestRunRetryReleasesParallelSlotDuringBackoff(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`s:s1`,
+		`s:s2`,
+		`s:s3`,
+	})
+
+	// The stack without a parallel slot runs while the other ones wait to
+	// be retried, then all the stacks fail before any retry.
+	tm := NewCLI(t, s.RootDir())
+	res := tm.Run("run", "--parallel", "2",
+		"--retry-max-attempts", "2", "--retry-backoff", "3s",
+		HelperPath, "fail-once", "marker", "3")
+	AssertRunResult(t, res, RunExpected{
+		IgnoreStdout: true,
+		IgnoreStderr: true,
+	})
+
+	firstRetry := strings.Index(res.Stderr, "attempt 2/2")
+	assert.IsTrue(t, firstRetry != -1, "no retry in the output: %s", res.Stderr)
+	assert.EqualInts(t, 3, strings.Count(res.Stderr[:firstRetry], "attempt 1/2 failed"))
+}
+
+func TestScriptRunRetry(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	marker := filepath.Join(s.RootDir(), "marker")
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    experiments = ["scripts"]
+		  }
+		}`,
+		`s:s1`,
+		fmt.Sprintf(`f:script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  job {
+		    command = ["%s", "fail-once", "%s", "1", {
+		      retry = {
+		        max_attempts = 3
+		        backoff      = "1ms"
+		      }
+		    }]
+		  }
+		}`, HelperPathAsHCL, filepath.ToSlash(marker)),
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "deploy"), RunExpected{
+		Stdout:      "success\n",
+		StderrRegex: `attempt 1/3 failed with exit code 1, retrying in 1ms`,
+	})
+}
@@ -0,0 +1,113 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunRedactsSensitiveValues(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    run {
+		      env {
+		        TOKEN = "env-secret"
+		      }
+		      sensitive {
+		        env      = ["TOKEN", "HOST_TOKEN"]
+		        globals  = ["secrets.password"]
+		        patterns = ["ghp_[a-z0-9]+"]
+		      }
+		      after_run {
+		        command = ["` + HelperPathAsHCL + `", "echo", "hook ${global.secrets.password}"]
+		      }
+		    }
+		  }
+		}
+		globals {
+		  secrets = {
+		    password = "global-secret"
+		  }
+		}`,
+		`s:stack`,
+	})
+
+	tm := NewCLI(t, s.RootDir(), "HOST_TOKEN=host-secret")
+	AssertRunResult(t, tm.Run("run", "--quiet", "--",
+		HelperPath, "echo", "env-secret host-secret global-secret ghp_abc123 public"),
+		RunExpected{
+			Stdout: "*** *** *** *** public\nhook ***\n",
+		},
+	)
+}
+
+func TestRunRedactsSensitiveValuesInCommands(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    experiments = ["scripts"]
+		    run {
+		      sensitive {
+		        globals = ["secrets.password"]
+		      }
+		    }
+		  }
+		}
+		globals {
+		  secrets = {
+		    password = "global-secret"
+		  }
+		}`,
+		`s:stack`,
+		`f:stack/script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  job {
+		    command = ["` + HelperPathAsHCL + `", "false", global.secrets.password]
+		  }
+		}`,
+	})
+
+	assertRedacted := func(t *testing.T, res RunResult) {
+		t.Helper()
+		if strings.Contains(res.Stdout+res.Stderr, "global-secret") {
+			t.Errorf("sensitive value not redacted:\nstdout: %s\nstderr: %s", res.Stdout, res.Stderr)
+		}
+	}
+
+	tm := NewCLI(t, s.RootDir())
+	res := tm.Run("run", "--eval", "--", HelperPath, "false", "${global.secrets.password}")
+	AssertRunResult(t, res, RunExpected{
+		StderrRegexes: []string{
+			`Executing command ".*false \*\*\*"`,
+			`running .*false \*\*\* \(in /stack\)`,
+		},
+		Status: 1,
+	})
+	assertRedacted(t, res)
+
+	res = tm.Run("script", "run", "deploy")
+	AssertRunResult(t, res, RunExpected{
+		IgnoreStdout: true,
+		StderrRegexes: []string{
+			`/stack \(script:0 job:0\.0\)> .*false \*\*\*`,
+			`running .*false \*\*\* \(in /stack\)`,
+		},
+		Status: 1,
+	})
+	assertRedacted(t, res)
+}
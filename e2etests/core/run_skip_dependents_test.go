@@ -0,0 +1,141 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"testing"
+
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunSkipDependents(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		name   string
+		layout []string
+		flags  []string
+		want   RunExpected
+	}
+
+	for _, tc := range []testcase{
+		{
+			name: "continue-on-error runs dependents of failed stacks",
+			layout: []string{
+				`s:a`,
+				`s:b:after=["/a"]`,
+				`s:c:after=["/b"]`,
+				`s:d`,
+				`f:b/data:b`,
+				`f:c/data:c`,
+				`f:d/data:d`,
+			},
+			flags: []string{"--continue-on-error"},
+			want: RunExpected{
+				Stdout:       "bcd",
+				IgnoreStderr: true,
+				Status:       1,
+			},
+		},
+		{
+			name: "dependents of failed stacks are skipped",
+			layout: []string{
+				`s:a`,
+				`s:b:after=["/a"]`,
+				`s:c:after=["/b"]`,
+				`s:d`,
+				`f:b/data:b`,
+				`f:c/data:c`,
+				`f:d/data:d`,
+			},
+			flags: []string{"--skip-dependents"},
+			want: RunExpected{
+				Stdout: "d",
+				StderrRegexes: []string{
+					`Run summary: 1 succeeded, 1 failed, 2 skipped`,
+					`/a: failed \(exit code 1\)`,
+					`/b: skipped \(upstream failed: /a\)`,
+					`/c: skipped \(upstream failed: /a -> /b\)`,
+				},
+				Status: 1,
+			},
+		},
+		{
+			name: "dependents of failed stacks are skipped in parallel runs",
+			layout: []string{
+				`s:a`,
+				`s:b:after=["/a"]`,
+				`s:c:after=["/b"]`,
+				`s:d`,
+				`f:b/data:b`,
+				`f:c/data:c`,
+				`f:d/data:d`,
+			},
+			flags: []string{"--skip-dependents", "--parallel", "2"},
+			want: RunExpected{
+				Stdout: "d",
+				StderrRegexes: []string{
+					`/b: skipped \(upstream failed: /a\)`,
+					`/c: skipped \(upstream failed: /a -> /b\)`,
+				},
+				Status: 1,
+			},
+		},
+		{
+			name: "dependents of failed stacks are skipped in reverse order",
+			layout: []string{
+				`s:a`,
+				`s:b:after=["/a"]`,
+				`s:c:after=["/b"]`,
+				`s:d`,
+				`f:a/data:a`,
+				`f:b/data:b`,
+				`f:d/data:d`,
+			},
+			flags: []string{"--skip-dependents", "--reverse"},
+			want: RunExpected{
+				Stdout: "d",
+				StderrRegexes: []string{
+					`/c: failed \(exit code 1\)`,
+					`/b: skipped \(upstream failed: /c\)`,
+					`/a: skipped \(upstream failed: /c -> /b\)`,
+				},
+				Status: 1,
+			},
+		},
+		{
+			name: "stacks after multiple stacks are skipped if any of them failed",
+			layout: []string{
+				`s:a`,
+				`s:b`,
+				`s:c:after=["/a", "/b"]`,
+				`f:b/data:b`,
+				`f:c/data:c`,
+			},
+			flags: []string{"--skip-dependents"},
+			want: RunExpected{
+				Stdout: "b",
+				StderrRegexes: []string{
+					`/a: failed \(exit code 1\)`,
+					`/c: skipped \(upstream failed: /a\)`,
+				},
+				Status: 1,
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := sandbox.NoGit(t, true)
+			s.BuildTree(tc.layout)
+
+			tm := NewCLI(t, s.RootDir())
+			args := append([]string{"run"}, tc.flags...)
+			args = append(args, HelperPath, "cat", "data")
+			AssertRunResult(t, tm.Run(args...), tc.want)
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestRunTimeout(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`s:s1`,
+		`s:s2`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("run", "--summary", "--timeout", "1s", HelperPath, "sleep", "1m"), RunExpected{
+		Stdout: "ready\n",
+		StderrRegexes: []string{
+			`command timed out after 1s, interrupting it`,
+			`Run summary: 1 timed out, 1 canceled`,
+			`/s1: timed out \(after 1s\)`,
+			`/s2: canceled \(run timed out\)`,
+		},
+		Status: 1,
+	})
+}
+
+func TestRunStackTimeoutKillsAfterGracePeriod(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    run {
+		      stack_timeout        = "500ms"
+		      timeout_grace_period = "500ms"
+		    }
+		  }
+		}`,
+		`s:s1`,
+		`s:s2`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("run", "--summary", "--continue-on-error", HelperPath, "hang"), RunExpected{
+		IgnoreStdout: true,
+		StderrRegexes: []string{
+			`command did not exit within 500ms, killing it`,
+			`Run summary: 2 timed out`,
+			`/s1: timed out \(after 500ms\)`,
+			`/s2: timed out \(after 500ms\)`,
+		},
+		Status: 1,
+	})
+	AssertRunResult(t, tm.Run("run", "--resume", "--dry-run"), RunExpected{
+		StderrRegexes: []string{
+			`Entering stack in /s1`,
+			`Entering stack in /s2`,
+		},
+	})
+}
+
+func TestScriptRunCommandTimeout(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    experiments = ["scripts"]
+		  }
+		}`,
+		`s:s1`,
+		fmt.Sprintf(`f:script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  job {
+		    commands = [
+		      ["%[1]s", "sleep", "1m", {
+		        timeout = "1s"
+		      }],
+		      ["%[1]s", "echo", "not executed"],
+		    ]
+		  }
+		}`, HelperPathAsHCL),
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--summary", "deploy"), RunExpected{
+		Stdout: "ready\n",
+		StderrRegexes: []string{
+			`command timed out after 1s, interrupting it`,
+			`/s1: timed out \(after 1s\)`,
+		},
+		Status: 1,
+	})
+}
+
+func TestRunStackTimeoutAppliesToHooks(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    run {
+		      stack_timeout = "1s"
+		      before_run {
+		        command = ["` + HelperPathAsHCL + `", "sleep", "1m"]
+		      }
+		    }
+		  }
+		}`,
+		`s:s1`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("run", "--summary", HelperPath, "echo", "not executed"), RunExpected{
+		Stdout: "ready\n",
+		StderrRegexes: []string{
+			`before_run hook timed out after 1s, interrupting it`,
+			`Run summary: 1 failed`,
+		},
+		Status: 1,
+	})
+}
+
+func TestRunStackTimeoutAppliesToAllAttempts(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    run {
+		      stack_timeout = "1s"
+		    }
+		  }
+		}`,
+		`s:s1`,
+	})
+
+	// The second retry would start after 1.2s, past the timeout of the stack.
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("run", "--summary", "--retry-max-attempts", "5", "--retry-backoff", "400ms",
+		HelperPath, "exit", "3"), RunExpected{
+		StderrRegexes: []string{
+			`attempt 1/5 failed with exit code 3, retrying in 400ms`,
+			`attempt 2/5 failed with exit code 3, retrying in 800ms`,
+			`command timed out after 1s, not retrying it`,
+			`/s1: timed out \(after 1s\)`,
+		},
+		Status: 1,
+	})
+}
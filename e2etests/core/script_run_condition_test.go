@@ -0,0 +1,95 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	runutil "github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestScriptRunJobCondition(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:tf:tags=["terraform"]`,
+		`s:other`,
+		`f:script.tm:
+		script "check" {
+		  description = "check"
+		  job {
+		    name      = "tflint"
+		    condition = tm_contains(terramate.stack.tags, "terraform")
+		    command   = ["` + HelperPathAsHCL + `", "echo", "tflint ${terramate.stack.name}"]
+		  }
+		  job {
+		    name    = "validate"
+		    command = ["` + HelperPathAsHCL + `", "echo", "validate ${terramate.stack.name}"]
+		  }
+		}`,
+	})
+
+	jsonReport := filepath.Join(t.TempDir(), "report.json")
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "--report-json", jsonReport, "check"), RunExpected{
+		Stdout: "validate other\ntflint tf\nvalidate tf\n",
+	})
+
+	data, err := os.ReadFile(jsonReport)
+	assert.NoError(t, err)
+
+	var report runutil.Report
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.EqualInts(t, 2, len(report.Stacks))
+
+	other := report.Stacks[0]
+	assert.EqualStrings(t, "/other", other.Path)
+	assert.EqualStrings(t, string(runutil.StackOK), string(other.Status))
+	assert.EqualInts(t, 2, len(other.Jobs))
+	assert.EqualStrings(t, string(runutil.StackSkipped), string(other.Jobs[0].Status))
+	assert.EqualStrings(t, "condition is false", other.Jobs[0].Reason)
+	assert.EqualStrings(t, string(runutil.StackOK), string(other.Jobs[1].Status))
+
+	tf := report.Stacks[1]
+	assert.EqualStrings(t, "/tf", tf.Path)
+	assert.EqualStrings(t, string(runutil.StackOK), string(tf.Jobs[0].Status))
+	assert.EqualStrings(t, string(runutil.StackOK), string(tf.Jobs[1].Status))
+}
+
+func TestScriptRunScriptCondition(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:tf:tags=["terraform"]`,
+		`s:other`,
+		`f:script.tm:
+		script "check" {
+		  description = "check"
+		  condition   = tm_contains(terramate.stack.tags, "terraform")
+		  job {
+		    command = ["` + HelperPathAsHCL + `", "echo", "tflint ${terramate.stack.name}"]
+		  }
+		}`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "check"), RunExpected{
+		Stdout: "tflint tf\n",
+	})
+	AssertRunResult(t, tm.Run("script", "run", "check"), RunExpected{
+		IgnoreStdout: true,
+		StderrRegex:  `Skipping stack /other: condition is false`,
+	})
+}
@@ -0,0 +1,169 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	runutil "github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestScriptRunEnv(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:stack`,
+		`f:env.tm:
+		terramate {
+		  config {
+		    run {
+		      env {
+		        RUN_VAR    = "run"
+		        SCRIPT_VAR = "run"
+		      }
+		    }
+		  }
+		}`,
+		`f:script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  env {
+		    SCRIPT_VAR = "script ${terramate.stack.name}"
+		    JOB_VAR    = "script"
+		  }
+		  job {
+		    name = "plan"
+		    env {
+		      JOB_VAR  = "plan"
+		      RUN_VAR  = unset
+		      HOST_VAR = null
+		    }
+		    commands = [
+		      ["` + HelperPathAsHCL + `", "env", terramate.root.path.fs.absolute, "RUN_VAR", "HOST_VAR"],
+		      ["` + HelperPathAsHCL + `", "env", terramate.root.path.fs.absolute, "SCRIPT_VAR"],
+		      ["` + HelperPathAsHCL + `", "env", terramate.root.path.fs.absolute, "JOB_VAR"],
+		    ]
+		  }
+		  job {
+		    name = "apply"
+		    commands = [
+		      ["` + HelperPathAsHCL + `", "env", terramate.root.path.fs.absolute, "RUN_VAR"],
+		      ["` + HelperPathAsHCL + `", "env", terramate.root.path.fs.absolute, "HOST_VAR"],
+		      ["` + HelperPathAsHCL + `", "env", terramate.root.path.fs.absolute, "JOB_VAR"],
+		    ]
+		  }
+		}`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	tm.AppendEnv = append(tm.AppendEnv, "HOST_VAR=host")
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "deploy"), RunExpected{
+		Stdout: nljoin(
+			"/stack: script stack",
+			"/stack: plan",
+			"/stack: run",
+			"/stack: host",
+			"/stack: script",
+		),
+	})
+
+	// The env of the script doesn't leak to other commands.
+	AssertRunResult(t, tm.Run("run", "--quiet", "--", HelperPath, "env", s.RootDir(), "SCRIPT_VAR", "JOB_VAR"), RunExpected{
+		Stdout: nljoin("/stack: run"),
+	})
+}
+
+func TestScriptRunEnvJSONPlan(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:stack`,
+		`f:script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  env {
+		    TOKEN = "secret"
+		  }
+		  job {
+		    name = "plan"
+		    env {
+		      PROFILE = "plan"
+		      AWS_VAR = unset
+		    }
+		    command = ["echo", "plan"]
+		  }
+		  job {
+		    name    = "apply"
+		    command = ["echo", "apply"]
+		  }
+		}`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	res := tm.Run("script", "run", "--dry-run", "--format", "json", "deploy")
+	AssertRunResult(t, res, RunExpected{IgnoreStdout: true, IgnoreStderr: true})
+
+	var plan runutil.Plan
+	if err := json.Unmarshal([]byte(res.Stdout), &plan); err != nil {
+		t.Fatalf("invalid JSON plan: %v\n%s", err, res.Stdout)
+	}
+	assert.EqualInts(t, 1, len(plan.Stacks))
+
+	want := []runutil.TaskPlan{
+		{
+			Cmd:            []string{"echo", "plan"},
+			ScriptJob:      1,
+			ScriptCommand:  1,
+			ScriptJobName:  "plan",
+			ScriptEnv:      []string{"PROFILE", "TOKEN"},
+			ScriptUnsetEnv: []string{"AWS_VAR"},
+		},
+		{
+			Cmd:                []string{"echo", "apply"},
+			ScriptJob:          2,
+			ScriptCommand:      1,
+			ScriptJobName:      "apply",
+			ScriptJobDependsOn: []int{1},
+			ScriptEnv:          []string{"TOKEN"},
+		},
+	}
+	if diff := cmp.Diff(want, plan.Stacks[0].Tasks); diff != "" {
+		t.Fatalf("unexpected plan: %s", diff)
+	}
+}
+
+func TestScriptRunEnvInvalidType(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:stack`,
+		`f:script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  job {
+		    env {
+		      TF_LOG = 1
+		    }
+		    command = ["` + HelperPathAsHCL + `", "true"]
+		  }
+		}`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "deploy"), RunExpected{
+		StderrRegex: `env.TF_LOG must be a string, but has type number`,
+		Status:      1,
+	})
+}
@@ -0,0 +1,166 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	runutil "github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+// scriptWithFinally returns a script whose first job exits with the exit code
+// of global.exit_code.
+func scriptWithFinally() string {
+	return `f:script.tm:
+script "deploy" {
+  description = "deploy"
+  job {
+    name    = "apply"
+    command = ["` + HelperPathAsHCL + `", "exit", global.exit_code]
+  }
+  job {
+    name    = "check"
+    command = ["` + HelperPathAsHCL + `", "echo", "check"]
+  }
+  on_failure {
+    name    = "notify"
+    command = ["` + HelperPathAsHCL + `", "echo", "${script.result.failed_job} failed with ${script.result.exit_code}"]
+  }
+  finally {
+    command = ["` + HelperPathAsHCL + `", "echo", "unlock failed=${script.result.failed}"]
+  }
+}`
+}
+
+func TestScriptRunFinally(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:stack`,
+		`f:globals.tm:globals {
+		  exit_code = "0"
+		}`,
+		scriptWithFinally(),
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "deploy"), RunExpected{
+		Stdout: nljoin("check", "unlock failed=false"),
+	})
+}
+
+func TestScriptRunOnFailure(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:stack`,
+		`f:globals.tm:globals {
+		  exit_code = "3"
+		}`,
+		scriptWithFinally(),
+	})
+
+	jsonReport := filepath.Join(t.TempDir(), "report.json")
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "--report-json", jsonReport, "deploy"), RunExpected{
+		Stdout:       nljoin("apply failed with 3", "unlock failed=true"),
+		IgnoreStderr: true,
+		Status:       1,
+	})
+
+	data, err := os.ReadFile(jsonReport)
+	assert.NoError(t, err)
+
+	var report runutil.Report
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.EqualInts(t, 1, len(report.Stacks))
+
+	stack := report.Stacks[0]
+	assert.EqualStrings(t, string(runutil.StackFailed), string(stack.Status))
+	assert.IsTrue(t, stack.ExitCode != nil && *stack.ExitCode == 3, "stack exit code must be the one of the failed job")
+	assert.EqualInts(t, 4, len(stack.Jobs))
+
+	for i, want := range []struct {
+		name, kind string
+		status     runutil.StackStatus
+	}{
+		{"apply", "", runutil.StackFailed},
+		{"check", "", runutil.StackCanceled},
+		{"notify", "on_failure", runutil.StackOK},
+		{"", "finally", runutil.StackOK},
+	} {
+		job := stack.Jobs[i]
+		assert.EqualStrings(t, want.name, job.Name, "job %d name", i)
+		assert.EqualStrings(t, want.kind, job.Kind, "job %d kind", i)
+		assert.EqualStrings(t, string(want.status), string(job.Status), "job %d status", i)
+	}
+}
+
+func TestScriptRunFinallyJSONPlan(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:stack`,
+		`f:globals.tm:globals {
+		  exit_code = "0"
+		}`,
+		scriptWithFinally(),
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	res := tm.Run("script", "run", "--dry-run", "--format", "json", "deploy")
+	AssertRunResult(t, res, RunExpected{IgnoreStdout: true, IgnoreStderr: true})
+
+	var plan runutil.Plan
+	if err := json.Unmarshal([]byte(res.Stdout), &plan); err != nil {
+		t.Fatalf("invalid JSON plan: %v\n%s", err, res.Stdout)
+	}
+	assert.EqualInts(t, 1, len(plan.Stacks))
+
+	want := []runutil.TaskPlan{
+		{
+			Cmd:           []string{HelperPath, "exit", "0"},
+			ScriptJob:     1,
+			ScriptCommand: 1,
+			ScriptJobName: "apply",
+		},
+		{
+			Cmd:                []string{HelperPath, "echo", "check"},
+			ScriptJob:          2,
+			ScriptCommand:      1,
+			ScriptJobName:      "check",
+			ScriptJobDependsOn: []int{1},
+		},
+		{
+			Cmd:           []string{HelperPath, "echo", " failed with 1"},
+			ScriptJob:     1,
+			ScriptCommand: 1,
+			ScriptJobName: "notify",
+			ScriptJobKind: "on_failure",
+		},
+		{
+			Cmd:           []string{HelperPath, "echo", "unlock failed=false"},
+			ScriptJob:     1,
+			ScriptCommand: 1,
+			ScriptJobKind: "finally",
+		},
+	}
+	if diff := cmp.Diff(want, plan.Stacks[0].Tasks); diff != "" {
+		t.Fatalf("unexpected plan: %s", diff)
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	runutil "github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+const scriptsExperimentConfig = `f:terramate.tm:
+terramate {
+  config {
+    experiments = ["scripts"]
+  }
+}`
+
+func TestScriptRunParallelJobs(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:stack`,
+		`d:stack/rendezvous`,
+		`f:script.tm:
+		script "check" {
+		  description = "check"
+		  job {
+		    name     = "lint"
+		    parallel = true
+		    command  = ["` + HelperPathAsHCL + `", "rendezvous", "rendezvous", "2", "30s"]
+		  }
+		  job {
+		    name     = "scan"
+		    parallel = true
+		    command  = ["` + HelperPathAsHCL + `", "rendezvous", "rendezvous", "2", "30s"]
+		  }
+		  job {
+		    name    = "plan"
+		    command = ["` + HelperPathAsHCL + `", "echo", "plan"]
+		  }
+		}`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	res := tm.Run("script", "run", "--quiet", "check")
+	AssertRunResult(t, res, RunExpected{IgnoreStdout: true})
+
+	lines := strings.Split(strings.TrimSpace(res.Stdout), "\n")
+	assert.EqualInts(t, 3, len(lines), "unexpected output:\n%s", res.Stdout)
+	assert.IsTrue(t, strings.Contains(res.Stdout, "[lint] done\n"), "unexpected output:\n%s", res.Stdout)
+	assert.IsTrue(t, strings.Contains(res.Stdout, "[scan] done\n"), "unexpected output:\n%s", res.Stdout)
+	assert.EqualStrings(t, "[plan] plan", lines[2])
+}
+
+func TestScriptRunJobDependsOn(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:stack`,
+		`f:script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  job {
+		    name       = "apply"
+		    depends_on = ["init"]
+		    command    = ["` + HelperPathAsHCL + `", "echo", "apply"]
+		  }
+		  job {
+		    name       = "init"
+		    depends_on = []
+		    command    = ["` + HelperPathAsHCL + `", "echo", "init"]
+		  }
+		}`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "deploy"), RunExpected{
+		Stdout: "[init] init\n[apply] apply\n",
+	})
+}
+
+func TestScriptRunJobDependsOnUnknownJob(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:stack`,
+		`f:script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  job {
+		    depends_on = ["init"]
+		    command    = ["` + HelperPathAsHCL + `", "echo", "apply"]
+		  }
+		}`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "deploy"), RunExpected{
+		StderrRegex: `job "init" not found`,
+		Status:      1,
+	})
+}
+
+func TestScriptRunParallelJobsReport(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:stack`,
+		`d:stack/rendezvous`,
+		`f:script.tm:
+		script "check" {
+		  description = "check"
+		  job {
+		    name     = "lint"
+		    parallel = true
+		    commands = [
+		      ["` + HelperPathAsHCL + `", "rendezvous", "rendezvous", "2", "30s"],
+		      ["` + HelperPathAsHCL + `", "exit", "3"],
+		    ]
+		  }
+		  job {
+		    name     = "scan"
+		    parallel = true
+		    command  = ["` + HelperPathAsHCL + `", "rendezvous", "rendezvous", "2", "30s"]
+		  }
+		  job {
+		    name       = "plan"
+		    depends_on = ["lint"]
+		    command    = ["` + HelperPathAsHCL + `", "echo", "plan"]
+		  }
+		}`,
+	})
+
+	jsonReport := filepath.Join(t.TempDir(), "report.json")
+
+	tm := NewCLI(t, s.RootDir())
+	res := tm.Run("script", "run", "--summary", "--report-json", jsonReport, "check")
+	AssertRunResult(t, res, RunExpected{
+		IgnoreStdout: true,
+		IgnoreStderr: true,
+		Status:       1,
+	})
+	assert.IsTrue(t, strings.Contains(res.Stderr, "/stack: failed (lint: exit code 3)"),
+		"unexpected stderr:\n%s", res.Stderr)
+
+	data, err := os.ReadFile(jsonReport)
+	assert.NoError(t, err)
+
+	var report runutil.Report
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.EqualInts(t, 1, len(report.Stacks))
+
+	stack := report.Stacks[0]
+	assert.EqualStrings(t, string(runutil.StackFailed), string(stack.Status))
+	assert.EqualStrings(t, "lint: exit code 3", stack.Reason)
+	assert.EqualInts(t, 3, len(stack.Jobs))
+
+	lint, scan, plan := stack.Jobs[0], stack.Jobs[1], stack.Jobs[2]
+
+	assert.EqualStrings(t, "lint", lint.Name)
+	assert.EqualInts(t, 1, lint.Index)
+	assert.EqualStrings(t, string(runutil.StackFailed), string(lint.Status))
+	assert.EqualStrings(t, "exit code 3", lint.Reason)
+	assert.EqualInts(t, 3, *lint.ExitCode)
+
+	assert.EqualStrings(t, "scan", scan.Name)
+	assert.EqualStrings(t, string(runutil.StackOK), string(scan.Status))
+	assert.EqualInts(t, 0, *scan.ExitCode)
+
+	assert.EqualStrings(t, "plan", plan.Name)
+	assert.EqualStrings(t, string(runutil.StackCanceled), string(plan.Status))
+	assert.EqualStrings(t, "another job failed", plan.Reason)
+	assert.IsTrue(t, plan.StartedAt == nil)
+}
+
+func TestScriptRunParallelJobsGetNoStdin(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:stack`,
+		`f:script.tm:
+		script "check" {
+		  description = "check"
+		  job {
+		    name     = "lint"
+		    parallel = true
+		    command  = ["` + HelperPathAsHCL + `", "cat", "-"]
+		  }
+		  job {
+		    name     = "scan"
+		    parallel = true
+		    command  = ["` + HelperPathAsHCL + `", "cat", "-"]
+		  }
+		  job {
+		    name    = "plan"
+		    command = ["` + HelperPathAsHCL + `", "cat", "-"]
+		  }
+		}`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.RunWithStdin("input\n", "script", "run", "--quiet", "check"), RunExpected{
+		Stdout: "[plan] input\n",
+	})
+}
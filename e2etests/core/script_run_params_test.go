@@ -0,0 +1,101 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"testing"
+
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+const scriptWithParams = `f:script.tm:
+script "deploy" {
+  description = "deploy"
+  param "region" {
+    type        = string
+    default     = "eu-west-1"
+    description = "AWS region"
+  }
+  param "replicas" {
+    type = number
+  }
+  job {
+    command = ["echo", "${terramate.stack.name} ${script.params.region} ${script.params.replicas + 1}"]
+  }
+}`
+
+func TestScriptRunParams(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:stack`,
+		scriptWithParams,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "deploy", "--param", "replicas=2"), RunExpected{
+		Stdout: "stack eu-west-1 3\n",
+	})
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "--param", "region=us-east-1", "deploy", "--param=replicas=0"), RunExpected{
+		Stdout: "stack us-east-1 1\n",
+	})
+}
+
+func TestScriptRunParamsErrors(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:stack`,
+		scriptWithParams,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "deploy"), RunExpected{
+		StderrRegex: `missing required parameter "replicas"`,
+		Status:      1,
+	})
+	AssertRunResult(t, tm.Run("script", "run", "deploy", "--param", "replicas=two"), RunExpected{
+		StderrRegex: `parameter "replicas" must be of type number`,
+		Status:      1,
+	})
+	AssertRunResult(t, tm.Run("script", "run", "deploy", "--param", "replicas=2", "--param", "zone=a"), RunExpected{
+		StderrRegex: `unknown parameter "zone"`,
+		Status:      1,
+	})
+	AssertRunResult(t, tm.Run("script", "run", "deploy", "--param", "replicas=2", "other"), RunExpected{
+		StderrRegex: `unexpected argument "other" after script parameters`,
+		Status:      1,
+	})
+}
+
+func TestScriptInfoParams(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:stack`,
+		scriptWithParams,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "info", "deploy"), RunExpected{
+		Stdout: `Definition: /script.tm:2,1-15,2
+Description: "deploy"
+Stacks:
+  /stack
+Parameters:
+  * region (string, default "eu-west-1"): "AWS region"
+  * replicas (number, required)
+Jobs:
+  * ["echo","${terramate.stack.name} ${script.params.region} ${script.params.replicas + 1}"]
+
+`,
+	})
+}
@@ -0,0 +1,433 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/madlambda/spells/assert"
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	runutil "github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestScriptRunRootJobs(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:stacks/a`,
+		`s:stacks/b`,
+		`f:script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  job {
+		    context = root
+		    command = ["` + HelperPathAsHCL + `", "echo", "before ${tm_length(terramate.run.stacks)}"]
+		  }
+		  job {
+		    command = ["` + HelperPathAsHCL + `", "echo", "deploy", terramate.stack.path.absolute]
+		  }
+		  job {
+		    context = root
+		    command = ["` + HelperPathAsHCL + `", "echo", "after", tm_join(",", terramate.run.stacks)]
+		  }
+		}`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "deploy"), RunExpected{
+		Stdout: nljoin(
+			"before 2",
+			"deploy /stacks/a",
+			"deploy /stacks/b",
+			"after /stacks/a,/stacks/b",
+		),
+	})
+
+	// Only the selected stacks are exposed to the root jobs.
+	tm = NewCLI(t, filepath.Join(s.RootDir(), "stacks/b"))
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "deploy"), RunExpected{
+		Stdout: nljoin(
+			"before 1",
+			"deploy /stacks/b",
+			"after /stacks/b",
+		),
+	})
+}
+
+func TestScriptRunRootContextScript(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:stacks/a`,
+		`s:stacks/b`,
+		`f:script.tm:
+		script "report" {
+		  description = "aggregate the plans"
+		  context     = root
+		  job {
+		    command = ["` + HelperPathAsHCL + `", "echo", "report", tm_join(",", terramate.run.stacks)]
+		  }
+		}`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "report"), RunExpected{
+		Stdout: nljoin("report /stacks/a,/stacks/b"),
+	})
+
+	AssertRunResult(t, tm.Run("script", "run", "--dry-run", "report"), RunExpected{
+		StderrRegex: `/ \(script:0 root:0.0\)> .* echo report /stacks/a,/stacks/b`,
+	})
+}
+
+func TestScriptRunRootJobFailureSkipsStacks(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:stack`,
+		`f:script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  job {
+		    context = root
+		    command = ["` + HelperPathAsHCL + `", "exit", "1"]
+		  }
+		  job {
+		    command = ["` + HelperPathAsHCL + `", "echo", "deploy"]
+		  }
+		}`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "deploy"), RunExpected{
+		StderrRegex: `one or more commands failed`,
+		Status:      1,
+	})
+}
+
+func TestScriptRunRootJobsEnvLogsAndReport(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    experiments = ["scripts"]
+		    run {
+		      env {
+		        NAME  = global.name
+		        TOKEN = "secret-${global.name}"
+		      }
+		      sensitive {
+		        env = ["TOKEN"]
+		      }
+		    }
+		  }
+		}
+		globals {
+		  name = "root"
+		}`,
+		`s:stack`,
+		`f:stack/config.tm:
+		globals {
+		  name = "stack"
+		}`,
+		`f:script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  job {
+		    context = root
+		    commands = [
+		      ["` + HelperPathAsHCL + `", "env", terramate.root.path.fs.absolute, "NAME"],
+		      ["` + HelperPathAsHCL + `", "env", terramate.root.path.fs.absolute, "TOKEN"],
+		    ]
+		  }
+		  job {
+		    command = ["` + HelperPathAsHCL + `", "env", terramate.root.path.fs.absolute, "NAME"]
+		  }
+		  job {
+		    context = root
+		    command = ["` + HelperPathAsHCL + `", "echo", "after"]
+		  }
+		}`,
+	})
+
+	logDir := t.TempDir()
+	jsonReport := filepath.Join(t.TempDir(), "report.json")
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "--log-dir", logDir, "--report-json", jsonReport, "deploy"), RunExpected{
+		Stdout: nljoin(
+			"/: root",
+			"/: ***",
+			"/stack: stack",
+			"after",
+		),
+	})
+
+	for name, want := range map[string]string{
+		"root-1.cmd-1.stdout.log": "/: root\n",
+		"root-1.cmd-2.stdout.log": "/: ***\n",
+		"root-2.cmd-1.stdout.log": "after\n",
+	} {
+		assertLogFile(t, filepath.Join(logDir, name), want)
+	}
+
+	data, err := os.ReadFile(jsonReport)
+	assert.NoError(t, err)
+
+	var report runutil.Report
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.EqualInts(t, 3, len(report.Stacks))
+
+	for i, want := range []struct {
+		root  string
+		path  string
+		order int
+		jobs  int
+	}{
+		{root: runutil.RootBefore, path: "/", order: 0, jobs: 1},
+		{path: "/stack", order: 1, jobs: 1},
+		{root: runutil.RootAfter, path: "/", order: 2, jobs: 1},
+	} {
+		got := report.Stacks[i]
+		assert.EqualStrings(t, want.root, got.Root)
+		assert.EqualStrings(t, want.path, got.Path)
+		assert.EqualInts(t, want.order, got.Order)
+		assert.EqualStrings(t, string(runutil.StackOK), string(got.Status))
+		assert.EqualInts(t, want.jobs, len(got.Jobs))
+	}
+	assert.EqualStrings(t, "root", report.Stacks[0].Jobs[0].Kind)
+}
+
+func TestScriptRunRootJobsRetryAndTimeout(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	marker := filepath.Join(s.RootDir(), "marker")
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:stack`,
+		fmt.Sprintf(`f:script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  job {
+		    context = root
+		    command = ["%s", "fail-once", "%s", "1", {
+		      retry = {
+		        max_attempts = 2
+		        backoff      = "1ms"
+		      }
+		    }]
+		  }
+		  job {
+		    command = ["%s", "echo", "deploy"]
+		  }
+		  job {
+		    context = root
+		    command = ["%s", "sleep", "1m", {
+		      timeout = "1s"
+		    }]
+		  }
+		}`, HelperPathAsHCL, filepath.ToSlash(marker), HelperPathAsHCL, HelperPathAsHCL),
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--summary", "deploy"), RunExpected{
+		Stdout:      nljoin("success", "deploy", "ready"),
+		StderrRegex: `(?s)attempt 1/2 failed with exit code 1, retrying in 1ms.*root jobs after stacks: timed out`,
+		Status:      1,
+	})
+}
+
+func TestScriptRunRootJobsIgnoreStackTimeout(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    experiments = ["scripts"]
+		    run {
+		      stack_timeout = "1s"
+		    }
+		  }
+		}`,
+		`s:stack`,
+		`f:script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  job {
+		    command = ["` + HelperPathAsHCL + `", "echo", "deploy"]
+		  }
+		  job {
+		    context = root
+		    command = ["` + HelperPathAsHCL + `", "sleep", "2s"]
+		  }
+		}`,
+	})
+
+	// The root job runs once for all stacks, then the stack_timeout doesn't
+	// apply to it.
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "deploy"), RunExpected{
+		Stdout: nljoin("deploy", "ready"),
+	})
+}
+
+func TestScriptRunRootJobsNotExecutedOnInvalidEnv(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		scriptsExperimentConfig,
+		`s:stack`,
+		`f:stack/config.tm:
+		terramate {
+		  config {
+		    run {
+		      env {
+		        INVALID = global.undefined
+		      }
+		    }
+		  }
+		}`,
+		`f:script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  job {
+		    context = root
+		    command = ["` + HelperPathAsHCL + `", "echo", "before"]
+		  }
+		  job {
+		    command = ["` + HelperPathAsHCL + `", "echo", "deploy"]
+		  }
+		}`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "deploy"), RunExpected{
+		StderrRegex: `evaluating terramate.config.run.env`,
+		Status:      1,
+	})
+}
+
+func TestScriptRunRootJobsJSONPlan(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    experiments = ["scripts"]
+		    run {
+		      env {
+		        NAME = "root"
+		      }
+		      sensitive {
+		        patterns = ["secret-[0-9]+"]
+		      }
+		    }
+		  }
+		}`,
+		`s:stack`,
+		`f:script.tm:
+		script "deploy" {
+		  description = "deploy"
+		  job {
+		    name    = "lock"
+		    context = root
+		    command = ["` + HelperPathAsHCL + `", "echo", "lock secret-123"]
+		  }
+		  job {
+		    context = root
+		    command = ["` + HelperPathAsHCL + `", "echo", "prepare"]
+		  }
+		  job {
+		    command = ["` + HelperPathAsHCL + `", "echo", "deploy"]
+		  }
+		  job {
+		    context = root
+		    command = ["` + HelperPathAsHCL + `", "echo", "unlock"]
+		  }
+		}`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	res := tm.Run("script", "run", "--dry-run", "--format", "json", "deploy")
+	AssertRunResult(t, res, RunExpected{IgnoreStdout: true, IgnoreStderr: true})
+
+	var plan runutil.Plan
+	if err := json.Unmarshal([]byte(res.Stdout), &plan); err != nil {
+		t.Fatalf("invalid JSON plan: %v\n%s", err, res.Stdout)
+	}
+
+	want := []runutil.StackPlan{
+		{
+			Path:  "/",
+			Root:  runutil.RootBefore,
+			Order: 0,
+			Env:   []string{"NAME"},
+			Tasks: []runutil.TaskPlan{
+				{
+					Cmd:           []string{HelperPath, "echo", "lock ***"},
+					ScriptJob:     1,
+					ScriptCommand: 1,
+					ScriptJobName: "lock",
+					ScriptJobKind: "root",
+				},
+				{
+					Cmd:                []string{HelperPath, "echo", "prepare"},
+					ScriptJob:          2,
+					ScriptCommand:      1,
+					ScriptJobKind:      "root",
+					ScriptJobDependsOn: []int{1},
+				},
+			},
+		},
+		{
+			Path:  "/stack",
+			Order: 1,
+			Env:   []string{"NAME"},
+			Tasks: []runutil.TaskPlan{
+				{
+					Cmd:           []string{HelperPath, "echo", "deploy"},
+					ScriptJob:     1,
+					ScriptCommand: 1,
+				},
+			},
+		},
+		{
+			Path:  "/",
+			Root:  runutil.RootAfter,
+			Order: 2,
+			Env:   []string{"NAME"},
+			Tasks: []runutil.TaskPlan{
+				{
+					Cmd:           []string{HelperPath, "echo", "unlock"},
+					ScriptJob:     3,
+					ScriptCommand: 1,
+					ScriptJobKind: "root",
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, plan.Stacks); diff != "" {
+		t.Fatalf("unexpected plan: %s", diff)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package core_test
+
+import (
+	"testing"
+
+	. "github.com/terramate-io/terramate/e2etests/internal/runner"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestShardSelection(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`s:network`,
+		`s:database:after=["/network"]`,
+		`s:app:after=["/database"]`,
+		`s:dns`,
+		`s:monitoring`,
+		`f:terramate.tm:
+		terramate {
+		  config {
+		    experiments = ["scripts"]
+		  }
+		}`,
+		`f:script.tm:
+		script "path" {
+		  description = "print the stack path"
+		  job {
+		    command = ["` + HelperPathAsHCL + `", "stack-abs-path", "${terramate.root.path.fs.absolute}"]
+		  }
+		}`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+
+	AssertRunResult(t, tm.Run("list", "--shard", "1/2"), RunExpected{
+		Stdout: nljoin("app", "database", "network"),
+	})
+	AssertRunResult(t, tm.Run("list", "--shard", "2/2"), RunExpected{
+		Stdout: nljoin("dns", "monitoring"),
+	})
+	AssertRunResult(t, tm.Run("list", "--shard", "2/2", "--tags", "none"), RunExpected{})
+
+	AssertRunResult(t, tm.Run("run", "--quiet", "--shard", "1/2", HelperPath, "stack-abs-path", s.RootDir()), RunExpected{
+		Stdout: nljoin("/network", "/database", "/app"),
+	})
+	AssertRunResult(t, tm.Run("script", "run", "--quiet", "--shard", "2/2", "path"), RunExpected{
+		Stdout: nljoin("/dns", "/monitoring"),
+	})
+
+	for _, shard := range []string{"0/2", "3/2", "2", "a/b"} {
+		AssertRunResult(t, tm.Run("list", "--shard", shard), RunExpected{
+			StderrRegex: "invalid shard",
+			Status:      1,
+		})
+	}
+}
+
+func TestShardSelectionWarnsOnUnbalancedShards(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`s:network`,
+		`s:database:after=["/network"]`,
+		`s:app:after=["/database"]`,
+		`s:dns`,
+		`s:monitoring`,
+	})
+
+	tm := NewCLI(t, s.RootDir())
+	tm.LogLevel = "warn"
+
+	AssertRunResult(t, tm.Run("list", "--shard", "1/4"), RunExpected{
+		Stdout:      nljoin("app", "database", "network"),
+		StderrRegex: `the shards are unbalanced: 3 stacks ordered before or after /app must be in the same shard`,
+	})
+	AssertRunResult(t, tm.Run("list", "--shard", "4/4"), RunExpected{
+		StderrRegexes: []string{
+			`the shards are unbalanced`,
+			`shard 4/4 is empty`,
+		},
+	})
+	AssertRunResult(t, tm.Run("list", "--shard", "1/3", "--tags", "none"), RunExpected{})
+}
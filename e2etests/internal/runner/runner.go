@@ -176,6 +176,10 @@ type Cmd struct {
 	Stdin  *buffer
 	Stdout *buffer
 	Stderr *buffer
+
+	// ptyDone is closed when the output of the terminal the command was
+	// started with is fully copied to Stdout.
+	ptyDone chan struct{}
 }
 
 // Run the command.
@@ -287,6 +291,23 @@ func (tm CLI) RunWithStdin(stdin string, args ...string) RunResult {
 	}
 }
 
+// RunWithCombinedOutput runs the CLI writing its stdout and stderr to the same
+// buffer, returned as the stdout of the result, so their order is kept.
+func (tm CLI) RunWithCombinedOutput(args ...string) RunResult {
+	t := tm.t
+	t.Helper()
+
+	cmd := tm.NewCmd(args...)
+	cmd.cmd.Stderr = cmd.Stdout
+	_ = cmd.Run()
+
+	return RunResult{
+		Cmd:    strings.Join(args, " "),
+		Stdout: cmd.Stdout.String(),
+		Status: cmd.ExitCode(),
+	}
+}
+
 // RunScript is a helper for executing `terramate run-script`.
 func (tm CLI) RunScript(args ...string) RunResult {
 	return tm.Run(append([]string{"script", "run"}, args...)...)
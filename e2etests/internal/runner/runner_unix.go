@@ -6,9 +6,11 @@
 package runner
 
 import (
+	"io"
 	"os"
 	"syscall"
 
+	"github.com/creack/pty"
 	"github.com/madlambda/spells/assert"
 )
 
@@ -20,9 +22,37 @@ func (tc *Cmd) Start() {
 	assert.NoError(t, tc.cmd.Start())
 }
 
+// StartWithPty starts the command with a new pseudo-terminal as its stdin,
+// stdout and stderr. The output written to the terminal is copied to Stdout.
+func (tc *Cmd) StartWithPty() {
+	t := tc.t
+	t.Helper()
+
+	tc.cmd.Stdin = nil
+	tc.cmd.Stdout = nil
+	tc.cmd.Stderr = nil
+
+	tty, err := pty.Start(tc.cmd)
+	assert.NoError(t, err)
+
+	tc.ptyDone = make(chan struct{})
+	go func() {
+		defer close(tc.ptyDone)
+		defer func() { _ = tty.Close() }()
+
+		// Reading fails when the command and its children exit, closing
+		// the terminal.
+		_, _ = io.Copy(tc.Stdout, tty)
+	}()
+}
+
 // Wait for the command completion.
 func (tc *Cmd) Wait() error {
-	return tc.cmd.Wait()
+	err := tc.cmd.Wait()
+	if tc.ptyDone != nil {
+		<-tc.ptyDone
+	}
+	return err
 }
 
 // Setpgid sets the pgid process attribute.
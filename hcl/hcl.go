@@ -8,14 +8,17 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/gobwas/glob"
 	"github.com/rs/zerolog/log"
 	"github.com/terramate-io/hcl/v2"
 	"github.com/terramate-io/hcl/v2/hclparse"
 	"github.com/terramate-io/hcl/v2/hclsyntax"
+	"github.com/terramate-io/terramate/config/filter"
 	"github.com/terramate-io/terramate/errors"
 	"github.com/terramate-io/terramate/fs"
 	"github.com/terramate-io/terramate/hcl/ast"
@@ -178,14 +181,112 @@ type RunConfig struct {
 	// CheckGenCode enables generated code is up-to-date check on run.
 	CheckGenCode bool
 
+	// Cache enables the local run cache, skipping stacks whose inputs didn't
+	// change since the last successful execution of the same commands.
+	Cache bool
+
+	// TrackDurations enables recording the execution duration of the stacks,
+	// used to weight the critical path of parallel runs of the same commands.
+	TrackDurations bool
+
+	// StackTimeout is the maximum execution time of a command in each stack.
+	// Zero means no timeout.
+	StackTimeout time.Duration
+
+	// TimeoutGracePeriod is how long a timed-out command has to exit after
+	// being interrupted, before it's killed.
+	// Zero means DefaultTimeoutGracePeriod.
+	TimeoutGracePeriod time.Duration
+
+	// ConcurrencyGroups limit the number of stacks running concurrently in
+	// parallel runs, sorted by name.
+	ConcurrencyGroups []ConcurrencyGroup
+
 	// Env contains environment definitions for run.
 	Env *RunEnv
+
+	// Sensitive configures the values redacted from the output of the
+	// commands. It's nil if not defined.
+	Sensitive *RunSensitive
+
+	// BeforeRun, AfterRun and OnFailure are the hooks executed around the
+	// commands of each stack. They are nil if not defined.
+	BeforeRun *RunHook
+	AfterRun  *RunHook
+	OnFailure *RunHook
+}
+
+// RunSensitive represents the terramate.config.run.sensitive block.
+type RunSensitive struct {
+	// Env are the names of the environment variables whose values are redacted.
+	Env []string
+
+	// Globals are the names of the globals whose values are redacted. Nested
+	// globals are referenced with dots, eg. "secrets.db_password".
+	Globals []string
+
+	// Patterns are regular expressions matching text to be redacted.
+	Patterns []string
+}
+
+// RunHook represents a hook block of terramate.config.run.
+// The commands are evaluated for each stack, like the run environment.
+type RunHook struct {
+	// Command is the single command of the hook, if defined.
+	Command *ast.Attribute
+
+	// Commands is the list of commands of the hook, if defined.
+	Commands *ast.Attribute
+}
+
+// Hook returns the hook with the given name, or nil if it's not defined.
+func (r *RunConfig) Hook(name string) *RunHook {
+	switch name {
+	case "before_run":
+		return r.BeforeRun
+	case "after_run":
+		return r.AfterRun
+	case "on_failure":
+		return r.OnFailure
+	}
+	return nil
+}
+
+// RunHookNames are the names of the hook blocks of terramate.config.run, in
+// the order they may be executed.
+var RunHookNames = []string{"before_run", "after_run", "on_failure"}
+
+// DefaultTimeoutGracePeriod is the default grace period given to timed-out
+// commands to exit before they are killed.
+const DefaultTimeoutGracePeriod = 10 * time.Second
+
+// ConcurrencyGroup is a group of stacks with a limited number of stacks
+// running concurrently.
+type ConcurrencyGroup struct {
+	// Name of the group. Stacks join the group by setting it in the
+	// stack.concurrency_group attribute.
+	Name string
+
+	// Limit is the maximum number of stacks of the group running concurrently.
+	Limit int
+
+	// Tags, if not empty, is the tag filter selecting additional stacks into
+	// the group.
+	Tags filter.TagClause
 }
 
 // RunEnv represents Terramate run environment.
 type RunEnv struct {
 	// Attributes is the collection of attribute definitions within the env block.
 	Attributes ast.Attributes
+
+	// EnvFile is the env_file attribute, the path of a dotenv file to load
+	// the environment from, if defined.
+	EnvFile *ast.Attribute
+
+	// EnvFiles is the env_files attribute, the list of paths of dotenv files
+	// to load the environment from, if defined.
+	EnvFiles *ast.Attribute
 }
 
 // GitConfig represents Terramate Git configuration.
@@ -335,6 +436,11 @@ type Stack struct {
 
 	// Watch is a list of files to be watched for changes.
 	Watch []string
+
+	// ConcurrencyGroup is the name of the concurrency group of the stack.
+	// Stacks of the same group don't run concurrently, unless the group
+	// limit is defined in terramate.config.run.concurrency_groups.
+	ConcurrencyGroup string
 }
 
 // GenHCLBlock represents a parsed generate_hcl block.
@@ -859,6 +965,16 @@ func (p *TerramateParser) parseStack(stackblock *ast.Block) (*Stack, error) {
 			}
 			stack.Description = attrVal.AsString()
 
+		case "concurrency_group":
+			if attrVal.Type() != cty.String {
+				errs.Append(hclAttrErr(attr,
+					"field stack.concurrency_group must be a string but given %q",
+					attrVal.Type().FriendlyName()),
+				)
+				continue
+			}
+			stack.ConcurrencyGroup = attrVal.AsString()
+
 			// The `tags`, `after`, `before`, `wants`, `wanted_by` and `watch`
 			// have all the same parsing rules.
 			// By the spec, they must be a `set(string)`.
@@ -1801,9 +1917,7 @@ func (p *TerramateParser) parseRootConfig(cfg *RootConfig, block *ast.MergedBloc
 }
 
 func parseRunConfig(cfg *RootConfig, runBlock *ast.MergedBlock) error {
-	cfg.Run = &RunConfig{
-		CheckGenCode: true,
-	}
+	cfg.Run = NewRunConfig()
 	runCfg := cfg.Run
 	errs := errors.L()
 	for _, attr := range runBlock.Attributes.SortedList() {
@@ -1833,13 +1947,54 @@ func parseRunConfig(cfg *RootConfig, runBlock *ast.MergedBlock) error {
 				continue
 			}
 			runCfg.CheckGenCode = value.True()
+		case "cache":
+			if value.Type() != cty.Bool {
+				errs.Append(attrErr(attr,
+					"terramate.config.run.cache is not a bool but %q",
+					value.Type().FriendlyName(),
+				))
+
+				continue
+			}
+			runCfg.Cache = value.True()
+		case "track_durations":
+			if value.Type() != cty.Bool {
+				errs.Append(attrErr(attr,
+					"terramate.config.run.track_durations is not a bool but %q",
+					value.Type().FriendlyName(),
+				))
+
+				continue
+			}
+			runCfg.TrackDurations = value.True()
+		case "stack_timeout":
+			d, err := parseRunDuration(attr, value)
+			if err != nil {
+				errs.Append(err)
+				continue
+			}
+			runCfg.StackTimeout = d
+		case "timeout_grace_period":
+			d, err := parseRunDuration(attr, value)
+			if err != nil {
+				errs.Append(err)
+				continue
+			}
+			runCfg.TimeoutGracePeriod = d
+		case "concurrency_groups":
+			groups, err := parseConcurrencyGroups(attr, value)
+			if err != nil {
+				errs.Append(err)
+				continue
+			}
+			runCfg.ConcurrencyGroups = groups
 		default:
 			errs.Append(errors.E("unrecognized attribute terramate.config.run.env.%s",
 				attr.Name))
 		}
 	}
 
-	errs.AppendWrap(ErrTerramateSchema, runBlock.ValidateSubBlocks("env"))
+	errs.AppendWrap(ErrTerramateSchema, runBlock.ValidateSubBlocks(append([]string{"env", "sensitive"}, RunHookNames...)...))
 
 	block, ok := runBlock.Blocks[ast.NewEmptyLabelBlockType("env")]
 	if ok {
@@ -1847,9 +2002,209 @@ func parseRunConfig(cfg *RootConfig, runBlock *ast.MergedBlock) error {
 		errs.Append(parseRunEnv(runCfg.Env, block))
 	}
 
+	block, ok = runBlock.Blocks[ast.NewEmptyLabelBlockType("sensitive")]
+	if ok {
+		runCfg.Sensitive = &RunSensitive{}
+		errs.Append(parseRunSensitive(runCfg.Sensitive, block))
+	}
+
+	for _, name := range RunHookNames {
+		block, ok := runBlock.Blocks[ast.NewEmptyLabelBlockType(name)]
+		if !ok {
+			continue
+		}
+		hook, err := parseRunHook(name, block)
+		if err != nil {
+			errs.Append(err)
+			continue
+		}
+		switch name {
+		case "before_run":
+			runCfg.BeforeRun = hook
+		case "after_run":
+			runCfg.AfterRun = hook
+		case "on_failure":
+			runCfg.OnFailure = hook
+		}
+	}
+
+	return errs.AsError()
+}
+
+func parseRunSensitive(sensitive *RunSensitive, block *ast.MergedBlock) error {
+	errs := errors.L()
+	errs.AppendWrap(ErrTerramateSchema, block.ValidateSubBlocks())
+
+	for _, attr := range block.Attributes.SortedList() {
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			errs.Append(errors.E(ErrTerramateSchema, diags,
+				"failed to evaluate terramate.config.run.sensitive.%s attribute", attr.Name,
+			))
+			continue
+		}
+
+		list, err := ValueAsStringList(value)
+		if err != nil {
+			errs.Append(attrErr(attr, "terramate.config.run.sensitive.%s: %v", attr.Name, err))
+			continue
+		}
+
+		switch attr.Name {
+		case "env":
+			sensitive.Env = list
+		case "globals":
+			sensitive.Globals = list
+		case "patterns":
+			for _, pattern := range list {
+				if _, err := regexp.Compile(pattern); err != nil {
+					errs.Append(attrErr(attr,
+						"terramate.config.run.sensitive.patterns: invalid regex %q: %v", pattern, err))
+				}
+			}
+			sensitive.Patterns = list
+		default:
+			errs.Append(errors.E(ErrTerramateSchema, attr.NameRange,
+				"unrecognized attribute terramate.config.run.sensitive.%s", attr.Name))
+		}
+	}
 	return errs.AsError()
 }
 
+func parseRunHook(name string, block *ast.MergedBlock) (*RunHook, error) {
+	errs := errors.L()
+	errs.AppendWrap(ErrTerramateSchema, block.ValidateSubBlocks())
+
+	hook := &RunHook{}
+	for _, attr := range block.Attributes.SortedList() {
+		attr := attr
+		switch attr.Name {
+		case "command":
+			hook.Command = &attr
+		case "commands":
+			hook.Commands = &attr
+		default:
+			errs.Append(errors.E(ErrTerramateSchema, attr.NameRange,
+				"unrecognized attribute terramate.config.run.%s.%s", name, attr.Name))
+		}
+	}
+
+	switch {
+	case hook.Command != nil && hook.Commands != nil:
+		errs.Append(errors.E(ErrTerramateSchema, block.RawOrigins[0].Range,
+			"terramate.config.run.%s must set either command or commands, not both", name))
+	case hook.Command == nil && hook.Commands == nil:
+		errs.Append(errors.E(ErrTerramateSchema, block.RawOrigins[0].Range,
+			"terramate.config.run.%s requires a command or commands attribute", name))
+	}
+
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+func parseRunDuration(attr ast.Attribute, value cty.Value) (time.Duration, error) {
+	if value.Type() != cty.String {
+		return 0, attrErr(attr,
+			"terramate.config.run.%s is not a string but %q",
+			attr.Name, value.Type().FriendlyName(),
+		)
+	}
+	d, err := time.ParseDuration(value.AsString())
+	if err != nil {
+		return 0, attrErr(attr,
+			"terramate.config.run.%s is not a valid duration: %v",
+			attr.Name, err,
+		)
+	}
+	if d < 0 {
+		return 0, attrErr(attr,
+			"terramate.config.run.%s must not be negative", attr.Name,
+		)
+	}
+	return d, nil
+}
+
+func parseConcurrencyGroups(attr ast.Attribute, value cty.Value) ([]ConcurrencyGroup, error) {
+	if !value.Type().IsObjectType() && !value.Type().IsMapType() {
+		return nil, attrErr(attr,
+			"terramate.config.run.concurrency_groups is not an object but %q",
+			value.Type().FriendlyName(),
+		)
+	}
+
+	errs := errors.L()
+	var groups []ConcurrencyGroup
+	it := value.ElementIterator()
+	for it.Next() {
+		k, v := it.Element()
+		group := ConcurrencyGroup{
+			Name:  k.AsString(),
+			Limit: 1,
+		}
+		if !v.Type().IsObjectType() && !v.Type().IsMapType() {
+			errs.Append(attrErr(attr,
+				"terramate.config.run.concurrency_groups.%s is not an object but %q",
+				group.Name, v.Type().FriendlyName(),
+			))
+			continue
+		}
+
+		fieldsIt := v.ElementIterator()
+		for fieldsIt.Next() {
+			fk, fv := fieldsIt.Element()
+			switch field := fk.AsString(); field {
+			case "limit":
+				if fv.Type() != cty.Number || !fv.AsBigFloat().IsInt() {
+					errs.Append(attrErr(attr,
+						"terramate.config.run.concurrency_groups.%s.limit is not an integer but %q",
+						group.Name, fv.Type().FriendlyName(),
+					))
+					continue
+				}
+				limit, _ := fv.AsBigFloat().Int64()
+				if limit < 1 {
+					errs.Append(attrErr(attr,
+						"terramate.config.run.concurrency_groups.%s.limit must be greater than zero",
+						group.Name,
+					))
+					continue
+				}
+				group.Limit = int(limit)
+			case "tags":
+				if fv.Type() != cty.String {
+					errs.Append(attrErr(attr,
+						"terramate.config.run.concurrency_groups.%s.tags is not a string but %q",
+						group.Name, fv.Type().FriendlyName(),
+					))
+					continue
+				}
+				clause, _, err := filter.ParseTagClauses(fv.AsString())
+				if err != nil {
+					errs.Append(attrErr(attr,
+						"terramate.config.run.concurrency_groups.%s.tags is not a valid tag filter: %v",
+						group.Name, err,
+					))
+					continue
+				}
+				group.Tags = clause
+			default:
+				errs.Append(attrErr(attr,
+					"unrecognized attribute terramate.config.run.concurrency_groups.%s.%s",
+					group.Name, field,
+				))
+			}
+		}
+		groups = append(groups, group)
+	}
+
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
 func parseGenerateRootConfig(cfg *GenerateRootConfig, generateBlock *ast.MergedBlock) error {
 	errs := errors.L()
 
@@ -2067,12 +2422,28 @@ func parseGitChangeDetectionConfig(cfg *GitChangeDetectionConfig, gitBlock *ast.
 }
 
 func parseRunEnv(runEnv *RunEnv, envBlock *ast.MergedBlock) error {
-	if len(envBlock.Attributes) > 0 {
-		runEnv.Attributes = envBlock.Attributes
-	}
-
 	errs := errors.L()
 	errs.AppendWrap(ErrTerramateSchema, envBlock.ValidateSubBlocks())
+
+	for _, attr := range envBlock.Attributes.SortedList() {
+		attr := attr
+		switch attr.Name {
+		case "env_file":
+			runEnv.EnvFile = &attr
+		case "env_files":
+			runEnv.EnvFiles = &attr
+		default:
+			if runEnv.Attributes == nil {
+				runEnv.Attributes = ast.Attributes{}
+			}
+			runEnv.Attributes[attr.Name] = attr
+		}
+	}
+
+	if runEnv.EnvFile != nil && runEnv.EnvFiles != nil {
+		errs.Append(errors.E(ErrTerramateSchema, runEnv.EnvFiles.NameRange,
+			"terramate.config.run.env must set either env_file or env_files, not both"))
+	}
 	return errs.AsError()
 }
 
@@ -7,10 +7,12 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/madlambda/spells/assert"
 	"github.com/terramate-io/hcl/v2/hclparse"
 	"github.com/terramate-io/hcl/v2/hclsyntax"
+	"github.com/terramate-io/terramate/config/filter"
 	"github.com/terramate-io/terramate/errors"
 	"github.com/terramate-io/terramate/hcl"
 	"github.com/terramate-io/terramate/hcl/ast"
@@ -19,7 +21,7 @@ import (
 )
 
 func TestHCLParserConfigRun(t *testing.T) {
-	runEnvCfg := func(rawattributes string) hcl.Config {
+	parseAttributes := func(rawattributes string) ast.Attributes {
 		// Comparing attributes/expressions with hcl/hclsyntax is hard
 		// Using reflect.DeepEqual is tricky since it compares unexported attrs
 		// and can lead to hard to debug failures since some internal fields may
@@ -47,7 +49,11 @@ func TestHCLParserConfigRun(t *testing.T) {
 		for name, attr := range body.Attributes {
 			attrs[name] = ast.NewAttribute(rootdir, attr.AsHCLAttribute())
 		}
+		return attrs
+	}
 
+	runEnvCfg := func(rawattributes string) hcl.Config {
+		attrs := parseAttributes(rawattributes)
 		return hcl.Config{
 			Terramate: &hcl.Terramate{
 				Config: &hcl.RootConfig{
@@ -62,6 +68,31 @@ func TestHCLParserConfigRun(t *testing.T) {
 		}
 	}
 
+	runEnvFilesCfg := func(rawattributes, rawfiles string) hcl.Config {
+		cfg := runEnvCfg(rawattributes)
+		env := cfg.Terramate.Config.Run.Env
+		if len(env.Attributes) == 0 {
+			env.Attributes = nil
+		}
+		for name, attr := range parseAttributes(rawfiles) {
+			attr := attr
+			if name == "env_file" {
+				env.EnvFile = &attr
+			} else {
+				env.EnvFiles = &attr
+			}
+		}
+		return cfg
+	}
+
+	runHook := func(name, rawattribute string) *hcl.RunHook {
+		attr := parseAttributes(rawattribute)[name]
+		if name == "command" {
+			return &hcl.RunHook{Command: &attr}
+		}
+		return &hcl.RunHook{Commands: &attr}
+	}
+
 	for _, tc := range []testcase{
 		{
 			name: "empty run",
@@ -291,7 +322,7 @@ func TestHCLParserConfigRun(t *testing.T) {
 			},
 		},
 		{
-			name: "attrs on run.env in single block/file",
+			name: "run.cache defined",
 			input: []cfgfile{
 				{
 					filename: "cfg.tm",
@@ -299,13 +330,7 @@ func TestHCLParserConfigRun(t *testing.T) {
 						terramate {
 						  config {
 						    run {
-						      env {
-						        string = "value"
-						        number = 666
-						        list = []
-						        interp = "${global.a}"
-						        traversal = global.a.b
-						      }
+						      cache = true
 						    }
 						  }
 						}
@@ -313,17 +338,20 @@ func TestHCLParserConfigRun(t *testing.T) {
 				},
 			},
 			want: want{
-				config: runEnvCfg(`
-						string = "value"
-						number = 666
-						list = []
-						interp = "${global.a}"
-						traversal = global.a.b
-				`),
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Run: &hcl.RunConfig{
+								CheckGenCode: true,
+								Cache:        true,
+							},
+						},
+					},
+				},
 			},
 		},
 		{
-			name: "multiple run env blocks on same file are merged",
+			name: "run.cache with invalid type fails",
 			input: []cfgfile{
 				{
 					filename: "cfg.tm",
@@ -331,17 +359,29 @@ func TestHCLParserConfigRun(t *testing.T) {
 						terramate {
 						  config {
 						    run {
-						      env {
-						        string = "value"
-						        number = 666
-						      }
+						      cache = "yes"
 						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "run.track_durations defined",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
 						    run {
-						      env {
-						        list = []
-						        interp = "${global.a}"
-						        traversal = global.a.b
-						      }
+						      track_durations = true
 						    }
 						  }
 						}
@@ -349,17 +389,20 @@ func TestHCLParserConfigRun(t *testing.T) {
 				},
 			},
 			want: want{
-				config: runEnvCfg(`
-						string = "value"
-						number = 666
-						list = []
-						interp = "${global.a}"
-						traversal = global.a.b
-				`),
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Run: &hcl.RunConfig{
+								CheckGenCode:   true,
+								TrackDurations: true,
+							},
+						},
+					},
+				},
 			},
 		},
 		{
-			name: "multiple run env blocks on same file are merged",
+			name: "run.track_durations with invalid type fails",
 			input: []cfgfile{
 				{
 					filename: "cfg.tm",
@@ -367,15 +410,7 @@ func TestHCLParserConfigRun(t *testing.T) {
 						terramate {
 						  config {
 						    run {
-						      env {
-						        string = "value"
-						        number = 666
-						      }
-						      env {
-						        list = []
-						        interp = "${global.a}"
-						        traversal = global.a.b
-						      }
+						      track_durations = 1
 						    }
 						  }
 						}
@@ -383,57 +418,96 @@ func TestHCLParserConfigRun(t *testing.T) {
 				},
 			},
 			want: want{
-				config: runEnvCfg(`
-						string = "value"
-						number = 666
-						list = []
-						interp = "${global.a}"
-						traversal = global.a.b
-				`),
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
 			},
 		},
 		{
-			name: "run env defined on multiple files are merged",
+			name: "run.stack_timeout and run.timeout_grace_period defined",
 			input: []cfgfile{
 				{
-					filename: "cfg1.tm",
+					filename: "cfg.tm",
 					body: `
 						terramate {
 						  config {
 						    run {
-						      env {
-						        string = "value"
-						      }
+						      stack_timeout = "30m"
+						      timeout_grace_period = "1m30s"
 						    }
 						  }
 						}
 					`,
 				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Run: &hcl.RunConfig{
+								CheckGenCode:       true,
+								StackTimeout:       30 * time.Minute,
+								TimeoutGracePeriod: 90 * time.Second,
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "run.stack_timeout with invalid type fails",
+			input: []cfgfile{
 				{
-					filename: "cfg2.tm",
+					filename: "cfg.tm",
 					body: `
 						terramate {
 						  config {
 						    run {
-						      env {
-						        number = 666
-						        list = []
-						      }
+						      stack_timeout = 10
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "run.stack_timeout with invalid duration fails",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      stack_timeout = "10 minutes"
 						    }
 						  }
 						}
 					`,
 				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "run.timeout_grace_period with negative duration fails",
+			input: []cfgfile{
 				{
-					filename: "cfg3.tm",
+					filename: "cfg.tm",
 					body: `
 						terramate {
 						  config {
 						    run {
-						      env {
-						        interp = "${global.a}"
-						        traversal = global.a.b
-						      }
+						      timeout_grace_period = "-1s"
 						    }
 						  }
 						}
@@ -441,62 +515,110 @@ func TestHCLParserConfigRun(t *testing.T) {
 				},
 			},
 			want: want{
-				config: runEnvCfg(`
-						string = "value"
-						number = 666
-						list = []
-						interp = "${global.a}"
-						traversal = global.a.b
-				`),
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
 			},
 		},
 		{
-			name: "imported env is merged",
+			name: "run hooks defined",
 			input: []cfgfile{
 				{
-					filename: "other/cfg.tm",
-					body: `terramate {
-						config {
-						  run {
-							env {
-							  string = "value"
-							}
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      before_run {
+						        command = ["terraform", "init"]
+						      }
+						      after_run {
+						        commands = [["echo", "done"], ["echo", global.name]]
+						      }
+						      on_failure {
+						        command = ["echo", "failed ${terramate.stack.name}"]
+						      }
+						    }
 						  }
 						}
-					  }`,
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Run: &hcl.RunConfig{
+								CheckGenCode: true,
+								BeforeRun:    runHook("command", `command = ["terraform", "init"]`),
+								AfterRun:     runHook("commands", `commands = [["echo", "done"], ["echo", global.name]]`),
+								OnFailure:    runHook("command", `command = ["echo", "failed ${terramate.stack.name}"]`),
+							},
+						},
+					},
 				},
+			},
+		},
+		{
+			name: "run hook with unknown attribute fails",
+			input: []cfgfile{
 				{
-					filename: "cfg1.tm",
+					filename: "cfg.tm",
 					body: `
-						import {
-							source = "/other/cfg.tm"
+						terramate {
+						  config {
+						    run {
+						      before_run {
+						        command = ["terraform", "init"]
+						        dir     = "/"
+						      }
+						    }
+						  }
 						}
 					`,
 				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "run hook with command and commands fails",
+			input: []cfgfile{
 				{
-					filename: "cfg2.tm",
+					filename: "cfg.tm",
 					body: `
 						terramate {
 						  config {
 						    run {
-						      env {
-						        number = 666
-						        list = []
+						      after_run {
+						        command  = ["echo", "a"]
+						        commands = [["echo", "b"]]
 						      }
 						    }
 						  }
 						}
 					`,
 				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "run hook without commands fails",
+			input: []cfgfile{
 				{
-					filename: "cfg3.tm",
+					filename: "cfg.tm",
 					body: `
 						terramate {
 						  config {
 						    run {
-						      env {
-						        interp = "${global.a}"
-						        traversal = global.a.b
+						      on_failure {
 						      }
 						    }
 						  }
@@ -505,13 +627,557 @@ func TestHCLParserConfigRun(t *testing.T) {
 				},
 			},
 			want: want{
-				config: runEnvCfg(`
-						string = "value"
-						number = 666
-						list = []
-						interp = "${global.a}"
-						traversal = global.a.b
-				`),
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "run.concurrency_groups defined",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      concurrency_groups = {
+						        backend = {}
+						        aws_prod = {
+						          limit = 2
+						          tags  = "aws:prod"
+						        }
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Run: &hcl.RunConfig{
+								CheckGenCode: true,
+								ConcurrencyGroups: []hcl.ConcurrencyGroup{
+									{
+										Name:  "aws_prod",
+										Limit: 2,
+										Tags: filter.TagClause{
+											Op: filter.AND,
+											Children: []filter.TagClause{
+												{Op: filter.EQ, Tag: "aws"},
+												{Op: filter.EQ, Tag: "prod"},
+											},
+										},
+									},
+									{
+										Name:  "backend",
+										Limit: 1,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "run.concurrency_groups with invalid type fails",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      concurrency_groups = ["backend"]
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "run.concurrency_groups with invalid limit fails",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      concurrency_groups = { backend = { limit = 0 } }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "run.concurrency_groups with invalid tags fails",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      concurrency_groups = { backend = { tags = "Invalid Tag" } }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "run.concurrency_groups with unrecognized attribute fails",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      concurrency_groups = { backend = { max = 2 } }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "attrs on run.env in single block/file",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      env {
+						        string = "value"
+						        number = 666
+						        list = []
+						        interp = "${global.a}"
+						        traversal = global.a.b
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: runEnvCfg(`
+						string = "value"
+						number = 666
+						list = []
+						interp = "${global.a}"
+						traversal = global.a.b
+				`),
+			},
+		},
+		{
+			name: "multiple run env blocks on same file are merged",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      env {
+						        string = "value"
+						        number = 666
+						      }
+						    }
+						    run {
+						      env {
+						        list = []
+						        interp = "${global.a}"
+						        traversal = global.a.b
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: runEnvCfg(`
+						string = "value"
+						number = 666
+						list = []
+						interp = "${global.a}"
+						traversal = global.a.b
+				`),
+			},
+		},
+		{
+			name: "multiple run env blocks on same file are merged",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      env {
+						        string = "value"
+						        number = 666
+						      }
+						      env {
+						        list = []
+						        interp = "${global.a}"
+						        traversal = global.a.b
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: runEnvCfg(`
+						string = "value"
+						number = 666
+						list = []
+						interp = "${global.a}"
+						traversal = global.a.b
+				`),
+			},
+		},
+		{
+			name: "run env defined on multiple files are merged",
+			input: []cfgfile{
+				{
+					filename: "cfg1.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      env {
+						        string = "value"
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+				{
+					filename: "cfg2.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      env {
+						        number = 666
+						        list = []
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+				{
+					filename: "cfg3.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      env {
+						        interp = "${global.a}"
+						        traversal = global.a.b
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: runEnvCfg(`
+						string = "value"
+						number = 666
+						list = []
+						interp = "${global.a}"
+						traversal = global.a.b
+				`),
+			},
+		},
+		{
+			name: "imported env is merged",
+			input: []cfgfile{
+				{
+					filename: "other/cfg.tm",
+					body: `terramate {
+						config {
+						  run {
+							env {
+							  string = "value"
+							}
+						  }
+						}
+					  }`,
+				},
+				{
+					filename: "cfg1.tm",
+					body: `
+						import {
+							source = "/other/cfg.tm"
+						}
+					`,
+				},
+				{
+					filename: "cfg2.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      env {
+						        number = 666
+						        list = []
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+				{
+					filename: "cfg3.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      env {
+						        interp = "${global.a}"
+						        traversal = global.a.b
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: runEnvCfg(`
+						string = "value"
+						number = 666
+						list = []
+						interp = "${global.a}"
+						traversal = global.a.b
+				`),
+			},
+		},
+		{
+			name: "run.sensitive defined",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      sensitive {
+						        env      = ["TF_VAR_token"]
+						        globals  = ["secrets.db_password"]
+						        patterns = ["ghp_[A-Za-z0-9]+"]
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Run: &hcl.RunConfig{
+								CheckGenCode: true,
+								Sensitive: &hcl.RunSensitive{
+									Env:      []string{"TF_VAR_token"},
+									Globals:  []string{"secrets.db_password"},
+									Patterns: []string{"ghp_[A-Za-z0-9]+"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "run.sensitive with invalid pattern fails",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      sensitive {
+						        patterns = ["[a-z"]
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "run.sensitive with unrecognized attribute fails",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      sensitive {
+						        outputs = ["token"]
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "run.sensitive with non-list attribute fails",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      sensitive {
+						        env = "TF_VAR_token"
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
+			},
+		},
+		{
+			name: "run env with env_file",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      env {
+						        env_file = "/envs/${global.env}.env"
+						        string = "value"
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: runEnvFilesCfg(
+					`string = "value"`,
+					`env_file = "/envs/${global.env}.env"`,
+				),
+			},
+		},
+		{
+			name: "run env with env_files",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      env {
+						        env_files = [".env", "/common.env"]
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				config: runEnvFilesCfg(
+					``,
+					`env_files = [".env", "/common.env"]`,
+				),
+			},
+		},
+		{
+			name: "run env with env_file and env_files fails",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      env {
+						        env_file = ".env"
+						        env_files = [".env"]
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema),
+				},
 			},
 		},
 		{
@@ -6,9 +6,12 @@ package hcl
 import (
 	"strings"
 
+	hhcl "github.com/terramate-io/hcl/v2"
+	"github.com/terramate-io/hcl/v2/hclsyntax"
 	"github.com/terramate-io/terramate/errors"
 	"github.com/terramate-io/terramate/hcl/ast"
 	"github.com/terramate-io/terramate/hcl/info"
+	"github.com/zclconf/go-cty/cty"
 	"golang.org/x/exp/slices"
 )
 
@@ -22,6 +25,20 @@ const (
 	ErrScriptNoCmds              errors.Kind = "terramate schema error: (script): missing command or commands"
 	ErrScriptMissingOrInvalidJob errors.Kind = "terramate schema error: (script): missing or invalid job"
 	ErrScriptCmdConflict         errors.Kind = "terramate schema error: (script): conflicting attribute already set"
+	ErrScriptInvalidMatrix       errors.Kind = "terramate schema error: (script.matrix): invalid matrix block"
+	ErrScriptInvalidParam        errors.Kind = "terramate schema error: (script.param): invalid param block"
+	ErrScriptInvalidEnv          errors.Kind = "terramate schema error: (script.env): invalid env block"
+	ErrScriptInvalidContext      errors.Kind = "terramate schema error: (script): invalid context"
+)
+
+// Contexts of scripts and script jobs.
+const (
+	// ScriptStackContext is the context of jobs executed in each stack.
+	ScriptStackContext = "stack"
+
+	// ScriptRootContext is the context of jobs executed once in the root of
+	// the project, before or after the stacks.
+	ScriptRootContext = "root"
 )
 
 // Command represents an executable command
@@ -32,10 +49,38 @@ type Commands ast.Attribute
 
 // ScriptJob represent a Job within a Script
 type ScriptJob struct {
+	Range       info.Range
 	Name        *ast.Attribute
 	Description *ast.Attribute
 	Command     *Command  // Command is a single executable command
 	Commands    *Commands // Commands is a list of executable commands
+
+	// DependsOn is the list of names of the jobs that must finish before this
+	// job starts.
+	DependsOn *ast.Attribute
+
+	// Parallel tells if the job can run concurrently with the previous
+	// parallel jobs of the script.
+	Parallel *ast.Attribute
+
+	// Condition tells if the job is executed in the stack.
+	Condition *ast.Attribute
+
+	// Env are the environment variables of the job commands, if any.
+	Env ast.Attributes
+
+	// Context is the context of the job, ScriptStackContext or
+	// ScriptRootContext. It defaults to the context of the script.
+	Context string
+}
+
+// ScriptParam represents a parameter of a script, set on the command line.
+type ScriptParam struct {
+	Range       info.Range
+	Name        string         // Name is the label of the param block.
+	Type        *ast.Attribute // Type is the type constraint of the parameter value.
+	Default     *ast.Attribute // Default is the value used if the parameter is not set.
+	Description *ast.Attribute // Description is a human readable description of the parameter.
 }
 
 // Script represents a parsed script block
@@ -46,6 +91,22 @@ type Script struct {
 	Description *ast.Attribute   // Description is a human readable description of a script
 	Jobs        []*ScriptJob     // Job represents the command(s) part of this script
 	Lets        *ast.MergedBlock // Lets are script local variables.
+	Matrix      ast.Attributes   // Matrix are the variables of the script matrix, if any.
+	Params      []*ScriptParam   // Params are the parameters of the script, in declaration order.
+	Condition   *ast.Attribute   // Condition tells if the script is executed in the stack.
+	Env         ast.Attributes   // Env are the environment variables of the script commands, if any.
+
+	// OnFailure are the jobs executed after the jobs of the script if any of
+	// them failed.
+	OnFailure []*ScriptJob
+
+	// Finally are the jobs always executed after the jobs of the script and
+	// its on_failure jobs.
+	Finally []*ScriptJob
+
+	// Context is the context of the script, ScriptStackContext or
+	// ScriptRootContext.
+	Context string
 }
 
 // NewScriptCommand returns a *Command encapsulating an ast.Attribute
@@ -60,6 +121,36 @@ func NewScriptCommands(attr ast.Attribute) *Commands {
 	return &cmds
 }
 
+// StackJobs returns the jobs of the script executed in each stack.
+func (sc *Script) StackJobs() []*ScriptJob {
+	var jobs []*ScriptJob
+	for _, job := range sc.Jobs {
+		if job.Context == ScriptStackContext {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// RootJobs returns the jobs of the script executed in the root of the
+// project before and after the stacks: the root jobs declared before and
+// after the stack jobs. If the script has no stack jobs, all of its jobs are
+// executed before.
+func (sc *Script) RootJobs() (before, after []*ScriptJob) {
+	stackJobs := 0
+	for _, job := range sc.Jobs {
+		switch {
+		case job.Context == ScriptStackContext:
+			stackJobs++
+		case stackJobs == 0:
+			before = append(before, job)
+		default:
+			after = append(after, job)
+		}
+	}
+	return before, after
+}
+
 // AccessorName returns the name traversal for accessing the script.
 func (sc *Script) AccessorName() string {
 	var b strings.Builder
@@ -82,8 +173,9 @@ func (p *TerramateParser) parseScriptBlock(block *ast.Block) (*Script, error) {
 	errs := errors.L()
 
 	parsedScript := &Script{
-		Range:  block.Range,
-		Labels: block.Labels,
+		Range:   block.Range,
+		Labels:  block.Labels,
+		Context: ScriptStackContext,
 	}
 
 	for _, attr := range block.Attributes {
@@ -93,6 +185,12 @@ func (p *TerramateParser) parseScriptBlock(block *ast.Block) (*Script, error) {
 			parsedScript.Name = &attr
 		case "description":
 			parsedScript.Description = &attr
+		case "condition":
+			parsedScript.Condition = &attr
+		case "context":
+			context, err := parseScriptContext(&attr)
+			errs.Append(err)
+			parsedScript.Context = context
 		default:
 			errs.Append(errors.E(ErrScriptUnrecognizedAttr, attr.NameRange))
 		}
@@ -111,8 +209,55 @@ func (p *TerramateParser) parseScriptBlock(block *ast.Block) (*Script, error) {
 				continue
 			}
 			parsedScript.Jobs = append(parsedScript.Jobs, parsedJobBlock)
+		case "on_failure", "finally":
+			parsedJobBlock, err := parseScriptResultJobBlock(nestedBlock)
+			if err != nil {
+				errs.Append(err)
+				continue
+			}
+			if nestedBlock.Type == "on_failure" {
+				parsedScript.OnFailure = append(parsedScript.OnFailure, parsedJobBlock)
+			} else {
+				parsedScript.Finally = append(parsedScript.Finally, parsedJobBlock)
+			}
 		case "lets":
 			errs.AppendWrap(ErrTerramateSchema, letsConfig.mergeBlocks(ast.Blocks{nestedBlock}))
+		case "matrix":
+			if parsedScript.Matrix != nil {
+				errs.Append(errors.E(ErrScriptInvalidMatrix, nestedBlock.TypeRange,
+					"multiple matrix blocks in the same script"))
+				continue
+			}
+			matrix, err := parseScriptMatrixBlock(nestedBlock)
+			if err != nil {
+				errs.Append(err)
+				continue
+			}
+			parsedScript.Matrix = matrix
+		case "param":
+			param, err := parseScriptParamBlock(nestedBlock)
+			if err != nil {
+				errs.Append(err)
+				continue
+			}
+			if slices.ContainsFunc(parsedScript.Params, func(p *ScriptParam) bool { return p.Name == param.Name }) {
+				errs.Append(errors.E(ErrScriptInvalidParam, nestedBlock.LabelRanges(),
+					"param %q redeclared", param.Name))
+				continue
+			}
+			parsedScript.Params = append(parsedScript.Params, param)
+		case "env":
+			if parsedScript.Env != nil {
+				errs.Append(errors.E(ErrScriptInvalidEnv, nestedBlock.TypeRange,
+					"multiple env blocks in the same script"))
+				continue
+			}
+			env, err := parseScriptEnvBlock(nestedBlock)
+			if err != nil {
+				errs.Append(err)
+				continue
+			}
+			parsedScript.Env = env
 		default:
 			errs.Append(errors.E(ErrScriptUnrecognizedBlock, nestedBlock.TypeRange, nestedBlock.Type))
 		}
@@ -126,6 +271,8 @@ func (p *TerramateParser) parseScriptBlock(block *ast.Block) (*Script, error) {
 		errs.Append(errors.E(ErrScriptMissingOrInvalidJob, block.Range))
 	}
 
+	errs.Append(validateScriptContexts(parsedScript, block))
+
 	mergedLets := ast.MergedLabelBlocks{}
 	for labelType, mergedBlock := range letsConfig.MergedLabelBlocks {
 		if labelType.Type == "lets" {
@@ -147,6 +294,136 @@ func (p *TerramateParser) parseScriptBlock(block *ast.Block) (*Script, error) {
 	return parsedScript, nil
 }
 
+// parseScriptContext parses the context attribute, given as a keyword like in
+// generate_file blocks or as a string.
+func parseScriptContext(attr *ast.Attribute) (string, error) {
+	context := hhcl.ExprAsKeyword(attr.Expr)
+	if context == "" {
+		if val, diags := attr.Expr.Value(nil); !diags.HasErrors() && val.Type() == cty.String && val.IsKnown() && !val.IsNull() {
+			context = val.AsString()
+		}
+	}
+	if context != ScriptStackContext && context != ScriptRootContext {
+		return "", errors.E(ErrScriptInvalidContext, attr.Expr.Range(),
+			"%s supported values are %q and %q", attr.Name, ScriptStackContext, ScriptRootContext)
+	}
+	return context, nil
+}
+
+// validateScriptContexts sets the context of the jobs not setting it and
+// checks the root context jobs are declared before or after all stack jobs.
+func validateScriptContexts(script *Script, block *ast.Block) error {
+	errs := errors.L()
+	for _, job := range script.Jobs {
+		switch {
+		case job.Context == "":
+			job.Context = script.Context
+		case job.Context == ScriptStackContext && script.Context == ScriptRootContext:
+			errs.Append(errors.E(ErrScriptInvalidContext, job.Range,
+				"stack context jobs are not supported in root context scripts"))
+		}
+		if job.Context != ScriptRootContext {
+			continue
+		}
+		for _, attr := range []*ast.Attribute{job.DependsOn, job.Parallel} {
+			if attr != nil {
+				errs.Append(errors.E(ErrScriptInvalidContext, attr.NameRange,
+					"%s is not supported in root context jobs", attr.Name))
+			}
+		}
+	}
+
+	// The root jobs are executed before or after the stacks, then they can't
+	// be declared between stack jobs.
+	before, after := script.RootJobs()
+	stackJobs := len(script.Jobs) - len(before) - len(after)
+	for _, job := range script.Jobs[len(before) : len(before)+stackJobs] {
+		if job.Context == ScriptRootContext {
+			errs.Append(errors.E(ErrScriptInvalidContext, job.Range,
+				"root context jobs must be declared before or after all the stack context jobs"))
+		}
+	}
+
+	if script.Context == ScriptRootContext {
+		for _, nestedBlock := range block.Blocks {
+			switch nestedBlock.Type {
+			case "matrix", "on_failure", "finally":
+				errs.Append(errors.E(ErrScriptInvalidContext, nestedBlock.TypeRange,
+					"%s blocks are not supported in root context scripts", nestedBlock.Type))
+			}
+		}
+	}
+	return errs.AsError()
+}
+
+func parseScriptMatrixBlock(block *ast.Block) (ast.Attributes, error) {
+	errs := errors.L()
+	if len(block.Labels) > 0 {
+		errs.Append(errors.E(ErrScriptInvalidMatrix, block.LabelRanges(), "matrix block must have no labels"))
+	}
+	for _, childBlock := range block.Blocks {
+		errs.Append(errors.E(ErrScriptUnrecognizedBlock, childBlock.TypeRange, childBlock.Type))
+	}
+	if len(block.Attributes) == 0 {
+		errs.Append(errors.E(ErrScriptInvalidMatrix, block.Range, "matrix block must define at least one variable"))
+	}
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+	return block.Attributes, nil
+}
+
+func parseScriptEnvBlock(block *ast.Block) (ast.Attributes, error) {
+	errs := errors.L()
+	if len(block.Labels) > 0 {
+		errs.Append(errors.E(ErrScriptInvalidEnv, block.LabelRanges(), "env block must have no labels"))
+	}
+	for _, childBlock := range block.Blocks {
+		errs.Append(errors.E(ErrScriptUnrecognizedBlock, childBlock.TypeRange, childBlock.Type))
+	}
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+	return block.Attributes, nil
+}
+
+func parseScriptParamBlock(block *ast.Block) (*ScriptParam, error) {
+	errs := errors.L()
+
+	param := &ScriptParam{Range: block.Range}
+	if len(block.Labels) != 1 {
+		errs.Append(errors.E(ErrScriptInvalidParam, block.TypeRange,
+			"param block must have a single label but %d given", len(block.Labels)))
+	} else if !hclsyntax.ValidIdentifier(block.Labels[0]) {
+		errs.Append(errors.E(ErrScriptInvalidParam, block.LabelRanges(),
+			"param name %q is not a valid identifier", block.Labels[0]))
+	} else {
+		param.Name = block.Labels[0]
+	}
+
+	for _, attr := range block.Attributes {
+		attr := attr
+		switch attr.Name {
+		case "type":
+			param.Type = &attr
+		case "default":
+			param.Default = &attr
+		case "description":
+			param.Description = &attr
+		default:
+			errs.Append(errors.E(ErrScriptInvalidParam, attr.NameRange,
+				"unrecognized attribute %q", attr.Name))
+		}
+	}
+	for _, childBlock := range block.Blocks {
+		errs.Append(errors.E(ErrScriptUnrecognizedBlock, childBlock.TypeRange, childBlock.Type))
+	}
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+	return param, nil
+}
+
 func findScript(scripts []*Script, target []string) (*Script, bool) {
 	for _, script := range scripts {
 		if slices.Equal(script.Labels, target) {
@@ -156,10 +433,35 @@ func findScript(scripts []*Script, target []string) (*Script, bool) {
 	return nil, false
 }
 
+// parseScriptResultJobBlock parses an on_failure or finally block, which has
+// the schema of a job block, except for the attributes ordering the jobs.
+func parseScriptResultJobBlock(block *ast.Block) (*ScriptJob, error) {
+	job, err := parseScriptJobBlock(block)
+	if err != nil {
+		return nil, err
+	}
+	errs := errors.L()
+	for _, attr := range []*ast.Attribute{job.DependsOn, job.Parallel} {
+		if attr != nil {
+			errs.Append(errors.E(ErrScriptJobUnrecognizedAttr, attr.NameRange,
+				"%s is not supported in %s blocks", attr.Name, block.Type))
+		}
+	}
+	if attr, ok := block.Attributes["context"]; ok {
+		errs.Append(errors.E(ErrScriptJobUnrecognizedAttr, attr.NameRange,
+			"context is not supported in %s blocks", block.Type))
+	}
+	job.Context = ScriptStackContext
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
 func parseScriptJobBlock(block *ast.Block) (*ScriptJob, error) {
 	errs := errors.L()
 
-	parsedScriptJob := &ScriptJob{}
+	parsedScriptJob := &ScriptJob{Range: block.Range}
 	for _, attr := range block.Attributes {
 		attr := attr
 		switch attr.Name {
@@ -171,13 +473,37 @@ func parseScriptJobBlock(block *ast.Block) (*ScriptJob, error) {
 			parsedScriptJob.Command = NewScriptCommand(attr)
 		case "commands":
 			parsedScriptJob.Commands = NewScriptCommands(attr)
+		case "depends_on":
+			parsedScriptJob.DependsOn = &attr
+		case "parallel":
+			parsedScriptJob.Parallel = &attr
+		case "condition":
+			parsedScriptJob.Condition = &attr
+		case "context":
+			context, err := parseScriptContext(&attr)
+			errs.Append(err)
+			parsedScriptJob.Context = context
 		default:
 			errs.Append(errors.E(ErrScriptJobUnrecognizedAttr, attr.NameRange, attr.Name))
 		}
 	}
 
 	for _, childBlock := range block.Blocks {
-		errs.Append(errors.E(ErrScriptUnrecognizedBlock, childBlock.TypeRange, childBlock.Type))
+		if childBlock.Type != "env" {
+			errs.Append(errors.E(ErrScriptUnrecognizedBlock, childBlock.TypeRange, childBlock.Type))
+			continue
+		}
+		if parsedScriptJob.Env != nil {
+			errs.Append(errors.E(ErrScriptInvalidEnv, childBlock.TypeRange,
+				"multiple env blocks in the same job"))
+			continue
+		}
+		env, err := parseScriptEnvBlock(childBlock)
+		if err != nil {
+			errs.Append(err)
+			continue
+		}
+		parsedScriptJob.Env = env
 	}
 
 	// job.command and job.commands are mutually exclusive
@@ -677,6 +677,694 @@ func TestHCLScript(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "script with matrix",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+					  terramate {
+						  config {
+							  experiments = ["scripts"]
+						  }
+					  }
+					`,
+				},
+				{
+					filename: "script.tm",
+					body: `
+					  script "deploy" {
+						matrix {
+						  region = ["us", "eu"]
+						  workspace = global.workspaces
+						}
+						job {
+						  command = ["echo", terramate.run.matrix.region]
+						}
+					  }
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Experiments: []string{"scripts"},
+						},
+					},
+					Scripts: []*hcl.Script{
+						{
+							Labels: []string{"deploy"},
+							Matrix: ast.Attributes{
+								"region":    *makeAttribute(t, "region", `["us", "eu"]`),
+								"workspace": *makeAttribute(t, "workspace", `global.workspaces`),
+							},
+							Jobs: []*hcl.ScriptJob{
+								{
+									Command: makeCommand(t, `["echo", terramate.run.matrix.region]`),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "script with job dependencies",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+					  terramate {
+						  config {
+							  experiments = ["scripts"]
+						  }
+					  }
+					`,
+				},
+				{
+					filename: "script.tm",
+					body: `
+					  script "deploy" {
+						job {
+						  name     = "lint"
+						  parallel = true
+						  command  = ["lint"]
+						}
+						job {
+						  name     = "validate"
+						  parallel = true
+						  command  = ["validate"]
+						}
+						job {
+						  depends_on = ["lint", "validate"]
+						  command    = ["plan"]
+						}
+					  }
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Experiments: []string{"scripts"},
+						},
+					},
+					Scripts: []*hcl.Script{
+						{
+							Labels: []string{"deploy"},
+							Jobs: []*hcl.ScriptJob{
+								{
+									Name:     makeAttribute(t, "name", `"lint"`),
+									Parallel: makeAttribute(t, "parallel", `true`),
+									Command:  makeCommand(t, `["lint"]`),
+								},
+								{
+									Name:     makeAttribute(t, "name", `"validate"`),
+									Parallel: makeAttribute(t, "parallel", `true`),
+									Command:  makeCommand(t, `["validate"]`),
+								},
+								{
+									DependsOn: makeAttribute(t, "depends_on", `["lint", "validate"]`),
+									Command:   makeCommand(t, `["plan"]`),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "script with params",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+					  terramate {
+						  config {
+							  experiments = ["scripts"]
+						  }
+					  }
+					`,
+				},
+				{
+					filename: "script.tm",
+					body: `
+					  script "deploy" {
+						param "region" {
+						  type        = string
+						  default     = "eu-west-1"
+						  description = "AWS region"
+						}
+						param "replicas" {
+						  type = number
+						}
+						job {
+						  command = ["echo", script.params.region]
+						}
+					  }
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Experiments: []string{"scripts"},
+						},
+					},
+					Scripts: []*hcl.Script{
+						{
+							Labels: []string{"deploy"},
+							Params: []*hcl.ScriptParam{
+								{
+									Name:        "region",
+									Type:        makeAttribute(t, "type", `string`),
+									Default:     makeAttribute(t, "default", `"eu-west-1"`),
+									Description: makeAttribute(t, "description", `"AWS region"`),
+								},
+								{
+									Name: "replicas",
+									Type: makeAttribute(t, "type", `number`),
+								},
+							},
+							Jobs: []*hcl.ScriptJob{
+								{
+									Command: makeCommand(t, `["echo", script.params.region]`),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "script with conditions",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+					  terramate {
+						  config {
+							  experiments = ["scripts"]
+						  }
+					  }
+					`,
+				},
+				{
+					filename: "script.tm",
+					body: `
+					  script "lint" {
+						condition = global.lint_enabled
+						job {
+						  condition = tm_contains(terramate.stack.tags, "terraform")
+						  command   = ["tflint"]
+						}
+					  }
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Experiments: []string{"scripts"},
+						},
+					},
+					Scripts: []*hcl.Script{
+						{
+							Labels:    []string{"lint"},
+							Condition: makeAttribute(t, "condition", `global.lint_enabled`),
+							Jobs: []*hcl.ScriptJob{
+								{
+									Condition: makeAttribute(t, "condition", `tm_contains(terramate.stack.tags, "terraform")`),
+									Command:   makeCommand(t, `["tflint"]`),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "script with env",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+					  terramate {
+						  config {
+							  experiments = ["scripts"]
+						  }
+					  }
+					`,
+				},
+				{
+					filename: "script.tm",
+					body: `
+					  script "deploy" {
+						env {
+						  AWS_PROFILE = global.profile
+						  TF_LOG      = unset
+						}
+						job {
+						  env {
+						    TF_CLI_ARGS_plan = "-lock=false"
+						  }
+						  command = ["terraform", "plan"]
+						}
+						job {
+						  command = ["terraform", "apply"]
+						}
+					  }
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Experiments: []string{"scripts"},
+						},
+					},
+					Scripts: []*hcl.Script{
+						{
+							Labels: []string{"deploy"},
+							Env: ast.Attributes{
+								"AWS_PROFILE": *makeAttribute(t, "AWS_PROFILE", `global.profile`),
+								"TF_LOG":      *makeAttribute(t, "TF_LOG", `unset`),
+							},
+							Jobs: []*hcl.ScriptJob{
+								{
+									Env: ast.Attributes{
+										"TF_CLI_ARGS_plan": *makeAttribute(t, "TF_CLI_ARGS_plan", `"-lock=false"`),
+									},
+									Command: makeCommand(t, `["terraform", "plan"]`),
+								},
+								{
+									Command: makeCommand(t, `["terraform", "apply"]`),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "script with invalid env",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+					  terramate {
+						  config {
+							  experiments = ["scripts"]
+						  }
+					  }
+					`,
+				},
+				{
+					filename: "script.tm",
+					body: `
+					  script "deploy" {
+						env "label" {
+						}
+						env {
+						}
+						env {
+						}
+						job {
+						  env {
+						    nested {
+						    }
+						  }
+						  command = ["echo", "hello"]
+						}
+					  }
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrScriptInvalidEnv),
+					errors.E(hcl.ErrScriptInvalidEnv),
+					errors.E(hcl.ErrScriptUnrecognizedBlock),
+					errors.E(hcl.ErrScriptMissingOrInvalidJob),
+				},
+			},
+		},
+		{
+			name: "script with on_failure and finally jobs",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+					  terramate {
+						  config {
+							  experiments = ["scripts"]
+						  }
+					  }
+					`,
+				},
+				{
+					filename: "script.tm",
+					body: `
+					  script "deploy" {
+						job {
+						  command = ["terraform", "apply"]
+						}
+						on_failure {
+						  name    = "notify"
+						  command = ["notify", script.result.failed_job]
+						}
+						finally {
+						  commands = [["unlock"], ["upload"]]
+						}
+					  }
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Experiments: []string{"scripts"},
+						},
+					},
+					Scripts: []*hcl.Script{
+						{
+							Labels: []string{"deploy"},
+							Jobs: []*hcl.ScriptJob{
+								{
+									Command: makeCommand(t, `["terraform", "apply"]`),
+								},
+							},
+							OnFailure: []*hcl.ScriptJob{
+								{
+									Name:    makeAttribute(t, "name", `"notify"`),
+									Command: makeCommand(t, `["notify", script.result.failed_job]`),
+								},
+							},
+							Finally: []*hcl.ScriptJob{
+								{
+									Commands: makeCommands(t, `[["unlock"], ["upload"]]`),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "script with invalid on_failure and finally jobs",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+					  terramate {
+						  config {
+							  experiments = ["scripts"]
+						  }
+					  }
+					`,
+				},
+				{
+					filename: "script.tm",
+					body: `
+					  script "deploy" {
+						job {
+						  name    = "apply"
+						  command = ["terraform", "apply"]
+						}
+						on_failure {
+						  depends_on = ["apply"]
+						  command    = ["notify"]
+						}
+						finally {
+						  parallel = true
+						  command  = ["unlock"]
+						}
+						finally {
+						}
+					  }
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrScriptJobUnrecognizedAttr),
+					errors.E(hcl.ErrScriptJobUnrecognizedAttr),
+					errors.E(hcl.ErrScriptNoCmds),
+				},
+			},
+		},
+		{
+			name: "script with root context jobs",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+					  terramate {
+						  config {
+							  experiments = ["scripts"]
+						  }
+					  }
+					`,
+				},
+				{
+					filename: "script.tm",
+					body: `
+					  script "deploy" {
+						job {
+						  context = root
+						  command = ["refresh-credentials"]
+						}
+						job {
+						  command = ["terraform", "apply"]
+						}
+						job {
+						  context = "root"
+						  command = ["report", terramate.run.stacks]
+						}
+					  }
+					  script "report" {
+						context = root
+						job {
+						  command = ["report", terramate.run.stacks]
+						}
+					  }
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Terramate: &hcl.Terramate{
+						Config: &hcl.RootConfig{
+							Experiments: []string{"scripts"},
+						},
+					},
+					Scripts: []*hcl.Script{
+						{
+							Labels:  []string{"deploy"},
+							Context: hcl.ScriptStackContext,
+							Jobs: []*hcl.ScriptJob{
+								{
+									Context: hcl.ScriptRootContext,
+									Command: makeCommand(t, `["refresh-credentials"]`),
+								},
+								{
+									Context: hcl.ScriptStackContext,
+									Command: makeCommand(t, `["terraform", "apply"]`),
+								},
+								{
+									Context: hcl.ScriptRootContext,
+									Command: makeCommand(t, `["report", terramate.run.stacks]`),
+								},
+							},
+						},
+						{
+							Labels:  []string{"report"},
+							Context: hcl.ScriptRootContext,
+							Jobs: []*hcl.ScriptJob{
+								{
+									Context: hcl.ScriptRootContext,
+									Command: makeCommand(t, `["report", terramate.run.stacks]`),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "script with invalid contexts",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+					  terramate {
+						  config {
+							  experiments = ["scripts"]
+						  }
+					  }
+					`,
+				},
+				{
+					filename: "script.tm",
+					body: `
+					  script "deploy" {
+						job {
+						  name    = "plan"
+						  command = ["terraform", "plan"]
+						}
+						job {
+						  context    = root
+						  depends_on = ["plan"]
+						  command    = ["report"]
+						}
+						job {
+						  command = ["terraform", "apply"]
+						}
+						job {
+						  context = "workspace"
+						  command = ["echo"]
+						}
+						finally {
+						  context = root
+						  command = ["unlock"]
+						}
+					  }
+					  script "report" {
+						context = root
+						matrix {
+						  region = ["eu-west-1"]
+						}
+						job {
+						  context = stack
+						  command = ["report"]
+						}
+					  }
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrScriptInvalidContext),
+					errors.E(hcl.ErrScriptJobUnrecognizedAttr),
+					errors.E(hcl.ErrScriptInvalidContext),
+					errors.E(hcl.ErrScriptInvalidContext),
+					errors.E(hcl.ErrScriptInvalidContext),
+					errors.E(hcl.ErrScriptInvalidContext),
+				},
+			},
+		},
+		{
+			name: "script with redeclared param",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+					  terramate {
+						  config {
+							  experiments = ["scripts"]
+						  }
+					  }
+					`,
+				},
+				{
+					filename: "script.tm",
+					body: `
+					  script "deploy" {
+						param "region" {
+						}
+						param "region" {
+						}
+						job {
+						  command = ["echo", "hello"]
+						}
+					  }
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrScriptInvalidParam),
+				},
+			},
+		},
+		{
+			name: "script with invalid param",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+					  terramate {
+						  config {
+							  experiments = ["scripts"]
+						  }
+					  }
+					`,
+				},
+				{
+					filename: "script.tm",
+					body: `
+					  script "deploy" {
+						param {
+						}
+						param "1region" {
+						}
+						param "region" {
+						  required = true
+						}
+						job {
+						  command = ["echo", "hello"]
+						}
+					  }
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrScriptInvalidParam),
+					errors.E(hcl.ErrScriptInvalidParam),
+					errors.E(hcl.ErrScriptInvalidParam),
+				},
+			},
+		},
+		{
+			name: "script with empty matrix",
+			input: []cfgfile{
+				{
+					filename: "cfg.tm",
+					body: `
+					  terramate {
+						  config {
+							  experiments = ["scripts"]
+						  }
+					  }
+					`,
+				},
+				{
+					filename: "script.tm",
+					body: `
+					  script "deploy" {
+						matrix {
+						}
+						job {
+						  command = ["echo", "hello"]
+						}
+					  }
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrScriptInvalidMatrix,
+						Mkrange("script.tm", Start(3, 7, 32), End(4, 8, 48))),
+				},
+			},
+		},
 		{
 			name:                  "script inside a stack dir",
 			parsedir:              "stack",
@@ -216,6 +216,46 @@ func TestHCLParserStack(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "stack with concurrency_group",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							concurrency_group = "backend"
+						}
+					`,
+				},
+			},
+			want: want{
+				config: hcl.Config{
+					Stack: &hcl.Stack{
+						ConcurrencyGroup: "backend",
+					},
+				},
+			},
+		},
+		{
+			name: "concurrency_group is not a string - fails",
+			input: []cfgfile{
+				{
+					filename: "stack.tm",
+					body: `
+						stack {
+							concurrency_group = 1
+						}
+					`,
+				},
+			},
+			want: want{
+				errs: []error{
+					errors.E(hcl.ErrTerramateSchema,
+						Mkrange("stack.tm", Start(3, 28, 42), End(3, 29, 43)),
+					),
+				},
+			},
+		},
 		{
 			name: "id is not a string - fails",
 			input: []cfgfile{
@@ -88,6 +88,10 @@ func PrintConfig(w io.Writer, cfg Config) error {
 		if stack.ID != "" {
 			stackBody.SetAttributeValue("id", cty.StringVal(stack.ID))
 		}
+
+		if stack.ConcurrencyGroup != "" {
+			stackBody.SetAttributeValue("concurrency_group", cty.StringVal(stack.ConcurrencyGroup))
+		}
 	}
 
 	logger.Debug().Msg("write to output")
@@ -0,0 +1,242 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/project"
+	"github.com/terramate-io/terramate/tf"
+)
+
+// CacheFilename is the name of the file, inside the local state directory,
+// keeping the input hashes of the last successful execution of the stacks.
+const CacheFilename = "run-cache.json"
+
+// ErrCache indicates a failure computing the inputs hash of a stack.
+const ErrCache errors.Kind = "computing stack inputs hash"
+
+// Cache keeps, for each stack and command, the hash of the stack inputs at
+// the last successful execution of the command. It's safe to use concurrently.
+type Cache struct {
+	mu      sync.Mutex
+	rootdir string
+
+	// stacks maps the stack path to the hashes of the commands to the
+	// inputs hash.
+	stacks map[string]map[string]string
+}
+
+// LoadCache loads the run cache of the project at rootdir.
+// If no cache was saved yet, it returns an empty cache.
+func LoadCache(rootdir string) (*Cache, error) {
+	c := &Cache{
+		rootdir: rootdir,
+		stacks:  map[string]map[string]string{},
+	}
+	data, err := os.ReadFile(filepath.Join(rootdir, StateDirName, CacheFilename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, errors.E(ErrState, err)
+	}
+	if err := json.Unmarshal(data, &c.stacks); err != nil {
+		return nil, errors.E(ErrState, err, "parsing %s", CacheFilename)
+	}
+	return c, nil
+}
+
+// Hit tells if the stack at path was successfully executed with the given
+// commands and the same inputs hash.
+func (c *Cache) Hit(path string, cmds [][]string, inputs string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stacks[path][commandsHash(cmds)] == inputs
+}
+
+// Store records the inputs hash of a successful execution of the given
+// commands in the stack at path.
+func (c *Cache) Store(path string, cmds [][]string, inputs string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stacks[path] == nil {
+		c.stacks[path] = map[string]string{}
+	}
+	c.stacks[path][commandsHash(cmds)] = inputs
+}
+
+// Save writes the cache to the local state directory.
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := json.MarshalIndent(c.stacks, "", "  ")
+	if err != nil {
+		return errors.E(ErrState, err)
+	}
+	return writeStateFile(c.rootdir, CacheFilename, data)
+}
+
+func commandsHash(cmds [][]string) string {
+	h := sha256.New()
+	for _, cmd := range cmds {
+		writeHashField(h, "cmd", strings.Join(cmd, "\x00"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// StackInputsHash computes the hash of the inputs of the given stack: the
+// files of the stack (except the files of child stacks and of hidden
+// directories), its watched files, the files of the local Terraform modules
+// it calls, transitively, and its environment.
+func StackInputsHash(root *config.Root, st *config.Stack, env EnvVars) (string, error) {
+	h := sha256.New()
+
+	if err := hashDir(h, root, st.Dir, true); err != nil {
+		return "", err
+	}
+
+	for _, watch := range st.Watch {
+		if err := hashFile(h, root, watch); err != nil {
+			return "", err
+		}
+	}
+
+	visited := map[project.Path]bool{}
+	if err := hashModules(h, root, st.Dir, visited); err != nil {
+		return "", err
+	}
+
+	for _, v := range env {
+		writeHashField(h, "env", v)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashDir hashes all files of the given directory, recursively. Hidden
+// directories are skipped and, if skipStacks is true, so are child stacks.
+func hashDir(h hash.Hash, root *config.Root, dir project.Path, skipStacks bool) error {
+	hostdir := project.AbsPath(root.HostDir(), dir.String())
+	return filepath.WalkDir(hostdir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.E(ErrCache, err)
+		}
+		if d.IsDir() {
+			if p == hostdir {
+				return nil
+			}
+			if strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if skipStacks {
+				if node, ok := root.Lookup(project.PrjAbsPath(root.HostDir(), p)); ok && node.IsStack() {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return hashFile(h, root, project.PrjAbsPath(root.HostDir(), p))
+	})
+}
+
+func hashFile(h hash.Hash, root *config.Root, file project.Path) error {
+	writeHashField(h, "file", file.String())
+
+	f, err := os.Open(project.AbsPath(root.HostDir(), file.String()))
+	if err != nil {
+		if os.IsNotExist(err) {
+			writeHashField(h, "missing", file.String())
+			return nil
+		}
+		return errors.E(ErrCache, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return errors.E(ErrCache, err, "reading %s", file)
+	}
+	return nil
+}
+
+// hashModules hashes the local Terraform modules called by the .tf files of
+// the given directory, transitively.
+func hashModules(h hash.Hash, root *config.Root, dir project.Path, visited map[project.Path]bool) error {
+	hostdir := project.AbsPath(root.HostDir(), dir.String())
+	entries, err := os.ReadDir(hostdir)
+	if err != nil {
+		return errors.E(ErrCache, err)
+	}
+
+	var sources []string
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".tf" {
+			continue
+		}
+		modules, err := tf.ParseModules(filepath.Join(hostdir, entry.Name()))
+		if err != nil {
+			return errors.E(ErrCache, err, "parsing modules of %s", dir)
+		}
+		for _, mod := range modules {
+			if mod.IsLocal() {
+				sources = append(sources, mod.Source)
+			}
+		}
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		modAbsPath := filepath.Join(hostdir, source)
+		rootdir := root.HostDir()
+		if modAbsPath != rootdir && !strings.HasPrefix(modAbsPath, rootdir+string(filepath.Separator)) {
+			log.Debug().Msgf("skipping module %q of %s outside of the project root", source, dir)
+			continue
+		}
+
+		modPath := project.PrjAbsPath(rootdir, modAbsPath)
+		if visited[modPath] {
+			continue
+		}
+		visited[modPath] = true
+
+		if st, err := os.Stat(modAbsPath); err != nil || !st.IsDir() {
+			return errors.E(ErrCache, fmt.Sprintf("module source %q of %s is not a directory", source, dir))
+		}
+
+		writeHashField(h, "module", modPath.String())
+		if err := hashDir(h, root, modPath, false); err != nil {
+			return err
+		}
+		if err := hashModules(h, root, modPath, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeHashField writes a length-prefixed field, then different fields never
+// produce the same hash input.
+func writeHashField(h hash.Hash, kind, value string) {
+	_, _ = fmt.Fprintf(h, "%s:%d:%s\n", kind, len(value), value)
+}
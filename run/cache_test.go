@@ -0,0 +1,97 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/terramate-io/terramate/project"
+	"github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestCacheSaveAndLoad(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	cmds := [][]string{{"terraform", "apply"}}
+
+	c, err := run.LoadCache(s.RootDir())
+	assert.NoError(t, err)
+	assert.IsTrue(t, !c.Hit("/s1", cmds, "hash"))
+
+	c.Store("/s1", cmds, "hash")
+	assert.NoError(t, c.Save())
+
+	got, err := run.LoadCache(s.RootDir())
+	assert.NoError(t, err)
+	assert.IsTrue(t, got.Hit("/s1", cmds, "hash"))
+	assert.IsTrue(t, !got.Hit("/s1", cmds, "other"), "different inputs")
+	assert.IsTrue(t, !got.Hit("/s1", [][]string{{"terraform", "plan"}}, "hash"), "different commands")
+	assert.IsTrue(t, !got.Hit("/s2", cmds, "hash"), "different stack")
+}
+
+func TestStackInputsHash(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`s:stack:watch=["/external/file.txt"]`,
+		`s:stack/child`,
+		`f:stack/main.tf:module "m" {
+		  source = "../modules/m1"
+		}`,
+		`f:modules/m1/main.tf:module "nested" {
+		  source = "../m2"
+		}`,
+		`f:modules/m2/main.tf:# m2`,
+		`f:modules/unused/main.tf:# unused`,
+		`f:external/file.txt:watched`,
+		`f:stack/.terraform/cache:ignored`,
+	})
+
+	root := s.Config()
+	st := s.LoadStack(project.NewPath("/stack"))
+	env := run.EnvVars{"NAME=value"}
+
+	hash := func(env run.EnvVars) string {
+		t.Helper()
+		h, err := run.StackInputsHash(root, st, env)
+		assert.NoError(t, err)
+		return h
+	}
+
+	base := hash(env)
+	assert.EqualStrings(t, base, hash(env), "hash must be deterministic")
+	assert.IsTrue(t, hash(run.EnvVars{"NAME=other"}) != base, "env must be hashed")
+
+	unchanged := []struct {
+		dir, file string
+	}{
+		{"stack/child", "main.tf"},
+		{"stack/.terraform", "cache"},
+		{"modules/unused", "main.tf"},
+	}
+	for _, f := range unchanged {
+		test.WriteFile(t, filepath.Join(s.RootDir(), f.dir), f.file, "changed")
+		assert.EqualStrings(t, base, hash(env), "%s/%s must not be hashed", f.dir, f.file)
+	}
+
+	for _, f := range []struct {
+		dir, file string
+	}{
+		{"stack", "variables.tf"},
+		{"external", "file.txt"},
+		{"modules/m1", "variables.tf"},
+		{"modules/m2", "main.tf"},
+	} {
+		test.WriteFile(t, filepath.Join(s.RootDir(), f.dir), f.file, "# changed")
+		got := hash(env)
+		assert.IsTrue(t, got != base, "%s/%s must be hashed", f.dir, f.file)
+		base = got
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+
+	"github.com/terramate-io/hcl/v2"
+	"github.com/terramate-io/terramate/errors"
+)
+
+// ErrDotenvSyntax indicates that a dotenv file has invalid syntax.
+const ErrDotenvSyntax errors.Kind = "invalid dotenv file syntax"
+
+// dotenvVar is a variable defined in a dotenv file.
+type dotenvVar struct {
+	name  string
+	value string
+}
+
+// parseDotenv parses the content of a dotenv file, returning the variables in
+// the order they are defined.
+//
+// Each line is either empty, a comment starting with #, or a NAME=VALUE
+// definition, optionally prefixed by `export`. Values can be unquoted, with
+// trailing comments removed, single-quoted, taken literally, or double-quoted,
+// with the \n, \t, \", \\ and \$ escape sequences.
+func parseDotenv(filename string, data []byte) ([]dotenvVar, error) {
+	var vars []dotenvVar
+	errs := errors.L()
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	offset := 0
+	for scanner.Scan() {
+		line++
+		lineOffset := offset
+		offset += len(scanner.Bytes()) + 1
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+
+		rangeAt := func(column int) hcl.Range {
+			pos := hcl.Pos{Line: line, Column: column + 1, Byte: lineOffset + column}
+			return hcl.Range{
+				Filename: filename,
+				Start:    pos,
+				End:      hcl.Pos{Line: line, Column: len(text) + 1, Byte: lineOffset + len(text)},
+			}
+		}
+
+		trimmed := strings.TrimLeft(text, " \t")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		column := len(text) - len(trimmed)
+
+		if rest := strings.TrimPrefix(trimmed, "export "); rest != trimmed {
+			rest = strings.TrimLeft(rest, " \t")
+			column += len(trimmed) - len(rest)
+			trimmed = rest
+		}
+
+		eq := strings.IndexByte(trimmed, '=')
+		if eq == -1 {
+			errs.Append(errors.E(ErrDotenvSyntax, rangeAt(column), "expected NAME=VALUE"))
+			continue
+		}
+
+		name := strings.TrimRight(trimmed[:eq], " \t")
+		if !isEnvName(name) {
+			errs.Append(errors.E(ErrDotenvSyntax, rangeAt(column), "invalid variable name %q", name))
+			continue
+		}
+
+		value, err := parseDotenvValue(strings.TrimLeft(trimmed[eq+1:], " \t"))
+		if err != nil {
+			errs.Append(errors.E(ErrDotenvSyntax, rangeAt(column+eq+1), err))
+			continue
+		}
+		vars = append(vars, dotenvVar{name: name, value: value})
+	}
+
+	if err := scanner.Err(); err != nil {
+		errs.Append(errors.E(ErrDotenvSyntax, err, "reading %s", filename))
+	}
+	if err := errs.AsError(); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+func parseDotenvValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	switch raw[0] {
+	case '\'':
+		end := strings.IndexByte(raw[1:], '\'')
+		if end == -1 {
+			return "", errors.E("unterminated single-quoted value")
+		}
+		if err := checkTrailing(raw[end+2:]); err != nil {
+			return "", err
+		}
+		return raw[1 : end+1], nil
+
+	case '"':
+		var value strings.Builder
+		for i := 1; i < len(raw); i++ {
+			c := raw[i]
+			switch {
+			case c == '"':
+				if err := checkTrailing(raw[i+1:]); err != nil {
+					return "", err
+				}
+				return value.String(), nil
+			case c == '\\' && i+1 < len(raw):
+				i++
+				switch raw[i] {
+				case 'n':
+					value.WriteByte('\n')
+				case 't':
+					value.WriteByte('\t')
+				case '"', '\\', '$':
+					value.WriteByte(raw[i])
+				default:
+					value.WriteByte('\\')
+					value.WriteByte(raw[i])
+				}
+			default:
+				value.WriteByte(c)
+			}
+		}
+		return "", errors.E("unterminated double-quoted value")
+	}
+
+	if i := strings.Index(raw, " #"); i != -1 {
+		raw = raw[:i]
+	}
+	return strings.TrimRight(raw, " \t"), nil
+}
+
+// checkTrailing checks that only blanks or a comment follow a quoted value.
+func checkTrailing(rest string) error {
+	rest = strings.TrimLeft(rest, " \t")
+	if rest != "" && rest[0] != '#' {
+		return errors.E("unexpected characters after quoted value: %q", rest)
+	}
+	return nil
+}
+
+func isEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
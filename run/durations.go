@@ -0,0 +1,107 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/terramate-io/terramate/errors"
+)
+
+// DurationsFilename is the name of the file, inside the local state directory,
+// keeping the execution durations of the stacks in previous runs, per command.
+const DurationsFilename = "durations.json"
+
+// durationsSmoothing is the weight of the most recent execution in the
+// expected duration of a stack.
+const durationsSmoothing = 0.5
+
+// Durations keeps the expected execution duration of stacks, learned from
+// previous runs of the same commands, then the durations of a command (e.g.
+// plan) don't drive the scheduling of another (e.g. apply).
+// The commands are kept as hashes, since they may contain sensitive values.
+// It's safe to use concurrently.
+type Durations struct {
+	mu       sync.Mutex
+	rootdir  string
+	commands map[string]map[string]float64
+}
+
+// LoadDurations loads the stack durations of the project at rootdir.
+// If no durations were saved yet, it returns empty durations.
+func LoadDurations(rootdir string) (*Durations, error) {
+	d := &Durations{
+		rootdir:  rootdir,
+		commands: map[string]map[string]float64{},
+	}
+	data, err := os.ReadFile(filepath.Join(rootdir, StateDirName, DurationsFilename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return d, nil
+		}
+		return nil, errors.E(ErrState, err)
+	}
+	if err := json.Unmarshal(data, &d.commands); err != nil {
+		return nil, errors.E(ErrState, err, "parsing %s", DurationsFilename)
+	}
+	return d, nil
+}
+
+// Expected returns the expected duration, in seconds, of the commands in the
+// stack at path. Stacks never executed before are expected to take the
+// average duration of the commands in the known stacks, or 1 second if none
+// is known.
+func (d *Durations) Expected(cmds [][]string, path string) float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stacks := d.commands[commandsHash(cmds)]
+	if v, ok := stacks[path]; ok {
+		return v
+	}
+	if len(stacks) == 0 {
+		return 1
+	}
+	var total float64
+	for _, v := range stacks {
+		total += v
+	}
+	return total / float64(len(stacks))
+}
+
+// Update records a new execution duration of the commands in the stack at
+// path. The expected duration moves towards the recorded one, so a single
+// unusually slow or fast execution doesn't override the history.
+func (d *Durations) Update(cmds [][]string, path string, duration time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	command := commandsHash(cmds)
+	stacks, ok := d.commands[command]
+	if !ok {
+		stacks = map[string]float64{}
+		d.commands[command] = stacks
+	}
+	seconds := duration.Seconds()
+	if v, ok := stacks[path]; ok {
+		seconds = durationsSmoothing*seconds + (1-durationsSmoothing)*v
+	}
+	stacks[path] = seconds
+}
+
+// Save writes the durations to the local state directory.
+func (d *Durations) Save() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	data, err := json.MarshalIndent(d.commands, "", "  ")
+	if err != nil {
+		return errors.E(ErrState, err)
+	}
+	return writeStateFile(d.rootdir, DurationsFilename, data)
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestDurationsSaveAndLoad(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	apply := [][]string{{"terraform", "apply"}}
+	plan := [][]string{{"terraform", "plan"}}
+	validate := [][]string{{"terraform", "init"}, {"terraform", "validate"}}
+
+	d, err := run.LoadDurations(s.RootDir())
+	assert.NoError(t, err)
+	assert.IsTrue(t, d.Expected(apply, "/s1") == 1)
+
+	d.Update(apply, "/s1", 10*time.Second)
+	d.Update(apply, "/s2", 2*time.Second)
+	d.Update(plan, "/s1", 4*time.Second)
+	assert.NoError(t, d.Save())
+
+	got, err := run.LoadDurations(s.RootDir())
+	assert.NoError(t, err)
+	assert.IsTrue(t, got.Expected(apply, "/s1") == 10)
+	assert.IsTrue(t, got.Expected(apply, "/s2") == 2)
+	assert.IsTrue(t, got.Expected(apply, "/s3") == 6, "unknown stacks take the average")
+	assert.IsTrue(t, got.Expected(plan, "/s1") == 4, "durations are kept per command")
+	assert.IsTrue(t, got.Expected(plan, "/s2") == 4)
+	assert.IsTrue(t, got.Expected(validate, "/s1") == 1, "unknown commands take 1 second")
+
+	got.Update(apply, "/s1", 20*time.Second)
+	assert.IsTrue(t, got.Expected(apply, "/s1") == 15)
+}
@@ -5,6 +5,7 @@ package run
 
 import (
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 
@@ -12,7 +13,9 @@ import (
 	"github.com/terramate-io/terramate/config"
 	"github.com/terramate-io/terramate/errors"
 	"github.com/terramate-io/terramate/globals"
+	"github.com/terramate-io/terramate/hcl/ast"
 	"github.com/terramate-io/terramate/hcl/eval"
+	"github.com/terramate-io/terramate/project"
 	"github.com/terramate-io/terramate/stdlib"
 	"golang.org/x/exp/maps"
 
@@ -30,6 +33,10 @@ const (
 	// ErrInvalidEnvVarType indicates the env var attribute
 	// has an invalid type.
 	ErrInvalidEnvVarType errors.Kind = "invalid environment variable type"
+
+	// ErrEnvFile indicates that an error happened while loading the dotenv
+	// files of the env_file or env_files attributes.
+	ErrEnvFile errors.Kind = "loading terramate.config.run.env env file"
 )
 
 // EnvVars represents a set of environment variables to be used
@@ -43,26 +50,51 @@ type EnvVars []string
 // All defined `terramate.config.run.env` definitions from the provided stack dir
 // up to the root of the project are collected, and env definitions closer to the
 // stack have precedence over parent definitions.
+//
+// The dotenv files of the env_file and env_files attributes are loaded at the
+// same level of the env block they are defined in. Attributes of the env block
+// have precedence over the variables of the files, and variables of later files
+// have precedence over earlier ones. Absolute paths are relative to the root of
+// the project, other paths are relative to the dir of the file defining the
+// attribute.
 func LoadEnv(root *config.Root, st *config.Stack) (EnvVars, error) {
-	globalsReport := globals.ForStack(root, st)
-	if err := globalsReport.AsError(); err != nil {
-		return nil, errors.E(ErrLoadingGlobals, err)
-	}
+	return LoadVariantEnv(root, st, nil)
+}
 
-	evalctx := eval.NewContext(stdlib.Functions(st.HostDir(root), root.Tree().Node.Experiments()))
-	runtime := root.Runtime()
-	runtime.Merge(st.RuntimeValues(root))
-	evalctx.SetNamespace("terramate", runtime)
-	evalctx.SetNamespace("global", globalsReport.Globals.AsValueMap())
-	evalctx.SetEnv(os.Environ())
+// LoadVariantEnv is like LoadEnv but loads the environment variables of the
+// given matrix variant, exposing its values as terramate.run.matrix.
+func LoadVariantEnv(root *config.Root, st *config.Stack, variant config.Variant) (EnvVars, error) {
+	evalctx, err := stackEvalContext(root, st, variant)
+	if err != nil {
+		return nil, err
+	}
 
 	tree, _ := root.Lookup(st.Dir)
+	return loadEnv(root, evalctx, tree)
+}
+
+// LoadRootEnv loads the environment variables of the commands executed in the
+// root of the project, as the root context jobs of scripts. Only the
+// `terramate.config.run.env` definitions of the root of the project are
+// loaded, evaluated with the globals of the root and without stack metadata.
+func LoadRootEnv(root *config.Root) (EnvVars, error) {
+	evalctx, err := rootEvalContext(root)
+	if err != nil {
+		return nil, err
+	}
+	return loadEnv(root, evalctx, root.Tree())
+}
+
+// loadEnv loads the env definitions from the given tree up to the root of the
+// project.
+func loadEnv(root *config.Root, evalctx *eval.Context, tree *config.Tree) (EnvVars, error) {
 	envMap := map[string]string{}
 	skipMap := map[string]struct{}{}
 
 	for {
 		if tree.Node.HasRunEnv() {
-			attrs := tree.Node.Terramate.Config.Run.Env.Attributes.SortedList()
+			runEnv := tree.Node.Terramate.Config.Run.Env
+			attrs := runEnv.Attributes.SortedList()
 
 			for _, attr := range attrs {
 				if _, skip := skipMap[attr.Name]; skip {
@@ -97,6 +129,19 @@ func LoadEnv(root *config.Root, st *config.Stack) (EnvVars, error) {
 					envMap[attr.Name] = val.AsString()
 				}
 			}
+
+			fileVars, err := loadEnvFiles(root, evalctx, runEnv.EnvFile, runEnv.EnvFiles)
+			if err != nil {
+				return nil, err
+			}
+			for name, value := range fileVars {
+				if _, skip := skipMap[name]; skip {
+					continue
+				}
+				if _, ok := envMap[name]; !ok {
+					envMap[name] = value
+				}
+			}
 		}
 
 		tree = tree.Parent
@@ -114,6 +159,116 @@ func LoadEnv(root *config.Root, st *config.Stack) (EnvVars, error) {
 	return envVars, nil
 }
 
+// loadEnvFiles loads the variables of the dotenv files of the given env_file
+// or env_files attribute. At most one of them is not nil.
+func loadEnvFiles(
+	root *config.Root,
+	evalctx *eval.Context,
+	envFile, envFiles *ast.Attribute,
+) (map[string]string, error) {
+	attr := envFile
+	if attr == nil {
+		attr = envFiles
+	}
+	if attr == nil {
+		return nil, nil
+	}
+
+	val, err := evalctx.Eval(attr.Expr)
+	if err != nil {
+		return nil, errors.E(ErrEval, err)
+	}
+
+	var paths []string
+	switch {
+	case envFile != nil && val.Type() == cty.String:
+		paths = append(paths, val.AsString())
+	case envFiles != nil && (val.Type().IsListType() || val.Type().IsTupleType()):
+		for it := val.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			if elem.Type() != cty.String {
+				return nil, errors.E(ErrEnvFile, attr.Range,
+					"env_files must be a list(string) but has element of type %s",
+					elem.Type().FriendlyName())
+			}
+			paths = append(paths, elem.AsString())
+		}
+	case envFile != nil:
+		return nil, errors.E(ErrEnvFile, attr.Range,
+			"env_file must be a string but has type %s", val.Type().FriendlyName())
+	default:
+		return nil, errors.E(ErrEnvFile, attr.Range,
+			"env_files must be a list(string) but has type %s", val.Type().FriendlyName())
+	}
+
+	vars := map[string]string{}
+	for _, path := range paths {
+		basedir := filepath.Dir(attr.Range.HostPath())
+		if strings.HasPrefix(path, "/") {
+			basedir = root.HostDir()
+		}
+		hostpath := filepath.Join(basedir, filepath.FromSlash(path))
+		if rel, err := filepath.Rel(root.HostDir(), hostpath); err != nil || rel == ".." ||
+			strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, errors.E(ErrEnvFile, attr.Range, "env file %q is outside the project", path)
+		}
+
+		data, err := os.ReadFile(hostpath)
+		if err != nil {
+			return nil, errors.E(ErrEnvFile, attr.Range, err, "reading env file %q", path)
+		}
+
+		fileVars, err := parseDotenv(hostpath, data)
+		if err != nil {
+			return nil, errors.E(ErrEnvFile, err)
+		}
+		for _, v := range fileVars {
+			vars[v.name] = v.value
+		}
+	}
+	return vars, nil
+}
+
+// stackEvalContext returns the context used to evaluate the run configuration
+// of the given stack, with globals, terramate metadata and env available.
+// The values of the matrix variant, if any, are available as
+// terramate.run.matrix.
+func stackEvalContext(root *config.Root, st *config.Stack, variant config.Variant) (*eval.Context, error) {
+	globalsReport := globals.ForStack(root, st)
+	if err := globalsReport.AsError(); err != nil {
+		return nil, errors.E(ErrLoadingGlobals, err)
+	}
+
+	evalctx := eval.NewContext(stdlib.Functions(st.HostDir(root), root.Tree().Node.Experiments()))
+	runtime := root.Runtime()
+	runtime.Merge(st.RuntimeValues(root))
+	evalctx.SetNamespace("terramate", runtime)
+	evalctx.SetNamespace("global", globalsReport.Globals.AsValueMap())
+	evalctx.SetEnv(os.Environ())
+	config.SetMatrixNamespace(evalctx, variant)
+	return evalctx, nil
+}
+
+func rootEvalContext(root *config.Root) (*eval.Context, error) {
+	globalsReport := rootGlobals(root)
+	if err := globalsReport.AsError(); err != nil {
+		return nil, errors.E(ErrLoadingGlobals, err)
+	}
+
+	evalctx := eval.NewContext(stdlib.Functions(root.HostDir(), root.Tree().Node.Experiments()))
+	evalctx.SetNamespace("terramate", root.Runtime())
+	evalctx.SetNamespace("global", globalsReport.Globals.AsValueMap())
+	evalctx.SetEnv(os.Environ())
+	return evalctx, nil
+}
+
+// rootGlobals evaluates the globals of the root of the project.
+func rootGlobals(root *config.Root) globals.EvalReport {
+	ctx := eval.NewContext(stdlib.Functions(root.HostDir(), root.Tree().Node.Experiments()))
+	ctx.SetNamespace("terramate", root.Runtime())
+	return globals.ForDir(root, project.NewPath("/"), ctx)
+}
+
 func getEnv(key string, environ []string) (string, bool) {
 	for i := len(environ) - 1; i >= 0; i-- {
 		env := environ[i]
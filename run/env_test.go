@@ -6,6 +6,7 @@ package run_test
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/madlambda/spells/assert"
@@ -562,6 +563,185 @@ func TestLoadRunEnv(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "env loaded from env files",
+			layout: []string{
+				"s:stacks/stack-1",
+				"s:stacks/stack-2",
+				"f:common.env:# common settings\nexport COMMON=common\nFROM_ATTR=file\nLOCAL=root\n",
+				"f:quoting.env:DOUBLE=\"a\\tb \\\"c\\\"\"\nSINGLE='${raw}' # comment\nPLAIN=value # comment\nEMPTY=\n",
+				"f:stacks/stack-1/.env:LOCAL=stack-1\n",
+				"f:stacks/stack-2/.env:LOCAL=stack-2\n",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: runEnvCfg(
+						Expr("env_files", `["/common.env", "/quoting.env"]`),
+						Str("FROM_ATTR", "attr"),
+					),
+				},
+				{
+					path: "/stacks/stack-1",
+					add: runEnvCfg(
+						Str("env_file", ".env"),
+					),
+				},
+			},
+			want: map[string]result{
+				"stacks/stack-1": {
+					env: run.EnvVars{
+						"COMMON=common",
+						"DOUBLE=a\tb \"c\"",
+						"EMPTY=",
+						"FROM_ATTR=attr",
+						"LOCAL=stack-1",
+						"PLAIN=value",
+						"SINGLE=${raw}",
+					},
+				},
+				"stacks/stack-2": {
+					env: run.EnvVars{
+						"COMMON=common",
+						"DOUBLE=a\tb \"c\"",
+						"EMPTY=",
+						"FROM_ATTR=attr",
+						"LOCAL=root",
+						"PLAIN=value",
+						"SINGLE=${raw}",
+					},
+				},
+			},
+		},
+		{
+			name: "later env files have precedence and env files can be unset",
+			layout: []string{
+				"s:stack",
+				"f:a.env:A=a\nB=a\n",
+				"f:b.env:B=b\n",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: runEnvCfg(
+						Expr("env_files", `["/a.env", "/b.env"]`),
+					),
+				},
+				{
+					path: "/stack",
+					add: runEnvCfg(
+						Expr("A", "unset"),
+					),
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					env: run.EnvVars{
+						"B=b",
+					},
+				},
+			},
+		},
+		{
+			name: "relative env files are relative to the dir of the file defining them",
+			layout: []string{
+				"s:stacks/stack",
+				"f:config/.env:FROM=config\n",
+				"f:stacks/stack/config/.env:FROM=stack\n",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: runEnvCfg(
+						Str("env_file", "config/.env"),
+					),
+				},
+			},
+			want: map[string]result{
+				"stacks/stack": {
+					env: run.EnvVars{
+						"FROM=config",
+					},
+				},
+			},
+		},
+		{
+			name: "fails if env file does not exist",
+			layout: []string{
+				"s:stack",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: runEnvCfg(
+						Str("env_file", "/missing.env"),
+					),
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					enverr: errors.E(run.ErrEnvFile),
+				},
+			},
+		},
+		{
+			name: "fails if env file has invalid syntax",
+			layout: []string{
+				"s:stack",
+				"f:.env:VALID=1\nINVALID\n",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: runEnvCfg(
+						Str("env_file", ".env"),
+					),
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					enverr: errors.E(run.ErrDotenvSyntax),
+				},
+			},
+		},
+		{
+			name: "fails if env file is outside the project",
+			layout: []string{
+				"s:stack",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: runEnvCfg(
+						Str("env_file", "../../.env"),
+					),
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					enverr: errors.E(run.ErrEnvFile),
+				},
+			},
+		},
+		{
+			name: "fails if env_files is not a list of strings",
+			layout: []string{
+				"s:stack",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					add: runEnvCfg(
+						Expr("env_files", `"/.env"`),
+					),
+				},
+			},
+			want: map[string]result{
+				"stack": {
+					enverr: errors.E(run.ErrEnvFile),
+				},
+			},
+		},
 	}
 
 	// TODO(i4k): these tests should not call setenv()!
@@ -606,6 +786,91 @@ func TestLoadRunEnv(t *testing.T) {
 	}
 }
 
+func TestLoadRootEnv(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		name    string
+		layout  []string
+		want    run.EnvVars
+		wantErr error
+	}
+
+	for _, tc := range []testcase{
+		{
+			name:   "no env config",
+			layout: []string{"s:stack"},
+		},
+		{
+			name: "env of the root evaluated with the root globals",
+			layout: []string{
+				"s:stack",
+				`f:globals.tm:globals {
+				  name = "root"
+				}`,
+				`f:env.tm:terramate {
+				  config {
+				    run {
+				      env {
+				        NAME = global.name
+				        ROOT = terramate.root.path.fs.absolute
+				      }
+				    }
+				  }
+				}`,
+				`f:stack/env.tm:terramate {
+				  config {
+				    run {
+				      env {
+				        STACK = "stack"
+				      }
+				    }
+				  }
+				}`,
+			},
+			want: run.EnvVars{"NAME=root", "ROOT={{root}}"},
+		},
+		{
+			name: "fails on stack metadata",
+			layout: []string{
+				"s:stack",
+				`f:env.tm:terramate {
+				  config {
+				    run {
+				      env {
+				        NAME = terramate.stack.name
+				      }
+				    }
+				  }
+				}`,
+			},
+			wantErr: errors.E(run.ErrEval),
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := sandbox.NoGit(t, true)
+			s.BuildTree(tc.layout)
+
+			root, err := config.LoadRoot(s.RootDir())
+			assert.NoError(t, err)
+
+			got, err := run.LoadRootEnv(root)
+			errorstest.Assert(t, err, tc.wantErr)
+			if err != nil {
+				return
+			}
+			var want run.EnvVars
+			for _, v := range tc.want {
+				want = append(want, strings.ReplaceAll(v, "{{root}}", s.RootDir()))
+			}
+			test.AssertDiff(t, got, want)
+		})
+	}
+}
+
 func init() {
 	zerolog.SetGlobalLevel(zerolog.Disabled)
 }
@@ -0,0 +1,166 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run
+
+import (
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/hcl"
+	"github.com/terramate-io/terramate/hcl/ast"
+	"github.com/terramate-io/terramate/hcl/eval"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ErrInvalidHookCommand indicates that the command of a run hook has an
+// invalid type.
+const ErrInvalidHookCommand errors.Kind = "invalid run hook command"
+
+// Names of the run hooks.
+const (
+	HookBeforeRun = "before_run"
+	HookAfterRun  = "after_run"
+	HookOnFailure = "on_failure"
+)
+
+// Hooks are the evaluated commands of the run hooks of a stack.
+type Hooks struct {
+	// BeforeRun commands are executed before the commands of the stack.
+	BeforeRun [][]string
+
+	// AfterRun commands are executed after all commands of the stack
+	// succeeded.
+	AfterRun [][]string
+
+	// OnFailure commands are executed when the stack fails.
+	OnFailure [][]string
+}
+
+// Commands returns the commands of the hook with the given name.
+func (h Hooks) Commands(name string) [][]string {
+	switch name {
+	case HookBeforeRun:
+		return h.BeforeRun
+	case HookAfterRun:
+		return h.AfterRun
+	case HookOnFailure:
+		return h.OnFailure
+	}
+	return nil
+}
+
+// LoadHooks loads the run hooks of the given stack.
+// Like `terramate.config.run.env`, hooks can be defined in the stack dir and
+// in any of its parent dirs, and the hook definition closer to the stack has
+// precedence over parent definitions.
+func LoadHooks(root *config.Root, st *config.Stack) (Hooks, error) {
+	defs := map[string]*hcl.RunHook{}
+
+	tree, _ := root.Lookup(st.Dir)
+	for ; tree != nil; tree = tree.Parent {
+		cfg := tree.Node.Terramate
+		if cfg == nil || cfg.Config == nil || cfg.Config.Run == nil {
+			continue
+		}
+		for _, name := range hcl.RunHookNames {
+			if _, ok := defs[name]; ok {
+				continue
+			}
+			if hook := cfg.Config.Run.Hook(name); hook != nil {
+				defs[name] = hook
+			}
+		}
+	}
+
+	var hooks Hooks
+	if len(defs) == 0 {
+		return hooks, nil
+	}
+
+	evalctx, err := stackEvalContext(root, st, nil)
+	if err != nil {
+		return Hooks{}, err
+	}
+
+	errs := errors.L()
+	for name, def := range defs {
+		cmds, err := evalHookCommands(evalctx, def)
+		if err != nil {
+			errs.Append(errors.E(err, "evaluating terramate.config.run.%s", name))
+			continue
+		}
+		switch name {
+		case HookBeforeRun:
+			hooks.BeforeRun = cmds
+		case HookAfterRun:
+			hooks.AfterRun = cmds
+		case HookOnFailure:
+			hooks.OnFailure = cmds
+		}
+	}
+	if err := errs.AsError(); err != nil {
+		return Hooks{}, err
+	}
+	return hooks, nil
+}
+
+func evalHookCommands(evalctx *eval.Context, hook *hcl.RunHook) ([][]string, error) {
+	if hook.Command != nil {
+		val, err := evalctx.Eval(hook.Command.Expr)
+		if err != nil {
+			return nil, errors.E(ErrEval, err)
+		}
+		cmd, err := hookCommand(*hook.Command, val)
+		if err != nil {
+			return nil, err
+		}
+		return [][]string{cmd}, nil
+	}
+
+	val, err := evalctx.Eval(hook.Commands.Expr)
+	if err != nil {
+		return nil, errors.E(ErrEval, err)
+	}
+	if !val.Type().IsTupleType() && !val.Type().IsListType() {
+		return nil, errors.E(ErrInvalidHookCommand, hook.Commands.Range,
+			"commands must be a list of list(string) but got %s", val.Type().FriendlyName())
+	}
+	if val.LengthInt() == 0 {
+		return nil, errors.E(ErrInvalidHookCommand, hook.Commands.Range, "commands must not be empty")
+	}
+
+	var cmds [][]string
+	it := val.ElementIterator()
+	for it.Next() {
+		_, elem := it.Element()
+		cmd, err := hookCommand(*hook.Commands, elem)
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, nil
+}
+
+func hookCommand(attr ast.Attribute, val cty.Value) ([]string, error) {
+	if !val.Type().IsTupleType() && !val.Type().IsListType() {
+		return nil, errors.E(ErrInvalidHookCommand, attr.Range,
+			"command must be a list(string) but got %s", val.Type().FriendlyName())
+	}
+	if val.LengthInt() == 0 {
+		return nil, errors.E(ErrInvalidHookCommand, attr.Range, "command must not be empty")
+	}
+
+	var cmd []string
+	it := val.ElementIterator()
+	for it.Next() {
+		_, elem := it.Element()
+		if elem.Type() != cty.String {
+			return nil, errors.E(ErrInvalidHookCommand, attr.Range,
+				"command must be a list(string) but has element of type %s", elem.Type().FriendlyName())
+		}
+		cmd = append(cmd, elem.AsString())
+	}
+	return cmd, nil
+}
@@ -0,0 +1,247 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test"
+	errorstest "github.com/terramate-io/terramate/test/errors"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestLoadRunHooks(t *testing.T) {
+	t.Parallel()
+
+	type (
+		hclconfig struct {
+			path string
+			body string
+		}
+		result struct {
+			hooks run.Hooks
+			err   error
+		}
+		testcase struct {
+			name    string
+			layout  []string
+			configs []hclconfig
+			want    map[string]result
+		}
+	)
+
+	for _, tc := range []testcase{
+		{
+			name:   "no hooks config",
+			layout: []string{"s:stack"},
+		},
+		{
+			name: "hooks evaluated with globals and stack metadata",
+			layout: []string{
+				"s:stacks/stack-1",
+				"s:stacks/stack-2",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					body: `
+						globals {
+						  tool = "terraform"
+						}
+						terramate {
+						  config {
+						    run {
+						      before_run {
+						        command = [global.tool, "init", terramate.stack.name]
+						      }
+						      after_run {
+						        commands = [
+						          ["echo", "done", terramate.stack.path.absolute],
+						          ["cleanup"],
+						        ]
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: map[string]result{
+				"stacks/stack-1": {
+					hooks: run.Hooks{
+						BeforeRun: [][]string{{"terraform", "init", "stack-1"}},
+						AfterRun: [][]string{
+							{"echo", "done", "/stacks/stack-1"},
+							{"cleanup"},
+						},
+					},
+				},
+				"stacks/stack-2": {
+					hooks: run.Hooks{
+						BeforeRun: [][]string{{"terraform", "init", "stack-2"}},
+						AfterRun: [][]string{
+							{"echo", "done", "/stacks/stack-2"},
+							{"cleanup"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "dirs override parent hooks",
+			layout: []string{
+				"s:stacks/stack-1",
+				"s:other/stack-2",
+			},
+			configs: []hclconfig{
+				{
+					path: "/",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      before_run {
+						        command = ["root"]
+						      }
+						      on_failure {
+						        command = ["notify"]
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+				{
+					path: "/stacks",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      before_run {
+						        command = ["stacks"]
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: map[string]result{
+				"stacks/stack-1": {
+					hooks: run.Hooks{
+						BeforeRun: [][]string{{"stacks"}},
+						OnFailure: [][]string{{"notify"}},
+					},
+				},
+				"other/stack-2": {
+					hooks: run.Hooks{
+						BeforeRun: [][]string{{"root"}},
+						OnFailure: [][]string{{"notify"}},
+					},
+				},
+			},
+		},
+		{
+			name:   "fails if command is not a list of strings",
+			layout: []string{"s:stack"},
+			configs: []hclconfig{
+				{
+					path: "/",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      before_run {
+						        command = ["echo", 1, {}]
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: map[string]result{
+				"stack": {err: errors.E(run.ErrInvalidHookCommand)},
+			},
+		},
+		{
+			name:   "fails if commands is not a list of lists",
+			layout: []string{"s:stack"},
+			configs: []hclconfig{
+				{
+					path: "/",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      after_run {
+						        commands = ["echo", "done"]
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: map[string]result{
+				"stack": {err: errors.E(run.ErrInvalidHookCommand)},
+			},
+		},
+		{
+			name:   "fails evaluating undefined global",
+			layout: []string{"s:stack"},
+			configs: []hclconfig{
+				{
+					path: "/",
+					body: `
+						terramate {
+						  config {
+						    run {
+						      before_run {
+						        command = [global.undefined]
+						      }
+						    }
+						  }
+						}
+					`,
+				},
+			},
+			want: map[string]result{
+				"stack": {err: errors.E(run.ErrEval)},
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := sandbox.NoGit(t, true)
+			s.BuildTree(tc.layout)
+			for _, cfg := range tc.configs {
+				test.AppendFile(t, filepath.Join(s.RootDir(), cfg.path), "run_hooks_test_cfg.tm", cfg.body)
+			}
+
+			root, err := config.LoadRoot(s.RootDir())
+			assert.NoError(t, err)
+
+			for _, stackPath := range root.Stacks() {
+				stack, err := config.LoadStack(root, stackPath)
+				assert.NoError(t, err)
+
+				want := tc.want[stackPath.String()[1:]]
+				got, err := run.LoadHooks(root, stack)
+				errorstest.Assert(t, err, want.err)
+				if err != nil {
+					continue
+				}
+				test.AssertDiff(t, got, want.hooks)
+			}
+		})
+	}
+}
@@ -0,0 +1,356 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/fs"
+)
+
+// JournalFilename is the name of the run-state journal file inside the
+// local state directory.
+const JournalFilename = "run-state.json"
+
+// ErrJournalNotFound indicates there's no run-state journal to resume from.
+const ErrJournalNotFound errors.Kind = "no run-state journal found"
+
+// Kinds of runs recorded in the journal.
+const (
+	JournalKindRun    = "run"
+	JournalKindScript = "script"
+)
+
+// When the root context jobs of scripts are executed, once in the root of the
+// project before or after the stacks.
+const (
+	RootBefore = "before"
+	RootAfter  = "after"
+)
+
+// StackStatus is the execution status of a stack recorded in the journal.
+type StackStatus string
+
+// Stack statuses recorded in the journal.
+const (
+	StackPending  StackStatus = "pending"
+	StackOK       StackStatus = "ok"
+	StackFailed   StackStatus = "failed"
+	StackCanceled StackStatus = "canceled"
+	StackTimedOut StackStatus = "timeout"
+	StackSkipped  StackStatus = "skipped"
+	StackCached   StackStatus = "cached"
+)
+
+type (
+	// Journal is the run-state journal persisted during `terramate run` and
+	// `terramate script run`, so a failed or interrupted run can be resumed.
+	Journal struct {
+		// Kind is the kind of run, see JournalKindRun and JournalKindScript.
+		Kind string `json:"kind"`
+
+		// Command is the command (for `run`) or the script labels (for `script run`).
+		Command []string `json:"command"`
+
+		// Options are the options of the run restored when it's resumed,
+		// opaque to the journal.
+		Options json.RawMessage `json:"options,omitempty"`
+
+		// Params are the parameters of the script of a script run, as
+		// `name=value`.
+		Params []string `json:"params,omitempty"`
+
+		// Redacted tells if sensitive values were redacted from the command,
+		// options or params, then the run cannot be resumed.
+		Redacted bool `json:"redacted,omitempty"`
+
+		// Commit is the git HEAD commit the run started from, if any.
+		Commit string `json:"commit,omitempty"`
+
+		// ConfigDigest is the digest of the Terramate configuration files
+		// of the project, see ConfigDigest.
+		ConfigDigest string `json:"config_digest"`
+
+		// StartedAt is the time the run first started.
+		StartedAt time.Time `json:"started_at"`
+
+		// Stacks are the selected stacks of the run.
+		Stacks []*JournalStack `json:"stacks"`
+
+		// Selected are the paths of all the stacks selected by a script run,
+		// including the ones of scripts with only root context jobs, which
+		// are not executed.
+		Selected []string `json:"selected,omitempty"`
+
+		// Roots are the statuses of the root context jobs of a script run,
+		// by RootBefore and RootAfter.
+		Roots map[string]StackStatus `json:"roots,omitempty"`
+
+		rootdir string
+		mu      sync.Mutex
+	}
+
+	// JournalStack is a stack entry of the journal.
+	JournalStack struct {
+		Path   string      `json:"path"`
+		ID     string      `json:"id,omitempty"`
+		After  []string    `json:"after,omitempty"`
+		Status StackStatus `json:"status"`
+	}
+)
+
+// NewJournal creates a new journal for the project at rootdir.
+// The journal is not persisted until Save is called.
+func NewJournal(rootdir, kind string, command []string) *Journal {
+	return &Journal{
+		Kind:      kind,
+		Command:   command,
+		StartedAt: time.Now().UTC(),
+		rootdir:   rootdir,
+	}
+}
+
+// LoadJournal loads the run-state journal of the project at rootdir.
+// It returns an error of kind ErrJournalNotFound if no journal exists.
+func LoadJournal(rootdir string) (*Journal, error) {
+	data, err := os.ReadFile(filepath.Join(rootdir, StateDirName, JournalFilename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.E(ErrJournalNotFound)
+		}
+		return nil, errors.E(ErrState, err)
+	}
+	j := &Journal{}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, errors.E(ErrState, err, "parsing %s", JournalFilename)
+	}
+	j.rootdir = rootdir
+	return j, nil
+}
+
+// Track adds the stack to the journal, with the given DAG ancestors, or
+// resets its status to pending if it's already present.
+func (j *Journal) Track(path, id string, after []string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	sort.Strings(after)
+	if st, ok := j.lookup(path); ok {
+		st.Status = StackPending
+		st.After = after
+		return
+	}
+	j.Stacks = append(j.Stacks, &JournalStack{
+		Path:   path,
+		ID:     id,
+		After:  after,
+		Status: StackPending,
+	})
+}
+
+// SetStatus updates the status of the stack at path and persists the journal.
+func (j *Journal) SetStatus(path string, status StackStatus) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	st, ok := j.lookup(path)
+	if !ok {
+		return errors.E(errors.ErrInternal, "stack %s is not tracked by the journal", path)
+	}
+	st.Status = status
+	return j.save()
+}
+
+// TrackRoot adds the root context jobs executed at the given time, RootBefore
+// or RootAfter, to the journal, or resets their status to pending if they're
+// already present.
+func (j *Journal) TrackRoot(when string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.Roots == nil {
+		j.Roots = map[string]StackStatus{}
+	}
+	j.Roots[when] = StackPending
+}
+
+// SetRootStatus updates the status of the root context jobs executed at the
+// given time and persists the journal.
+func (j *Journal) SetRootStatus(when string, status StackStatus) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, ok := j.Roots[when]; !ok {
+		return errors.E(errors.ErrInternal, "root jobs %s stacks are not tracked by the journal", when)
+	}
+	j.Roots[when] = status
+	return j.save()
+}
+
+// RootCompleted tells if the root context jobs executed at the given time
+// completed successfully.
+func (j *Journal) RootCompleted(when string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.Roots[when] == StackOK
+}
+
+// Completed tells if the stack at path completed successfully. Stacks skipped
+// by the run cache are complete.
+func (j *Journal) Completed(path string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	st, ok := j.lookup(path)
+	return ok && (st.Status == StackOK || st.Status == StackCached)
+}
+
+// Incomplete returns the paths of the stacks that did not complete
+// successfully. Stacks skipped by the run cache are complete.
+func (j *Journal) Incomplete() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var paths []string
+	for _, st := range j.Stacks {
+		if st.Status != StackOK && st.Status != StackCached {
+			paths = append(paths, st.Path)
+		}
+	}
+	return paths
+}
+
+// Redact redacts the sensitive values of the given maskers from the command,
+// options and params of the journal, so they are not persisted in plain text.
+// If any value is redacted, Redacted is set.
+func (j *Journal) Redact(maskers ...*Masker) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var options any
+	if len(j.Options) > 0 {
+		if err := json.Unmarshal(j.Options, &options); err != nil {
+			return errors.E(ErrState, err, "parsing options")
+		}
+	}
+	command, params, maskedOptions := j.Command, j.Params, options
+	for _, masker := range maskers {
+		command = masker.MaskArgs(command)
+		params = masker.MaskArgs(params)
+		maskedOptions = maskJSON(masker, maskedOptions)
+	}
+	if slices.Equal(command, j.Command) && slices.Equal(params, j.Params) &&
+		reflect.DeepEqual(maskedOptions, options) {
+		return nil
+	}
+
+	if options != nil {
+		data, err := json.Marshal(maskedOptions)
+		if err != nil {
+			return errors.E(ErrState, err)
+		}
+		j.Options = data
+	}
+	j.Command, j.Params = command, params
+	j.Redacted = true
+	return nil
+}
+
+// maskJSON redacts the sensitive values from the strings of the decoded JSON
+// value.
+func maskJSON(masker *Masker, val any) any {
+	switch v := val.(type) {
+	case string:
+		return string(masker.Mask([]byte(v)))
+	case []any:
+		masked := make([]any, len(v))
+		for i, elem := range v {
+			masked[i] = maskJSON(masker, elem)
+		}
+		return masked
+	case map[string]any:
+		masked := make(map[string]any, len(v))
+		for key, elem := range v {
+			masked[key] = maskJSON(masker, elem)
+		}
+		return masked
+	}
+	return val
+}
+
+// Save persists the journal in the local state directory.
+func (j *Journal) Save() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.save()
+}
+
+func (j *Journal) save() error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return errors.E(ErrState, err)
+	}
+	return writeStateFile(j.rootdir, JournalFilename, data)
+}
+
+func (j *Journal) lookup(path string) (*JournalStack, bool) {
+	for _, st := range j.Stacks {
+		if st.Path == path {
+			return st, true
+		}
+	}
+	return nil, false
+}
+
+// ConfigDigest computes a digest of all Terramate configuration files (.tm
+// and .tm.hcl) of the project at rootdir. Any change to these files changes
+// the digest. Other files read by the run engine, as the dotenv files of
+// env_file and the watch files of stacks, are not part of the digest: their
+// changes are only detected when committed, as the HEAD commit of the run is
+// also checked.
+func ConfigDigest(rootdir string) (string, error) {
+	h := sha256.New()
+	err := digestDir(h, rootdir, rootdir)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func digestDir(w io.Writer, rootdir, dir string) error {
+	res, err := fs.ListTerramateFiles(dir)
+	if err != nil {
+		return err
+	}
+	for _, fname := range res.TmFiles {
+		abspath := filepath.Join(dir, fname)
+		data, err := os.ReadFile(abspath)
+		if err != nil {
+			return errors.E(err, "reading %s", abspath)
+		}
+		relpath, _ := filepath.Rel(rootdir, abspath)
+		_, _ = io.WriteString(w, filepath.ToSlash(relpath))
+		_, _ = w.Write([]byte{0})
+		_, _ = w.Write(data)
+		_, _ = w.Write([]byte{0})
+	}
+	for _, subdir := range res.Dirs {
+		if err := digestDir(w, rootdir, filepath.Join(dir, subdir)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
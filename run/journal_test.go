@@ -0,0 +1,127 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run_test
+
+import (
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestJournalSaveAndLoad(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		"s:s1",
+		"s:s2",
+		"s:s3",
+	})
+
+	_, err := run.LoadJournal(s.RootDir())
+	assert.IsTrue(t, errors.IsKind(err, run.ErrJournalNotFound))
+
+	j := run.NewJournal(s.RootDir(), run.JournalKindRun, []string{"terraform", "apply"})
+	j.Track("/s1", "", nil)
+	j.Track("/s2", "", []string{"/s1"})
+	j.Track("/s3", "", nil)
+	assert.NoError(t, j.Save())
+	assert.NoError(t, j.SetStatus("/s1", run.StackOK))
+	assert.NoError(t, j.SetStatus("/s2", run.StackFailed))
+	assert.NoError(t, j.SetStatus("/s3", run.StackCanceled))
+	assert.Error(t, j.SetStatus("/s4", run.StackOK))
+
+	got, err := run.LoadJournal(s.RootDir())
+	assert.NoError(t, err)
+	assert.EqualStrings(t, run.JournalKindRun, got.Kind)
+	assert.EqualInts(t, 2, len(got.Command))
+	assert.EqualInts(t, 2, len(got.Incomplete()))
+	assert.EqualStrings(t, "/s2", got.Incomplete()[0])
+	assert.EqualStrings(t, "/s3", got.Incomplete()[1])
+
+	got.Track("/s2", "", []string{"/s1"})
+	assert.NoError(t, got.SetStatus("/s2", run.StackOK))
+	assert.EqualInts(t, 1, len(got.Incomplete()))
+	assert.EqualInts(t, 3, len(got.Stacks))
+}
+
+func TestJournalRoots(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{"s:s1"})
+
+	j := run.NewJournal(s.RootDir(), run.JournalKindScript, []string{"deploy"})
+	j.Selected = []string{"/s1"}
+	j.Track("/s1", "", nil)
+	j.TrackRoot(run.RootBefore)
+	j.TrackRoot(run.RootAfter)
+	assert.NoError(t, j.Save())
+	assert.NoError(t, j.SetRootStatus(run.RootBefore, run.StackOK))
+	assert.NoError(t, j.SetStatus("/s1", run.StackOK))
+	assert.NoError(t, j.SetRootStatus(run.RootAfter, run.StackFailed))
+
+	got, err := run.LoadJournal(s.RootDir())
+	assert.NoError(t, err)
+	assert.EqualInts(t, 1, len(got.Selected))
+	assert.IsTrue(t, got.Completed("/s1"))
+	assert.IsTrue(t, !got.Completed("/s2"))
+	assert.IsTrue(t, got.RootCompleted(run.RootBefore))
+	assert.IsTrue(t, !got.RootCompleted(run.RootAfter))
+
+	got.TrackRoot(run.RootAfter)
+	assert.IsTrue(t, !got.RootCompleted(run.RootAfter))
+	assert.NoError(t, got.SetRootStatus(run.RootAfter, run.StackOK))
+	assert.IsTrue(t, got.RootCompleted(run.RootAfter))
+
+	fresh := run.NewJournal(s.RootDir(), run.JournalKindScript, []string{"deploy"})
+	assert.Error(t, fresh.SetRootStatus(run.RootBefore, run.StackOK))
+}
+
+func TestJournalRedact(t *testing.T) {
+	t.Parallel()
+
+	masker, err := run.NewMasker([]string{"secret-token"}, nil)
+	assert.NoError(t, err)
+
+	j := run.NewJournal(t.TempDir(), run.JournalKindScript, []string{"deploy"})
+	j.Options = []byte(`{"parallel":2,"target":"prod"}`)
+	j.Params = []string{"region=eu-west-1"}
+	assert.NoError(t, j.Redact(masker, nil))
+	assert.IsTrue(t, !j.Redacted)
+	assert.EqualStrings(t, `{"parallel":2,"target":"prod"}`, string(j.Options))
+
+	j.Options = []byte(`{"parallel":2,"target":"secret-token"}`)
+	j.Params = []string{"token=secret-token"}
+	assert.NoError(t, j.Redact(masker, nil))
+	assert.IsTrue(t, j.Redacted)
+	assert.EqualStrings(t, `{"parallel":2,"target":"***"}`, string(j.Options))
+	assert.EqualStrings(t, "token=***", j.Params[0])
+}
+
+func TestJournalConfigDigest(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		"s:s1",
+		"f:s1/main.tf:# not a config file",
+	})
+
+	digest, err := run.ConfigDigest(s.RootDir())
+	assert.NoError(t, err)
+
+	s.RootEntry().CreateFile("s1/main.tf", "# changed")
+	same, err := run.ConfigDigest(s.RootDir())
+	assert.NoError(t, err)
+	assert.EqualStrings(t, digest, same)
+
+	s.RootEntry().CreateFile("s1/globals.tm", "globals {\n  a = 1\n}\n")
+	changed, err := run.ConfigDigest(s.RootDir())
+	assert.NoError(t, err)
+	assert.IsTrue(t, digest != changed)
+}
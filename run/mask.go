@@ -0,0 +1,283 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/globals"
+	"github.com/terramate-io/terramate/hcl"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// ErrSensitive indicates that an error happened while loading the sensitive
+// values of terramate.config.run.sensitive.
+const ErrSensitive errors.Kind = "loading terramate.config.run.sensitive values"
+
+// Redacted replaces the sensitive values in the output of commands.
+const Redacted = "***"
+
+// MinSensitiveLength is the minimum length of the sensitive values not
+// warned about. Shorter values, like numbers or booleans, are still redacted
+// but would redact unrelated text all over the output.
+const MinSensitiveLength = 6
+
+// Masker redacts sensitive values from the output of commands.
+type Masker struct {
+	values   [][]byte
+	patterns []*regexp.Regexp
+}
+
+// NewMasker creates a masker redacting the given values and the text matching
+// the given regular expressions. Multi-line values are redacted line by line
+// and empty values are ignored.
+func NewMasker(values []string, patterns []string) (*Masker, error) {
+	m := &Masker{}
+	seen := map[string]struct{}{}
+	for _, value := range values {
+		for _, line := range strings.Split(value, "\n") {
+			line = strings.TrimSuffix(line, "\r")
+			if _, ok := seen[line]; ok || line == "" {
+				continue
+			}
+			seen[line] = struct{}{}
+			m.values = append(m.values, []byte(line))
+		}
+	}
+
+	// Longer values first, then values containing others are fully redacted.
+	sort.Slice(m.values, func(i, j int) bool {
+		return len(m.values[i]) > len(m.values[j])
+	})
+
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.E(ErrSensitive, err, "compiling pattern %q", pattern)
+		}
+		m.patterns = append(m.patterns, re)
+	}
+	return m, nil
+}
+
+// Mask returns the data with the sensitive values redacted. A nil Masker
+// returns the data unchanged.
+func (m *Masker) Mask(data []byte) []byte {
+	if m == nil {
+		return data
+	}
+	for _, value := range m.values {
+		data = bytes.ReplaceAll(data, value, []byte(Redacted))
+	}
+	for _, re := range m.patterns {
+		data = re.ReplaceAllLiteral(data, []byte(Redacted))
+	}
+	return data
+}
+
+// MaskArgs returns a copy of the arguments of a command with the sensitive
+// values redacted. A nil Masker returns the arguments unchanged.
+func (m *Masker) MaskArgs(args []string) []string {
+	if m == nil {
+		return args
+	}
+	masked := make([]string, len(args))
+	for i, arg := range args {
+		masked[i] = string(m.Mask([]byte(arg)))
+	}
+	return masked
+}
+
+// Writer returns a writer redacting the sensitive values of the data written
+// to w. The end of the data that may be the beginning of a sensitive value is
+// buffered, then values split across writes are also redacted. The patterns
+// are matched in the data written at once, which holds whole lines unless the
+// command writes a line in parts. Flush must be called after the last write.
+func (m *Masker) Writer(w io.Writer) *MaskWriter {
+	return &MaskWriter{masker: m, w: w}
+}
+
+// MaskWriter is a writer redacting sensitive values.
+// It's safe to be used concurrently.
+type MaskWriter struct {
+	masker *Masker
+	w      io.Writer
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// Write writes the data, masked, to the underlying writer. Only the end of
+// the data that may be completed into a sensitive value by the next writes is
+// kept buffered, which is never longer than the longest value.
+func (w *MaskWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+
+	n := w.masker.safeEnd(w.buf)
+	if n == 0 {
+		return len(p), nil
+	}
+
+	_, err := w.w.Write(w.masker.Mask(w.buf[:n]))
+	w.buf = append(w.buf[:0], w.buf[n:]...)
+	return len(p), err
+}
+
+// safeEnd returns the end of the data that can be masked and written: the
+// data after it may be the beginning of a sensitive value, completed by the
+// next writes. The values don't span lines, then the end is never before the
+// last newline of the data.
+func (m *Masker) safeEnd(data []byte) int {
+	end := len(data)
+	for _, value := range m.values {
+		for i := max(0, len(data)-len(value)+1); i < end; i++ {
+			if bytes.HasPrefix(value, data[i:]) {
+				end = i
+				break
+			}
+		}
+	}
+	return end
+}
+
+// Flush writes the buffered incomplete line, masked, to the underlying writer.
+func (w *MaskWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := w.w.Write(w.masker.Mask(w.buf))
+	w.buf = w.buf[:0]
+	return err
+}
+
+// LoadMasker creates the masker of the given stack from the
+// terramate.config.run.sensitive configuration. The values of the sensitive
+// env vars are looked up in the given environments of the commands, one for
+// each matrix variant of the stack. The stack is nil for the commands executed
+// in the root of the project, which use the globals of the root.
+// It returns nil if no sensitive configuration is given.
+func LoadMasker(root *config.Root, st *config.Stack, cfg *hcl.RunSensitive, environs ...[]string) (*Masker, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	logger := log.With().
+		Str("action", "run.LoadMasker()").
+		Logger()
+	if st != nil {
+		logger = logger.With().
+			Stringer("stack", st.Dir).
+			Logger()
+	}
+
+	var values []string
+	addValue := func(value, source string) {
+		if value != "" && len(value) < MinSensitiveLength {
+			logger.Warn().Msgf(
+				"the value of %s is shorter than %d characters: it's redacted but unrelated text matching it is also redacted",
+				source, MinSensitiveLength)
+		}
+		values = append(values, value)
+	}
+
+	for _, name := range cfg.Env {
+		for _, environ := range environs {
+			if value, ok := getEnv(name, environ); ok {
+				addValue(value, "env "+name)
+			}
+		}
+	}
+
+	if len(cfg.Globals) > 0 {
+		var report globals.EvalReport
+		if st != nil {
+			report = globals.ForStack(root, st)
+		} else {
+			report = rootGlobals(root)
+		}
+		if err := report.AsError(); err != nil {
+			return nil, errors.E(ErrLoadingGlobals, err)
+		}
+		globalValues := report.Globals.AsValueMap()
+		for _, name := range cfg.Globals {
+			path := strings.Split(name, ".")
+			val, ok := globalValues[path[0]]
+			for _, key := range path[1:] {
+				if !ok {
+					break
+				}
+				val, ok = lookupAttr(val, key)
+			}
+			if !ok {
+				continue
+			}
+			for _, leaf := range primitiveLeaves(val) {
+				addValue(leaf, "global."+name)
+			}
+		}
+	}
+
+	return NewMasker(values, cfg.Patterns)
+}
+
+func lookupAttr(val cty.Value, key string) (cty.Value, bool) {
+	if val.IsNull() || !val.IsKnown() {
+		return cty.NilVal, false
+	}
+	typ := val.Type()
+	switch {
+	case typ.IsObjectType():
+		if !typ.HasAttribute(key) {
+			return cty.NilVal, false
+		}
+		return val.GetAttr(key), true
+	case typ.IsMapType():
+		k := cty.StringVal(key)
+		if !val.HasIndex(k).True() {
+			return cty.NilVal, false
+		}
+		return val.Index(k), true
+	}
+	return cty.NilVal, false
+}
+
+// primitiveLeaves returns all primitive values nested in the given value,
+// with numbers and booleans converted to strings.
+func primitiveLeaves(val cty.Value) []string {
+	if val.IsNull() || !val.IsKnown() {
+		return nil
+	}
+	if val.Type().IsPrimitiveType() {
+		str, err := convert.Convert(val, cty.String)
+		if err != nil {
+			return nil
+		}
+		return []string{str.AsString()}
+	}
+	if !val.CanIterateElements() {
+		return nil
+	}
+	var leaves []string
+	for it := val.ElementIterator(); it.Next(); {
+		_, elem := it.Element()
+		leaves = append(leaves, primitiveLeaves(elem)...)
+	}
+	return leaves
+}
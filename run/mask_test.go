@@ -0,0 +1,141 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/hcl"
+	"github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestMaskerMask(t *testing.T) {
+	t.Parallel()
+
+	masker, err := run.NewMasker(
+		[]string{"secret", "secretive", "", "multi\nline"},
+		[]string{`ghp_[a-z0-9]+`},
+	)
+	assert.NoError(t, err)
+
+	got := masker.Mask([]byte("secretive secret multi line ghp_abc123 public\nline\n"))
+	assert.EqualStrings(t, "*** *** *** *** *** public\n***\n", string(got))
+}
+
+func TestMaskWriterBuffersPossibleValues(t *testing.T) {
+	t.Parallel()
+
+	masker, err := run.NewMasker([]string{"secret"}, []string{`ghp_[a-z0-9]+`, `key=[a-z]+!`})
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	w := masker.Writer(&out)
+
+	for _, tc := range []struct {
+		chunk string
+		want  string
+	}{
+		// Output not ending in a newline is written if it can't be the
+		// beginning of a sensitive value.
+		{chunk: "Enter a value: ", want: "Enter a value: "},
+		{chunk: "progress 1\r", want: "Enter a value: progress 1\r"},
+		{chunk: "the sec", want: "Enter a value: progress 1\rthe "},
+		{chunk: "ret is\nhere: se", want: "Enter a value: progress 1\rthe *** is\nhere: "},
+		{chunk: "cret ghp_abc123 key=ab! done", want: "Enter a value: progress 1\rthe *** is\nhere: *** *** *** done"},
+	} {
+		_, err := w.Write([]byte(tc.chunk))
+		assert.NoError(t, err)
+		assert.EqualStrings(t, tc.want, out.String(), "after writing %q", tc.chunk)
+	}
+
+	_, err = w.Write([]byte(" sec"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Flush())
+	assert.EqualStrings(t, "Enter a value: progress 1\rthe *** is\nhere: *** *** *** done sec", out.String())
+}
+
+func TestMaskWriterLongLines(t *testing.T) {
+	t.Parallel()
+
+	masker, err := run.NewMasker([]string{"secret"}, []string{`password=.*`})
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	w := masker.Writer(&out)
+
+	// Long lines are written as they come, keeping buffered only the end
+	// that may be the beginning of a value.
+	padding := strings.Repeat("x", 64*1024)
+	for _, tc := range []struct {
+		chunk string
+		want  string
+	}{
+		{chunk: padding + "sec", want: padding},
+		{chunk: "ret password=abc", want: padding + "*** ***"},
+		{chunk: " " + padding + "\n", want: padding + "*** ***" + " " + padding + "\n"},
+	} {
+		_, err := w.Write([]byte(tc.chunk))
+		assert.NoError(t, err)
+		assert.EqualInts(t, len(tc.want), out.Len())
+		assert.IsTrue(t, out.String() == tc.want, "unexpected output after writing %d bytes", len(tc.chunk))
+	}
+	assert.NoError(t, w.Flush())
+}
+
+func TestLoadMasker(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		"s:stack",
+		`f:globals.tm:
+		globals {
+		  secrets = {
+		    db_password = "db-pass"
+		    keys        = ["key-one", "key-two"]
+		    pin         = 987654321
+		  }
+		  public = "public-value"
+		  short  = "abc"
+		  flag   = true
+		}`,
+	})
+
+	root, err := config.LoadRoot(s.RootDir())
+	assert.NoError(t, err)
+	st, err := config.LoadStack(root, root.Stacks()[0])
+	assert.NoError(t, err)
+
+	masker, err := run.LoadMasker(root, st, nil, nil)
+	assert.NoError(t, err)
+	assert.IsTrue(t, masker == nil)
+
+	masker, err = run.LoadMasker(root, st, &hcl.RunSensitive{
+		Env:     []string{"TOKEN", "UNDEFINED"},
+		Globals: []string{"secrets", "undefined.value"},
+	}, []string{"TOKEN=env-token", "OTHER=other"})
+	assert.NoError(t, err)
+
+	got := masker.Mask([]byte("env-token other db-pass key-one key-two 987654321 public-value"))
+	assert.EqualStrings(t, "*** other *** *** *** *** public-value", string(got))
+
+	// Short values are redacted, with a warning.
+	for _, tc := range []struct {
+		cfg   *hcl.RunSensitive
+		value string
+	}{
+		{cfg: &hcl.RunSensitive{Globals: []string{"short"}}, value: "abc"},
+		{cfg: &hcl.RunSensitive{Globals: []string{"flag"}}, value: "true"},
+		{cfg: &hcl.RunSensitive{Env: []string{"OTHER"}}, value: "other"},
+	} {
+		masker, err := run.LoadMasker(root, st, tc.cfg, []string{"OTHER=other"})
+		assert.NoError(t, err)
+		assert.EqualStrings(t, "*** public", string(masker.Mask([]byte(tc.value+" public"))))
+	}
+}
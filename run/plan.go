@@ -0,0 +1,146 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/terramate-io/terramate/errors"
+)
+
+// ErrPlan indicates an error writing the execution plan.
+const ErrPlan errors.Kind = "execution plan error"
+
+type (
+	// Plan is the machine-readable execution plan of a `terramate run` or
+	// `terramate script run` executed with --dry-run.
+	Plan struct {
+		// Kind is the kind of run, see JournalKindRun and JournalKindScript.
+		Kind string `json:"kind"`
+
+		// Stacks are the stacks of the run, in execution order.
+		Stacks []StackPlan `json:"stacks"`
+	}
+
+	// StackPlan is the execution plan of a single stack.
+	StackPlan struct {
+		Path string `json:"path"`
+		ID   string `json:"id,omitempty"`
+
+		// Root is RootBefore or RootAfter for the plan of the root context
+		// jobs of scripts, executed once in the root of the project before
+		// or after the stacks.
+		Root string `json:"root,omitempty"`
+
+		// Order is the 1-based position of the stack in the execution order.
+		// The root context jobs executed before the stacks have order zero
+		// and the ones executed after them follow the last stack.
+		Order int `json:"order"`
+
+		// After are the paths of the stacks that must finish before this one.
+		After []string `json:"after,omitempty"`
+
+		// Env are the names of the environment variables defined by
+		// terramate.config.run.env for the stack. Values are omitted as they
+		// may be sensitive.
+		Env []string `json:"env,omitempty"`
+
+		// Hooks are the commands of the run hooks of the stack, by hook name.
+		Hooks map[string][][]string `json:"hooks,omitempty"`
+
+		// Tasks are the commands to be executed in the stack, in order.
+		Tasks []TaskPlan `json:"tasks"`
+	}
+
+	// TaskPlan is the execution plan of a single command of a stack.
+	TaskPlan struct {
+		// Cmd is the command, with its arguments already evaluated.
+		Cmd []string `json:"command"`
+
+		// Matrix are the values of the matrix variables of the command, if
+		// it's executed for a matrix.
+		Matrix map[string]string `json:"matrix,omitempty"`
+
+		// Env are the names of the environment variables of the matrix
+		// variant of the command, if it's executed for a matrix. Values are
+		// omitted as they may be sensitive.
+		Env []string `json:"env,omitempty"`
+
+		// ScriptJob and ScriptCommand are the 1-based indexes of the job and
+		// of the command in the job, for script runs.
+		ScriptJob     int `json:"script_job,omitempty"`
+		ScriptCommand int `json:"script_command,omitempty"`
+
+		// ScriptJobName is the name of the script job, if any.
+		ScriptJobName string `json:"script_job_name,omitempty"`
+
+		// ScriptJobKind is "on_failure" or "finally" for the jobs executed
+		// after the other jobs of the script, whose ScriptJob indexes are
+		// relative to the jobs of the same kind.
+		ScriptJobKind string `json:"script_job_kind,omitempty"`
+
+		// ScriptJobDependsOn are the 1-based indexes of the jobs that must
+		// finish before the job of the command starts.
+		ScriptJobDependsOn []int `json:"script_job_depends_on,omitempty"`
+
+		// ScriptEnv are the names of the environment variables set by the
+		// env blocks of the script and of the job of the command, and
+		// ScriptUnsetEnv the names of the variables they unset.
+		ScriptEnv      []string `json:"script_env,omitempty"`
+		ScriptUnsetEnv []string `json:"script_unset_env,omitempty"`
+
+		// Skipped tells if the script job is skipped by its condition, in
+		// which case there's no command.
+		Skipped bool `json:"skipped,omitempty"`
+
+		// Timeout is the maximum execution time of the command in seconds,
+		// zero means no timeout.
+		Timeout float64 `json:"timeout_seconds,omitempty"`
+
+		// MaxAttempts is the maximum number of executions of the command,
+		// if it's retried on failures.
+		MaxAttempts int `json:"max_attempts,omitempty"`
+
+		CloudSync *CloudSyncPlan `json:"cloud_sync,omitempty"`
+		Sharing   *SharingPlan   `json:"sharing,omitempty"`
+	}
+
+	// CloudSyncPlan are the Terramate Cloud synchronization options of a
+	// command.
+	CloudSyncPlan struct {
+		Deployment      bool   `json:"deployment,omitempty"`
+		DriftStatus     bool   `json:"drift_status,omitempty"`
+		Preview         bool   `json:"preview,omitempty"`
+		Target          string `json:"target,omitempty"`
+		FromTarget      string `json:"from_target,omitempty"`
+		Layer           string `json:"layer,omitempty"`
+		PlanFile        string `json:"plan_file,omitempty"`
+		PlanProvisioner string `json:"plan_provisioner,omitempty"`
+	}
+
+	// SharingPlan are the outputs sharing options of a command.
+	SharingPlan struct {
+		MockOnFail bool        `json:"mock_on_fail,omitempty"`
+		Inputs     []InputPlan `json:"inputs,omitempty"`
+	}
+
+	// InputPlan is an input of a stack, read from the outputs of another
+	// stack before the command is executed.
+	InputPlan struct {
+		Name        string `json:"name"`
+		Backend     string `json:"backend"`
+		FromStackID string `json:"from_stack_id"`
+	}
+)
+
+// WriteJSON writes the plan as JSON.
+func (p *Plan) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(p); err != nil {
+		return errors.E(ErrPlan, err, "encoding JSON plan")
+	}
+	return nil
+}
@@ -0,0 +1,382 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/terramate-io/terramate/errors"
+)
+
+// ErrReport indicates an error writing the run report.
+const ErrReport errors.Kind = "run report error"
+
+type (
+	// Report is the machine-readable report of a `terramate run` or
+	// `terramate script run` execution.
+	Report struct {
+		// Kind is the kind of run, see JournalKindRun and JournalKindScript.
+		Kind string `json:"kind"`
+
+		StartedAt  time.Time `json:"started_at"`
+		FinishedAt time.Time `json:"finished_at"`
+
+		// Duration is the duration of the whole run in seconds.
+		Duration float64 `json:"duration_seconds"`
+
+		// Stacks are the stacks of the run, in the order they finished.
+		Stacks []StackReport `json:"stacks"`
+	}
+
+	// StackReport is the report of a single stack of the run.
+	StackReport struct {
+		Path string `json:"path"`
+		ID   string `json:"id,omitempty"`
+
+		// Root is RootBefore or RootAfter for the report of the root context
+		// jobs of scripts, executed once in the root of the project before
+		// or after the stacks.
+		Root string `json:"root,omitempty"`
+
+		// Cmds are the commands executed (or to be executed) in the stack.
+		Cmds [][]string `json:"commands"`
+
+		Status StackStatus `json:"status"`
+
+		// Reason gives details about a non-successful status.
+		Reason string `json:"reason,omitempty"`
+
+		// ExitCode is the exit code of the last executed command, if any
+		// command was executed.
+		ExitCode *int `json:"exit_code,omitempty"`
+
+		StartedAt  *time.Time `json:"started_at,omitempty"`
+		FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+		// Duration is the execution time of the stack in seconds.
+		Duration float64 `json:"duration_seconds"`
+
+		// Order is the 1-based position of the stack in the planned execution
+		// order. The root context jobs executed before the stacks have order
+		// zero and the ones executed after them follow the last stack.
+		Order int `json:"order"`
+
+		// After are the paths of the stacks that must finish before this one.
+		After []string `json:"after,omitempty"`
+
+		// Hooks are the run hooks executed in the stack, in execution order.
+		Hooks []HookReport `json:"hooks,omitempty"`
+
+		// Variants are the reports of each matrix variant of the commands,
+		// in execution order, if the commands are executed for a matrix.
+		Variants []VariantReport `json:"variants,omitempty"`
+
+		// Jobs are the reports of each script job of the stack, in
+		// declaration order. They are only set for script runs.
+		Jobs []JobReport `json:"jobs,omitempty"`
+
+		// Attempts are the reports of each attempt of the commands executed
+		// with a retry policy, in execution order.
+		Attempts []AttemptReport `json:"attempts,omitempty"`
+	}
+
+	// AttemptReport is the report of an attempt of a command executed with a
+	// retry policy.
+	AttemptReport struct {
+		Cmd []string `json:"command"`
+
+		// Attempt is the 1-based number of the attempt.
+		Attempt int `json:"attempt"`
+
+		// ExitCode is the exit code of the command, if it was executed and
+		// not killed.
+		ExitCode *int `json:"exit_code,omitempty"`
+
+		StartedAt  time.Time `json:"started_at"`
+		FinishedAt time.Time `json:"finished_at"`
+
+		// Duration is the execution time of the attempt in seconds.
+		Duration float64 `json:"duration_seconds"`
+
+		// StdoutLog and StderrLog are the paths of the log files of the
+		// attempt, if the logs are written with --log-dir.
+		StdoutLog string `json:"stdout_log,omitempty"`
+		StderrLog string `json:"stderr_log,omitempty"`
+	}
+
+	// JobReport is the report of a script job executed in a stack.
+	JobReport struct {
+		// Name is the name of the job, if any.
+		Name string `json:"name,omitempty"`
+
+		// Kind is the kind of the job, "on_failure" or "finally" for the jobs
+		// executed after the other jobs of the script.
+		Kind string `json:"kind,omitempty"`
+
+		// Index is the 1-based position of the job in the script, among the
+		// jobs of the same kind.
+		Index int `json:"index"`
+
+		// Variant is the name of the matrix variant of the job, if any.
+		Variant string `json:"variant,omitempty"`
+
+		Status StackStatus `json:"status"`
+		Reason string      `json:"reason,omitempty"`
+
+		// ExitCode is the exit code of the last executed command of the job,
+		// if any command was executed.
+		ExitCode *int `json:"exit_code,omitempty"`
+
+		StartedAt  *time.Time `json:"started_at,omitempty"`
+		FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+		// Duration is the execution time of the job in seconds.
+		Duration float64 `json:"duration_seconds"`
+	}
+
+	// VariantReport is the report of a matrix variant of the commands of a
+	// stack.
+	VariantReport struct {
+		// Name identifies the variant, in the format name1=value1,name2=value2.
+		Name string `json:"name"`
+
+		// Matrix are the values of the matrix variables of the variant.
+		Matrix map[string]string `json:"matrix"`
+
+		Status StackStatus `json:"status"`
+		Reason string      `json:"reason,omitempty"`
+
+		// ExitCode is the exit code of the last executed command of the
+		// variant, if any command was executed.
+		ExitCode *int `json:"exit_code,omitempty"`
+
+		StartedAt  *time.Time `json:"started_at,omitempty"`
+		FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+		// Duration is the execution time of the variant in seconds.
+		Duration float64 `json:"duration_seconds"`
+	}
+
+	// HookReport is the report of a run hook executed in a stack.
+	HookReport struct {
+		// Name is the name of the hook, see HookBeforeRun, HookAfterRun and
+		// HookOnFailure.
+		Name string `json:"name"`
+
+		// Cmds are the commands of the hook. The commands after a failed one
+		// are not executed.
+		Cmds [][]string `json:"commands"`
+
+		// Status is either StackOK or StackFailed.
+		Status StackStatus `json:"status"`
+
+		// ExitCode is the exit code of the last executed command, if any
+		// command was executed.
+		ExitCode *int `json:"exit_code,omitempty"`
+	}
+)
+
+// Reason describes the failure of the hook.
+func (h HookReport) Reason() string {
+	if h.ExitCode != nil && *h.ExitCode > 0 {
+		return fmt.Sprintf("%s hook exit code %d", h.Name, *h.ExitCode)
+	}
+	return h.Name + " hook failed"
+}
+
+// Name identifies the stack in the run summary and in the JUnit report. The
+// root context jobs are named after when they are executed.
+func (s StackReport) Name() string {
+	if s.Root != "" {
+		return "root jobs " + s.Root + " stacks"
+	}
+	return s.Path
+}
+
+// SetTimes sets the start and finish time of the stack execution.
+func (s *StackReport) SetTimes(startedAt, finishedAt time.Time) {
+	s.StartedAt = &startedAt
+	s.FinishedAt = &finishedAt
+	s.Duration = finishedAt.Sub(startedAt).Seconds()
+}
+
+// SetTimes sets the start and finish time of the variant execution.
+func (v *VariantReport) SetTimes(startedAt, finishedAt time.Time) {
+	v.StartedAt = &startedAt
+	v.FinishedAt = &finishedAt
+	v.Duration = finishedAt.Sub(startedAt).Seconds()
+}
+
+// SetTimes sets the start and finish time of the job execution.
+func (j *JobReport) SetTimes(startedAt, finishedAt time.Time) {
+	j.StartedAt = &startedAt
+	j.FinishedAt = &finishedAt
+	j.Duration = finishedAt.Sub(startedAt).Seconds()
+}
+
+// Finish sets the finish time of the whole run.
+func (r *Report) Finish(finishedAt time.Time) {
+	r.FinishedAt = finishedAt
+	r.Duration = finishedAt.Sub(r.StartedAt).Seconds()
+}
+
+// WriteJSON writes the report as JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return errors.E(ErrReport, err, "encoding JSON report")
+	}
+	return nil
+}
+
+// WriteJUnit writes the report in the JUnit XML format. Each stack is a test
+// case, failed and timed out stacks are failures and canceled, skipped and
+// cached stacks are skipped. Stacks executed for a matrix have a test case
+// for each variant.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	name := "terramate " + r.Kind
+	suite := junitTestSuite{
+		Name:      name,
+		Time:      junitTime(r.Duration),
+		Timestamp: r.StartedAt.Format(time.RFC3339),
+	}
+	addTestCase := func(tc junitTestCase, status StackStatus, reason string) {
+		message := string(status)
+		if reason != "" {
+			message += ": " + reason
+		}
+		switch status {
+		case StackFailed, StackTimedOut:
+			suite.Failures++
+			tc.Failure = &junitResult{Type: string(status), Message: message}
+		case StackCanceled, StackSkipped, StackCached:
+			suite.Skipped++
+			tc.Skipped = &junitResult{Type: string(status), Message: message}
+		}
+		suite.Tests++
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+
+	for _, st := range r.Stacks {
+		if len(st.Variants) > 0 {
+			for _, variant := range st.Variants {
+				addTestCase(junitTestCase{
+					Name:      st.Name() + " [" + variant.Name + "]",
+					ClassName: name,
+					Time:      junitTime(variant.Duration),
+				}, variant.Status, variant.Reason)
+			}
+			continue
+		}
+
+		tc := junitTestCase{
+			Name:      st.Name(),
+			ClassName: name,
+			Time:      junitTime(st.Duration),
+		}
+
+		var cmds []string
+		for _, cmd := range st.Cmds {
+			cmds = append(cmds, strings.Join(cmd, " "))
+		}
+		if len(cmds) > 0 {
+			tc.SystemOut = strings.Join(cmds, "\n")
+		}
+		addTestCase(tc, st.Status, st.Reason)
+	}
+
+	suites := junitTestSuites{
+		Name:     name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return errors.E(ErrReport, err, "writing JUnit report")
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return errors.E(ErrReport, err, "encoding JUnit report")
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return errors.E(ErrReport, err, "writing JUnit report")
+	}
+	return nil
+}
+
+// SaveJSON writes the report as JSON to the given file.
+func (r *Report) SaveJSON(path string) error {
+	return saveReport(path, r.WriteJSON)
+}
+
+// SaveJUnit writes the report in the JUnit XML format to the given file.
+func (r *Report) SaveJUnit(path string) error {
+	return saveReport(path, r.WriteJUnit)
+}
+
+func saveReport(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.E(ErrReport, err, "creating report file")
+	}
+	if err := write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return errors.E(ErrReport, err, "closing report file")
+	}
+	return nil
+}
+
+type (
+	junitTestSuites struct {
+		XMLName  xml.Name         `xml:"testsuites"`
+		Name     string           `xml:"name,attr"`
+		Tests    int              `xml:"tests,attr"`
+		Failures int              `xml:"failures,attr"`
+		Skipped  int              `xml:"skipped,attr"`
+		Time     string           `xml:"time,attr"`
+		Suites   []junitTestSuite `xml:"testsuite"`
+	}
+
+	junitTestSuite struct {
+		Name      string          `xml:"name,attr"`
+		Tests     int             `xml:"tests,attr"`
+		Failures  int             `xml:"failures,attr"`
+		Skipped   int             `xml:"skipped,attr"`
+		Time      string          `xml:"time,attr"`
+		Timestamp string          `xml:"timestamp,attr"`
+		TestCases []junitTestCase `xml:"testcase"`
+	}
+
+	junitTestCase struct {
+		Name      string       `xml:"name,attr"`
+		ClassName string       `xml:"classname,attr"`
+		Time      string       `xml:"time,attr"`
+		Failure   *junitResult `xml:"failure,omitempty"`
+		Skipped   *junitResult `xml:"skipped,omitempty"`
+		SystemOut string       `xml:"system-out,omitempty"`
+	}
+
+	junitResult struct {
+		Type    string `xml:"type,attr"`
+		Message string `xml:"message,attr"`
+	}
+)
+
+func junitTime(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
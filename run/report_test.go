@@ -0,0 +1,103 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/madlambda/spells/assert"
+	"github.com/terramate-io/terramate/run"
+)
+
+func TestReportJSON(t *testing.T) {
+	t.Parallel()
+
+	report := testReport()
+
+	var buf bytes.Buffer
+	assert.NoError(t, report.WriteJSON(&buf))
+
+	var got run.Report
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	if diff := cmp.Diff(*report, got); diff != "" {
+		t.Fatalf("unexpected report: %s", diff)
+	}
+}
+
+func TestReportJUnit(t *testing.T) {
+	t.Parallel()
+
+	report := testReport()
+
+	var buf bytes.Buffer
+	assert.NoError(t, report.WriteJUnit(&buf))
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="terramate run" tests="3" failures="1" skipped="1" time="10.000">
+  <testsuite name="terramate run" tests="3" failures="1" skipped="1" time="10.000" timestamp="2024-01-02T10:00:00Z">
+    <testcase name="/s1" classname="terramate run" time="2.500">
+      <system-out>terraform apply</system-out>
+    </testcase>
+    <testcase name="/s2" classname="terramate run" time="1.000">
+      <failure type="failed" message="failed: exit code 1"></failure>
+      <system-out>terraform apply</system-out>
+    </testcase>
+    <testcase name="/s3" classname="terramate run" time="0.000">
+      <skipped type="canceled" message="canceled: a previous stack failed"></skipped>
+      <system-out>terraform apply</system-out>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Fatalf("unexpected JUnit report: %s", diff)
+	}
+}
+
+func testReport() *run.Report {
+	start := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	okCode, failedCode := 0, 1
+
+	s1 := run.StackReport{
+		Path:     "/s1",
+		ID:       "s1-id",
+		Cmds:     [][]string{{"terraform", "apply"}},
+		Status:   run.StackOK,
+		ExitCode: &okCode,
+		Order:    1,
+	}
+	s1.SetTimes(start, start.Add(2500*time.Millisecond))
+
+	s2 := run.StackReport{
+		Path:     "/s2",
+		Cmds:     [][]string{{"terraform", "apply"}},
+		Status:   run.StackFailed,
+		Reason:   "exit code 1",
+		ExitCode: &failedCode,
+		Order:    2,
+		After:    []string{"/s1"},
+	}
+	s2.SetTimes(start.Add(3*time.Second), start.Add(4*time.Second))
+
+	s3 := run.StackReport{
+		Path:   "/s3",
+		Cmds:   [][]string{{"terraform", "apply"}},
+		Status: run.StackCanceled,
+		Reason: "a previous stack failed",
+		Order:  3,
+		After:  []string{"/s2"},
+	}
+
+	report := &run.Report{
+		Kind:      run.JournalKindRun,
+		StartedAt: start,
+		Stacks:    []run.StackReport{s1, s2, s3},
+	}
+	report.Finish(start.Add(10 * time.Second))
+	return report
+}
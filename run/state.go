@@ -0,0 +1,60 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package run
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/terramate-io/terramate/errors"
+)
+
+// StateDirName is the name of the directory, relative to the project root,
+// where Terramate keeps local state about previous runs.
+const StateDirName = ".terramate-cache"
+
+// ErrState indicates a failure reading or writing the local run state.
+const ErrState errors.Kind = "accessing local run state"
+
+// StateDir returns the absolute path of the local state directory for the
+// project at rootdir, creating it if needed.
+// The directory ignores itself from git, so the files created inside it never
+// show up as untracked files.
+func StateDir(rootdir string) (string, error) {
+	dir := filepath.Join(rootdir, StateDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", errors.E(ErrState, err)
+	}
+	gitignore := filepath.Join(dir, ".gitignore")
+	if _, err := os.Stat(gitignore); err == nil {
+		return dir, nil
+	}
+	if err := os.WriteFile(gitignore, []byte("*\n"), 0644); err != nil {
+		return "", errors.E(ErrState, err)
+	}
+	return dir, nil
+}
+
+// writeStateFile atomically replaces the file name inside the state directory
+// with the given data.
+func writeStateFile(rootdir, name string, data []byte) error {
+	dir, err := StateDir(rootdir)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, name+".*")
+	if err != nil {
+		return errors.E(ErrState, err)
+	}
+	_, err = tmp.Write(data)
+	err = errors.L(err, tmp.Close()).AsError()
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(dir, name))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return errors.E(ErrState, err, "writing %s", name)
+	}
+	return nil
+}
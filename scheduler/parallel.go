@@ -4,6 +4,7 @@
 package scheduler
 
 import (
+	"sort"
 	"sync"
 	"sync/atomic"
 
@@ -12,6 +13,10 @@ import (
 )
 
 // Parallel is a parallel scheduler implementing the scheduler.S interface.
+//
+// Each node has a priority, which is the total weight of the longest path
+// from the node until the end of the DAG. Ready nodes are started in priority
+// order, so the nodes on the critical path go first.
 type Parallel[V any] struct {
 	wg *sync.WaitGroup
 	d  *dag.DAG[V]
@@ -56,18 +61,71 @@ func NewParallel[V any](d *dag.DAG[V], reverse bool) *Parallel[V] {
 		}
 	}
 
+	s.SetWeights(nil)
 	return s
 }
 
+// SetWeights sets the function giving the expected cost of running each node,
+// usually its expected duration, and recomputes the node priorities.
+// If weight is nil, all nodes have the same weight, so the critical path is
+// the longest chain of nodes.
+func (s *Parallel[V]) SetWeights(weight func(id dag.ID) float64) {
+	for _, st := range s.state {
+		st.visited = false
+	}
+
+	var visit func(st *parallelNodeState)
+	visit = func(st *parallelNodeState) {
+		if st.visited {
+			return
+		}
+		st.visited = true
+
+		var longest float64
+		for _, succ := range st.successors {
+			visit(succ)
+			if succ.priority > longest {
+				longest = succ.priority
+			}
+		}
+		st.priority = 1
+		if weight != nil {
+			st.priority = weight(st.id)
+		}
+		st.priority += longest
+	}
+	for _, st := range s.state {
+		visit(st)
+	}
+
+	for _, st := range s.state {
+		sortByPriority(st.successors)
+	}
+}
+
+// Priority returns the priority of the node with the given ID. Nodes with
+// higher priority are on longer paths and should be run first.
+func (s *Parallel[V]) Priority(id dag.ID) float64 {
+	if st, ok := s.state[id]; ok {
+		return st.priority
+	}
+	return 0
+}
+
 // Run executes the given function on each node of the DAG.
 // Nodes are run in parallel, but no node is visted until all its precessors are done.
 func (s *Parallel[V]) Run(f Func[V]) error {
+	var roots []*parallelNodeState
 	for _, st := range s.state {
 		// Start at root nodes (nodes without any predecessors).
 		if st.nRequiredPredecessors == 0 {
-			s.visitNode(st, f)
+			roots = append(roots, st)
 		}
 	}
+	sortByPriority(roots)
+	for _, st := range roots {
+		s.visitNode(st, f)
+	}
 
 	s.wg.Wait()
 	return s.errs.AsError()
@@ -78,6 +136,20 @@ type parallelNodeState struct {
 	successors            []*parallelNodeState
 	nReadyPredecessors    atomic.Int64
 	nRequiredPredecessors int64
+
+	priority float64
+	visited  bool
+}
+
+// sortByPriority sorts the nodes by descending priority. Nodes with the same
+// priority are sorted by ID, so the order is stable.
+func sortByPriority(nodes []*parallelNodeState) {
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].priority != nodes[j].priority {
+			return nodes[i].priority > nodes[j].priority
+		}
+		return nodes[i].id < nodes[j].id
+	})
 }
 
 func (s *Parallel[V]) visitNode(st *parallelNodeState, f Func[V]) {
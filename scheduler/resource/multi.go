@@ -0,0 +1,32 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package resource
+
+import "context"
+
+// Multi is a resource composed of other resources. They are acquired in order
+// and released in reverse order, so callers acquiring the same resources in
+// the same order never deadlock.
+type Multi []R
+
+// Acquire acquires all the resources in order. If any of them fails, the
+// already acquired ones are released.
+func (m Multi) Acquire(ctx context.Context) bool {
+	for i, r := range m {
+		if !r.Acquire(ctx) {
+			for j := i - 1; j >= 0; j-- {
+				m[j].Release()
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// Release releases all the resources in reverse order.
+func (m Multi) Release() {
+	for i := len(m) - 1; i >= 0; i-- {
+		m[i].Release()
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package resource
+
+import (
+	"context"
+	"sync"
+)
+
+// Prioritized is a bounded resource that, when exhausted, is handed to the
+// waiting caller with the highest priority first. Callers with the same
+// priority get it in the order they asked for it.
+type Prioritized struct {
+	mu      sync.Mutex
+	free    int
+	seq     uint64
+	waiters []*prioritizedWaiter
+}
+
+type prioritizedWaiter struct {
+	priority float64
+	seq      uint64
+	ready    chan struct{}
+}
+
+// NewPrioritized creates a new prioritized resource that can be acquired n
+// times concurrently.
+func NewPrioritized(n int) *Prioritized {
+	return &Prioritized{free: n}
+}
+
+// Acquire acquires the resource with the given priority. If the resource is
+// already acquired n times, wait until it's released and no caller with a
+// higher priority is waiting.
+func (r *Prioritized) Acquire(ctx context.Context, priority float64) bool {
+	r.mu.Lock()
+	if r.free > 0 && len(r.waiters) == 0 {
+		r.free--
+		r.mu.Unlock()
+		return true
+	}
+	w := &prioritizedWaiter{
+		priority: priority,
+		seq:      r.seq,
+		ready:    make(chan struct{}),
+	}
+	r.seq++
+	r.waiters = append(r.waiters, w)
+	r.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return true
+	case <-ctx.Done():
+	}
+
+	r.mu.Lock()
+	select {
+	case <-w.ready:
+		// The resource was handed to us while the context was canceled.
+		r.mu.Unlock()
+		r.Release()
+		return false
+	default:
+	}
+	for i, other := range r.waiters {
+		if other == w {
+			r.waiters = append(r.waiters[:i], r.waiters[i+1:]...)
+			break
+		}
+	}
+	r.mu.Unlock()
+	return false
+}
+
+// Release a previously acquired resource.
+func (r *Prioritized) Release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.waiters) == 0 {
+		r.free++
+		return
+	}
+	next := 0
+	for i, w := range r.waiters {
+		best := r.waiters[next]
+		if w.priority > best.priority || (w.priority == best.priority && w.seq < best.seq) {
+			next = i
+		}
+	}
+	w := r.waiters[next]
+	r.waiters = append(r.waiters[:next], r.waiters[next+1:]...)
+	close(w.ready)
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package resource
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/madlambda/spells/assert"
+)
+
+func TestPrioritizedOrder(t *testing.T) {
+	t.Parallel()
+
+	r := NewPrioritized(1)
+	ctx := context.Background()
+	assert.IsTrue(t, r.Acquire(ctx, 0))
+
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		got []float64
+	)
+	for i, priority := range []float64{1, 3, 2, 3} {
+		wg.Add(1)
+		go func(priority float64) {
+			defer wg.Done()
+			assert.IsTrue(t, r.Acquire(ctx, priority))
+			mu.Lock()
+			got = append(got, priority)
+			mu.Unlock()
+			r.Release()
+		}(priority)
+		waitForWaiters(t, r, i+1)
+	}
+
+	r.Release()
+	wg.Wait()
+	assert.EqualInts(t, 4, len(got))
+	for i, want := range []float64{3, 3, 2, 1} {
+		assert.IsTrue(t, got[i] == want, "got %v", got)
+	}
+}
+
+func TestPrioritizedCanceled(t *testing.T) {
+	t.Parallel()
+
+	r := NewPrioritized(1)
+	assert.IsTrue(t, r.Acquire(context.Background(), 0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.IsTrue(t, !r.Acquire(ctx, 1))
+
+	r.Release()
+	assert.IsTrue(t, r.Acquire(context.Background(), 0))
+}
+
+func waitForWaiters(t *testing.T, r *Prioritized, n int) {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		r.mu.Lock()
+		waiting := len(r.waiters)
+		r.mu.Unlock()
+		if waiting == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d waiters", n)
+}
@@ -46,6 +46,68 @@ func TestSimpleParallel(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestParallelPriority(t *testing.T) {
+	t.Parallel()
+
+	type testcase struct {
+		name    string
+		weights map[dag.ID]float64
+		reverse bool
+		want    map[dag.ID]float64
+	}
+
+	for _, tc := range []testcase{
+		{
+			name: "longest chain",
+			want: map[dag.ID]float64{
+				"a": 4, "a/1": 3, "a/2": 2, "a/3": 1,
+				"b": 2, "b/1": 1, "b/2": 1, "b/3": 1,
+				"c": 2, "z": 1,
+			},
+		},
+		{
+			name: "heaviest path",
+			weights: map[dag.ID]float64{
+				"c": 10,
+				"z": 5,
+			},
+			want: map[dag.ID]float64{
+				"a": 6, "a/1": 3, "a/2": 2, "a/3": 1,
+				"b": 6, "b/1": 1, "b/2": 1, "b/3": 1,
+				"c": 15, "z": 5,
+			},
+		},
+		{
+			name:    "reverse order",
+			reverse: true,
+			want: map[dag.ID]float64{
+				"a": 1, "a/1": 2, "a/2": 3, "a/3": 4,
+				"b": 1, "b/1": 2, "b/2": 2, "b/3": 2,
+				"c": 1, "z": 2,
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := scheduler.NewParallel(makeDAG(), tc.reverse)
+			if tc.weights != nil {
+				g.SetWeights(func(id dag.ID) float64 {
+					if w, ok := tc.weights[id]; ok {
+						return w
+					}
+					return 1
+				})
+			}
+			for id, want := range tc.want {
+				got := g.Priority(id)
+				assert.IsTrue(t, got == want, "node %s: want priority %v, got %v", id, want, got)
+			}
+		})
+	}
+}
+
 func makeDAG() *dag.DAG[string] {
 	d := dag.New[string]()
 
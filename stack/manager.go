@@ -506,6 +506,91 @@ func (m *Manager) AddWantedOf(scopeStacks config.List[*config.SortableStack]) (c
 	return selectedStacks, nil
 }
 
+// AddRelatedOf returns the given entries plus the stacks ordered after
+// (dependents) and/or before (dependencies) any of them, transitively, using
+// the same ordering graph as the execution of stacks. The reason of each added
+// entry tells which of the given stacks caused it to be added.
+func (m *Manager) AddRelatedOf(entries []Entry, dependents, dependencies bool) ([]Entry, error) {
+	if !dependents && !dependencies {
+		return entries, nil
+	}
+
+	allstacks, err := config.LoadAllStacks(m.root, m.root.Tree())
+	if err != nil {
+		return nil, errors.E(err, "loading all stacks")
+	}
+	d, reason, err := run.BuildDAGFromStacks(m.root, allstacks,
+		func(s *config.SortableStack) *config.Stack { return s.Stack })
+	if err != nil {
+		return nil, errors.E(err, "building order DAG: %s", reason)
+	}
+
+	dependentsOf := map[dag.ID][]dag.ID{}
+	for _, id := range d.IDs() {
+		for _, ancestor := range d.AncestorsOf(id) {
+			dependentsOf[ancestor] = append(dependentsOf[ancestor], id)
+		}
+	}
+
+	result := append([]Entry{}, entries...)
+	selected := map[dag.ID]bool{}
+	for _, e := range entries {
+		selected[dag.ID(e.Stack.Dir.String())] = true
+	}
+
+	// addRelated walks the graph from the given entries, adding the stacks
+	// found on the way. The chain of each visited stack is the path from the
+	// entry it was reached from.
+	addRelated := func(relation string, next func(id dag.ID) []dag.ID) {
+		type visit struct {
+			id    dag.ID
+			chain []string
+		}
+		var pending []visit
+		visited := map[dag.ID]bool{}
+		for _, e := range entries {
+			id := dag.ID(e.Stack.Dir.String())
+			visited[id] = true
+			pending = append(pending, visit{id: id, chain: []string{string(id)}})
+		}
+		for len(pending) > 0 {
+			v := pending[0]
+			pending = pending[1:]
+
+			related := append([]dag.ID{}, next(v.id)...)
+			sort.Slice(related, func(i, j int) bool { return related[i] < related[j] })
+			for _, id := range related {
+				if visited[id] {
+					continue
+				}
+				visited[id] = true
+				pending = append(pending, visit{id: id, chain: append(v.chain[:len(v.chain):len(v.chain)], string(id))})
+				if selected[id] {
+					continue
+				}
+				selected[id] = true
+
+				s, _ := d.Node(id)
+				reason := fmt.Sprintf("stack runs %s %s", relation, v.chain[0])
+				if len(v.chain) > 1 {
+					reason += " through " + strings.Join(v.chain[1:], " -> ")
+				}
+				result = append(result, Entry{Stack: s.Stack, Reason: reason})
+			}
+		}
+	}
+
+	if dependents {
+		addRelated("after", func(id dag.ID) []dag.ID { return dependentsOf[id] })
+	}
+	if dependencies {
+		addRelated("before", d.AncestorsOf)
+	}
+
+	sort.Sort(EntrySlice(result))
+	return result, nil
+}
+
 func (m *Manager) filesApply(dir project.Path, apply func(fname string) error) (err error) {
 	var files []string
 
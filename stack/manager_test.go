@@ -15,6 +15,7 @@ import (
 	"github.com/terramate-io/terramate/stack"
 	"github.com/terramate-io/terramate/test"
 	. "github.com/terramate-io/terramate/test/hclwrite/hclutils"
+	"github.com/terramate-io/terramate/test/sandbox"
 )
 
 type repository struct {
@@ -334,6 +335,78 @@ func TestListChangedStackReason(t *testing.T) {
 	}
 }
 
+func TestAddRelatedOf(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`s:a`,
+		`s:b:after=["/a"]`,
+		`s:c:after=["/b"]`,
+		`s:d`,
+		`s:e:before=["/a"]`,
+	})
+	m := stack.NewManager(s.Config())
+
+	selected := []stack.Entry{{Stack: s.LoadStack(project.NewPath("/a")), Reason: "changed"}}
+
+	type testcase struct {
+		name         string
+		dependents   bool
+		dependencies bool
+		want         []string
+	}
+
+	for _, tc := range []testcase{
+		{
+			name: "no expansion",
+			want: []string{"/a: changed"},
+		},
+		{
+			name:       "dependents",
+			dependents: true,
+			want: []string{
+				"/a: changed",
+				"/b: stack runs after /a",
+				"/c: stack runs after /a through /b",
+			},
+		},
+		{
+			name:         "dependencies",
+			dependencies: true,
+			want: []string{
+				"/a: changed",
+				"/e: stack runs before /a",
+			},
+		},
+		{
+			name:         "dependents and dependencies",
+			dependents:   true,
+			dependencies: true,
+			want: []string{
+				"/a: changed",
+				"/b: stack runs after /a",
+				"/c: stack runs after /a through /b",
+				"/e: stack runs before /a",
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := m.AddRelatedOf(selected, tc.dependents, tc.dependencies)
+			assert.NoError(t, err)
+
+			var gotStrs []string
+			for _, e := range got {
+				gotStrs = append(gotStrs, e.Stack.Dir.String()+": "+e.Reason)
+			}
+			assert.EqualStrings(t, strings.Join(tc.want, "\n"), strings.Join(gotStrs, "\n"))
+		})
+	}
+}
+
 func assertStacks(
 	t *testing.T, want []string, got []stack.Entry, wantReason bool,
 ) {
@@ -0,0 +1,166 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package stack
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/run"
+	"github.com/terramate-io/terramate/run/dag"
+)
+
+// ErrInvalidShard indicates that the shard specification is invalid.
+const ErrInvalidShard errors.Kind = "invalid shard"
+
+// Shard identifies one of the partitions of the selected stacks.
+type Shard struct {
+	// Index is the 1-based index of the shard.
+	Index int
+
+	// Total is the total number of shards.
+	Total int
+}
+
+// ParseShard parses a shard in the "i/n" format, where i is the 1-based index
+// of the shard and n the total number of shards.
+func ParseShard(spec string) (Shard, error) {
+	index, total, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Shard{}, errors.E(ErrInvalidShard, "%q must be in the i/n format", spec)
+	}
+	i, err1 := strconv.Atoi(strings.TrimSpace(index))
+	n, err2 := strconv.Atoi(strings.TrimSpace(total))
+	if err1 != nil || err2 != nil {
+		return Shard{}, errors.E(ErrInvalidShard, "%q must be in the i/n format", spec)
+	}
+	if n < 1 || i < 1 || i > n {
+		return Shard{}, errors.E(ErrInvalidShard,
+			"%q must have a number of shards greater than zero and an index between 1 and the number of shards", spec)
+	}
+	return Shard{Index: i, Total: n}, nil
+}
+
+// String returns the shard in the "i/n" format.
+func (s Shard) String() string {
+	return strconv.Itoa(s.Index) + "/" + strconv.Itoa(s.Total)
+}
+
+// SelectShard partitions the given stacks into shards and returns the items of
+// the given shard, in their original order.
+//
+// The partitioning is deterministic: the same stacks are always partitioned in
+// the same way. Stacks ordered before or after each other, directly or through
+// other given stacks, always belong to the same shard, then each shard can be
+// executed independently. Groups of related stacks are assigned to the least
+// loaded shard, largest groups first. A warning is logged when the groups don't
+// allow balancing the shards.
+//
+// It returns an error if the ordering of the stacks can't be satisfied, for
+// example if they have a cycle.
+func SelectShard[S ~[]E, E any](root *config.Root, items S, getStack func(E) *config.Stack, shard Shard) (S, error) {
+	if shard.Total <= 1 {
+		return items, nil
+	}
+
+	logger := log.With().
+		Str("action", "stack.SelectShard()").
+		Stringer("shard", shard).
+		Logger()
+
+	d, reason, err := run.BuildDAGFromStacks(root, items, getStack)
+	if err != nil {
+		return nil, errors.E(err, "sharding stacks: %s", reason)
+	}
+
+	groupOf := map[dag.ID]dag.ID{}
+	var find func(id dag.ID) dag.ID
+	find = func(id dag.ID) dag.ID {
+		parent, ok := groupOf[id]
+		if !ok || parent == id {
+			return id
+		}
+		group := find(parent)
+		groupOf[id] = group
+		return group
+	}
+	union := func(a, b dag.ID) {
+		ra, rb := find(a), find(b)
+		// The smallest ID represents the group, then groups are built the
+		// same way regardless of the order of the edges.
+		if rb < ra {
+			ra, rb = rb, ra
+		}
+		groupOf[rb] = ra
+	}
+
+	ids := d.IDs()
+	for _, id := range ids {
+		for _, ancestor := range d.AncestorsOf(id) {
+			union(id, ancestor)
+		}
+	}
+
+	members := map[dag.ID][]dag.ID{}
+	for _, id := range ids {
+		group := find(id)
+		members[group] = append(members[group], id)
+	}
+
+	groups := make([]dag.ID, 0, len(members))
+	for group := range members {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if len(members[a]) != len(members[b]) {
+			return len(members[a]) > len(members[b])
+		}
+		return a < b
+	})
+
+	loads := make([]int, shard.Total)
+	selected := map[string]bool{}
+	for _, group := range groups {
+		target := 0
+		for i, load := range loads {
+			if load < loads[target] {
+				target = i
+			}
+		}
+		loads[target] += len(members[group])
+		if target != shard.Index-1 {
+			continue
+		}
+		for _, id := range members[group] {
+			selected[string(id)] = true
+		}
+	}
+
+	// A balanced shard has at most this number of stacks.
+	balanced := (len(ids) + shard.Total - 1) / shard.Total
+	if len(groups) > 0 && len(members[groups[0]]) > balanced {
+		logger.Warn().Msgf(
+			"the shards are unbalanced: %d stacks ordered before or after %s must be in the same shard, "+
+				"while a balanced shard has at most %d stacks",
+			len(members[groups[0]]), groups[0], balanced)
+	}
+	if loads[shard.Index-1] == 0 && len(ids) >= shard.Total {
+		logger.Warn().Msgf(
+			"shard %s is empty because stacks ordered before or after each other must be in the same shard",
+			shard)
+	}
+
+	var result S
+	for _, item := range items {
+		if selected[getStack(item).Dir.String()] {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
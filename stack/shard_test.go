@@ -0,0 +1,121 @@
+// Copyright 2024 Terramate GmbH
+// SPDX-License-Identifier: MPL-2.0
+
+package stack_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/madlambda/spells/assert"
+	"github.com/terramate-io/terramate/config"
+	"github.com/terramate-io/terramate/errors"
+	"github.com/terramate-io/terramate/stack"
+	errtest "github.com/terramate-io/terramate/test/errors"
+	"github.com/terramate-io/terramate/test/sandbox"
+)
+
+func TestParseShard(t *testing.T) {
+	t.Parallel()
+
+	shard, err := stack.ParseShard("2/3")
+	assert.NoError(t, err)
+	assert.EqualInts(t, 2, shard.Index)
+	assert.EqualInts(t, 3, shard.Total)
+	assert.EqualStrings(t, "2/3", shard.String())
+
+	for _, spec := range []string{"", "1", "a/2", "1/b", "0/2", "3/2", "1/0", "-1/2"} {
+		_, err := stack.ParseShard(spec)
+		errtest.Assert(t, err, errors.E(stack.ErrInvalidShard), "spec %q", spec)
+	}
+}
+
+func TestSelectShard(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`s:a`,
+		`s:b:after=["/a"]`,
+		`s:c`,
+		`s:d`,
+		`s:e`,
+		`s:e/nested`,
+	})
+	root := s.Config()
+
+	stacks, err := config.LoadAllStacks(root, root.Tree())
+	assert.NoError(t, err)
+
+	getStack := func(s *config.SortableStack) *config.Stack { return s.Stack }
+	dirs := func(stacks config.List[*config.SortableStack]) string {
+		var dirs []string
+		for _, st := range stacks {
+			dirs = append(dirs, st.Dir().String())
+		}
+		return strings.Join(dirs, " ")
+	}
+
+	type testcase struct {
+		total int
+		want  []string
+	}
+
+	for _, tc := range []testcase{
+		{
+			total: 1,
+			want:  []string{"/a /b /c /d /e /e/nested"},
+		},
+		{
+			total: 2,
+			want: []string{
+				"/a /b /c",
+				"/d /e /e/nested",
+			},
+		},
+		{
+			total: 3,
+			want: []string{
+				"/a /b",
+				"/e /e/nested",
+				"/c /d",
+			},
+		},
+		{
+			total: 5,
+			want: []string{
+				"/a /b",
+				"/e /e/nested",
+				"/c",
+				"/d",
+				"",
+			},
+		},
+	} {
+		for i, want := range tc.want {
+			shard := stack.Shard{Index: i + 1, Total: tc.total}
+			got, err := stack.SelectShard(root, stacks, getStack, shard)
+			assert.NoError(t, err)
+			assert.EqualStrings(t, want, dirs(got), "shard %s", shard)
+		}
+	}
+}
+
+func TestSelectShardFailsOnCycle(t *testing.T) {
+	t.Parallel()
+
+	s := sandbox.NoGit(t, true)
+	s.BuildTree([]string{
+		`s:a:after=["/b"]`,
+		`s:b:after=["/a"]`,
+		`s:c`,
+	})
+	root := s.Config()
+
+	stacks, err := config.LoadAllStacks(root, root.Tree())
+	assert.NoError(t, err)
+
+	getStack := func(s *config.SortableStack) *config.Stack { return s.Stack }
+	_, err = stack.SelectShard(root, stacks, getStack, stack.Shard{Index: 1, Total: 2})
+	assert.Error(t, err)
+}
@@ -86,7 +86,8 @@ func AssertTerramateConfig(t *testing.T, got, want hcl.Config) {
 
 		// Globals/Asserts/Scripts are mostly Attribute and Expr, which cannot be easily compared with cmp.Diff.
 		cmpopts.IgnoreFields(hcl.Config{}, "Globals", "Asserts", "Scripts", "Inputs", "Outputs"),
-		cmpopts.IgnoreFields(hcl.RunEnv{}, "Attributes"), // because Expr and Range
+		cmpopts.IgnoreFields(hcl.RunEnv{}, "Attributes", "EnvFile", "EnvFiles"), // because Expr and Range
+		cmpopts.IgnoreFields(hcl.RunHook{}, "Command", "Commands"),              // because Expr and Range
 		cmpopts.IgnoreFields(hcl.Config{}, "Generate"),
 	); diff != "" {
 		t.Logf("want: %+v", want)
@@ -331,48 +332,161 @@ func assertScriptBlocks(t *testing.T, got, want []*hcl.Script) {
 
 		}
 
+		if w.Condition != nil {
+			assert.EqualStrings(t,
+				exprAsStr(t, w.Condition.Expr), exprAsStr(t, g.Condition.Expr),
+				"condition expr mismatch")
+		} else if g.Condition != nil {
+			t.Fatalf("got script.condition[%s] but expected nil", exprAsStr(t, g.Condition.Expr))
+		}
+
 		assert.IsTrue(t, slices.Equal(w.Labels, g.Labels),
 			fmt.Sprintf("script label value mismatch: want[%#v], got [%#v]", w.Labels, g.Labels))
 
-		assert.EqualInts(t, len(w.Jobs), len(g.Jobs), "script len(jobs) mismatch")
-		for k, gotJob := range g.Jobs {
-			wantJob := w.Jobs[k]
-
-			if wantJob.Name != nil {
-				assert.EqualStrings(t,
-					exprAsStr(t, wantJob.Name.Expr),
-					exprAsStr(t, gotJob.Name.Expr),
-				)
-			} else if gotJob.Name != nil {
-				t.Fatalf("got job.name[%s] but expected nil", exprAsStr(t, gotJob.Name.Expr))
+		assert.EqualInts(t, len(w.Matrix), len(g.Matrix), "script len(matrix) mismatch")
+		for name, wantVar := range w.Matrix {
+			gotVar, ok := g.Matrix[name]
+			if !ok {
+				t.Fatalf("script.matrix.%s not found", name)
 			}
+			assert.EqualStrings(t,
+				exprAsStr(t, wantVar.Expr),
+				exprAsStr(t, gotVar.Expr),
+				"matrix.%s mismatch", name)
+		}
 
-			if wantJob.Description != nil {
-				assert.EqualStrings(t,
-					exprAsStr(t, wantJob.Description.Expr),
-					exprAsStr(t, gotJob.Description.Expr),
-				)
-			} else if gotJob.Description != nil {
-				t.Fatalf("got job.description[%s] but expected nil", exprAsStr(t, gotJob.Description.Expr))
-			}
+		assertScriptEnv(t, w.Env, g.Env, "script")
 
-			if wantJob.Command != nil {
-				assert.EqualStrings(t,
-					exprAsStr(t, wantJob.Command.Expr),
-					exprAsStr(t, gotJob.Command.Expr),
-					"command mismatch")
-			}
+		if w.Context != "" {
+			assert.EqualStrings(t, w.Context, g.Context, "script context mismatch")
+		}
 
-			if wantJob.Commands != nil {
+		assert.EqualInts(t, len(w.Params), len(g.Params), "script len(params) mismatch")
+		for k, gotParam := range g.Params {
+			wantParam := w.Params[k]
+			assert.EqualStrings(t, wantParam.Name, gotParam.Name, "param name mismatch")
+			for _, attr := range []struct {
+				name      string
+				want, got *ast.Attribute
+			}{
+				{"type", wantParam.Type, gotParam.Type},
+				{"default", wantParam.Default, gotParam.Default},
+				{"description", wantParam.Description, gotParam.Description},
+			} {
+				if attr.want == nil {
+					if attr.got != nil {
+						t.Fatalf("got param.%s[%s] but expected nil", attr.name, exprAsStr(t, attr.got.Expr))
+					}
+					continue
+				}
+				if attr.got == nil {
+					t.Fatalf("param.%s not found", attr.name)
+				}
 				assert.EqualStrings(t,
-					exprAsStr(t, wantJob.Commands.Expr),
-					exprAsStr(t, gotJob.Commands.Expr),
-					"commands mismatch")
+					exprAsStr(t, attr.want.Expr),
+					exprAsStr(t, attr.got.Expr),
+					"param.%s mismatch", attr.name)
 			}
+		}
+
+		assertScriptJobs(t, w.Jobs, g.Jobs, "jobs")
+		assertScriptJobs(t, w.OnFailure, g.OnFailure, "on_failure")
+		assertScriptJobs(t, w.Finally, g.Finally, "finally")
+	}
+
+}
+
+func assertScriptJobs(t *testing.T, want, got []*hcl.ScriptJob, kind string) {
+	t.Helper()
 
+	assert.EqualInts(t, len(want), len(got), "script len(%s) mismatch", kind)
+	for k, gotJob := range got {
+		wantJob := want[k]
+
+		if wantJob.Name != nil {
+			assert.EqualStrings(t,
+				exprAsStr(t, wantJob.Name.Expr),
+				exprAsStr(t, gotJob.Name.Expr),
+			)
+		} else if gotJob.Name != nil {
+			t.Fatalf("got job.name[%s] but expected nil", exprAsStr(t, gotJob.Name.Expr))
+		}
+
+		if wantJob.Description != nil {
+			assert.EqualStrings(t,
+				exprAsStr(t, wantJob.Description.Expr),
+				exprAsStr(t, gotJob.Description.Expr),
+			)
+		} else if gotJob.Description != nil {
+			t.Fatalf("got job.description[%s] but expected nil", exprAsStr(t, gotJob.Description.Expr))
 		}
+
+		if wantJob.Command != nil {
+			assert.EqualStrings(t,
+				exprAsStr(t, wantJob.Command.Expr),
+				exprAsStr(t, gotJob.Command.Expr),
+				"command mismatch")
+		}
+
+		if wantJob.Commands != nil {
+			assert.EqualStrings(t,
+				exprAsStr(t, wantJob.Commands.Expr),
+				exprAsStr(t, gotJob.Commands.Expr),
+				"commands mismatch")
+		}
+
+		if wantJob.DependsOn != nil {
+			assert.EqualStrings(t,
+				exprAsStr(t, wantJob.DependsOn.Expr),
+				exprAsStr(t, gotJob.DependsOn.Expr),
+				"depends_on mismatch")
+		} else if gotJob.DependsOn != nil {
+			t.Fatalf("got job.depends_on[%s] but expected nil", exprAsStr(t, gotJob.DependsOn.Expr))
+		}
+
+		if wantJob.Parallel != nil {
+			assert.EqualStrings(t,
+				exprAsStr(t, wantJob.Parallel.Expr),
+				exprAsStr(t, gotJob.Parallel.Expr),
+				"parallel mismatch")
+		} else if gotJob.Parallel != nil {
+			t.Fatalf("got job.parallel[%s] but expected nil", exprAsStr(t, gotJob.Parallel.Expr))
+		}
+
+		if wantJob.Condition != nil {
+			assert.EqualStrings(t,
+				exprAsStr(t, wantJob.Condition.Expr),
+				exprAsStr(t, gotJob.Condition.Expr),
+				"condition mismatch")
+		} else if gotJob.Condition != nil {
+			t.Fatalf("got job.condition[%s] but expected nil", exprAsStr(t, gotJob.Condition.Expr))
+		}
+
+		if wantJob.Context != "" {
+			assert.EqualStrings(t, wantJob.Context, gotJob.Context, "job context mismatch")
+		}
+
+		assertScriptEnv(t, wantJob.Env, gotJob.Env, "job")
 	}
+}
 
+func assertScriptEnv(t *testing.T, want, got ast.Attributes, ctx string) {
+	t.Helper()
+
+	if (want == nil) != (got == nil) {
+		t.Fatalf("%s.env: want[%v] but got[%v]", ctx, want, got)
+	}
+	assert.EqualInts(t, len(want), len(got), "%s len(env) mismatch", ctx)
+	for name, wantVar := range want {
+		gotVar, ok := got[name]
+		if !ok {
+			t.Fatalf("%s.env.%s not found", ctx, name)
+		}
+		assert.EqualStrings(t,
+			exprAsStr(t, wantVar.Expr),
+			exprAsStr(t, gotVar.Expr),
+			"%s.env.%s mismatch", ctx, name)
+	}
 }
 
 func assertTerramateRunBlock(t *testing.T, got, want *hcl.RunConfig) {
@@ -390,6 +504,26 @@ func assertTerramateRunBlock(t *testing.T, got, want *hcl.RunConfig) {
 		"want.Run.CheckGenCode %v != got.Run.CheckGenCode %v",
 		want.CheckGenCode, got.CheckGenCode)
 
+	assert.IsTrue(t, want.Cache == got.Cache,
+		"want.Run.Cache %v != got.Run.Cache %v",
+		want.Cache, got.Cache)
+
+	assert.IsTrue(t, want.TrackDurations == got.TrackDurations,
+		"want.Run.TrackDurations %v != got.Run.TrackDurations %v",
+		want.TrackDurations, got.TrackDurations)
+
+	assert.IsTrue(t, want.StackTimeout == got.StackTimeout,
+		"want.Run.StackTimeout %v != got.Run.StackTimeout %v",
+		want.StackTimeout, got.StackTimeout)
+
+	assert.IsTrue(t, want.TimeoutGracePeriod == got.TimeoutGracePeriod,
+		"want.Run.TimeoutGracePeriod %v != got.Run.TimeoutGracePeriod %v",
+		want.TimeoutGracePeriod, got.TimeoutGracePeriod)
+
+	assertRunHook(t, "before_run", got.BeforeRun, want.BeforeRun)
+	assertRunHook(t, "after_run", got.AfterRun, want.AfterRun)
+	assertRunHook(t, "on_failure", got.OnFailure, want.OnFailure)
+
 	if (want.Env == nil) != (got.Env == nil) {
 		t.Fatalf(
 			"want.Run.Env[%+v] != got.Run.Env[%+v]",
@@ -407,12 +541,51 @@ func assertTerramateRunBlock(t *testing.T, got, want *hcl.RunConfig) {
 	// So we do this hack in an attempt of comparing the attributes
 	// original expressions (no eval involved).
 
-	gotHCL := hclFromAttributes(t, got.Env.Attributes)
-	wantHCL := hclFromAttributes(t, want.Env.Attributes)
+	runEnvAttributes := func(env *hcl.RunEnv) ast.Attributes {
+		attrs := ast.Attributes{}
+		for name, attr := range env.Attributes {
+			attrs[name] = attr
+		}
+		if env.EnvFile != nil {
+			attrs["env_file"] = *env.EnvFile
+		}
+		if env.EnvFiles != nil {
+			attrs["env_files"] = *env.EnvFiles
+		}
+		return attrs
+	}
+
+	gotHCL := hclFromAttributes(t, runEnvAttributes(got.Env))
+	wantHCL := hclFromAttributes(t, runEnvAttributes(want.Env))
 
 	AssertDiff(t, gotHCL, wantHCL)
 }
 
+func assertRunHook(t *testing.T, name string, got, want *hcl.RunHook) {
+	t.Helper()
+
+	if (want == nil) != (got == nil) {
+		t.Fatalf("want.Run.%s[%+v] != got.Run.%s[%+v]", name, want, name, got)
+	}
+
+	if want == nil {
+		return
+	}
+
+	hookAttributes := func(hook *hcl.RunHook) ast.Attributes {
+		attrs := ast.Attributes{}
+		if hook.Command != nil {
+			attrs["command"] = *hook.Command
+		}
+		if hook.Commands != nil {
+			attrs["commands"] = *hook.Commands
+		}
+		return attrs
+	}
+
+	AssertDiff(t, hclFromAttributes(t, hookAttributes(got)), hclFromAttributes(t, hookAttributes(want)))
+}
+
 func assertTerramateCloudBlock(t *testing.T, got, want *hcl.CloudConfig) {
 	t.Helper()
 
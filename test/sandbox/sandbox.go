@@ -695,6 +695,8 @@ func buildTree(t testing.TB, root *config.Root, environ []string, layout []strin
 				cfg.Stack.Description = value
 			case "tags":
 				cfg.Stack.Tags = parseListSpec(t, name, value)
+			case "concurrency_group":
+				cfg.Stack.ConcurrencyGroup = value
 			default:
 				t.Fatal("attribute " + parts[0] + " not supported.")
 			}